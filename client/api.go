@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// subscriptionBuffer is the number of notifications buffered per subscription.
+const subscriptionBuffer = 32
+
+type accountParams struct {
+	Account solana.PublicKey `json:"account"`
+}
+
+// GetProductList returns all products and their price accounts.
+func (c *Client) GetProductList(ctx context.Context) ([]ProductAccount, error) {
+	var products []ProductAccount
+	err := c.Call(ctx, "get_product_list", nil, &products)
+	return products, err
+}
+
+// GetAllProducts returns the full state of all products and prices.
+func (c *Client) GetAllProducts(ctx context.Context) ([]ProductAccountDetail, error) {
+	var products []ProductAccountDetail
+	err := c.Call(ctx, "get_all_products", nil, &products)
+	return products, err
+}
+
+// GetProduct returns the full state of a product and its prices.
+func (c *Client) GetProduct(ctx context.Context, account solana.PublicKey) (*ProductAccountDetail, error) {
+	product := new(ProductAccountDetail)
+	if err := c.Call(ctx, "get_product", accountParams{account}, product); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// UpdatePrice queues a price update for the given price account.
+func (c *Client) UpdatePrice(ctx context.Context, account solana.PublicKey, price int64, conf uint64, status string) error {
+	params := struct {
+		Account solana.PublicKey `json:"account"`
+		Price   int64            `json:"price"`
+		Conf    uint64           `json:"conf"`
+		Status  string           `json:"status"`
+	}{account, price, conf, status}
+	return c.Call(ctx, "update_price", params, nil)
+}
+
+// PriceSubscription delivers on-chain price changes of a price account.
+type PriceSubscription struct {
+	C <-chan PriceUpdate
+
+	client *Client
+	sub    *subscription
+}
+
+// SubscribePrice subscribes to on-chain changes of a price account.
+//
+// The subscription survives reconnects. Notifications get dropped
+// if the channel is not drained fast enough.
+func (c *Client) SubscribePrice(ctx context.Context, account solana.PublicKey) (*PriceSubscription, error) {
+	ch := make(chan PriceUpdate, subscriptionBuffer)
+	sub := &subscription{
+		method: "subscribe_price",
+		params: accountParams{account},
+		handle: func(result json.RawMessage) bool {
+			var update PriceUpdate
+			if err := json.Unmarshal(result, &update); err != nil {
+				return true
+			}
+			select {
+			case ch <- update:
+				return true
+			default:
+				return false
+			}
+		},
+		onClose: func() { close(ch) },
+	}
+	if err := c.subscribe(ctx, sub); err != nil {
+		return nil, err
+	}
+	return &PriceSubscription{C: ch, client: c, sub: sub}, nil
+}
+
+// Unsubscribe stops delivery and closes the channel.
+func (p *PriceSubscription) Unsubscribe() {
+	p.client.unsubscribe(p.sub)
+}
+
+// PriceSchedSubscription delivers price update schedule ticks.
+type PriceSchedSubscription struct {
+	C <-chan struct{}
+
+	client *Client
+	sub    *subscription
+}
+
+// SubscribePriceSched subscribes to the schedule at which updates
+// for the given price account should be submitted.
+//
+// The subscription survives reconnects. Ticks get dropped
+// if the channel is not drained fast enough.
+func (c *Client) SubscribePriceSched(ctx context.Context, account solana.PublicKey) (*PriceSchedSubscription, error) {
+	ch := make(chan struct{}, subscriptionBuffer)
+	sub := &subscription{
+		method: "subscribe_price_sched",
+		params: accountParams{account},
+		handle: func(json.RawMessage) bool {
+			select {
+			case ch <- struct{}{}:
+				return true
+			default:
+				return false
+			}
+		},
+		onClose: func() { close(ch) },
+	}
+	if err := c.subscribe(ctx, sub); err != nil {
+		return nil, err
+	}
+	return &PriceSchedSubscription{C: ch, client: c, sub: sub}, nil
+}
+
+// Unsubscribe stops delivery and closes the channel.
+func (p *PriceSchedSubscription) Unsubscribe() {
+	p.client.unsubscribe(p.sub)
+}
@@ -0,0 +1,421 @@
+// Package client implements a WebSocket client for the pythian JSON-RPC API.
+//
+// The client transparently reconnects when the connection drops
+// and re-establishes all active subscriptions afterwards.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/gorilla/websocket"
+	"go.blockdaemon.com/pythian/jsonrpc"
+	"go.uber.org/zap"
+)
+
+// ErrDisconnected is returned by calls interrupted by a connection loss.
+var ErrDisconnected = errors.New("disconnected from pythian")
+
+// ErrClosed is returned by calls on a closed client.
+var ErrClosed = errors.New("client closed")
+
+// Client is a pythian JSON-RPC client.
+type Client struct {
+	Log               *zap.Logger
+	Dialer            websocket.Dialer
+	Header            http.Header   // extra headers sent with the WebSocket handshake
+	ReconnectInterval time.Duration // time between reconnect attempts
+
+	url    string
+	ctx    context.Context // cancelled by Close
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	writeLock sync.Mutex // gorilla allows only one concurrent writer
+
+	lock      sync.Mutex
+	running   bool            // connection loop started
+	conn      *websocket.Conn // nil while disconnected
+	connected chan struct{}   // closed once conn is available
+	nextID    uint64
+	pending   map[uint64]*call
+	subs      map[*subscription]struct{}
+	subIDs    map[uint64]*subscription // by server subscription ID
+}
+
+// New creates a new unconnected client.
+func New(url string) *Client {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Client{
+		Log: zap.NewNop(),
+		Dialer: websocket.Dialer{
+			HandshakeTimeout: 5 * time.Second,
+		},
+		ReconnectInterval: 3 * time.Second,
+
+		url:       url,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		connected: make(chan struct{}),
+		pending:   make(map[uint64]*call),
+		subs:      make(map[*subscription]struct{}),
+		subIDs:    make(map[uint64]*subscription),
+	}
+}
+
+// Connect dials the server and starts the background connection loop.
+//
+// The given context only bounds the initial dial.
+// Calls made before Connect wait for the connection.
+// Use Close to shut down the client.
+func (c *Client) Connect(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	if c.ctx.Err() != nil || c.running {
+		c.lock.Unlock()
+		_ = conn.Close()
+		if c.running {
+			return errors.New("client already connected")
+		}
+		return ErrClosed
+	}
+	c.running = true
+	c.conn = conn
+	close(c.connected)
+	c.lock.Unlock()
+	go c.run(conn)
+	return nil
+}
+
+// Close shuts down the client and all of its subscriptions.
+func (c *Client) Close() {
+	c.cancel()
+	c.lock.Lock()
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+	running := c.running
+	c.lock.Unlock()
+	if running {
+		<-c.done
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for sub := range c.subs {
+		sub.close()
+	}
+	c.subs = make(map[*subscription]struct{})
+	c.subIDs = make(map[uint64]*subscription)
+}
+
+func (c *Client) dial(ctx context.Context) (*websocket.Conn, error) {
+	conn, _, err := c.Dialer.DialContext(ctx, c.url, c.Header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to pythian: %w", err)
+	}
+	return conn, nil
+}
+
+func (c *Client) run(conn *websocket.Conn) {
+	defer close(c.done)
+	for {
+		err := c.readLoop(conn)
+		c.dropConn(conn)
+		if c.ctx.Err() != nil {
+			return
+		}
+		c.Log.Warn("Connection lost, reconnecting", zap.Error(err))
+
+		err = backoff.Retry(func() error {
+			var err error
+			conn, err = c.dial(c.ctx)
+			if err != nil {
+				c.Log.Debug("Reconnect failed", zap.Error(err))
+			}
+			return err
+		}, backoff.WithContext(backoff.NewConstantBackOff(c.ReconnectInterval), c.ctx))
+		if err != nil {
+			return
+		}
+		c.Log.Info("Reconnected")
+		c.setConn(conn)
+		go c.resubscribe()
+	}
+}
+
+func (c *Client) setConn(conn *websocket.Conn) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.conn = conn
+	close(c.connected)
+}
+
+// dropConn discards the connection and fails all in-flight calls.
+func (c *Client) dropConn(conn *websocket.Conn) {
+	_ = conn.Close()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.conn = nil
+	c.connected = make(chan struct{})
+	for id, pending := range c.pending {
+		close(pending.resp)
+		delete(c.pending, id)
+	}
+	c.subIDs = make(map[uint64]*subscription)
+}
+
+// waitConn blocks until a connection is available.
+func (c *Client) waitConn(ctx context.Context) (*websocket.Conn, error) {
+	for {
+		c.lock.Lock()
+		conn, connected := c.conn, c.connected
+		c.lock.Unlock()
+		if conn != nil {
+			return conn, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-c.ctx.Done():
+			return nil, ErrClosed
+		case <-connected:
+		}
+	}
+}
+
+// message is either a response or a notification from the server.
+type message struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *jsonrpc.Error  `json:"error"`
+}
+
+// call is an in-flight request.
+type call struct {
+	resp chan *message
+	sub  *subscription // registered on success if not nil
+}
+
+func (c *Client) readLoop(conn *websocket.Conn) error {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		var msgs []message
+		if jsonrpc.IsBatch(data) {
+			err = json.Unmarshal(data, &msgs)
+		} else {
+			msgs = make([]message, 1)
+			err = json.Unmarshal(data, &msgs[0])
+		}
+		if err != nil {
+			c.Log.Warn("Received invalid message", zap.Error(err))
+			continue
+		}
+		for i := range msgs {
+			c.handleMessage(&msgs[i])
+		}
+	}
+}
+
+func (c *Client) handleMessage(msg *message) {
+	if msg.Method != "" {
+		c.handleNotification(msg)
+		return
+	}
+	var id uint64
+	if err := json.Unmarshal(msg.ID, &id); err != nil {
+		c.Log.Warn("Received response with unknown ID", zap.ByteString("id", msg.ID))
+		return
+	}
+
+	c.lock.Lock()
+	pending := c.pending[id]
+	delete(c.pending, id)
+	if pending != nil && pending.sub != nil && msg.Error == nil {
+		// Register subscription before any of its notifications get read.
+		var result subscriptionResult
+		if err := json.Unmarshal(msg.Result, &result); err == nil {
+			pending.sub.serverID = result.Subscription
+			c.subIDs[result.Subscription] = pending.sub
+		}
+	}
+	c.lock.Unlock()
+
+	if pending != nil {
+		pending.resp <- msg
+	}
+}
+
+func (c *Client) handleNotification(msg *message) {
+	var params struct {
+		Result       json.RawMessage `json:"result"`
+		Subscription uint64          `json:"subscription"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.Log.Warn("Received invalid notification", zap.String("method", msg.Method), zap.Error(err))
+		return
+	}
+	c.lock.Lock()
+	sub := c.subIDs[params.Subscription]
+	c.lock.Unlock()
+	if sub == nil {
+		return
+	}
+	if !sub.deliver(params.Result) {
+		c.Log.Warn("Subscriber too slow, dropping notification", zap.String("method", msg.Method))
+	}
+}
+
+// Call invokes a JSON-RPC method and decodes the result into the value pointed to by result.
+//
+// Returns a *jsonrpc.Error if the server responded with an error.
+func (c *Client) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	return c.call(ctx, method, params, result, nil)
+}
+
+func (c *Client) call(ctx context.Context, method string, params interface{}, result interface{}, sub *subscription) error {
+	conn, err := c.waitConn(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Register call.
+	pending := &call{resp: make(chan *message, 1), sub: sub}
+	c.lock.Lock()
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = pending
+	c.lock.Unlock()
+	defer func() {
+		c.lock.Lock()
+		delete(c.pending, id)
+		c.lock.Unlock()
+	}()
+
+	// Send request.
+	req := jsonrpc.Request{
+		Version: jsonrpc.Version,
+		ID:      id,
+		Method:  method,
+		Params:  params,
+	}
+	c.writeLock.Lock()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetWriteDeadline(deadline)
+	} else {
+		_ = conn.SetWriteDeadline(time.Time{})
+	}
+	err = conn.WriteJSON(&req)
+	c.writeLock.Unlock()
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrDisconnected, err)
+	}
+
+	// Wait for response.
+	var msg *message
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case msg = <-pending.resp:
+	}
+	if msg == nil {
+		return ErrDisconnected
+	}
+	if msg.Error != nil {
+		return msg.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(msg.Result, result)
+}
+
+type subscriptionResult struct {
+	Subscription uint64 `json:"subscription"`
+}
+
+// subscription is a server-side subscription that survives reconnects.
+type subscription struct {
+	method   string
+	params   interface{}
+	serverID uint64
+
+	lock    sync.Mutex
+	closed  bool
+	handle  func(json.RawMessage) bool // returns false if the notification was dropped
+	onClose func()
+}
+
+func (s *subscription) deliver(result json.RawMessage) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return true
+	}
+	return s.handle(result)
+}
+
+func (s *subscription) close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.onClose()
+}
+
+func (c *Client) subscribe(ctx context.Context, sub *subscription) error {
+	c.lock.Lock()
+	c.subs[sub] = struct{}{}
+	c.lock.Unlock()
+	if err := c.call(ctx, sub.method, sub.params, nil, sub); err != nil {
+		c.unsubscribe(sub)
+		return err
+	}
+	return nil
+}
+
+func (c *Client) unsubscribe(sub *subscription) {
+	c.lock.Lock()
+	delete(c.subs, sub)
+	if c.subIDs[sub.serverID] == sub {
+		delete(c.subIDs, sub.serverID)
+	}
+	c.lock.Unlock()
+	sub.close()
+}
+
+// resubscribe re-establishes all subscriptions after a reconnect.
+func (c *Client) resubscribe() {
+	c.lock.Lock()
+	subs := make([]*subscription, 0, len(c.subs))
+	for sub := range c.subs {
+		subs = append(subs, sub)
+	}
+	c.lock.Unlock()
+
+	for _, sub := range subs {
+		ctx, cancel := context.WithTimeout(c.ctx, 10*time.Second)
+		err := c.call(ctx, sub.method, sub.params, nil, sub)
+		cancel()
+		if err != nil {
+			c.Log.Warn("Failed to resubscribe", zap.String("method", sub.method), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pythian/jsonrpc"
+)
+
+var testAccount = solana.MustPublicKeyFromBase58("E36MyBbavhYKHVLWR79GiReNNnBDiHj6nWA7htbkNZbh")
+
+// newTestServer runs an in-process JSON-RPC server with fake pythian methods.
+func newTestServer(t *testing.T) *httptest.Server {
+	var subNonce uint64
+	mux := jsonrpc.NewMux()
+	mux.HandleFunc("get_product_list", func(_ context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+		return jsonrpc.NewResultResponse(req.ID, []map[string]interface{}{
+			{
+				"account":   testAccount.String(),
+				"attr_dict": map[string]string{"symbol": "Crypto.BTC/USD"},
+				"price": []map[string]interface{}{
+					{"account": testAccount.String(), "price_exponent": -8, "price_type": "price"},
+				},
+			},
+		})
+	})
+	mux.HandleFunc("update_price", func(_ context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+		// Echo price back as result to check ID correlation.
+		params := req.Params.(map[string]interface{})
+		return jsonrpc.NewResultResponse(req.ID, params["price"])
+	})
+	mux.HandleFunc("subscribe_price_sched", func(_ context.Context, req jsonrpc.Request, callback jsonrpc.Requester) *jsonrpc.Response {
+		subID := atomic.AddUint64(&subNonce, 1)
+		go func() {
+			ticker := time.NewTicker(10 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-callback.Done():
+					return
+				case <-ticker.C:
+					_ = callback.AsyncRequestJSONRPC(context.Background(), "notify_price_sched", map[string]interface{}{
+						"subscription": subID,
+					})
+				}
+			}
+		}()
+		return jsonrpc.NewResultResponse(req.ID, map[string]interface{}{"subscription": subID})
+	})
+	server := httptest.NewServer(jsonrpc.NewServer(mux))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestClient(t *testing.T, server *httptest.Server) *Client {
+	c := New("ws" + strings.TrimPrefix(server.URL, "http"))
+	c.ReconnectInterval = 10 * time.Millisecond
+	require.NoError(t, c.Connect(context.Background()))
+	t.Cleanup(c.Close)
+	return c
+}
+
+func TestClient_GetProductList(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	products, err := c.GetProductList(ctx)
+	require.NoError(t, err)
+	require.Len(t, products, 1)
+	assert.Equal(t, testAccount, products[0].Account)
+	assert.Equal(t, "Crypto.BTC/USD", products[0].AttrDict["symbol"])
+	require.Len(t, products[0].Prices, 1)
+	assert.Equal(t, -8, products[0].Prices[0].PriceExponent)
+}
+
+func TestClient_CallBeforeConnect(t *testing.T) {
+	server := newTestServer(t)
+	c := New("ws" + strings.TrimPrefix(server.URL, "http"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := c.GetProductList(ctx)
+		errs <- err
+	}()
+	require.NoError(t, c.Connect(ctx))
+	t.Cleanup(c.Close)
+	assert.NoError(t, <-errs)
+}
+
+func TestClient_CloseBeforeConnect(t *testing.T) {
+	server := newTestServer(t)
+	c := New("ws" + strings.TrimPrefix(server.URL, "http"))
+	c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := c.GetProductList(ctx)
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.ErrorIs(t, c.Connect(ctx), ErrClosed)
+}
+
+func TestClient_MethodNotFound(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := c.GetProduct(ctx, testAccount)
+	var rpcErr *jsonrpc.Error
+	require.True(t, errors.As(err, &rpcErr))
+	assert.Equal(t, jsonrpc.ErrCodeMethodNotFound, rpcErr.Code)
+}
+
+func TestClient_Correlation(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := int64(1); i <= 64; i++ {
+		wg.Add(1)
+		go func(price int64) {
+			defer wg.Done()
+			var result int64
+			err := c.Call(ctx, "update_price", map[string]interface{}{"price": price}, &result)
+			assert.NoError(t, err)
+			assert.Equal(t, price, result)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestClient_Resubscribe(t *testing.T) {
+	server := newTestServer(t)
+	c := newTestClient(t, server)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub, err := c.SubscribePriceSched(ctx, testAccount)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+	waitTick(t, sub.C)
+
+	// Kill connection and expect ticks to resume.
+	server.CloseClientConnections()
+	time.Sleep(50 * time.Millisecond)
+	drain(sub.C)
+	waitTick(t, sub.C)
+
+	// Calls work again after reconnect.
+	require.NoError(t, c.UpdatePrice(ctx, testAccount, 1, 1, "trading"))
+}
+
+func waitTick(t *testing.T, ch <-chan struct{}) {
+	select {
+	case _, ok := <-ch:
+		require.True(t, ok, "subscription closed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for notification")
+	}
+}
+
+func drain(ch <-chan struct{}) {
+	for {
+		select {
+		case <-ch:
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package client
+
+import "github.com/gagliardetto/solana-go"
+
+// ProductAccount is a product as returned by get_product_list.
+type ProductAccount struct {
+	Account  solana.PublicKey  `json:"account"`
+	AttrDict map[string]string `json:"attr_dict"`
+	Prices   []PriceAccount    `json:"price"`
+}
+
+// PriceAccount is a price account summary as returned by get_product_list.
+type PriceAccount struct {
+	Account       solana.PublicKey `json:"account"`
+	PriceExponent int              `json:"price_exponent"`
+	PriceType     string           `json:"price_type"`
+}
+
+// ProductAccountDetail is a product as returned by get_product and get_all_products.
+type ProductAccountDetail struct {
+	Account       solana.PublicKey     `json:"account"`
+	AttrDict      map[string]string    `json:"attr_dict"`
+	PriceAccounts []PriceAccountDetail `json:"price_accounts"`
+}
+
+// PriceAccountDetail is the full state of a price account.
+type PriceAccountDetail struct {
+	Account           solana.PublicKey   `json:"account"`
+	PriceType         string             `json:"price_type"`
+	PriceExponent     int                `json:"price_exponent"`
+	Status            string             `json:"status"`
+	Price             int64              `json:"price"`
+	Conf              int64              `json:"conf"`
+	EmaPrice          int64              `json:"ema_price"`
+	EmaConfidence     int64              `json:"ema_confidence"`
+	ValidSlot         uint64             `json:"valid_slot"`
+	PubSlot           uint64             `json:"pub_slot"`
+	PrevSlot          uint64             `json:"prev_slot"`
+	PrevPrice         int64              `json:"prev_price"`
+	PrevConf          int64              `json:"prev_conf"`
+	PublisherAccounts []PublisherAccount `json:"publisher_accounts"`
+}
+
+// PublisherAccount is a publisher's component of a price account.
+type PublisherAccount struct {
+	Account solana.PublicKey `json:"account"`
+	Status  string           `json:"status"`
+	Price   int64            `json:"price"`
+	Conf    int64            `json:"conf"`
+	Slot    uint64           `json:"slot"`
+}
+
+// PriceUpdate is a price change notification from subscribe_price.
+type PriceUpdate struct {
+	Price     int64  `json:"price"`
+	Conf      uint64 `json:"conf"`
+	Status    string `json:"status"`
+	ValidSlot uint64 `json:"valid_slot"`
+	PubSlot   uint64 `json:"pub_slot"`
+}
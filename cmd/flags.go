@@ -2,11 +2,15 @@ package cmd
 
 import (
 	"fmt"
+	"net/http"
 	"net/url"
+	"time"
 
-	"github.com/spf13/cobra"
+	"github.com/gagliardetto/solana-go"
 	"github.com/spf13/pflag"
 	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/rpcauth"
+	"go.blockdaemon.com/pythian/signer"
 )
 
 var (
@@ -17,8 +21,14 @@ var (
 	flagRPC    = pflag.String("rpc", "https://api.mainnet-beta.solana.com", "RPC URL")
 	flagWS     = pflag.String("ws", "", "WebSocket RPC URL")
 
+	flagRPCHeaders     = pflag.StringArray("rpc-header", nil, "Header sent to the RPC and WebSocket RPC, as 'Key: Value' (repeatable, value may be env:NAME or file:PATH)")
+	flagRPCToken       = pflag.String("rpc-token", "", "Bearer token sent to the RPC and WebSocket RPC, as env:NAME or file:PATH")
+	flagWSHeaders      = pflag.StringArray("ws-header", nil, "Header sent only to the WebSocket RPC, as 'Key: Value' (repeatable, value may be env:NAME or file:PATH)")
+	flagSendRPC        = pflag.String("send-rpc", "", "Separate RPC URL for submitting transactions (default --rpc)")
+	flagSendRPCHeaders = pflag.StringArray("send-rpc-header", nil, "Header sent to the send RPC, as 'Key: Value' (repeatable, value may be env:NAME or file:PATH)")
+
 	FlagSetSigner  = pflag.NewFlagSet("signer", pflag.ExitOnError)
-	flagPrivateKey = pflag.String("private-key-file", "", "Path to private key file")
+	flagPrivateKey = pflag.String("private-key-file", "", "Private key file path, fd://N, or env://NAME (default: systemd credential "+signer.CredentialName+")")
 )
 
 func GetRPCFlag() (*url.URL, error) {
@@ -32,6 +42,53 @@ func GetRPCFlag() (*url.URL, error) {
 	return u, nil
 }
 
+// GetRPCHeadersFlag returns the headers sent to the RPC, with secrets resolved.
+func GetRPCHeadersFlag() (http.Header, error) {
+	headers, err := rpcauth.ParseHeaders(*flagRPCHeaders)
+	if err != nil {
+		return nil, err
+	}
+	if err := rpcauth.BearerToken(headers, *flagRPCToken); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+// GetWSHeadersFlag returns the headers sent with WebSocket handshakes, with secrets resolved.
+//
+// These are the RPC headers, overridden by WebSocket-specific headers.
+func GetWSHeadersFlag() (http.Header, error) {
+	headers, err := GetRPCHeadersFlag()
+	if err != nil {
+		return nil, err
+	}
+	wsHeaders, err := rpcauth.ParseHeaders(*flagWSHeaders)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range wsHeaders {
+		headers[key] = values
+	}
+	return headers, nil
+}
+
+// GetSendRPCFlag returns the RPC URL used to submit transactions, or an empty string if not set.
+func GetSendRPCFlag() (string, error) {
+	if *flagSendRPC == "" {
+		return "", nil
+	}
+	u, err := url.Parse(*flagSendRPC)
+	if err != nil {
+		return "", fmt.Errorf("invalid send RPC URL: %s", err)
+	}
+	return u.String(), nil
+}
+
+// GetSendRPCHeadersFlag returns the headers sent to the send RPC, with secrets resolved.
+func GetSendRPCHeadersFlag() (http.Header, error) {
+	return rpcauth.ParseHeaders(*flagSendRPCHeaders)
+}
+
 func GetWSFlag() (*url.URL, error) {
 	if *flagWS == "" {
 		u, err := GetRPCFlag()
@@ -59,25 +116,63 @@ func GetWSFlag() (*url.URL, error) {
 	return u, nil
 }
 
-func GetPythEnv() (pyth.Env, error) {
-	var pythEnv pyth.Env
-	switch *FlagNetwork {
-	case "devnet":
-		pythEnv = pyth.Devnet
-	case "testnet":
-		pythEnv = pyth.Testnet
-	case "mainnet":
-		pythEnv = pyth.Mainnet
-	default:
-		return pyth.Env{}, fmt.Errorf("unsupported network: %s", *FlagNetwork)
+// Network is a Solana cluster with a Pyth deployment.
+type Network struct {
+	Name        string
+	Env         pyth.Env
+	GenesisHash solana.Hash
+
+	// Mainnet refuses to start with unsafe settings such as fault injection.
+	Mainnet bool
+	// MinBalance is the default minimum publisher balance in SOL required by the startup check.
+	MinBalance float64
+	// SendOffset is the default offset into each slot at which updates are flushed.
+	SendOffset time.Duration
+	// PriorityFee is the default compute unit price in micro-lamports.
+	PriorityFee uint64
+}
+
+// networks are the known values of the network flag.
+var networks = map[string]Network{
+	"devnet": {
+		Name:        "devnet",
+		Env:         pyth.Devnet,
+		GenesisHash: solana.MustHashFromBase58("EtWTRABZaYq6iMfeYKouRu166VU2xqa1wcaWoxPkrZBG"),
+	},
+	"testnet": {
+		Name:        "testnet",
+		Env:         pyth.Testnet,
+		GenesisHash: solana.MustHashFromBase58("4uhcVJyU9pJkvQyS88uRDiswHXSCkY3zQawwpjk2NsNY"),
+	},
+	"mainnet": {
+		Name:        "mainnet",
+		Env:         pyth.Mainnet,
+		GenesisHash: solana.MustHashFromBase58("5eykt4UsFv8P8NJdTREpY1vzqKqZKvdpKuc147dw2N9d"),
+		Mainnet:     true,
+		MinBalance:  1,
+		SendOffset:  50 * time.Millisecond,
+		PriorityFee: 1_000,
+	},
+}
+
+// GetNetwork returns the network selected by the network flag.
+func GetNetwork() (Network, error) {
+	network, ok := networks[*FlagNetwork]
+	if !ok {
+		return Network{}, fmt.Errorf("unsupported network: %s", *FlagNetwork)
 	}
-	return pythEnv, nil
+	return network, nil
 }
 
-func GetPrivateKeyPath() string {
-	v := *flagPrivateKey
-	if v == "" {
-		cobra.CheckErr("Missing private key flag")
+func GetPythEnv() (pyth.Env, error) {
+	network, err := GetNetwork()
+	if err != nil {
+		return pyth.Env{}, err
 	}
-	return v
+	return network.Env, nil
+}
+
+// GetPrivateKeySource returns the private key source, empty for the systemd credential.
+func GetPrivateKeySource() string {
+	return *flagPrivateKey
 }
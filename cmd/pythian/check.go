@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/spf13/cobra"
+	"go.blockdaemon.com/pythian/publisher"
+	pythian_server "go.blockdaemon.com/pythian/server"
+)
+
+var checkCmd = cobra.Command{
+	Use:   "check",
+	Short: "Validate the server configuration against the cluster",
+	Long: "Runs the startup checks of the server (equivalent to server --check-only)\n" +
+		"and exits non-zero if any check fails. Accepts all server flags.",
+	Args: cobra.NoArgs,
+	Run: func(c *cobra.Command, args []string) {
+		serverCheckOnlyFlag = true
+		runServer(c, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(&checkCmd)
+}
+
+// runChecks runs the startup checks with the server components and prints a report.
+// Returns false if any check failed.
+func runChecks(ctx context.Context, handler *pythian_server.Handler, pub *publisher.Publisher) bool {
+	opts := publisher.CheckOptions{
+		MinBalance:  uint64(serverCheckMinBalance * float64(solana.LAMPORTS_PER_SOL)),
+		SlotTimeout: serverCheckSlotTimeout,
+	}
+	if serverCheckSimulate != "" {
+		var err error
+		opts.SimulatePrice, err = solana.PublicKeyFromBase58(serverCheckSimulate)
+		cobra.CheckErr(err)
+	}
+
+	var results []publisher.CheckResult
+	products, err := handler.WarmUp(ctx)
+	results = append(results, publisher.CheckResult{
+		Name:   "products",
+		Detail: fmt.Sprintf("fetched %d products", products),
+		Err:    err,
+	})
+	detail, err := handler.CheckPermissions(ctx)
+	results = append(results, publisher.CheckResult{Name: "permissions", Detail: detail, Err: err})
+	results = append(results, pub.Check(ctx, opts)...)
+
+	ok := true
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, result := range results {
+		status, detail := "PASS", result.Detail
+		switch {
+		case result.Skipped:
+			status = "SKIP"
+		case result.Err != nil:
+			status, detail = "FAIL", result.Err.Error()
+			ok = false
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", status, result.Name, detail)
+	}
+	_ = w.Flush()
+	return ok
+}
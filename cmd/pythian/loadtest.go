@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/spf13/cobra"
+	"go.blockdaemon.com/pythian/client"
+	"go.blockdaemon.com/pythian/loadtest"
+	"go.uber.org/zap"
+)
+
+var loadtestCmd = cobra.Command{
+	Use:   "loadtest",
+	Short: "Send synthetic price updates to a pythian instance",
+	Long: "Sends update_price calls to a running pythian instance and reports latency percentiles,\n" +
+		"errors by code, and notifications received. Exits non-zero if a threshold is exceeded.\n" +
+		"Do not point at a production instance: Updates of real accounts are published.",
+	Args: cobra.NoArgs,
+	Run:  runLoadtest,
+}
+
+var (
+	loadtestFlags          = loadtestCmd.Flags()
+	loadtestTarget         string
+	loadtestAccounts       []string
+	loadtestSynthetic      int
+	loadtestRate           float64
+	loadtestProfile        string
+	loadtestDuration       time.Duration
+	loadtestWorkers        int
+	loadtestSched          bool
+	loadtestMaxP99         time.Duration
+	loadtestMaxErrorRate   float64
+	loadtestConnectTimeout time.Duration
+)
+
+func init() {
+	rootCmd.AddCommand(&loadtestCmd)
+
+	loadtestFlags.StringVar(&loadtestTarget, "target", "ws://localhost:8910", "WebSocket URL of the pythian instance")
+	loadtestFlags.StringSliceVar(&loadtestAccounts, "account", nil, "Price account to update (repeatable, default random accounts)")
+	loadtestFlags.IntVar(&loadtestSynthetic, "synthetic-accounts", 10, "Number of random price accounts to update if no --account is given")
+	loadtestFlags.Float64Var(&loadtestRate, "rate", 100, "Updates per second at full load")
+	loadtestFlags.StringVar(&loadtestProfile, "profile", string(loadtest.ProfileConstant), "Load profile (constant, step, spike)")
+	loadtestFlags.DurationVar(&loadtestDuration, "duration", time.Minute, "Test duration")
+	loadtestFlags.IntVar(&loadtestWorkers, "workers", 16, "Number of concurrent requests")
+	loadtestFlags.BoolVar(&loadtestSched, "sched", false, "Send an update per price_sched notification instead of following --rate")
+	loadtestFlags.DurationVar(&loadtestMaxP99, "max-p99", 0, "Fail if the p99 latency exceeds this (0 disables)")
+	loadtestFlags.Float64Var(&loadtestMaxErrorRate, "max-error-rate", 0, "Fail if the share of failed requests exceeds this percentage (0 disables)")
+	loadtestFlags.DurationVar(&loadtestConnectTimeout, "connect-timeout", 10*time.Second, "Timeout connecting to the target")
+}
+
+func runLoadtest(_ *cobra.Command, _ []string) {
+	profile, err := loadtest.ParseProfile(loadtestProfile)
+	cobra.CheckErr(err)
+	var accounts []solana.PublicKey
+	for _, str := range loadtestAccounts {
+		account, err := solana.PublicKeyFromBase58(str)
+		cobra.CheckErr(err)
+		accounts = append(accounts, account)
+	}
+	if len(accounts) == 0 {
+		for i := 0; i < loadtestSynthetic; i++ {
+			accounts = append(accounts, solana.NewWallet().PublicKey())
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	c := client.New(loadtestTarget)
+	c.Log = log.Named("client")
+	connectCtx, connectCancel := context.WithTimeout(ctx, loadtestConnectTimeout)
+	err = c.Connect(connectCtx)
+	connectCancel()
+	cobra.CheckErr(err)
+	defer c.Close()
+
+	runner := loadtest.NewRunner(c, loadtest.Config{
+		Accounts: accounts,
+		Rate:     loadtestRate,
+		Profile:  profile,
+		Duration: loadtestDuration,
+		Workers:  loadtestWorkers,
+		Sched:    loadtestSched,
+	})
+	runner.Log = log.Named("loadtest")
+	log.Info("Starting load test",
+		zap.String("target", loadtestTarget),
+		zap.Int("accounts", len(accounts)),
+		zap.String("profile", string(profile)),
+		zap.Duration("duration", loadtestDuration))
+	report, err := runner.Run(ctx)
+	cobra.CheckErr(err)
+
+	report.Print(os.Stdout)
+	violations := report.Check(loadtest.Thresholds{
+		MaxP99:       loadtestMaxP99,
+		MaxErrorRate: loadtestMaxErrorRate / 100,
+	})
+	for _, violation := range violations {
+		fmt.Println("FAIL:", violation)
+	}
+	if len(violations) > 0 {
+		os.Exit(1)
+	}
+}
@@ -3,19 +3,29 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
-	"os/signal"
-	"syscall"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
-	solana_rpc "github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
 	"go.blockdaemon.com/pyth"
 	"go.blockdaemon.com/pythian/cmd"
+	"go.blockdaemon.com/pythian/errlog"
+	"go.blockdaemon.com/pythian/faults"
 	"go.blockdaemon.com/pythian/jsonrpc"
+	"go.blockdaemon.com/pythian/lifecycle"
+	"go.blockdaemon.com/pythian/publisher"
 	"go.blockdaemon.com/pythian/schedule"
 	pythian_server "go.blockdaemon.com/pythian/server"
 	"go.blockdaemon.com/pythian/signer"
+	"go.blockdaemon.com/pythian/stats"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 )
@@ -28,8 +38,70 @@ var serverCmd = cobra.Command{
 }
 
 var (
-	serverFlags      = serverCmd.Flags()
-	serverListenFlag string
+	serverFlags            = serverCmd.Flags()
+	serverListenFlag       string
+	serverAllowedPriceFlag []string
+	serverAdminFlag        bool
+	serverDecimalFlag      bool
+	serverBreakerFlag      []string
+	serverSlotAlignedFlag  bool
+	serverSendOffsetFlag   time.Duration
+	serverMemoFlag         string
+	serverNonceAccount     string
+	serverNonceAuthority   string
+	serverPriorityFee      uint64
+	serverMaxUpdatesPerTx  int
+	serverSlotWSURLs       []string
+	serverMaxTxsPerSlot    int
+	serverPriceWeightFlag  map[string]string
+	serverDrainTimeout     time.Duration
+	serverComputeUnits     uint32
+	serverStatsWindowsFlag []time.Duration
+	serverMinConfirmFlag   float64
+	serverMaxDeviation     float64
+	serverDefaultConf      uint64
+	serverDefaultConfPct   float64
+	serverProductFetchFlag string
+	serverStaticAccounts   string
+	serverStaticRefresh    bool
+	serverMaxConnsFlag     int
+	serverIdleTimeoutFlag  time.Duration
+	serverReqTimeoutFlag   time.Duration
+	serverTraceFlag        bool
+	serverMaxRequestSize   uint
+	serverMaxResponseSize  int
+	serverMaxParamsSize    int
+	serverParamsLimitFlag  map[string]int
+	serverMaxFutureSlots   uint64
+	serverFutureSlotPolicy string
+	serverCommitmentFlag   string
+	serverSkipPreflight    bool
+	serverPreflightCommit  string
+	serverSendMaxRetries   int
+	serverNotifyProcessed  bool
+	serverLeaderSlots      uint64
+	serverRetainFlag       time.Duration
+	serverLeaderInterval   time.Duration
+	serverStaleTimeout     time.Duration
+	serverConflictSlots    uint64
+	serverPermissionsFlag  time.Duration
+	serverDumpDir          string
+	serverOTLPEndpoint     string
+	serverOTLPInsecure     bool
+	serverErrorLogSize     int
+	serverFeedInterval     time.Duration
+	serverCoalesceFlag     bool
+	serverFaultsFlag       bool
+	serverAllowUnsafeFlag  bool
+	serverPublisherRPCFlag map[string]string
+	serverEMAAlphaFlag     map[string]string
+	serverMetricLabels     string
+	serverMetricMaxPrices  int
+	serverCheckOnlyFlag    bool
+	serverPreflightFlag    bool
+	serverCheckMinBalance  float64
+	serverCheckSimulate    string
+	serverCheckSlotTimeout time.Duration
 )
 
 func init() {
@@ -37,16 +109,88 @@ func init() {
 	serverFlags.AddFlagSet(cmd.FlagSetRPC)
 	serverFlags.AddFlagSet(cmd.FlagSetSigner)
 	serverFlags.StringVar(&serverListenFlag, "listen", ":8910", "Listen address")
+	serverFlags.IntVar(&serverMaxConnsFlag, "max-connections", 0, "Maximum concurrent WebSocket connections (0 for unlimited)")
+	serverFlags.BoolVar(&serverTraceFlag, "trace-requests", false, "Log each JSON-RPC request with a correlation ID (from the "+jsonrpc.CorrelationIDHeader+" header or generated), carried through to the transaction logs of price updates")
+	serverFlags.DurationVar(&serverIdleTimeoutFlag, "idle-timeout", 0, "Close WebSocket connections without requests or subscriptions after this duration (0 disables)")
+	serverFlags.DurationVar(&serverReqTimeoutFlag, "request-timeout", 0, "Answer JSON-RPC requests with a timeout error if handling takes longer than this (0 disables)")
+	serverFlags.UintVar(&serverMaxRequestSize, "max-request-size", 128000, "Maximum size of inbound JSON-RPC messages in bytes")
+	serverFlags.IntVar(&serverMaxResponseSize, "max-response-size", 64<<20, "Maximum size of outbound JSON-RPC messages in bytes (0 for unlimited)")
+	serverFlags.IntVar(&serverMaxParamsSize, "max-params-size", 0, "Maximum size of request params in bytes (0 for unlimited)")
+	serverFlags.StringToIntVar(&serverParamsLimitFlag, "method-params-limit", nil, "Per-method params size limit METHOD=BYTES, overriding --max-params-size")
+	serverFlags.BoolVar(&serverAdminFlag, "admin", false, "Enable admin JSON-RPC methods")
+	serverFlags.BoolVar(&serverDecimalFlag, "decimal-prices", false, "Include exponent-scaled decimal strings in price responses")
+	serverFlags.StringVar(&serverStaticAccounts, "static-accounts", "", "JSON file pinning the served product and price accounts instead of discovering them (empty disables)")
+	serverFlags.BoolVar(&serverStaticRefresh, "static-accounts-refresh", false, "Fetch the pinned product accounts for every request instead of once (requires --static-accounts)")
+	serverFlags.StringVar(&serverProductFetchFlag, "product-fetch", string(pythian_server.ProductFetchAuto), "Product account fetch strategy (auto, client, filtered, mapping)")
+	serverFlags.StringSliceVar(&serverAllowedPriceFlag, "allowed-price-accounts", nil, "Price accounts allowed to be updated (default all)")
+	serverFlags.BoolVar(&serverSlotAlignedFlag, "slot-aligned", false, "Send transactions at a fixed offset after each slot start")
+	serverFlags.DurationVar(&serverSendOffsetFlag, "send-offset", 0, "Offset into the slot at which to send (requires --slot-aligned, default depends on --network)")
+	serverFlags.StringToStringVar(&serverEMAAlphaFlag, "ema-alpha", nil, "Publish an exponential moving average of a price account's prices, as PRICE=ALPHA with ALPHA the weight of the newest price (repeatable)")
+	serverFlags.StringToStringVar(&serverPublisherRPCFlag, "publisher-rpc", nil, "Send transactions of a publisher key to its own RPC, e.g. a staked connection, as PUBKEY=URL (repeatable)")
+	serverFlags.BoolVar(&serverSkipPreflight, "skip-preflight", true, "Skip the simulation of sent transactions by the RPC node")
+	serverFlags.StringVar(&serverPreflightCommit, "preflight-commitment", "", "Commitment of the preflight simulation of sent transactions (default --submit-commitment)")
+	serverFlags.IntVar(&serverSendMaxRetries, "send-max-retries", -1, "Times the RPC node retries forwarding a transaction to the leader (-1 for the node default)")
+	serverFlags.StringVar(&serverCommitmentFlag, "submit-commitment", string(rpc.CommitmentConfirmed), "Commitment at which sent transactions count as landed (confirmed, finalized)")
+	serverFlags.BoolVar(&serverNotifyProcessed, "notify-processed", false, "Notify subscribers of sent transactions at processed commitment, ahead of --submit-commitment")
+	serverFlags.StringVar(&serverMetricLabels, "metric-labels", string(schedule.LabelPubkey), "Labels of per-update metrics (none, publisher, symbol, pubkey)")
+	serverFlags.IntVar(&serverMetricMaxPrices, "metric-max-prices", 0, "Aggregate per-update metrics of price accounts beyond the first N as \"other\" (0 for unlimited)")
+	serverFlags.DurationVar(&serverRetainFlag, "retain-unconfirmed", 0, "Keep sent updates until they land or for this duration, to replay them on the failover admin method (0 disables)")
+	serverFlags.Uint64Var(&serverLeaderSlots, "standby-takeover-slots", 0, "Stand by while another instance publishes with the same key, taking over after this many slots without its price updates (0 disables)")
+	serverFlags.DurationVar(&serverLeaderInterval, "standby-poll-interval", 2*time.Second, "Interval at which recent price updates of the publisher key are checked (requires --standby-takeover-slots)")
+	serverFlags.BoolVar(&serverCoalesceFlag, "coalesce-in-flight", false, "Hold back updates of price accounts until the previous transaction updating them landed or failed")
+	serverFlags.DurationVar(&serverFeedInterval, "feed-interval", 0, "Stream aggregate prices as Server-Sent Events at /feed, at most one update per price and interval (0 disables)")
+	serverFlags.DurationVar(&serverStaleTimeout, "stale-timeout", 0, "Publish an unknown status for price accounts without updates for this duration, until updates resume (0 disables)")
+	serverFlags.DurationVar(&serverPermissionsFlag, "permission-refresh", 0, "Drop updates of price accounts not listing the publisher as a component, refreshing the listed components at this interval (0 disables)")
+	serverFlags.Uint64Var(&serverConflictSlots, "conflict-slots", 0, "Report price accounts updated with the publisher key by another instance if their pub slots do not match ours for this many slots (0 disables)")
+	serverFlags.StringVar(&serverOTLPEndpoint, "otlp-endpoint", "", "Export OpenTelemetry spans of requests and sent transactions to this OTLP/HTTP collector host:port (empty disables)")
+	serverFlags.BoolVar(&serverOTLPInsecure, "otlp-insecure", false, "Export spans over plain HTTP instead of HTTPS (requires --otlp-endpoint)")
+	serverFlags.StringVar(&serverDumpDir, "dump-dir", os.TempDir(), "Directory for state dumps written on SIGUSR1 or the dump_state admin method")
+	serverFlags.IntVar(&serverErrorLogSize, "error-log-size", 100, "Number of recent errors kept for state dumps")
+	serverFlags.StringVar(&serverNonceAccount, "nonce-account", "", "Durable nonce account to send one transaction per flush through (empty disables)")
+	serverFlags.StringVar(&serverNonceAuthority, "nonce-authority", "", "Authority of the nonce account, must be the publisher key (empty defaults to the publisher key)")
+	serverFlags.StringArrayVar(&serverSlotWSURLs, "slot-ws-url", nil, "Additional WebSocket endpoint to stream slots from, tracking the highest slot across all endpoints (repeatable)")
+	serverFlags.IntVar(&serverMaxUpdatesPerTx, "max-updates-per-tx", 0, "Maximum number of price updates per transaction, limiting the updates lost with a failed transaction (0 only limits by size)")
+	serverFlags.IntVar(&serverMaxTxsPerSlot, "max-txs-per-slot", 0, "Maximum number of transactions sent per slot, dropping updates of the lowest weight price accounts first (0 disables)")
+	serverFlags.StringToStringVar(&serverPriceWeightFlag, "price-weight", nil, "Importance of a price account when updates must be dropped, as PRICE=WEIGHT (repeatable, defaults to 1)")
+	serverFlags.Uint64Var(&serverPriorityFee, "priority-fee", 0, "Compute unit price in micro-lamports paid on top of the base fee (0 disables, default depends on --network)")
+	serverFlags.Uint32Var(&serverComputeUnits, "compute-unit-limit", schedule.DefaultComputeUnits, "Compute units requested per transaction when paying a priority fee")
+	serverFlags.DurationVar(&serverDrainTimeout, "drain-timeout", 5*time.Second, "Send queued updates on shutdown, giving up after this duration (0 disables)")
+	serverFlags.StringVar(&serverMemoFlag, "memo", "", "Memo attached to every transaction, e.g. to identify this instance")
+	serverFlags.DurationSliceVar(&serverStatsWindowsFlag, "stats-windows", stats.DefaultWindows, "Rolling windows reported by get_stats")
+	serverFlags.Float64Var(&serverMinConfirmFlag, "min-confirm-rate", 0, "Report degraded health if the confirmation rate drops below this ratio (0 disables)")
+	serverFlags.Float64Var(&serverMaxDeviation, "max-price-deviation", 0, "Reject updates deviating more than this percentage from the aggregate price (0 disables)")
+	serverFlags.Uint64Var(&serverDefaultConf, "default-conf", 0, "Confidence of updates omitting conf (0 requires conf)")
+	serverFlags.Float64Var(&serverDefaultConfPct, "default-conf-percent", 0, "Confidence of updates omitting conf as a percentage of the price (0 requires conf)")
+	serverFlags.Uint64Var(&serverMaxFutureSlots, "max-future-slots", 0, "Guard against updates with a pub slot more than this many slots ahead of the current slot (0 disables)")
+	serverFlags.StringVar(&serverFutureSlotPolicy, "future-slot-policy", string(schedule.FutureSlotReject), "Handling of updates with a pub slot too far ahead (reject, clamp)")
+	serverFlags.StringArrayVar(&serverBreakerFlag, "price-breaker", nil, "Rate-of-change breaker rule PATTERN=PERCENT,WINDOW,COOLDOWN (repeatable, e.g. 'Crypto.*=5,10s,1m')")
+	serverFlags.BoolVar(&serverPreflightFlag, "preflight", true, "Validate endpoints, program, and publisher permissions before serving")
+	serverFlags.BoolVar(&serverCheckOnlyFlag, "check-only", false, "Validate the configuration against the cluster, print a report, and exit")
+	serverFlags.Float64Var(&serverCheckMinBalance, "check-min-balance", 0, "Minimum publisher balance in SOL required by the startup check (0 skips)")
+	serverFlags.StringVar(&serverCheckSimulate, "check-simulate", "", "Price account to simulate a no-op update for in the startup check")
+	serverFlags.DurationVar(&serverCheckSlotTimeout, "check-slot-timeout", 30*time.Second, "Time to wait for a slot update in the startup check")
+	serverFlags.BoolVar(&serverFaultsFlag, "fault-injection", false, "Enable admin methods injecting failures (testing only, requires --admin)")
+	_ = serverFlags.MarkHidden("fault-injection")
+	serverFlags.BoolVar(&serverAllowUnsafeFlag, "allow-unsafe", false, "Start on mainnet despite unsafe settings, such as fault injection or admin methods on a non-loopback listener")
+
+	// The check command accepts all server flags.
+	checkCmd.Flags().AddFlagSet(serverFlags)
 }
 
-func runServer(_ *cobra.Command, _ []string) {
+func runServer(c *cobra.Command, _ []string) {
+	// Keep recent errors of all components for state dumps.
+	errorRing := errlog.NewRing(serverErrorLogSize)
+	log = errorRing.Wrap(log)
+
 	log.Info("Initializing")
 	defer log.Info("Shutdown completed")
 
-	// Create root application context.
-	ctx := context.Background()
-	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	// Create root application context, cancelled by a shutdown signal.
+	controller := lifecycle.NewController()
+	controller.Log = log
+	ctx, cancel := controller.Context(context.Background())
 	defer cancel()
+	go controller.Listen(ctx)
 	group, ctx := errgroup.WithContext(ctx)
 
 	// Print message when exit is about to occur.
@@ -56,69 +200,305 @@ func runServer(_ *cobra.Command, _ []string) {
 		return nil
 	})
 
-	// Create RPC/WebSocket client to Pyth on-chain program.
+	// Export spans of requests and sent transactions.
+	if serverOTLPEndpoint != "" {
+		shutdownTracing, err := setupTracing(ctx, serverOTLPEndpoint, serverOTLPInsecure)
+		cobra.CheckErr(err)
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(shutdownCtx); err != nil {
+				log.Warn("Failed to flush spans", zap.Error(err))
+			}
+		}()
+		log.Info("Exporting OpenTelemetry spans", zap.String("endpoint", serverOTLPEndpoint))
+	}
+
+	// Read Solana RPC config.
 	solanaRpcUrl, err := cmd.GetRPCFlag()
 	cobra.CheckErr(err)
 	solanaWsUrl, err := cmd.GetWSFlag()
 	cobra.CheckErr(err)
-	pythEnv, err := cmd.GetPythEnv()
+	network, err := cmd.GetNetwork()
 	cobra.CheckErr(err)
-	pythClient := pyth.NewClient(pythEnv, solanaRpcUrl.String(), solanaWsUrl.String())
-	pythClient.Log = log.Named("rpc")
-	solanaRPC := solana_rpc.New(solanaRpcUrl.String())
-
+	pythEnv := network.Env
+	applyNetworkDefaults(c.Flags().Changed, network)
+	if unsafe := unsafeSettings(); network.Mainnet && len(unsafe) > 0 {
+		if !serverAllowUnsafeFlag {
+			cobra.CheckErr(fmt.Sprintf("refusing to publish on %s with unsafe settings: %s (override with --allow-unsafe)",
+				network.Name, strings.Join(unsafe, "; ")))
+		}
+		log.Warn("Publishing with unsafe settings", zap.String("network", network.Name), zap.Strings("unsafe", unsafe))
+	}
+	rpcHeaders, err := cmd.GetRPCHeadersFlag()
+	cobra.CheckErr(err)
+	sendRPCURL, err := cmd.GetSendRPCFlag()
+	cobra.CheckErr(err)
+	sendRPCHeaders, err := cmd.GetSendRPCHeadersFlag()
+	cobra.CheckErr(err)
+	wsHeaders, err := cmd.GetWSHeadersFlag()
+	cobra.CheckErr(err)
+	for _, headers := range []http.Header{rpcHeaders, sendRPCHeaders, wsHeaders} {
+		for _, values := range headers {
+			for _, value := range values {
+				errorRing.AddSecret(value)
+			}
+		}
+	}
+	var injector *faults.Injector
+	if serverFaultsFlag {
+		if !serverAdminFlag {
+			cobra.CheckErr("--fault-injection requires --admin")
+		}
+		log.Warn("Fault injection enabled, do not use in production")
+		injector = faults.NewInjector()
+		injector.Log = log.Named("faults")
+	}
 	// Create transaction signer.
-	txSigner, err := signer.NewSigner(cmd.GetPrivateKeyPath(), pythEnv.Program)
+	txSigner, err := signer.NewSigner(cmd.GetPrivateKeySource(), pythEnv.Program)
 	cobra.CheckErr(err)
 	log.Info("Signer initialized", zap.Stringer("pubkey", txSigner.Pubkey()))
 
-	// Create recent block hash monitor.
-	log.Info("Starting block hash monitor")
-	blockhashes, err := schedule.NewBlockHashMonitor(ctx, solanaRPC)
-	if err != nil {
-		log.Fatal("Failed to set up blockhash monitor", zap.Error(err))
+	// Create publish pipeline.
+	allowedPrices := make([]solana.PublicKey, len(serverAllowedPriceFlag))
+	for i, str := range serverAllowedPriceFlag {
+		allowedPrices[i], err = solana.PublicKeyFromBase58(str)
+		cobra.CheckErr(err)
 	}
-	blockhashes.Log = log.Named("blockhash")
-	group.Go(func() error {
-		defer log.Info("Stopped block hash monitor")
-		blockhashes.Run(ctx)
-		return nil
+	breakerRules := make([]publisher.BreakerRule, len(serverBreakerFlag))
+	for i, str := range serverBreakerFlag {
+		breakerRules[i], err = publisher.ParseBreakerRule(str)
+		cobra.CheckErr(err)
+	}
+	publisherRPCs := make(map[solana.PublicKey]string, len(serverPublisherRPCFlag))
+	for key, endpoint := range serverPublisherRPCFlag {
+		pubkey, err := solana.PublicKeyFromBase58(key)
+		cobra.CheckErr(err)
+		publisherRPCs[pubkey] = endpoint
+	}
+	var nonceAccount, nonceAuthority solana.PublicKey
+	if serverNonceAccount != "" {
+		nonceAccount, err = solana.PublicKeyFromBase58(serverNonceAccount)
+		cobra.CheckErr(err)
+	}
+	if serverNonceAuthority != "" {
+		nonceAuthority, err = solana.PublicKeyFromBase58(serverNonceAuthority)
+		cobra.CheckErr(err)
+	}
+	metricLabels, err := schedule.ParseLabelStrategy(serverMetricLabels)
+	cobra.CheckErr(err)
+	cobra.CheckErr(schedule.SetupMetrics(metricLabels, serverMetricMaxPrices))
+	futureSlotPolicy, err := schedule.ParseFutureSlotPolicy(serverFutureSlotPolicy)
+	cobra.CheckErr(err)
+	submitCommitment := rpc.CommitmentType(serverCommitmentFlag)
+	if submitCommitment != rpc.CommitmentConfirmed && submitCommitment != rpc.CommitmentFinalized {
+		cobra.CheckErr("--submit-commitment must be confirmed or finalized")
+	}
+	sendOpts := schedule.SendOptions{
+		SkipPreflight:       serverSkipPreflight,
+		PreflightCommitment: rpc.CommitmentType(serverPreflightCommit),
+	}
+	if serverSendMaxRetries >= 0 {
+		maxRetries := uint(serverSendMaxRetries)
+		sendOpts.MaxRetries = &maxRetries
+	}
+	priceWeights := make(map[solana.PublicKey]float64, len(serverPriceWeightFlag))
+	for key, value := range serverPriceWeightFlag {
+		account, err := solana.PublicKeyFromBase58(key)
+		cobra.CheckErr(err)
+		weight, err := strconv.ParseFloat(value, 64)
+		cobra.CheckErr(err)
+		priceWeights[account] = weight
+	}
+	var leaderOpts *publisher.LeaderOptions
+	if serverLeaderSlots > 0 {
+		leaderOpts = &publisher.LeaderOptions{
+			TakeoverSlots: serverLeaderSlots,
+			PollInterval:  serverLeaderInterval,
+		}
+	}
+	log.Info("Starting publisher")
+	pub, err := publisher.New(publisher.Options{
+		Log:                  log,
+		RPCURL:               solanaRpcUrl.String(),
+		RPCHeaders:           rpcHeaders,
+		WebSocketURL:         solanaWsUrl.String(),
+		WebSocketHeaders:     wsHeaders,
+		SlotWebSocketURLs:    serverSlotWSURLs,
+		Program:              pythEnv.Program,
+		Signer:               txSigner,
+		GenesisHash:          network.GenesisHash,
+		SendRPCURL:           sendRPCURL,
+		SendRPCHeaders:       sendRPCHeaders,
+		PublisherSendRPCURLs: publisherRPCs,
+		AllowedAccounts:      allowedPrices,
+		Memo:                 serverMemoFlag,
+		NonceAccount:         nonceAccount,
+		NonceAuthority:       nonceAuthority,
+		MaxUpdatesPerTx:      serverMaxUpdatesPerTx,
+		MaxTransactions:      serverMaxTxsPerSlot,
+		Weights:              priceWeights,
+		PriorityFee:          serverPriorityFee,
+		ComputeUnitLimit:     serverComputeUnits,
+		DrainTimeout:         serverDrainTimeout,
+		SlotAligned:          serverSlotAlignedFlag,
+		SendOffset:           serverSendOffsetFlag,
+		SubmitCommitment:     submitCommitment,
+		NotifyProcessed:      serverNotifyProcessed,
+		SendOptions:          &sendOpts,
+		CoalesceInFlight:     serverCoalesceFlag,
+		BreakerRules:         breakerRules,
+		StatsWindows:         serverStatsWindowsFlag,
+		Faults:               injector,
+		StaleTimeout:         serverStaleTimeout,
+		ConflictSlots:        serverConflictSlots,
+		Leader:               leaderOpts,
+		RetainUnconfirmed:    serverRetainFlag,
+		FutureSlots: schedule.FutureSlotGuard{
+			MaxAhead: serverMaxFutureSlots,
+			Policy:   futureSlotPolicy,
+		},
 	})
+	if err != nil {
+		log.Fatal("Failed to set up publisher", zap.Error(err))
+	}
 
-	// Create slot monitor.
-	log.Info("Starting slot monitor")
-	slots := schedule.NewSlotMonitor(solanaWsUrl.String())
-	slots.Log = log.Named("slots")
-	group.Go(func() error {
-		defer log.Info("Stopped slot monitor")
-		return slots.Run(ctx)
-	})
+	// Fail fast if the endpoints serve another network, e.g. after copying a config.
+	if !serverCheckOnlyFlag {
+		genesisCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		detail, err := pub.CheckGenesis(genesisCtx)
+		cancel()
+		if err != nil {
+			log.Fatal("Endpoints do not match network", zap.String("network", network.Name), zap.Error(err))
+		}
+		log.Info("Verified network", zap.String("network", network.Name), zap.String("detail", detail))
+	}
 
-	// Create update buffer.
-	buffer := schedule.NewBuffer()
+	// Create RPC/WebSocket client to Pyth on-chain program.
+	// The Pyth client cannot send WebSocket headers, its price streams rely on credentials in the URL.
+	if len(wsHeaders) > 0 {
+		log.Warn("WebSocket headers are not sent by price account streams (subscribe_price, dashboard feed, conflict detection)")
+	}
+	pythClient := pyth.NewClient(pythEnv, solanaRpcUrl.String(), pub.WebSocketURL())
+	pythClient.Log = log.Named("rpc")
+	pythClient.RPC = publisher.NewRPCClient(solanaRpcUrl.String(), rpcHeaders, publisher.RPCRoleRead, injector)
 
-	// Create scheduler.
-	sched := schedule.NewScheduler(buffer, blockhashes, txSigner, solanaRPC)
-	sched.Log = log.Named("scheduler")
-	log.Info("Starting publish scheduler")
+	// Create Pythian JSON-RPC handler.
+	rpc := pythian_server.NewHandler(pythClient, pub)
+	rpc.Log = log.Named("server")
+	rpc.DecimalPrices = serverDecimalFlag
+	rpc.MinConfirmRate = serverMinConfirmFlag
+	rpc.MaxDeviation = serverMaxDeviation / 100
+	if serverDefaultConf != 0 && serverDefaultConfPct != 0 {
+		cobra.CheckErr("--default-conf and --default-conf-percent are mutually exclusive")
+	}
+	rpc.DefaultConf = serverDefaultConf
+	rpc.DefaultConfRatio = serverDefaultConfPct / 100
+	productFetch, err := pythian_server.ParseProductFetchStrategy(serverProductFetchFlag)
+	cobra.CheckErr(err)
+	rpc.SetProductFetchStrategy(productFetch)
+	if serverStaticAccounts != "" {
+		staticProducts, err := pythian_server.LoadStaticAccounts(serverStaticAccounts)
+		cobra.CheckErr(err)
+		rpc.SetStaticAccounts(staticProducts, serverStaticRefresh)
+	} else if serverStaticRefresh {
+		cobra.CheckErr("--static-accounts-refresh requires --static-accounts")
+	}
+	for key, value := range serverEMAAlphaFlag {
+		account, err := solana.PublicKeyFromBase58(key)
+		cobra.CheckErr(err)
+		alpha, err := strconv.ParseFloat(value, 64)
+		cobra.CheckErr(err)
+		cobra.CheckErr(rpc.SetSmoothing(account, alpha))
+	}
+	rpc.Timeout = serverReqTimeoutFlag
+	rpc.DefaultParamsLimit = serverMaxParamsSize
+	for method, limit := range serverParamsLimitFlag {
+		rpc.SetParamsLimit(method, limit)
+	}
+	if serverAdminFlag {
+		log.Warn("Admin methods enabled")
+		rpc.EnableAdmin()
+		if injector != nil {
+			rpc.EnableFaultInjection(injector)
+		}
+	}
+
+	if serverCheckOnlyFlag {
+		if !runChecks(ctx, rpc, pub) {
+			os.Exit(1)
+		}
+		return
+	}
+	if serverPreflightFlag {
+		log.Info("Running preflight checks")
+		preflightCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err := rpc.Preflight(preflightCtx)
+		cancel()
+		if err != nil {
+			log.Fatal("Invalid configuration", zap.Error(err))
+		}
+	}
+
+	// The account cache also learns symbols for metric labels before the first updates arrive.
+	pub.Supervise(pythian_server.ComponentAccountCache, rpc.RunAccountCache)
+	// Reloading fetches product accounts again, picking up new symbols.
+	controller.OnReload(func() {
+		if err := pub.RestartComponent(pythian_server.ComponentAccountCache); err != nil {
+			log.Error("Failed to reload account cache", zap.Error(err))
+		}
+	})
+	if serverAdminFlag {
+		rpc.EnableReload(controller)
+	}
+	if serverFeedInterval > 0 {
+		rpc.EnableFeed(serverFeedInterval)
+		pub.Supervise(pythian_server.ComponentPriceFeed, rpc.RunPriceFeed)
+	}
+	if serverPermissionsFlag > 0 {
+		rpc.EnablePermissionCheck(serverPermissionsFlag)
+		pub.Supervise(pythian_server.ComponentPermissions, rpc.RunPermissionRefresh)
+	}
+	if serverConflictSlots > 0 {
+		pub.Supervise(pythian_server.ComponentConflictDetector, rpc.RunConflictDetector)
+	}
 	group.Go(func() error {
-		defer log.Info("Stopped publish scheduler")
-		sched.Run(ctx, slots.Updates())
-		return nil
+		defer log.Info("Stopped publisher")
+		return pub.Run(ctx)
 	})
 
-	// Create Pythian JSON-RPC handler.
-	rpc := pythian_server.NewHandler(pythClient, buffer, txSigner.Pubkey(), slots)
-	rpc.Log = log.Named("server")
+	rpcServer := jsonrpc.NewServer(rpc)
+	rpcServer.Log = log.Named("rpc")
+	rpcServer.MaxConns = serverMaxConnsFlag
+	rpcServer.IdleTimeout = serverIdleTimeoutFlag
+	rpcServer.Tracing = serverTraceFlag
+	rpcServer.MaxRequestSize = serverMaxRequestSize
+	rpcServer.MaxResponseSize = serverMaxResponseSize
+
+	// Write state dumps for post-mortems on request.
+	rpc.EnableStateDump(serverDumpDir, rpcServer, errorRing)
+	controller.OnDump(func() {
+		path, err := rpc.DumpState()
+		if err != nil {
+			log.Error("Failed to dump state", zap.Error(err))
+			return
+		}
+		log.Info("Dumped state", zap.String("path", path))
+	})
 
 	// Start HTTP server.
 	log.Info("Starting HTTP server", zap.String("listen", serverListenFlag))
 	group.Go(func() error {
 		defer log.Info("Stopped HTTP server")
 
-		rpcServer := jsonrpc.NewServer(rpc)
 		http.Handle("/", rpcServer)
 		http.Handle("/metrics", promhttp.Handler())
+		if serverFeedInterval > 0 {
+			http.Handle("/feed", rpcServer.Stream(rpc.FeedHandler()))
+		}
+		if serverAdminFlag {
+			http.Handle("/debug/state", rpc.DebugStateHandler(rpcServer))
+		}
 
 		server := http.Server{Addr: serverListenFlag}
 		go func() {
@@ -140,3 +520,41 @@ func runServer(_ *cobra.Command, _ []string) {
 		log.Error("Crashed", zap.Error(err))
 	}
 }
+
+// applyNetworkDefaults sets the defaults of the network to settings whose flags were not changed.
+func applyNetworkDefaults(changed func(name string) bool, network cmd.Network) {
+	if !changed("check-min-balance") {
+		serverCheckMinBalance = network.MinBalance
+	}
+	if !changed("send-offset") {
+		serverSendOffsetFlag = network.SendOffset
+	}
+	if !changed("priority-fee") {
+		serverPriorityFee = network.PriorityFee
+	}
+}
+
+// unsafeSettings lists settings that must not be used when publishing on mainnet.
+func unsafeSettings() []string {
+	var unsafe []string
+	if serverFaultsFlag {
+		unsafe = append(unsafe, "fault injection enabled")
+	}
+	if serverAdminFlag && !isLoopback(serverListenFlag) {
+		unsafe = append(unsafe, "admin methods enabled on non-loopback listener "+serverListenFlag)
+	}
+	return unsafe
+}
+
+// isLoopback returns whether a listen address only accepts local connections.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
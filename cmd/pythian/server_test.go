@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.blockdaemon.com/pythian/cmd"
+)
+
+func TestApplyNetworkDefaults(t *testing.T) {
+	network := cmd.Network{
+		MinBalance:  1,
+		SendOffset:  50 * time.Millisecond,
+		PriorityFee: 1_000,
+	}
+	t.Cleanup(func() {
+		serverCheckMinBalance, serverSendOffsetFlag, serverPriorityFee = 0, 0, 0
+	})
+
+	serverPriorityFee = 5
+	applyNetworkDefaults(func(name string) bool { return name == "priority-fee" }, network)
+	assert.Equal(t, float64(1), serverCheckMinBalance)
+	assert.Equal(t, 50*time.Millisecond, serverSendOffsetFlag)
+	assert.Equal(t, uint64(5), serverPriorityFee, "explicit flag overridden")
+}
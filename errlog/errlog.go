@@ -0,0 +1,178 @@
+// Package errlog keeps a bounded in-memory log of recent errors for post-mortems.
+//
+// The Ring is fed by a zap core, so every component logging through
+// a logger wrapped with Ring.Wrap contributes its errors.
+// Entries are redacted before they are stored, so that secrets
+// such as API keys in RPC URLs never reach a state dump.
+package errlog
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Redacted replaces secrets in log entries.
+const Redacted = "[REDACTED]"
+
+// Entry is a logged error.
+type Entry struct {
+	Time    time.Time
+	Logger  string // name of the logging component
+	Message string
+	Error   string // value of the "error" field, if any
+}
+
+// Ring holds the most recent errors, oldest first.
+type Ring struct {
+	lock    sync.Mutex
+	entries []Entry
+	next    int // index of the oldest entry once full
+	secrets []string
+}
+
+// NewRing creates a ring holding up to size entries.
+func NewRing(size int) *Ring {
+	if size <= 0 {
+		size = 1
+	}
+	return &Ring{entries: make([]Entry, 0, size)}
+}
+
+// AddSecret redacts the given value from entries added later.
+// Empty values are ignored.
+func (r *Ring) AddSecret(secret string) {
+	if secret == "" {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.secrets = append(r.secrets, secret)
+}
+
+// Add records an error, redacting secrets and URLs.
+func (r *Ring) Add(entry Entry) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	entry.Message = r.redact(entry.Message)
+	entry.Error = r.redact(entry.Error)
+	if len(r.entries) < cap(r.entries) {
+		r.entries = append(r.entries, entry)
+		return
+	}
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % len(r.entries)
+}
+
+// List returns the recorded errors, oldest first.
+func (r *Ring) List() []Entry {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	list := make([]Entry, 0, len(r.entries))
+	list = append(list, r.entries[r.next:]...)
+	return append(list, r.entries[:r.next]...)
+}
+
+// Redact removes secrets and URLs from s, like from added entries.
+func (r *Ring) Redact(s string) string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.redact(s)
+}
+
+// redact removes secrets from s. Must hold lock.
+func (r *Ring) redact(s string) string {
+	s = RedactURLs(s)
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	return s
+}
+
+var urlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'<>]+`)
+
+// RedactURLs reduces URLs in s to their scheme and host.
+//
+// RPC providers commonly put API keys into the path, query, or user info.
+func RedactURLs(s string) string {
+	return urlPattern.ReplaceAllStringFunc(s, func(raw string) string {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return Redacted
+		}
+		redacted := u.Scheme + "://" + u.Host
+		if u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+			redacted += "/" + Redacted
+		}
+		return redacted
+	})
+}
+
+// Wrap returns a logger that also records entries at error level and above in the ring.
+func (r *Ring) Wrap(log *zap.Logger) *zap.Logger {
+	return log.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, &ringCore{ring: r})
+	}))
+}
+
+// ringCore is a zap core adding error entries to a ring.
+type ringCore struct {
+	ring *Ring
+	err  string // error field added with With
+}
+
+func (c *ringCore) Enabled(level zapcore.Level) bool {
+	return level >= zapcore.ErrorLevel
+}
+
+func (c *ringCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	if err, ok := errorField(fields); ok {
+		clone.err = err
+	}
+	return &clone
+}
+
+func (c *ringCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *ringCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	err := c.err
+	if fieldErr, ok := errorField(fields); ok {
+		err = fieldErr
+	}
+	c.ring.Add(Entry{
+		Time:    entry.Time,
+		Logger:  entry.LoggerName,
+		Message: entry.Message,
+		Error:   err,
+	})
+	return nil
+}
+
+func (c *ringCore) Sync() error {
+	return nil
+}
+
+// errorField returns the message of the "error" field created by zap.Error.
+// Other fields are not recorded, they may hold arbitrary data.
+func errorField(fields []zapcore.Field) (string, bool) {
+	for _, field := range fields {
+		if field.Key != "error" || field.Type != zapcore.ErrorType {
+			continue
+		}
+		if err, ok := field.Interface.(error); ok {
+			return err.Error(), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,170 @@
+// Package faults injects failures into the publish pipeline to rehearse incident response.
+//
+// Components hold an optional *Injector. A nil Injector injects nothing,
+// so the hooks reduce to a nil check when fault injection is disabled.
+package faults
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Fault names, used as metric labels.
+const (
+	DropSend  = "drop_send"  // outgoing transaction discarded instead of sent
+	DelaySend = "delay_send" // outgoing transaction delayed
+	StallSlot = "stall_slot" // slot update discarded during a stall
+	ReadLimit = "read_429"   // read RPC request answered with 429 Too Many Requests
+)
+
+// Config selects the faults to inject.
+type Config struct {
+	DropSendRate  float64       // share of outgoing transactions to drop (0 to 1)
+	SendDelay     time.Duration // delay before sending each transaction
+	ReadLimitRate float64       // share of read RPC requests to fail with 429 (0 to 1)
+}
+
+// State is the current fault configuration.
+type State struct {
+	Config
+	StallUntil time.Time // zero if the slot stream is not stalled
+}
+
+// Injector decides when to inject faults. All methods are safe to call on a nil Injector.
+type Injector struct {
+	Log *zap.Logger
+
+	lock       sync.Mutex
+	config     Config
+	stallUntil time.Time
+	rand       *rand.Rand
+}
+
+// NewInjector creates an injector with no faults configured.
+func NewInjector() *Injector {
+	return &Injector{
+		Log:  zap.NewNop(),
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Set replaces the fault configuration. Does not affect a running slot stall.
+func (f *Injector) Set(config Config) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.config = config
+	f.Log.Warn("Fault injection configured",
+		zap.Float64("drop_send_rate", config.DropSendRate),
+		zap.Duration("send_delay", config.SendDelay),
+		zap.Float64("read_429_rate", config.ReadLimitRate))
+}
+
+// StallSlots discards slot updates for the given duration.
+func (f *Injector) StallSlots(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.stallUntil = time.Now().Add(d)
+	f.Log.Warn("Stalling slot stream", zap.Duration("duration", d))
+}
+
+// Clear removes all faults.
+func (f *Injector) Clear() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.config = Config{}
+	f.stallUntil = time.Time{}
+	f.Log.Warn("Fault injection cleared")
+}
+
+// State returns the current fault configuration.
+func (f *Injector) State() State {
+	if f == nil {
+		return State{}
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	state := State{Config: f.config}
+	if time.Now().Before(f.stallUntil) {
+		state.StallUntil = f.stallUntil
+	}
+	return state
+}
+
+// ShouldDropSend reports whether an outgoing transaction should be discarded.
+func (f *Injector) ShouldDropSend() bool {
+	if f == nil {
+		return false
+	}
+	f.lock.Lock()
+	drop := f.chance(f.config.DropSendRate)
+	f.lock.Unlock()
+	if drop {
+		f.fired(DropSend)
+	}
+	return drop
+}
+
+// DelaySend blocks for the configured send delay.
+// Returns early with the context error if the context is cancelled.
+func (f *Injector) DelaySend(ctx context.Context) error {
+	if f == nil {
+		return nil
+	}
+	f.lock.Lock()
+	delay := f.config.SendDelay
+	f.lock.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	f.fired(DelaySend, zap.Duration("delay", delay))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// ShouldStallSlot reports whether a slot update should be discarded.
+func (f *Injector) ShouldStallSlot(slot uint64) bool {
+	if f == nil {
+		return false
+	}
+	f.lock.Lock()
+	stall := time.Now().Before(f.stallUntil)
+	f.lock.Unlock()
+	if stall {
+		f.fired(StallSlot, zap.Uint64("slot", slot))
+	}
+	return stall
+}
+
+// ShouldLimitRead reports whether a read RPC request should fail with 429.
+func (f *Injector) ShouldLimitRead() bool {
+	if f == nil {
+		return false
+	}
+	f.lock.Lock()
+	limit := f.chance(f.config.ReadLimitRate)
+	f.lock.Unlock()
+	if limit {
+		f.fired(ReadLimit)
+	}
+	return limit
+}
+
+// chance returns true with the given probability. Must be called with the lock held.
+func (f *Injector) chance(p float64) bool {
+	return p > 0 && f.rand.Float64() < p
+}
+
+func (f *Injector) fired(fault string, fields ...zap.Field) {
+	metricFaultsInjected.WithLabelValues(fault).Inc()
+	f.Log.Warn("Injected fault", append([]zap.Field{zap.String("fault", fault)}, fields...)...)
+}
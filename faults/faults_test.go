@@ -0,0 +1,54 @@
+package faults
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInjector_Nil(t *testing.T) {
+	var f *Injector
+	assert.False(t, f.ShouldDropSend())
+	assert.False(t, f.ShouldStallSlot(1))
+	assert.False(t, f.ShouldLimitRead())
+	assert.NoError(t, f.DelaySend(context.Background()))
+	assert.Equal(t, State{}, f.State())
+}
+
+func TestInjector(t *testing.T) {
+	f := NewInjector()
+	assert.False(t, f.ShouldDropSend())
+	assert.False(t, f.ShouldLimitRead())
+
+	drops := testutil.ToFloat64(metricFaultsInjected.WithLabelValues(DropSend))
+	reads := testutil.ToFloat64(metricFaultsInjected.WithLabelValues(ReadLimit))
+	stalls := testutil.ToFloat64(metricFaultsInjected.WithLabelValues(StallSlot))
+
+	f.Set(Config{DropSendRate: 1, ReadLimitRate: 1, SendDelay: 10 * time.Millisecond})
+	assert.True(t, f.ShouldDropSend())
+	assert.True(t, f.ShouldLimitRead())
+	start := time.Now()
+	assert.NoError(t, f.DelaySend(context.Background()))
+	assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f.Set(Config{SendDelay: time.Hour})
+	assert.ErrorIs(t, f.DelaySend(ctx), context.Canceled)
+
+	f.StallSlots(time.Hour)
+	assert.True(t, f.ShouldStallSlot(1))
+	assert.False(t, f.State().StallUntil.IsZero())
+
+	f.Clear()
+	assert.False(t, f.ShouldStallSlot(2))
+	assert.False(t, f.ShouldDropSend())
+	assert.Equal(t, State{}, f.State())
+
+	assert.Equal(t, drops+1, testutil.ToFloat64(metricFaultsInjected.WithLabelValues(DropSend)))
+	assert.Equal(t, reads+1, testutil.ToFloat64(metricFaultsInjected.WithLabelValues(ReadLimit)))
+	assert.Equal(t, stalls+1, testutil.ToFloat64(metricFaultsInjected.WithLabelValues(StallSlot)))
+}
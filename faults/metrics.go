@@ -0,0 +1,12 @@
+package faults
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var metricFaultsInjected = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "pythian",
+	Name:      "faults_injected_total",
+	Help:      "Number of injected faults",
+}, []string{"fault"})
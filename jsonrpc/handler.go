@@ -20,6 +20,11 @@ type Requester interface {
 	AsyncRequestJSONRPC(ctx context.Context, method string, params interface{}) error
 }
 
+// HandleRequests executes requests and returns the encoded responses.
+//
+// Each request in a batch is handled independently, so the response array
+// may contain a mix of results and errors. Notifications produce no response.
+// Returns nil if there is nothing to respond with.
 func HandleRequests(ctx context.Context, h Handler, callback Requester, reqs []Request, isBatch bool) ([]byte, error) {
 	resps := make([]Response, 0, len(reqs))
 	for _, req := range reqs {
@@ -30,6 +35,9 @@ func HandleRequests(ctx context.Context, h Handler, callback Requester, reqs []R
 	}
 
 	if isBatch {
+		if len(resps) == 0 {
+			return nil, nil // batch of notifications
+		}
 		return json.Marshal(resps)
 	}
 	if len(resps) > 0 {
@@ -0,0 +1,117 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleRequests_BatchPartialFailure(t *testing.T) {
+	mux := NewMux()
+	mux.HandleFunc("hello", func(_ context.Context, req Request, _ Requester) *Response {
+		return NewResultResponse(req.ID, "world")
+	})
+
+	reqs, isBatch, err := ParseRequest([]byte(`[
+		{"jsonrpc":"2.0","id":1,"method":"hello"},
+		{"jsonrpc":"2.0","id":2,"method":"missing"},
+		{"jsonrpc":"2.0","method":"missing"}
+	]`))
+	require.NoError(t, err)
+	require.True(t, isBatch)
+
+	data, err := HandleRequests(context.Background(), mux, nil, reqs, isBatch)
+	require.NoError(t, err)
+
+	var resps []map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &resps))
+	require.Len(t, resps, 2)
+
+	assert.JSONEq(t, `1`, string(resps[0]["id"]))
+	assert.JSONEq(t, `"world"`, string(resps[0]["result"]))
+	assert.NotContains(t, resps[0], "error")
+
+	assert.JSONEq(t, `2`, string(resps[1]["id"]))
+	assert.JSONEq(t, `{"code":-32601,"message":"Method not found"}`, string(resps[1]["error"]))
+	assert.NotContains(t, resps[1], "result")
+}
+
+func TestHandleRequests_BatchNotifications(t *testing.T) {
+	reqs, isBatch, err := ParseRequest([]byte(`[{"jsonrpc":"2.0","method":"missing"}]`))
+	require.NoError(t, err)
+	data, err := HandleRequests(context.Background(), NewMux(), nil, reqs, isBatch)
+	require.NoError(t, err)
+	assert.Nil(t, data)
+}
+
+func TestMux_ParamsLimit(t *testing.T) {
+	mux := NewMux()
+	mux.DefaultParamsLimit = 16
+	mux.SetParamsLimit("big", 64)
+	mux.SetParamsLimit("unlimited", 0)
+	for _, method := range []string{"small", "big", "unlimited"} {
+		mux.HandleFunc(method, func(_ context.Context, req Request, _ Requester) *Response {
+			return NewResultResponse(req.ID, true)
+		})
+	}
+
+	serve := func(method string, size int) *Response {
+		var req Request
+		params := `["` + strings.Repeat("x", size-4) + `"]`
+		require.NoError(t, json.Unmarshal([]byte(`{"jsonrpc":"2.0","id":1,"method":"`+method+`","params":`+params+`}`), &req))
+		require.Equal(t, size, req.ParamsSize())
+		return mux.ServeJSONRPC(context.Background(), req, nil)
+	}
+
+	assert.Nil(t, serve("small", 16).Error)
+	if resp := serve("small", 17); assert.NotNil(t, resp.Error) {
+		assert.Equal(t, ErrCodeRequestTooLarge, resp.Error.Code)
+	}
+	assert.Nil(t, serve("big", 64).Error)
+	assert.NotNil(t, serve("big", 65).Error)
+	assert.Nil(t, serve("unlimited", 4096).Error)
+}
+
+func TestMux_Timeout(t *testing.T) {
+	mux := NewMux()
+	mux.Timeout = 50 * time.Millisecond
+	cancelled := make(chan struct{})
+	mux.HandleFunc("slow", func(ctx context.Context, req Request, _ Requester) *Response {
+		<-ctx.Done()
+		close(cancelled)
+		time.Sleep(time.Second) // ignores cancellation
+		return NewResultResponse(req.ID, true)
+	})
+	mux.HandleFunc("fast", func(_ context.Context, req Request, _ Requester) *Response {
+		return NewResultResponse(req.ID, true)
+	})
+	mux.HandleFunc("cancellable", func(ctx context.Context, req Request, _ Requester) *Response {
+		<-ctx.Done()
+		return NewErrorResponse(req.ID, Error{Code: 1, Message: ctx.Err().Error()})
+	})
+
+	assert.Nil(t, mux.ServeJSONRPC(context.Background(), Request{ID: 1, Method: "fast"}, nil).Error)
+
+	start := time.Now()
+	resp := mux.ServeJSONRPC(context.Background(), Request{ID: 2, Method: "slow"}, nil)
+	assert.Less(t, time.Since(start), time.Second)
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, ErrCodeRequestTimeout, resp.Error.Code)
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("handler context not cancelled")
+	}
+
+	// Cancellation by the caller is left to the handler.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	resp = mux.ServeJSONRPC(ctx, Request{ID: 3, Method: "cancellable"}, nil)
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, 1, resp.Error.Code)
+}
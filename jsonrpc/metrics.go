@@ -24,4 +24,46 @@ var (
 		Name:      "websocket_conns",
 		Help:      "Number of active WebSocket conns to Pythian",
 	})
+	metricWSConnsRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "rpc",
+		Name:      "websocket_conns_rejected_total",
+		Help:      "Number of WebSocket conns rejected due to the conn limit",
+	})
+	metricWSConnsIdleClosed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "rpc",
+		Name:      "websocket_conns_idle_closed_total",
+		Help:      "Number of WebSocket conns closed due to inactivity",
+	})
+	metricWSQueueOverflows = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "rpc",
+		Name:      "websocket_queue_overflows_total",
+		Help:      "Number of notifications dropped due to a full outbound queue",
+	})
+	metricWSConnsSlowClosed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "rpc",
+		Name:      "websocket_conns_slow_closed_total",
+		Help:      "Number of WebSocket conns closed due to repeated outbound queue overflows",
+	})
+	metricRequestsTooLarge = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "rpc",
+		Name:      "requests_too_large_total",
+		Help:      "Number of requests rejected for exceeding a size limit",
+	}, []string{"method"})
+	metricRequestTimeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "rpc",
+		Name:      "request_timeouts_total",
+		Help:      "Number of requests aborted for exceeding the handler timeout",
+	}, []string{"method"})
+	metricResponsesTooLarge = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "rpc",
+		Name:      "responses_too_large_total",
+		Help:      "Number of responses and notifications withheld for exceeding the size limit",
+	}, []string{"method"})
 )
@@ -1,13 +1,42 @@
 package jsonrpc
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the OpenTelemetry tracer of this package.
+const instrumentationName = "go.blockdaemon.com/pythian/jsonrpc"
 
 type Mux struct {
 	handlers map[string]Handler
+
+	// TracerProvider creates a span for each request.
+	// Nil uses the global provider, which is a no-op unless configured.
+	TracerProvider trace.TracerProvider
+
+	// Timeout is the max duration of a handler call. 0 for unlimited.
+	// Handlers exceeding it are answered with ErrCodeRequestTimeout,
+	// and their context is cancelled.
+	Timeout time.Duration
+
+	// DefaultParamsLimit is the max encoded size of params of methods without a specific limit.
+	// 0 for unlimited.
+	DefaultParamsLimit int
+	paramsLimits       map[string]int
 }
 
 func NewMux() *Mux {
-	return &Mux{handlers: make(map[string]Handler)}
+	return &Mux{
+		handlers:     make(map[string]Handler),
+		paramsLimits: make(map[string]int),
+	}
 }
 
 func (m *Mux) Handle(method string, sub Handler) {
@@ -18,11 +47,87 @@ func (m *Mux) HandleFunc(method string, f HandleFunc) {
 	m.handlers[method] = f
 }
 
+// SetParamsLimit sets the max encoded size of params of a method,
+// overriding DefaultParamsLimit. 0 for unlimited.
+func (m *Mux) SetParamsLimit(method string, limit int) {
+	m.paramsLimits[method] = limit
+}
+
 func (m *Mux) ServeJSONRPC(ctx context.Context, req Request, callback Requester) *Response {
 	handler := m.handlers[req.Method]
 	if handler == nil {
 		return NewMethodNotFoundResponse(req.ID)
 	}
 	metricRequests.WithLabelValues(req.Method).Inc()
-	return handler.ServeJSONRPC(ctx, req, callback)
+
+	ctx, span := m.tracer().Start(ctx, req.Method, trace.WithAttributes(
+		attribute.String("rpc.system", "jsonrpc"),
+		attribute.String("rpc.method", req.Method),
+	))
+	defer span.End()
+	resp := m.serve(ctx, handler, req, callback)
+	if resp != nil && resp.Error != nil {
+		span.SetAttributes(attribute.Int("rpc.jsonrpc.error_code", resp.Error.Code))
+		span.SetStatus(codes.Error, resp.Error.Message)
+	}
+	return resp
+}
+
+func (m *Mux) tracer() trace.Tracer {
+	provider := m.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(instrumentationName)
+}
+
+// serve applies params limits and the timeout, and executes a request.
+func (m *Mux) serve(ctx context.Context, handler Handler, req Request, callback Requester) *Response {
+
+	// Reject oversized params before the handler decodes them.
+	limit, ok := m.paramsLimits[req.Method]
+	if !ok {
+		limit = m.DefaultParamsLimit
+	}
+	if limit > 0 && req.ParamsSize() > limit {
+		metricRequestsTooLarge.WithLabelValues(req.Method).Inc()
+		return NewErrorResponse(req.ID, Error{
+			Code:    ErrCodeRequestTooLarge,
+			Message: "Params too large",
+			Data:    fmt.Sprintf("params of %d bytes exceed limit of %d bytes", req.ParamsSize(), limit),
+		})
+	}
+
+	if m.Timeout <= 0 {
+		return handler.ServeJSONRPC(ctx, req, callback)
+	}
+	return m.serveWithTimeout(ctx, handler, req, callback)
+}
+
+// serveWithTimeout executes a request, giving up after the timeout.
+//
+// The handler keeps running in the background until it observes the cancelled context.
+// If the parent context ends first, the handler's response is awaited,
+// since it is responsible for handling its own cancellation.
+func (m *Mux) serveWithTimeout(ctx context.Context, handler Handler, req Request, callback Requester) *Response {
+	timeoutCtx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+	done := make(chan *Response, 1)
+	go func() {
+		done <- handler.ServeJSONRPC(timeoutCtx, req, callback)
+	}()
+	select {
+	case resp := <-done:
+		return resp
+	case <-timeoutCtx.Done():
+	}
+	if ctx.Err() != nil {
+		return <-done
+	}
+	metricRequestTimeouts.WithLabelValues(req.Method).Inc()
+	return NewErrorResponse(req.ID, Error{
+		Code:    ErrCodeRequestTimeout,
+		Message: "Request timeout",
+		Data:    fmt.Sprintf("handler did not complete within %s", m.Timeout),
+	})
 }
@@ -3,11 +3,15 @@ package jsonrpc
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -16,11 +20,28 @@ import (
 )
 
 type Server struct {
-	Log            *zap.Logger
-	Upgrader       websocket.Upgrader
-	Handler        Handler
-	ReadTimeout    time.Duration // max time client can spend between creating a request and finish uploading it
-	MaxRequestSize uint
+	Log             *zap.Logger
+	Upgrader        websocket.Upgrader
+	Handler         Handler
+	ReadTimeout     time.Duration // max time client can spend between creating a request and finish uploading it
+	MaxRequestSize  uint          // max inbound message size, larger requests are rejected
+	MaxResponseSize int           // max outbound message size, 0 for unlimited
+	MaxConns        int           // max concurrent WebSocket conns, 0 for unlimited
+	IdleTimeout     time.Duration // close WebSocket conns without requests or subscriptions, 0 to disable
+	WriteTimeout    time.Duration // max time to write a single WebSocket message
+
+	// Tracing logs the start and end of each request with a correlation ID,
+	// taken from CorrelationIDHeader or generated. Handlers read it with CorrelationID.
+	Tracing bool
+
+	// Outbound messages are queued per connection.
+	// Notifications that don't fit into the queue are dropped.
+	// Clients overflowing their queue too often within the window are disconnected.
+	OutQueueSize        int
+	MaxQueueOverflows   int
+	QueueOverflowWindow time.Duration
+
+	conns int64
 }
 
 func NewServer(h Handler) *Server {
@@ -29,9 +50,15 @@ func NewServer(h Handler) *Server {
 		Upgrader: websocket.Upgrader{
 			HandshakeTimeout: 5 * time.Second,
 		},
-		Handler:        h,
-		ReadTimeout:    3 * time.Second,
-		MaxRequestSize: 128000,
+		Handler:         h,
+		ReadTimeout:     3 * time.Second,
+		MaxRequestSize:  128000,
+		MaxResponseSize: 64 << 20,
+		WriteTimeout:    10 * time.Second,
+
+		OutQueueSize:        256,
+		MaxQueueOverflows:   3,
+		QueueOverflowWindow: time.Minute,
 	}
 }
 
@@ -52,18 +79,27 @@ func (s *Server) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 }
 
 func (s *Server) ServePOST(rw http.ResponseWriter, req *http.Request) {
-	// Read request.
-	data, err := io.ReadAll(io.LimitReader(req.Body, int64(s.MaxRequestSize)))
+	// Reject bodies declared too large without reading them.
+	if req.ContentLength > int64(s.MaxRequestSize) {
+		s.writeRequestTooLarge(rw)
+		return
+	}
+	// Read request, bounded in case the body is chunked.
+	data, err := io.ReadAll(io.LimitReader(req.Body, int64(s.MaxRequestSize)+1))
 	if err != nil {
 		return
 	}
+	if len(data) > int(s.MaxRequestSize) {
+		s.writeRequestTooLarge(rw)
+		return
+	}
 	reqs, isBatch, err := ParseRequest(data)
 	if err != nil {
 		http.Error(rw, "Bad request", http.StatusBadRequest)
 		return
 	}
 	// Execute requests.
-	respData, err := HandleRequests(req.Context(), s.Handler, nil, reqs, isBatch)
+	respData, err := s.handleRequests(s.traceContext(req), s.getLog(req), nil, reqs, isBatch)
 	if err != nil {
 		s.Log.Error("Failed to marshal results", zap.Error(err))
 		http.Error(rw, "internal server error", http.StatusInternalServerError)
@@ -74,12 +110,135 @@ func (s *Server) ServePOST(rw http.ResponseWriter, req *http.Request) {
 	_, _ = rw.Write(respData)
 }
 
+func (s *Server) writeRequestTooLarge(rw http.ResponseWriter) {
+	metricRequestsTooLarge.WithLabelValues(methodUnknown).Inc()
+	buf, _ := json.Marshal(newRequestTooLargeResponse(s.MaxRequestSize))
+	rw.Header().Set("content-type", "application/json; charset=utf-8")
+	rw.Header().Set("connection", "close")
+	rw.WriteHeader(http.StatusRequestEntityTooLarge)
+	_, _ = rw.Write(buf)
+}
+
 func (s *Server) ServeWebSocket(rw http.ResponseWriter, req *http.Request) {
+	release, ok := s.acquireConn(rw, req)
+	if !ok {
+		return
+	}
+	defer release()
+
 	conn, err := s.Upgrader.Upgrade(rw, req, http.Header{})
 	if err != nil {
 		return
 	}
-	newServerConn(conn, s.getLog(req), s).run(req.Context())
+	newServerConn(conn, s.getLog(req), s).run(s.traceContext(req))
+}
+
+// acquireConn counts a long-lived connection towards MaxConns.
+// If the limit is reached, it responds with an error and returns false.
+func (s *Server) acquireConn(rw http.ResponseWriter, req *http.Request) (release func(), ok bool) {
+	conns := atomic.AddInt64(&s.conns, 1)
+	release = func() { atomic.AddInt64(&s.conns, -1) }
+	if s.MaxConns > 0 && conns > int64(s.MaxConns) {
+		release()
+		metricWSConnsRejected.Inc()
+		s.getLog(req).Warn("Rejecting WebSocket conn, too many conns", zap.Int("max_conns", s.MaxConns))
+		http.Error(rw, "Too many connections", http.StatusServiceUnavailable)
+		return nil, false
+	}
+	return release, true
+}
+
+// Stream wraps an HTTP handler serving a long-lived stream, e.g. Server-Sent Events.
+//
+// Streams are subject to the same origin check as WebSocket handshakes,
+// and count towards MaxConns along with WebSocket connections.
+func (s *Server) Stream(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !s.checkOrigin(req) {
+			http.Error(rw, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+		release, ok := s.acquireConn(rw, req)
+		if !ok {
+			return
+		}
+		defer release()
+		h.ServeHTTP(rw, req)
+	})
+}
+
+// checkOrigin applies the Upgrader's origin policy to a plain HTTP request.
+// Like the Upgrader, it only allows same-origin requests if CheckOrigin is nil.
+func (s *Server) checkOrigin(req *http.Request) bool {
+	if s.Upgrader.CheckOrigin != nil {
+		return s.Upgrader.CheckOrigin(req)
+	}
+	origin := req.Header.Get("origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, req.Host)
+}
+
+// Conns returns the number of open WebSocket connections and streams.
+func (s *Server) Conns() int {
+	return int(atomic.LoadInt64(&s.conns))
+}
+
+// handleRequests is like HandleRequests, but withholds responses exceeding MaxResponseSize.
+func (s *Server) handleRequests(ctx context.Context, log *zap.Logger, callback Requester, reqs []Request, isBatch bool) ([]byte, error) {
+	resps := make([]json.RawMessage, 0, len(reqs))
+	for _, req := range reqs {
+		resp := s.serve(ctx, log, req, callback)
+		if resp == nil {
+			continue
+		}
+		buf, err := json.Marshal(resp)
+		if err != nil {
+			return nil, err
+		}
+		if s.MaxResponseSize > 0 && len(buf) > s.MaxResponseSize {
+			log.Error("Response too large",
+				zap.String("method", req.Method),
+				zap.Int("size", len(buf)),
+				zap.Int("max_size", s.MaxResponseSize))
+			metricResponsesTooLarge.WithLabelValues(req.Method).Inc()
+			buf, err = json.Marshal(NewErrorResponse(req.ID, Error{
+				Code:    ErrCodeResponseTooLarge,
+				Message: "Response too large",
+			}))
+			if err != nil {
+				return nil, err
+			}
+		}
+		resps = append(resps, buf)
+	}
+
+	if isBatch {
+		if len(resps) == 0 {
+			return nil, nil // batch of notifications
+		}
+		return json.Marshal(resps)
+	}
+	if len(resps) > 0 {
+		return resps[0], nil
+	}
+	return nil, nil
+}
+
+// methodUnknown labels size violations detected before parsing the request.
+const methodUnknown = "unknown"
+
+func newRequestTooLargeResponse(limit uint) *Response {
+	return NewErrorResponse(Null, Error{
+		Code:    ErrCodeRequestTooLarge,
+		Message: "Request too large",
+		Data:    fmt.Sprintf("request exceeds limit of %d bytes", limit),
+	})
 }
 
 func (s *Server) getLog(req *http.Request) *zap.Logger {
@@ -95,15 +254,24 @@ type serverConn struct {
 	outLock sync.RWMutex
 	out     chan *websocket.PreparedMessage
 	onClose chan struct{}
+
+	lastActivity int64 // unix nanos of last request
+	holds        int32 // number of active subscriptions
+
+	overflowLock sync.Mutex
+	overflows    []time.Time
+	closeOnce    sync.Once
 }
 
 func newServerConn(conn *websocket.Conn, log *zap.Logger, server *Server) *serverConn {
 	return &serverConn{
 		conn:    conn,
-		out:     make(chan *websocket.PreparedMessage),
+		out:     make(chan *websocket.PreparedMessage, server.OutQueueSize),
 		log:     log,
 		server:  server,
 		onClose: make(chan struct{}),
+
+		lastActivity: time.Now().UnixNano(),
 	}
 }
 
@@ -125,23 +293,75 @@ func (h *serverConn) run(ctx context.Context) {
 		<-ctx.Done()
 		return nil
 	})
+	if h.server.IdleTimeout > 0 {
+		group.Go(func() error {
+			return h.idleLoop(ctx)
+		})
+	}
 	_ = group.Wait()
 }
 
+// idleLoop closes the connection once it has been idle for longer than the idle timeout.
+func (h *serverConn) idleLoop(ctx context.Context) error {
+	timeout := h.server.IdleTimeout
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if atomic.LoadInt32(&h.holds) > 0 {
+			continue
+		}
+		idle := time.Since(time.Unix(0, atomic.LoadInt64(&h.lastActivity)))
+		if idle < timeout {
+			continue
+		}
+		h.log.Info("Closing idle WebSocket conn", zap.Duration("idle", idle))
+		metricWSConnsIdleClosed.Inc()
+		h.closeWithReason(websocket.CloseGoingAway, "idle timeout")
+		return errIdleTimeout
+	}
+}
+
+var errIdleTimeout = errors.New("idle timeout")
+
+// KeepActive exempts the connection behind the given requester from the idle timeout
+// until the returned release func is called. Subscriptions hold their connection active.
+func KeepActive(r Requester) (release func()) {
+	conn, ok := r.(*serverConn)
+	if !ok {
+		return func() {}
+	}
+	atomic.AddInt32(&conn.holds, 1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			atomic.AddInt32(&conn.holds, -1)
+			atomic.StoreInt64(&conn.lastActivity, time.Now().UnixNano())
+		})
+	}
+}
+
 func (h *serverConn) readLoop(ctx context.Context) error {
 	defer h.close()
+	// Oversized messages fail the read and close the connection with a "message too big" close frame.
+	h.conn.SetReadLimit(int64(h.server.MaxRequestSize))
 	for {
 		// Read and parse request.
 		_, rd, err := h.conn.NextReader()
 		if err != nil {
-			return err
+			return h.checkReadErr(err)
 		}
 		_ = h.conn.SetReadDeadline(time.Now().Add(h.server.ReadTimeout))
-		data, err := io.ReadAll(io.LimitReader(rd, int64(h.server.MaxRequestSize)))
+		data, err := io.ReadAll(rd)
 		if err != nil {
-			return err
+			return h.checkReadErr(err)
 		}
 		_ = h.conn.SetReadDeadline(time.Time{}) // no limit
+		atomic.StoreInt64(&h.lastActivity, time.Now().UnixNano())
 
 		reqs, isBatch, err := ParseRequest(data)
 		if err != nil {
@@ -149,7 +369,7 @@ func (h *serverConn) readLoop(ctx context.Context) error {
 			continue
 		}
 		// Execute requests.
-		respData, err := HandleRequests(ctx, h.server.Handler, h, reqs, isBatch)
+		respData, err := h.server.handleRequests(ctx, h.log, h, reqs, isBatch)
 		if err != nil {
 			return fmt.Errorf("failed to marshal results: %w", err) // irrecoverable error
 		}
@@ -159,6 +379,16 @@ func (h *serverConn) readLoop(ctx context.Context) error {
 	}
 }
 
+// checkReadErr accounts for messages exceeding the size limit.
+func (h *serverConn) checkReadErr(err error) error {
+	if errors.Is(err, websocket.ErrReadLimit) {
+		h.log.Warn("Closing WebSocket conn, request too large",
+			zap.Uint("max_size", h.server.MaxRequestSize))
+		metricRequestsTooLarge.WithLabelValues(methodUnknown).Inc()
+	}
+	return err
+}
+
 func (h *serverConn) writeMessage(ctx context.Context, data interface{}) {
 	buf, err := json.Marshal(data)
 	if err != nil {
@@ -187,6 +417,7 @@ func (h *serverConn) writeLoop(ctx context.Context) error {
 			if !ok {
 				return nil
 			}
+			_ = h.conn.SetWriteDeadline(time.Now().Add(h.server.WriteTimeout))
 			if err := h.conn.WritePreparedMessage(msg); err != nil {
 				return err
 			}
@@ -198,6 +429,34 @@ func (h *serverConn) close() {
 	_ = h.conn.Close()
 }
 
+// closeWithReason sends a close frame and closes the connection.
+//
+// Control frames bypass the outbound queue, so this works even if the client stopped reading.
+func (h *serverConn) closeWithReason(code int, reason string) {
+	h.closeOnce.Do(func() {
+		_ = h.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(code, reason),
+			time.Now().Add(time.Second))
+		h.close()
+	})
+}
+
+// overflow records a queue overflow and reports whether the client exceeded the overflow limit.
+func (h *serverConn) overflow() bool {
+	h.overflowLock.Lock()
+	defer h.overflowLock.Unlock()
+	now := time.Now()
+	cutoff := now.Add(-h.server.QueueOverflowWindow)
+	recent := h.overflows[:0]
+	for _, t := range h.overflows {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	h.overflows = append(recent, now)
+	return len(h.overflows) >= h.server.MaxQueueOverflows
+}
+
 func (h *serverConn) dropOut() {
 	out := h.out
 	h.outLock.Lock()
@@ -208,7 +467,8 @@ func (h *serverConn) dropOut() {
 
 // AsyncRequestJSONRPC sends a JSON-RPC notification from server to client.
 //
-// Returns net.ErrClosed if the underlying connection has been closed already.
+// Returns net.ErrClosed if the underlying connection has been closed already,
+// or ErrSlowConsumer if the notification was dropped because the outbound queue is full.
 func (h *serverConn) AsyncRequestJSONRPC(ctx context.Context, method string, params interface{}) error {
 	// Encode request to JSON.
 	req := Request{
@@ -221,6 +481,14 @@ func (h *serverConn) AsyncRequestJSONRPC(ctx context.Context, method string, par
 	if err != nil {
 		return fmt.Errorf("failed to marshal request params: %w", err)
 	}
+	if max := h.server.MaxResponseSize; max > 0 && len(buf) > max {
+		h.log.Error("Notification too large",
+			zap.String("method", method),
+			zap.Int("size", len(buf)),
+			zap.Int("max_size", max))
+		metricResponsesTooLarge.WithLabelValues(method).Inc()
+		return ErrMessageTooLarge
+	}
 
 	// Create new WebSocket message.
 	msg, err := websocket.NewPreparedMessage(websocket.TextMessage, buf)
@@ -230,7 +498,7 @@ func (h *serverConn) AsyncRequestJSONRPC(ctx context.Context, method string, par
 
 	metricCallbacks.WithLabelValues(method).Inc()
 
-	// Blocking send to writer thread.
+	// Non-blocking send to writer thread.
 	h.outLock.RLock()
 	defer h.outLock.RUnlock()
 	select {
@@ -240,9 +508,26 @@ func (h *serverConn) AsyncRequestJSONRPC(ctx context.Context, method string, par
 		return ctx.Err()
 	case h.out <- msg:
 		return nil
+	default:
+	}
+
+	metricWSQueueOverflows.Inc()
+	if h.overflow() {
+		h.log.Warn("Disconnecting slow WebSocket client",
+			zap.Int("overflows", h.server.MaxQueueOverflows),
+			zap.Duration("window", h.server.QueueOverflowWindow))
+		metricWSConnsSlowClosed.Inc()
+		h.closeWithReason(websocket.ClosePolicyViolation, "slow consumer: outbound queue overflowed")
 	}
+	return ErrSlowConsumer
 }
 
+// ErrMessageTooLarge is returned when a notification exceeds the max response size.
+var ErrMessageTooLarge = errors.New("message too large")
+
+// ErrSlowConsumer is returned when a notification is dropped because the client is not reading fast enough.
+var ErrSlowConsumer = errors.New("outbound queue full")
+
 func (h *serverConn) Done() <-chan struct{} {
 	return h.onClose
 }
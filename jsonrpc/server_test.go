@@ -0,0 +1,231 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newTestServer(t *testing.T, h Handler) (*Server, string) {
+	s := NewServer(h)
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestServer_MaxConns(t *testing.T) {
+	s, url := newTestServer(t, HandleFunc(func(context.Context, Request, Requester) *Response {
+		return nil
+	}))
+	s.MaxConns = 1
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, res, err := websocket.DefaultDialer.Dial(url, nil)
+	require.Error(t, err)
+	require.NotNil(t, res)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+
+	// Slot frees up after disconnect.
+	require.NoError(t, conn.Close())
+	require.Eventually(t, func() bool {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			return false
+		}
+		_ = conn.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestServer_IdleTimeout(t *testing.T) {
+	s, url := newTestServer(t, HandleFunc(func(_ context.Context, req Request, callback Requester) *Response {
+		if req.Method == "subscribe" {
+			_ = KeepActive(callback)
+		}
+		return NewResultResponse(req.ID, true)
+	}))
+	s.IdleTimeout = 100 * time.Millisecond
+
+	t.Run("Idle", func(t *testing.T) {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, _, err = conn.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "unexpected error: %v", err)
+	})
+
+	t.Run("Subscribed", func(t *testing.T) {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		require.NoError(t, conn.WriteJSON(Request{Version: Version, ID: 1, Method: "subscribe"}))
+		_, _, err = conn.ReadMessage()
+		require.NoError(t, err)
+
+		// No close frame arrives while the subscription is held.
+		_ = conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		_, _, err = conn.ReadMessage()
+		var netErr interface{ Timeout() bool }
+		require.ErrorAs(t, err, &netErr)
+		assert.True(t, netErr.Timeout())
+	})
+}
+
+func TestServer_SlowConsumer(t *testing.T) {
+	dropped := make(chan struct{}, 1)
+	done := make(chan (<-chan struct{}), 1)
+	s, url := newTestServer(t, HandleFunc(func(_ context.Context, req Request, callback Requester) *Response {
+		done <- callback.Done()
+		go func() {
+			payload := strings.Repeat("x", 64*1024)
+			for {
+				err := callback.AsyncRequestJSONRPC(context.Background(), "notify", payload)
+				if err == ErrSlowConsumer {
+					select {
+					case dropped <- struct{}{}:
+					default:
+					}
+				} else if err != nil {
+					return
+				}
+			}
+		}()
+		return NewResultResponse(req.ID, true)
+	}))
+	s.OutQueueSize = 1
+	s.MaxQueueOverflows = 3
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Subscribe, then stop reading.
+	require.NoError(t, conn.WriteJSON(Request{Version: Version, ID: 1, Method: "subscribe"}))
+	connDone := <-done
+	select {
+	case <-connDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow consumer not disconnected")
+	}
+	select {
+	case <-dropped:
+	default:
+		t.Fatal("no notifications dropped")
+	}
+}
+
+func TestServer_MaxRequestSize(t *testing.T) {
+	s, url := newTestServer(t, HandleFunc(func(_ context.Context, req Request, _ Requester) *Response {
+		return NewResultResponse(req.ID, true)
+	}))
+	s.MaxRequestSize = 1024
+
+	t.Run("WebSocket", func(t *testing.T) {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		require.NoError(t, conn.WriteJSON(Request{Version: Version, ID: 1, Method: "hello", Params: strings.Repeat("x", 2048)}))
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, _, err = conn.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseMessageTooBig), "unexpected error: %v", err)
+	})
+
+	body := `{"jsonrpc":"2.0","id":1,"method":"hello","params":["` + strings.Repeat("x", 2048) + `"]}`
+	post := func(t *testing.T, body io.Reader) {
+		res, err := http.Post("http"+strings.TrimPrefix(url, "ws"), "application/json", body)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+
+		var resp Response
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&resp))
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, ErrCodeRequestTooLarge, resp.Error.Code)
+	}
+
+	t.Run("POST", func(t *testing.T) {
+		post(t, strings.NewReader(body))
+	})
+
+	t.Run("POSTChunked", func(t *testing.T) {
+		// Unknown length, the body is sent chunked.
+		post(t, io.MultiReader(strings.NewReader(body)))
+	})
+}
+
+func TestServer_MaxResponseSize(t *testing.T) {
+	notifyErr := make(chan error, 1)
+	s, url := newTestServer(t, HandleFunc(func(_ context.Context, req Request, callback Requester) *Response {
+		if req.Method == "subscribe" {
+			notifyErr <- callback.AsyncRequestJSONRPC(context.Background(), "notify", strings.Repeat("x", 2048))
+		}
+		return NewResultResponse(req.ID, strings.Repeat("x", 2048))
+	}))
+	s.MaxResponseSize = 1024
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.WriteJSON(Request{Version: Version, ID: 1, Method: "subscribe"}))
+	var resp Response
+	require.NoError(t, conn.ReadJSON(&resp))
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, ErrCodeResponseTooLarge, resp.Error.Code)
+	assert.Equal(t, ErrMessageTooLarge, <-notifyErr)
+}
+
+func TestServer_Tracing(t *testing.T) {
+	ids := make(chan string, 2)
+	s, url := newTestServer(t, HandleFunc(func(ctx context.Context, req Request, _ Requester) *Response {
+		ids <- CorrelationID(ctx)
+		return NewResultResponse(req.ID, true)
+	}))
+	core, logs := observer.New(zap.InfoLevel)
+	s.Log = zap.New(core)
+	s.Tracing = true
+
+	post := func(header string) {
+		req, err := http.NewRequest(http.MethodPost, "http"+strings.TrimPrefix(url, "ws"),
+			strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"test"}`))
+		require.NoError(t, err)
+		if header != "" {
+			req.Header.Set(CorrelationIDHeader, header)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+	}
+
+	post("abc")
+	assert.Equal(t, "abc", <-ids)
+	entries := logs.FilterField(zap.String("correlation_id", "abc")).All()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "Request started", entries[0].Message)
+	assert.Equal(t, "Request finished", entries[1].Message)
+	assert.Contains(t, entries[1].ContextMap(), "duration")
+
+	// Generated if not sent by the client.
+	post("")
+	generated := <-ids
+	assert.Len(t, generated, 16)
+	assert.Len(t, logs.FilterField(zap.String("correlation_id", generated)).All(), 2)
+}
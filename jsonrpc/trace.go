@@ -0,0 +1,75 @@
+package jsonrpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.uber.org/zap"
+)
+
+// CorrelationIDHeader optionally carries the correlation ID of requests
+// if tracing is enabled. Otherwise, each request is assigned a random ID.
+const CorrelationIDHeader = "X-Correlation-ID"
+
+// maxCorrelationIDLen bounds client-provided correlation IDs.
+const maxCorrelationIDLen = 128
+
+type correlationIDKey struct{}
+
+// WithCorrelationID returns a context carrying the given correlation ID.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationID returns the correlation ID of a request context.
+// Empty if tracing is disabled.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+func newCorrelationID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// traceContext attaches the correlation ID sent by the client, if any,
+// and the OpenTelemetry trace context propagated in the request headers.
+func (s *Server) traceContext(req *http.Request) context.Context {
+	ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+	if !s.Tracing {
+		return ctx
+	}
+	if id := req.Header.Get(CorrelationIDHeader); id != "" && len(id) <= maxCorrelationIDLen {
+		ctx = WithCorrelationID(ctx, id)
+	}
+	return ctx
+}
+
+// serve executes a request, logging entry and exit with the correlation ID if tracing is enabled.
+func (s *Server) serve(ctx context.Context, log *zap.Logger, req Request, callback Requester) *Response {
+	if !s.Tracing {
+		return s.Handler.ServeJSONRPC(ctx, req, callback)
+	}
+	id := CorrelationID(ctx)
+	if id == "" {
+		id = newCorrelationID()
+		ctx = WithCorrelationID(ctx, id)
+	}
+	log = log.With(zap.String("correlation_id", id), zap.String("method", req.Method))
+	log.Info("Request started")
+	start := time.Now()
+	resp := s.Handler.ServeJSONRPC(ctx, req, callback)
+	fields := []zap.Field{zap.Duration("duration", time.Since(start))}
+	if resp != nil && resp.Error != nil {
+		fields = append(fields, zap.Int("error_code", resp.Error.Code))
+	}
+	log.Info("Request finished", fields...)
+	return resp
+}
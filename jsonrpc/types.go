@@ -3,6 +3,7 @@ package jsonrpc
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 )
 
 type Request struct {
@@ -10,6 +11,32 @@ type Request struct {
 	ID      interface{} `json:"id,omitempty"`
 	Method  string      `json:"method,omitempty"`
 	Params  interface{} `json:"params,omitempty"`
+
+	paramsSize int // encoded size of params, if parsed
+}
+
+// UnmarshalJSON decodes a request and remembers the encoded size of its params.
+func (r *Request) UnmarshalJSON(data []byte) error {
+	type request Request // no methods, avoids recursion
+	var raw struct {
+		request
+		Params json.RawMessage `json:"params,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*r = Request(raw.request)
+	r.Params = nil
+	r.paramsSize = len(raw.Params)
+	if len(raw.Params) > 0 {
+		return json.Unmarshal(raw.Params, &r.Params)
+	}
+	return nil
+}
+
+// ParamsSize returns the encoded size of the params of a parsed request.
+func (r *Request) ParamsSize() int {
+	return r.paramsSize
 }
 
 type Response struct {
@@ -19,12 +46,52 @@ type Response struct {
 	Error   *Error          `json:"error,omitempty"`
 }
 
+// ResultAppender is implemented by results that encode themselves.
+//
+// Large results implement it to skip reflection and the validation
+// encoding/json applies to the output of json.Marshaler.
+type ResultAppender interface {
+	// AppendJSON appends the compact JSON encoding of the result to buf.
+	AppendJSON(buf []byte) []byte
+}
+
+// MarshalJSON omits the result member from error responses, as required by JSON-RPC 2.0.
+func (r Response) MarshalJSON() ([]byte, error) {
+	if result, ok := r.Result.(ResultAppender); ok && r.Error == nil {
+		version, err := json.Marshal(r.Version)
+		if err != nil {
+			return nil, err
+		}
+		buf := append([]byte(`{"jsonrpc":`), version...)
+		if len(r.ID) > 0 {
+			buf = append(buf, `,"id":`...)
+			buf = append(buf, r.ID...)
+		}
+		buf = append(buf, `,"result":`...)
+		buf = result.AppendJSON(buf)
+		return append(buf, '}'), nil
+	}
+	if r.Error == nil {
+		type response Response // no methods, avoids recursion
+		return json.Marshal(response(r))
+	}
+	return json.Marshal(&struct {
+		Version string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id,omitempty"`
+		Error   *Error          `json:"error"`
+	}{r.Version, r.ID, r.Error})
+}
+
 type Error struct {
 	Code    int         `json:"code"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
 }
 
+func (e *Error) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
 var Null = json.RawMessage("null")
 
 const Version = "2.0"
@@ -33,6 +100,10 @@ const (
 	ErrCodeParse          = -32700
 	ErrCodeMethodNotFound = -32601
 	ErrCodeInvalidParams  = -32601
+
+	ErrCodeRequestTimeout   = -32003
+	ErrCodeRequestTooLarge  = -32005
+	ErrCodeResponseTooLarge = -32006
 )
 
 func NewResultResponse(id interface{}, result interface{}) *Response {
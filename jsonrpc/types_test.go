@@ -1,9 +1,12 @@
 package jsonrpc
 
 import (
+	"encoding/json"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestIsBatch(t *testing.T) {
@@ -38,3 +41,29 @@ func TestIsBatch(t *testing.T) {
 		assert.Equal(t, tc.isBatch, IsBatch([]byte(tc.data)))
 	}
 }
+
+type appendedResult []int
+
+func (r appendedResult) AppendJSON(buf []byte) []byte {
+	buf = append(buf, '[')
+	for i, v := range r {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendInt(buf, int64(v), 10)
+	}
+	return append(buf, ']')
+}
+
+func TestResponse_ResultAppender(t *testing.T) {
+	for _, id := range []interface{}{1, "abc"} {
+		got, err := json.Marshal(NewResultResponse(id, appendedResult{1, 2, 3}))
+		require.NoError(t, err)
+		want, err := json.Marshal(NewResultResponse(id, []int{1, 2, 3}))
+		require.NoError(t, err)
+		assert.Equal(t, string(want), string(got))
+	}
+	got, err := json.Marshal(Response{Version: Version, Result: appendedResult{1}})
+	require.NoError(t, err)
+	assert.Equal(t, `{"jsonrpc":"2.0","result":[1]}`, string(got))
+}
@@ -0,0 +1,140 @@
+// Package lifecycle turns OS signals and admin requests into shutdown, reload, and dump events.
+//
+// Platforms deliver different signals, see the signals_*.go files.
+// All sources trigger the same Controller methods, so the shutdown sequence
+// runs identically regardless of how it was requested.
+package lifecycle
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Controller dispatches shutdown and reload requests.
+type Controller struct {
+	Log *zap.Logger
+
+	shutdownOnce sync.Once
+	shutdown     chan struct{}
+
+	lock    sync.Mutex
+	reloads []func()
+	dumps   []func()
+}
+
+// NewController creates a controller that has not been shut down.
+func NewController() *Controller {
+	return &Controller{
+		Log:      zap.NewNop(),
+		shutdown: make(chan struct{}),
+	}
+}
+
+// Shutdown requests a graceful shutdown. Repeated calls are no-ops.
+func (c *Controller) Shutdown(source string) {
+	c.shutdownOnce.Do(func() {
+		c.Log.Info("Shutdown requested", zap.String("source", source))
+		close(c.shutdown)
+	})
+}
+
+// Done is closed when shutdown is requested.
+func (c *Controller) Done() <-chan struct{} {
+	return c.shutdown
+}
+
+// Context returns a context cancelled when shutdown is requested.
+func (c *Controller) Context(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-c.shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// OnReload registers a function to run on reload requests.
+func (c *Controller) OnReload(fn func()) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.reloads = append(c.reloads, fn)
+}
+
+// Reload runs the reload functions in order of registration.
+// Reloads are ignored after shutdown was requested.
+func (c *Controller) Reload(source string) {
+	select {
+	case <-c.shutdown:
+		c.Log.Info("Ignoring reload during shutdown", zap.String("source", source))
+		return
+	default:
+	}
+	c.Log.Info("Reload requested", zap.String("source", source))
+	c.lock.Lock()
+	reloads := append([]func(){}, c.reloads...)
+	c.lock.Unlock()
+	for _, fn := range reloads {
+		fn()
+	}
+}
+
+// OnDump registers a function to run on state dump requests.
+func (c *Controller) OnDump(fn func()) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.dumps = append(c.dumps, fn)
+}
+
+// Dump runs the dump functions in order of registration.
+func (c *Controller) Dump(source string) {
+	c.Log.Info("State dump requested", zap.String("source", source))
+	c.lock.Lock()
+	dumps := append([]func(){}, c.dumps...)
+	c.lock.Unlock()
+	for _, fn := range dumps {
+		fn()
+	}
+}
+
+// Listen handles the platform's lifecycle signals until the context is cancelled.
+func (c *Controller) Listen(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	var all []os.Signal
+	all = append(all, shutdownSignals...)
+	all = append(all, reloadSignals...)
+	all = append(all, dumpSignals...)
+	signal.Notify(signals, all...)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			c.handleSignal(sig)
+		}
+	}
+}
+
+func (c *Controller) handleSignal(sig os.Signal) {
+	source := "signal " + sig.String()
+	for _, reload := range reloadSignals {
+		if sig == reload {
+			c.Reload(source)
+			return
+		}
+	}
+	for _, dump := range dumpSignals {
+		if sig == dump {
+			c.Dump(source)
+			return
+		}
+	}
+	c.Shutdown(source)
+}
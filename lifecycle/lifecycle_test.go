@@ -0,0 +1,72 @@
+package lifecycle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestController_Shutdown(t *testing.T) {
+	c := NewController()
+	ctx, cancel := c.Context(context.Background())
+	defer cancel()
+
+	select {
+	case <-c.Done():
+		t.Fatal("shut down early")
+	default:
+	}
+
+	c.Shutdown("test")
+	c.Shutdown("test") // no-op
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context not cancelled")
+	}
+	<-c.Done()
+}
+
+func TestController_Reload(t *testing.T) {
+	c := NewController()
+	var calls []int
+	c.OnReload(func() { calls = append(calls, 1) })
+	c.OnReload(func() { calls = append(calls, 2) })
+
+	c.Reload("test")
+	assert.Equal(t, []int{1, 2}, calls)
+
+	c.Shutdown("test")
+	c.Reload("test")
+	assert.Equal(t, []int{1, 2}, calls, "reloaded during shutdown")
+}
+
+func TestController_Signals(t *testing.T) {
+	c := NewController()
+	reloads, dumps := 0, 0
+	c.OnReload(func() { reloads++ })
+	c.OnDump(func() { dumps++ })
+
+	for _, sig := range reloadSignals {
+		c.handleSignal(sig)
+	}
+	assert.Equal(t, len(reloadSignals), reloads)
+	for _, sig := range dumpSignals {
+		c.handleSignal(sig)
+	}
+	assert.Equal(t, len(dumpSignals), dumps)
+	assert.Equal(t, len(reloadSignals), reloads)
+
+	require.NotEmpty(t, shutdownSignals)
+	for _, sig := range shutdownSignals {
+		c.handleSignal(sig)
+	}
+	select {
+	case <-c.Done():
+	default:
+		t.Fatal("signal did not shut down")
+	}
+}
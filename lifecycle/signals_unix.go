@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package lifecycle
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	shutdownSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	reloadSignals   = []os.Signal{syscall.SIGHUP}
+	dumpSignals     = []os.Signal{syscall.SIGUSR1}
+)
@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package lifecycle
+
+import (
+	"os"
+	"syscall"
+)
+
+// The Go runtime delivers Ctrl-C and Ctrl-Break as os.Interrupt,
+// and CTRL_CLOSE_EVENT, CTRL_LOGOFF_EVENT, and CTRL_SHUTDOWN_EVENT as SIGTERM.
+// Windows has no reload or dump signals, use the "reload" and "dump_state" admin methods instead.
+var (
+	shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	reloadSignals   []os.Signal
+	dumpSignals     []os.Signal
+)
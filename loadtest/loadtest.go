@@ -0,0 +1,194 @@
+// Package loadtest generates synthetic price update load against a pythian instance.
+//
+// The server does not accept batched updates, so load consists of
+// concurrent update_price calls over a single client connection.
+package loadtest
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"go.blockdaemon.com/pythian/client"
+	"go.uber.org/zap"
+)
+
+// tickInterval is how often the timer-driven dispatcher issues requests.
+const tickInterval = 10 * time.Millisecond
+
+// Config configures a load test.
+type Config struct {
+	// Accounts are the price accounts to update.
+	Accounts []solana.PublicKey
+	// Rate is the number of updates per second at full load.
+	// Ignored if Sched is set.
+	Rate float64
+	// Profile shapes the rate over the test duration.
+	Profile  Profile
+	Duration time.Duration
+	// Workers is the number of concurrent requests.
+	Workers int
+	// Sched sends an update for each price_sched notification
+	// instead of following Rate and Profile.
+	Sched bool
+	// RequestTimeout bounds each request. Defaults to DefaultRequestTimeout.
+	RequestTimeout time.Duration
+}
+
+// DefaultRequestTimeout is the default value of Config.RequestTimeout.
+const DefaultRequestTimeout = 10 * time.Second
+
+// Runner executes a load test.
+type Runner struct {
+	Log    *zap.Logger
+	Client *client.Client
+	Config Config
+
+	rand *rand.Rand // only used by the dispatcher
+}
+
+// NewRunner creates a load test against a connected client.
+func NewRunner(c *client.Client, config Config) *Runner {
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	if config.RequestTimeout <= 0 {
+		config.RequestTimeout = DefaultRequestTimeout
+	}
+	if config.Profile == "" {
+		config.Profile = ProfileConstant
+	}
+	return &Runner{
+		Log:    zap.NewNop(),
+		Client: c,
+		Config: config,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// update is a price update to send.
+type update struct {
+	account solana.PublicKey
+	price   int64
+	conf    uint64
+}
+
+// Run sends load until the configured duration passes or the context is cancelled.
+//
+// Requests in flight at the end of the test are awaited and included in the report.
+func (r *Runner) Run(ctx context.Context) (*Report, error) {
+	dispatchCtx, cancel := context.WithTimeout(ctx, r.Config.Duration)
+	defer cancel()
+	rec := newRecorder()
+	jobs := make(chan update, r.Config.Workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < r.Config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.work(ctx, jobs, rec)
+		}()
+	}
+
+	start := time.Now()
+	var err error
+	if r.Config.Sched {
+		err = r.dispatchSched(dispatchCtx, jobs, rec)
+	} else {
+		r.dispatchTimer(dispatchCtx, start, jobs, rec)
+	}
+	close(jobs)
+	wg.Wait()
+	return rec.report(time.Since(start)), err
+}
+
+func (r *Runner) work(ctx context.Context, jobs <-chan update, rec *recorder) {
+	for job := range jobs {
+		if ctx.Err() != nil {
+			continue // aborted
+		}
+		reqCtx, cancel := context.WithTimeout(ctx, r.Config.RequestTimeout)
+		start := time.Now()
+		err := r.Client.UpdatePrice(reqCtx, job.account, job.price, job.conf, "trading")
+		cancel()
+		if ctx.Err() != nil {
+			continue
+		}
+		if err != nil {
+			r.Log.Debug("Request failed", zap.Stringer("account", job.account), zap.Error(err))
+		}
+		rec.request(time.Since(start), err)
+	}
+}
+
+// enqueue hands an update to a worker, or counts it as skipped if all are busy.
+func (r *Runner) enqueue(jobs chan<- update, rec *recorder, account solana.PublicKey) {
+	job := update{
+		account: account,
+		price:   100_000 + r.rand.Int63n(1_000),
+		conf:    1 + uint64(r.rand.Int63n(10)),
+	}
+	select {
+	case jobs <- job:
+	default:
+		rec.skip()
+	}
+}
+
+// dispatchTimer issues updates at the profile's rate, cycling through accounts.
+func (r *Runner) dispatchTimer(ctx context.Context, start time.Time, jobs chan<- update, rec *recorder) {
+	if len(r.Config.Accounts) == 0 || r.Config.Rate <= 0 {
+		<-ctx.Done()
+		return
+	}
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	var due float64
+	next := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			rate := r.Config.Rate * r.Config.Profile.Multiplier(now.Sub(start), r.Config.Duration)
+			due += rate * tickInterval.Seconds()
+			for ; due >= 1; due-- {
+				r.enqueue(jobs, rec, r.Config.Accounts[next])
+				next = (next + 1) % len(r.Config.Accounts)
+			}
+		}
+	}
+}
+
+// dispatchSched issues an update for each price_sched notification.
+func (r *Runner) dispatchSched(ctx context.Context, jobs chan<- update, rec *recorder) error {
+	ticks := make(chan solana.PublicKey)
+	for _, account := range r.Config.Accounts {
+		sub, err := r.Client.SubscribePriceSched(ctx, account)
+		if err != nil {
+			return err
+		}
+		defer sub.Unsubscribe()
+		go func(account solana.PublicKey) {
+			for range sub.C {
+				select {
+				case ticks <- account:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(account)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case account := <-ticks:
+			rec.notification()
+			r.enqueue(jobs, rec, account)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package loadtest
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pythian/client"
+	"go.blockdaemon.com/pythian/jsonrpc"
+)
+
+// newTestClient connects to an in-process server rejecting updates of the rejected account.
+func newTestClient(t *testing.T, rejected solana.PublicKey) *client.Client {
+	var subNonce uint64
+	mux := jsonrpc.NewMux()
+	mux.HandleFunc("update_price", func(_ context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+		params := req.Params.(map[string]interface{})
+		if params["account"] == rejected.String() {
+			return jsonrpc.NewInvalidParamsResponse(req.ID)
+		}
+		return jsonrpc.NewResultResponse(req.ID, 0)
+	})
+	mux.HandleFunc("subscribe_price_sched", func(_ context.Context, req jsonrpc.Request, callback jsonrpc.Requester) *jsonrpc.Response {
+		subID := atomic.AddUint64(&subNonce, 1)
+		go func() {
+			ticker := time.NewTicker(10 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-callback.Done():
+					return
+				case <-ticker.C:
+					_ = callback.AsyncRequestJSONRPC(context.Background(), "notify_price_sched", map[string]interface{}{
+						"subscription": subID,
+					})
+				}
+			}
+		}()
+		return jsonrpc.NewResultResponse(req.ID, map[string]interface{}{"subscription": subID})
+	})
+	server := httptest.NewServer(jsonrpc.NewServer(mux))
+	t.Cleanup(server.Close)
+
+	c := client.New("ws" + strings.TrimPrefix(server.URL, "http"))
+	require.NoError(t, c.Connect(context.Background()))
+	t.Cleanup(c.Close)
+	return c
+}
+
+func TestRunner_Timer(t *testing.T) {
+	good, bad := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	r := NewRunner(newTestClient(t, bad), Config{
+		Accounts: []solana.PublicKey{good, bad},
+		Rate:     200,
+		Duration: 500 * time.Millisecond,
+		Workers:  4,
+	})
+	report, err := r.Run(context.Background())
+	require.NoError(t, err)
+
+	assert.InDelta(t, 100, report.Requests+report.Skipped, 30)
+	assert.InDelta(t, report.Requests/2, report.Errors[jsonrpc.ErrCodeInvalidParams], 2)
+	assert.Len(t, report.Errors, 1)
+	assert.Positive(t, report.P50)
+	assert.LessOrEqual(t, report.P50, report.P99)
+	assert.LessOrEqual(t, report.P99, report.Max)
+
+	assert.Empty(t, report.Check(Thresholds{MaxErrorRate: 0.6, MaxP99: time.Minute}))
+	assert.Len(t, report.Check(Thresholds{MaxErrorRate: 0.1, MaxP99: time.Nanosecond}), 2)
+}
+
+func TestRunner_Sched(t *testing.T) {
+	account := solana.NewWallet().PublicKey()
+	r := NewRunner(newTestClient(t, solana.PublicKey{}), Config{
+		Accounts: []solana.PublicKey{account},
+		Duration: 300 * time.Millisecond,
+		Workers:  2,
+		Sched:    true,
+	})
+	report, err := r.Run(context.Background())
+	require.NoError(t, err)
+
+	assert.Greater(t, report.Notifications, 5)
+	assert.InDelta(t, report.Notifications, report.Requests+report.Skipped, 2)
+	assert.Zero(t, report.ErrorCount())
+}
+
+func TestProfile_Multiplier(t *testing.T) {
+	const d = 100 * time.Second
+	for _, tc := range []struct {
+		profile Profile
+		elapsed time.Duration
+		want    float64
+	}{
+		{ProfileConstant, 0, 1},
+		{ProfileConstant, 99 * time.Second, 1},
+		{ProfileStep, 0, 0.25},
+		{ProfileStep, 30 * time.Second, 0.5},
+		{ProfileStep, 99 * time.Second, 1},
+		{ProfileStep, 120 * time.Second, 1},
+		{ProfileSpike, 10 * time.Second, 1},
+		{ProfileSpike, 50 * time.Second, spikeFactor},
+		{ProfileSpike, 60 * time.Second, 1},
+	} {
+		assert.Equal(t, tc.want, tc.profile.Multiplier(tc.elapsed, d), "%s at %s", tc.profile, tc.elapsed)
+	}
+}
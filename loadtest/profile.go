@@ -0,0 +1,57 @@
+package loadtest
+
+import (
+	"fmt"
+	"time"
+)
+
+// Profile shapes the request rate over the course of a load test.
+type Profile string
+
+const (
+	ProfileConstant Profile = "constant" // full rate throughout
+	ProfileStep     Profile = "step"     // ramps up to full rate in equal steps
+	ProfileSpike    Profile = "spike"    // full rate, with a burst in the middle
+)
+
+// Profile parameters.
+const (
+	stepCount   = 4   // number of steps of ProfileStep
+	spikeFactor = 5   // rate multiplier during the spike
+	spikeShare  = 0.1 // share of the duration spent in the spike
+)
+
+// ParseProfile parses a profile name.
+func ParseProfile(name string) (Profile, error) {
+	profile := Profile(name)
+	switch profile {
+	case ProfileConstant, ProfileStep, ProfileSpike:
+		return profile, nil
+	default:
+		return "", fmt.Errorf("unknown load profile %q", name)
+	}
+}
+
+// Multiplier returns the share of the configured rate to apply
+// at the given time into a test of the given duration.
+func (p Profile) Multiplier(elapsed, duration time.Duration) float64 {
+	if duration <= 0 {
+		return 1
+	}
+	progress := float64(elapsed) / float64(duration)
+	switch p {
+	case ProfileStep:
+		step := int(progress*stepCount) + 1
+		if step > stepCount {
+			step = stepCount
+		}
+		return float64(step) / stepCount
+	case ProfileSpike:
+		if progress >= 0.5-spikeShare/2 && progress < 0.5+spikeShare/2 {
+			return spikeFactor
+		}
+		return 1
+	default:
+		return 1
+	}
+}
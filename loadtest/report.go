@@ -0,0 +1,165 @@
+package loadtest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"go.blockdaemon.com/pythian/jsonrpc"
+)
+
+// codeTransport counts failed requests without a JSON-RPC error code,
+// e.g. disconnects and timeouts.
+const codeTransport = 0
+
+// Report summarizes a load test.
+type Report struct {
+	Duration      time.Duration
+	Requests      int
+	Errors        map[int]int // JSON-RPC error code => count, 0 for transport errors
+	Skipped       int         // requests not sent because all workers were busy
+	Notifications int         // price_sched notifications received
+	P50, P90, P99 time.Duration
+	Max           time.Duration
+}
+
+// ErrorCount returns the total number of failed requests.
+func (r *Report) ErrorCount() int {
+	n := 0
+	for _, count := range r.Errors {
+		n += count
+	}
+	return n
+}
+
+// ErrorRate returns the share of failed requests.
+func (r *Report) ErrorRate() float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	return float64(r.ErrorCount()) / float64(r.Requests)
+}
+
+// Thresholds fail a load test. Zero values are not checked.
+type Thresholds struct {
+	MaxP99       time.Duration
+	MaxErrorRate float64
+}
+
+// Check returns the violated thresholds.
+func (r *Report) Check(t Thresholds) []string {
+	var violations []string
+	if t.MaxP99 > 0 && r.P99 > t.MaxP99 {
+		violations = append(violations, fmt.Sprintf("p99 latency %s exceeds %s", r.P99, t.MaxP99))
+	}
+	if t.MaxErrorRate > 0 && r.ErrorRate() > t.MaxErrorRate {
+		violations = append(violations, fmt.Sprintf("error rate %.2f%% exceeds %.2f%%", r.ErrorRate()*100, t.MaxErrorRate*100))
+	}
+	return violations
+}
+
+// Print writes a human-readable summary.
+func (r *Report) Print(w io.Writer) {
+	rate := 0.0
+	if r.Duration > 0 {
+		rate = float64(r.Requests) / r.Duration.Seconds()
+	}
+	fmt.Fprintf(w, "Duration:      %s\n", r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(w, "Requests:      %d (%.1f/s)\n", r.Requests, rate)
+	fmt.Fprintf(w, "Skipped:       %d\n", r.Skipped)
+	fmt.Fprintf(w, "Notifications: %d\n", r.Notifications)
+	fmt.Fprintf(w, "Latency:       p50=%s p90=%s p99=%s max=%s\n", r.P50, r.P90, r.P99, r.Max)
+	fmt.Fprintf(w, "Errors:        %d (%.2f%%)\n", r.ErrorCount(), r.ErrorRate()*100)
+	codes := make([]int, 0, len(r.Errors))
+	for code := range r.Errors {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		name := fmt.Sprintf("code %d", code)
+		if code == codeTransport {
+			name = "transport"
+		}
+		fmt.Fprintf(w, "  %-12s %d\n", name+":", r.Errors[code])
+	}
+}
+
+// recorder collects request outcomes from concurrent workers.
+type recorder struct {
+	lock          sync.Mutex
+	latencies     []time.Duration
+	errors        map[int]int
+	skipped       int
+	notifications int
+}
+
+func newRecorder() *recorder {
+	return &recorder{errors: make(map[int]int)}
+}
+
+func (r *recorder) request(latency time.Duration, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.latencies = append(r.latencies, latency)
+	if err == nil {
+		return
+	}
+	var rpcErr *jsonrpc.Error
+	if errors.As(err, &rpcErr) {
+		r.errors[rpcErr.Code]++
+	} else {
+		r.errors[codeTransport]++
+	}
+}
+
+func (r *recorder) skip() {
+	r.lock.Lock()
+	r.skipped++
+	r.lock.Unlock()
+}
+
+func (r *recorder) notification() {
+	r.lock.Lock()
+	r.notifications++
+	r.lock.Unlock()
+}
+
+func (r *recorder) report(duration time.Duration) *Report {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	report := &Report{
+		Duration:      duration,
+		Requests:      len(r.latencies),
+		Errors:        make(map[int]int, len(r.errors)),
+		Skipped:       r.skipped,
+		Notifications: r.notifications,
+	}
+	for code, count := range r.errors {
+		report.Errors[code] = count
+	}
+	if len(r.latencies) == 0 {
+		return report
+	}
+	sorted := append([]time.Duration(nil), r.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	report.P50 = percentile(sorted, 0.5)
+	report.P90 = percentile(sorted, 0.9)
+	report.P99 = percentile(sorted, 0.99)
+	report.Max = sorted[len(sorted)-1]
+	return report
+}
+
+// percentile returns the nearest-rank percentile of sorted values.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	i := int(q*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
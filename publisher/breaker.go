@@ -0,0 +1,273 @@
+package publisher
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/schedule"
+	"go.uber.org/zap"
+)
+
+// ErrBreakerTripped is returned when a price update is rejected by the rate-of-change breaker.
+var ErrBreakerTripped = errors.New("price rate-of-change breaker tripped")
+
+// BreakerError rejects a price update while the breaker of its price account is tripped.
+// It matches ErrBreakerTripped with errors.Is.
+type BreakerError struct {
+	Until      time.Time     // end of the cooldown
+	RetryAfter time.Duration // remaining cooldown
+}
+
+func (e *BreakerError) Error() string {
+	return ErrBreakerTripped.Error()
+}
+
+func (e *BreakerError) Unwrap() error {
+	return ErrBreakerTripped
+}
+
+// BreakerRule limits how fast the published price of matching accounts may move.
+type BreakerRule struct {
+	// Pattern is matched against the product symbol, or the price account
+	// address if the symbol is unknown. "*" matches any sequence of characters.
+	Pattern string
+	// MaxChange is the maximum relative price move (0.05 = 5%) within Window.
+	MaxChange float64
+	Window    time.Duration
+	// Cooldown is the duration updates are rejected for after tripping.
+	Cooldown time.Duration
+
+	re *regexp.Regexp
+}
+
+// ParseBreakerRule parses a rule in the format "PATTERN=PERCENT,WINDOW,COOLDOWN",
+// for example "Crypto.*=5,10s,1m".
+func ParseBreakerRule(str string) (BreakerRule, error) {
+	eq := strings.LastIndexByte(str, '=')
+	if eq < 0 {
+		return BreakerRule{}, fmt.Errorf("invalid breaker rule %q: missing '='", str)
+	}
+	params := strings.Split(str[eq+1:], ",")
+	if len(params) != 3 {
+		return BreakerRule{}, fmt.Errorf("invalid breaker rule %q: expected PERCENT,WINDOW,COOLDOWN", str)
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(params[0], "%"), 64)
+	if err != nil || percent <= 0 {
+		return BreakerRule{}, fmt.Errorf("invalid breaker rule %q: bad percentage", str)
+	}
+	window, err := time.ParseDuration(params[1])
+	if err != nil {
+		return BreakerRule{}, fmt.Errorf("invalid breaker rule %q: bad window: %w", str, err)
+	}
+	cooldown, err := time.ParseDuration(params[2])
+	if err != nil {
+		return BreakerRule{}, fmt.Errorf("invalid breaker rule %q: bad cooldown: %w", str, err)
+	}
+	return BreakerRule{
+		Pattern:   str[:eq],
+		MaxChange: percent / 100,
+		Window:    window,
+		Cooldown:  cooldown,
+	}, nil
+}
+
+func (r *BreakerRule) compile() {
+	parts := strings.Split(r.Pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	r.re = regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+// TrippedBreaker describes a price account whose updates are currently rejected.
+type TrippedBreaker struct {
+	Account solana.PublicKey
+	Symbol  string
+	Reason  string
+	Until   time.Time
+}
+
+// breaker rejects price updates that move too quickly.
+//
+// Updates are compared with the latest price that landed on chain,
+// so that accepted updates that were dropped or never sent do not count.
+type breaker struct {
+	log   *zap.Logger
+	rules []BreakerRule
+	now   func() time.Time
+
+	lock    sync.Mutex
+	symbols map[solana.PublicKey]string
+	states  map[solana.PublicKey]*breakerState
+}
+
+type breakerState struct {
+	lastPrice    int64 // latest published price, 0 if none
+	lastPubSlot  uint64
+	lastTime     time.Time // when lastPrice was published
+	trippedUntil time.Time
+	reason       string
+}
+
+// err returns the error rejecting updates during the cooldown.
+func (s *breakerState) err(now time.Time) error {
+	return &BreakerError{Until: s.trippedUntil, RetryAfter: s.trippedUntil.Sub(now)}
+}
+
+func newBreaker(log *zap.Logger, rules []BreakerRule) *breaker {
+	compiled := make([]BreakerRule, len(rules))
+	for i, rule := range rules {
+		rule.compile()
+		compiled[i] = rule
+	}
+	return &breaker{
+		log:     log,
+		rules:   compiled,
+		now:     time.Now,
+		symbols: make(map[solana.PublicKey]string),
+		states:  make(map[solana.PublicKey]*breakerState),
+	}
+}
+
+func (b *breaker) setSymbols(symbols map[solana.PublicKey]string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.symbols = symbols
+}
+
+// rule returns the first rule matching the account. Must hold lock.
+func (b *breaker) rule(account solana.PublicKey) *BreakerRule {
+	name, ok := b.symbols[account]
+	if !ok {
+		name = account.String()
+	}
+	for i := range b.rules {
+		if b.rules[i].re.MatchString(name) {
+			return &b.rules[i]
+		}
+	}
+	return nil
+}
+
+// check returns an error if the price moved too far from the published price.
+// An override resets the breaker and the published price.
+func (b *breaker) check(account solana.PublicKey, price int64, override bool) error {
+	if len(b.rules) == 0 {
+		return nil
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	rule := b.rule(account)
+	if rule == nil {
+		return nil
+	}
+	now := b.now()
+	state, ok := b.states[account]
+	if !ok {
+		state = new(breakerState)
+		b.states[account] = state
+	}
+
+	if !override {
+		if now.Before(state.trippedUntil) {
+			return state.err(now)
+		}
+		if state.lastPrice != 0 && now.Sub(state.lastTime) <= rule.Window {
+			change := relativeChange(state.lastPrice, price)
+			if change > rule.MaxChange {
+				state.trippedUntil = now.Add(rule.Cooldown)
+				state.reason = fmt.Sprintf("price moved %.2f%% from %d to %d within %s (limit %.2f%%)",
+					change*100, state.lastPrice, price, now.Sub(state.lastTime), rule.MaxChange*100)
+				b.log.Error("Price breaker tripped, rejecting updates",
+					zap.Stringer("price", account),
+					zap.String("symbol", b.symbols[account]),
+					zap.String("rule", rule.Pattern),
+					zap.String("reason", state.reason),
+					zap.Time("until", state.trippedUntil))
+				metricBreakerTrips.Inc()
+				return state.err(now)
+			}
+		}
+	} else {
+		if now.Before(state.trippedUntil) {
+			b.log.Warn("Price breaker overridden", zap.Stringer("price", account))
+		}
+		// Updates are not held against the old price until the override lands.
+		state.lastPrice = 0
+	}
+
+	state.trippedUntil = time.Time{}
+	state.reason = ""
+	return nil
+}
+
+// published records the prices of a transaction that landed as the published prices.
+func (b *breaker) published(event schedule.PricePublished) {
+	if len(b.rules) == 0 || event.Status != schedule.ConfirmLanded || event.Preliminary {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := b.now()
+	for _, update := range event.Updates {
+		if update.Status != pyth.PriceStatusTrading || b.rule(update.Price) == nil {
+			continue
+		}
+		state, ok := b.states[update.Price]
+		if !ok {
+			state = new(breakerState)
+			b.states[update.Price] = state
+		}
+		// Transactions may land out of order.
+		if update.PubSlot < state.lastPubSlot {
+			continue
+		}
+		state.lastPrice = update.Value
+		state.lastPubSlot = update.PubSlot
+		state.lastTime = now
+	}
+}
+
+// tripped lists the accounts with an active breaker.
+func (b *breaker) tripped() []TrippedBreaker {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := b.now()
+	var list []TrippedBreaker
+	for account, state := range b.states {
+		if now.Before(state.trippedUntil) {
+			list = append(list, TrippedBreaker{
+				Account: account,
+				Symbol:  b.symbols[account],
+				Reason:  state.reason,
+				Until:   state.trippedUntil,
+			})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Account.String() < list[j].Account.String()
+	})
+	return list
+}
+
+// relativeChange returns |b-a|/|a|.
+func relativeChange(a, b int64) float64 {
+	diff := float64(b) - float64(a)
+	if diff < 0 {
+		diff = -diff
+	}
+	base := float64(a)
+	if base < 0 {
+		base = -base
+	}
+	return diff / base
+}
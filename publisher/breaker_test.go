@@ -0,0 +1,172 @@
+package publisher
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/schedule"
+	"go.uber.org/zap"
+)
+
+func TestParseBreakerRule(t *testing.T) {
+	rule, err := ParseBreakerRule("Crypto.*/USD=5%,10s,1m")
+	require.NoError(t, err)
+	assert.Equal(t, "Crypto.*/USD", rule.Pattern)
+	assert.InDelta(t, 0.05, rule.MaxChange, 1e-9)
+	assert.Equal(t, 10*time.Second, rule.Window)
+	assert.Equal(t, time.Minute, rule.Cooldown)
+
+	for _, bad := range []string{"Crypto.*", "Crypto.*=5,10s", "Crypto.*=x,10s,1m", "Crypto.*=5,x,1m", "Crypto.*=-1,10s,1m"} {
+		_, err := ParseBreakerRule(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+// publishFunc returns a function reporting a price as landed to the breaker.
+func publishFunc(b *breaker) func(account solana.PublicKey, price int64) {
+	var slot uint64
+	return func(account solana.PublicKey, price int64) {
+		slot++
+		b.published(schedule.PricePublished{
+			Status:  schedule.ConfirmLanded,
+			Updates: []schedule.QueuedUpdate{{Price: account, PubSlot: slot, Value: price, Status: pyth.PriceStatusTrading}},
+		})
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	btc := solana.NewWallet().PublicKey()
+	eth := solana.NewWallet().PublicKey()
+	b := newBreaker(zap.NewNop(), []BreakerRule{
+		{Pattern: "Crypto.BTC/*", MaxChange: 0.05, Window: 10 * time.Second, Cooldown: time.Minute},
+	})
+	now := time.Unix(1000, 0)
+	b.now = func() time.Time { return now }
+	b.setSymbols(map[solana.PublicKey]string{
+		btc: "Crypto.BTC/USD",
+		eth: "Crypto.ETH/USD",
+	})
+	publish := publishFunc(b)
+
+	require.NoError(t, b.check(btc, 1000, false))
+	publish(btc, 1000)
+	require.NoError(t, b.check(btc, 1040, false))
+	publish(btc, 1040)
+
+	// Unmatched symbols are not limited.
+	require.NoError(t, b.check(eth, 1000, false))
+	publish(eth, 1000)
+	require.NoError(t, b.check(eth, 5000, false))
+
+	// Move of more than 5% trips the breaker.
+	now = now.Add(time.Second)
+	err := b.check(btc, 1200, false)
+	assert.ErrorIs(t, err, ErrBreakerTripped)
+	var breakerErr *BreakerError
+	require.ErrorAs(t, err, &breakerErr)
+	assert.Equal(t, time.Minute, breakerErr.RetryAfter)
+	assert.ErrorIs(t, b.check(btc, 1040, false), ErrBreakerTripped, "breaker reset without cool-down")
+	tripped := b.tripped()
+	require.Len(t, tripped, 1)
+	assert.Equal(t, btc, tripped[0].Account)
+	assert.Equal(t, "Crypto.BTC/USD", tripped[0].Symbol)
+
+	// Override resets the breaker, and updates are not held against
+	// the previous price until the override lands.
+	require.NoError(t, b.check(btc, 1200, true))
+	assert.Empty(t, b.tripped())
+	require.NoError(t, b.check(btc, 1210, false))
+	publish(btc, 1200)
+
+	// Cool-down passes.
+	assert.ErrorIs(t, b.check(btc, 2000, false), ErrBreakerTripped)
+	now = now.Add(time.Minute)
+	assert.Empty(t, b.tripped())
+	require.NoError(t, b.check(btc, 2000, false))
+	publish(btc, 2000)
+
+	// Large moves after the window are fine.
+	now = now.Add(11 * time.Second)
+	require.NoError(t, b.check(btc, 4000, false))
+}
+
+func TestBreaker_Published(t *testing.T) {
+	btc := solana.NewWallet().PublicKey()
+	b := newBreaker(zap.NewNop(), []BreakerRule{
+		{Pattern: "*", MaxChange: 0.05, Window: 10 * time.Second, Cooldown: time.Minute},
+	})
+	now := time.Unix(1000, 0)
+	b.now = func() time.Time { return now }
+	event := func(pubSlot uint64, price int64) schedule.PricePublished {
+		return schedule.PricePublished{
+			Status:  schedule.ConfirmLanded,
+			Updates: []schedule.QueuedUpdate{{Price: btc, PubSlot: pubSlot, Value: price, Status: pyth.PriceStatusTrading}},
+		}
+	}
+	b.published(event(100, 1000))
+
+	// An accepted update that is dropped and never lands does not become the baseline.
+	require.NoError(t, b.check(btc, 1040, false))
+	assert.ErrorIs(t, b.check(btc, 1090, false), ErrBreakerTripped)
+	require.NoError(t, b.check(btc, 1000, true))
+
+	// Neither do preliminary, failed, or expired transactions.
+	for _, ev := range []schedule.PricePublished{
+		{Status: schedule.ConfirmLanded, Preliminary: true},
+		{Status: schedule.ConfirmFailed},
+		{Status: schedule.ConfirmExpired},
+	} {
+		ev.Updates = event(101, 5000).Updates
+		b.published(ev)
+	}
+	b.published(event(101, 1000))
+	require.NoError(t, b.check(btc, 1040, false))
+
+	// A transaction landing out of order does not replace a newer price.
+	b.published(event(102, 1040))
+	b.published(event(101, 5000))
+	require.NoError(t, b.check(btc, 1080, false))
+}
+
+func TestPublisher_Breaker(t *testing.T) {
+	cluster := newMockSendCluster(t, 1000)
+	account := solana.NewWallet().PublicKey()
+	p := newTestPublisher(t, Options{RPCURL: cluster.URL, BreakerRules: []BreakerRule{
+		{Pattern: account.String(), MaxChange: 0.1, Window: time.Minute, Cooldown: time.Minute},
+	}})
+	p.confirmer.PollInterval = time.Millisecond
+	var landed int32
+	p.SubscribePublished(func(event schedule.PricePublished) {
+		if event.Status == schedule.ConfirmLanded {
+			atomic.AddInt32(&landed, 1)
+		}
+	})
+	slots := runSender(t, p)
+	push := func(price int64, pubSlot uint64, opts PushOptions) error {
+		opts.PubSlot = pubSlot
+		return p.PushPriceWithOpts(account, price, 1, pyth.PriceStatusTrading, opts)
+	}
+
+	// The first price is sent, but never lands.
+	require.NoError(t, push(100, 1000, PushOptions{}))
+	slots <- &ws.SlotsUpdatesResult{Slot: 1000}
+	require.Eventually(t, func() bool {
+		return len(cluster.sentTxs()) == 1
+	}, 5*time.Second, time.Millisecond)
+
+	cluster.setLands(true)
+	require.NoError(t, push(200, 1001, PushOptions{}))
+	slots <- &ws.SlotsUpdatesResult{Slot: 1001}
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&landed) > 0
+	}, 5*time.Second, time.Millisecond)
+
+	assert.ErrorIs(t, push(400, 1002, PushOptions{}), ErrBreakerTripped)
+	assert.NoError(t, push(400, 1002, PushOptions{Override: true}))
+}
@@ -0,0 +1,249 @@
+package publisher
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gorilla/websocket"
+	"go.blockdaemon.com/pyth"
+)
+
+// CheckOptions configures Publisher.Check.
+type CheckOptions struct {
+	// MinBalance is the minimum publisher balance in lamports. 0 skips the check.
+	MinBalance uint64
+	// SlotTimeout is how long to wait for a slot update.
+	SlotTimeout time.Duration
+	// SimulatePrice is a price account to simulate an update for.
+	// The update has unknown status and zero price, i.e. it is a no-op. Zero skips the simulation.
+	SimulatePrice solana.PublicKey
+}
+
+// CheckResult is the outcome of a single startup check.
+type CheckResult struct {
+	Name    string
+	Detail  string // what was verified, or why the check was skipped
+	Err     error  // nil if passed
+	Skipped bool
+}
+
+// Check validates the configuration against the cluster.
+//
+// Checks run in order with the pipeline components. Checks depending on a
+// failed check are skipped. The publisher must not be run after checking,
+// as the slot stream check consumes the slot monitor.
+func (p *Publisher) Check(ctx context.Context, opts CheckOptions) []CheckResult {
+	if opts.SlotTimeout <= 0 {
+		opts.SlotTimeout = 30 * time.Second
+	}
+	var results []CheckResult
+	run := func(name string, check func() (string, error)) bool {
+		detail, err := check()
+		results = append(results, CheckResult{Name: name, Detail: detail, Err: err})
+		return err == nil
+	}
+	skip := func(name, reason string) {
+		results = append(results, CheckResult{Name: name, Detail: reason, Skipped: true})
+	}
+
+	if p.genesisHash.IsZero() {
+		skip("genesis", "no network configured")
+	} else {
+		run("genesis", func() (string, error) { return p.CheckGenesis(ctx) })
+	}
+	run("program", func() (string, error) { return p.checkProgram(ctx) })
+	run("publisher_account", func() (string, error) { return p.checkPublisherAccount(ctx) })
+	run("signer", p.checkSigner)
+	if opts.MinBalance > 0 {
+		run("balance", func() (string, error) { return p.checkBalance(ctx, opts.MinBalance) })
+	} else {
+		skip("balance", "no minimum balance configured")
+	}
+	blockhashOK := run("blockhash", func() (string, error) { return p.checkBlockhash(ctx) })
+	run("slot_stream", func() (string, error) { return p.checkSlotStream(ctx, opts.SlotTimeout) })
+	switch {
+	case opts.SimulatePrice.IsZero():
+		skip("simulate", "no price account configured")
+	case !blockhashOK:
+		skip("simulate", "no recent block hash")
+	default:
+		run("simulate", func() (string, error) { return p.checkSimulate(ctx, opts.SimulatePrice) })
+	}
+	return results
+}
+
+// Preflight runs quick checks of the RPC and WebSocket endpoints,
+// the program ID, and the publisher key. Unlike Check, it leaves the
+// publisher ready to run.
+func (p *Publisher) Preflight(ctx context.Context) []CheckResult {
+	var results []CheckResult
+	for _, check := range []struct {
+		name string
+		fn   func(context.Context) (string, error)
+	}{
+		{"websocket", p.checkWebSocket},
+		{"program", p.checkProgram},
+		{"publisher_account", p.checkPublisherAccount},
+	} {
+		detail, err := check.fn(ctx)
+		results = append(results, CheckResult{Name: check.name, Detail: detail, Err: err})
+	}
+	return results
+}
+
+// CheckGenesis verifies that all RPC endpoints serve the cluster with the configured genesis hash,
+// guarding against publishing to the wrong network.
+func (p *Publisher) CheckGenesis(ctx context.Context) (string, error) {
+	if p.genesisHash.IsZero() {
+		return "no network configured", nil
+	}
+	type endpoint struct {
+		name   string
+		client *rpc.Client
+	}
+	endpoints := []endpoint{{"RPC", p.readRPC}, {"send RPC", p.sendRPC}}
+	for publisher, client := range p.sched.PublisherRPC {
+		endpoints = append(endpoints, endpoint{"send RPC of publisher " + publisher.String(), client})
+	}
+	for _, e := range endpoints {
+		hash, err := e.client.GetGenesisHash(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to get genesis hash of %s: %w", e.name, err)
+		}
+		if hash != p.genesisHash {
+			return "", fmt.Errorf("%s serves cluster with genesis hash %s, expected %s", e.name, hash, p.genesisHash)
+		}
+	}
+	return fmt.Sprintf("%d endpoints serve cluster with genesis hash %s", len(endpoints), p.genesisHash), nil
+}
+
+// checkWebSocket opens and closes a WebSocket connection.
+func (p *Publisher) checkWebSocket(ctx context.Context) (string, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, p.wsURL, p.wsHeaders)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to WebSocket: %w", err)
+	}
+	_ = conn.Close()
+	return "connected to WebSocket", nil
+}
+
+func (p *Publisher) checkProgram(ctx context.Context) (string, error) {
+	info, err := p.readRPC.GetAccountInfo(ctx, p.program)
+	if errors.Is(err, rpc.ErrNotFound) {
+		return "", fmt.Errorf("program account %s does not exist", p.program)
+	} else if err != nil {
+		return "", err
+	}
+	if !info.Value.Executable {
+		return "", fmt.Errorf("account %s is not a program", p.program)
+	}
+	return fmt.Sprintf("program %s exists", p.program), nil
+}
+
+func (p *Publisher) checkPublisherAccount(ctx context.Context) (string, error) {
+	_, err := p.readRPC.GetAccountInfo(ctx, p.signer.Pubkey())
+	if errors.Is(err, rpc.ErrNotFound) {
+		return "", fmt.Errorf("publisher account %s does not exist (unfunded?)", p.signer.Pubkey())
+	} else if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("publisher account %s exists", p.signer.Pubkey()), nil
+}
+
+// checkSigner signs a price update and verifies the signature locally.
+func (p *Publisher) checkSigner() (string, error) {
+	tx, err := p.sched.SignTransaction(p.noopUpdate(solana.PublicKey{}), solana.Hash{})
+	if err != nil {
+		return "", err
+	}
+	if err := tx.VerifySignatures(); err != nil {
+		return "", fmt.Errorf("signature does not verify: %w", err)
+	}
+	return fmt.Sprintf("publisher %s signs price updates", p.signer.Pubkey()), nil
+}
+
+func (p *Publisher) checkBalance(ctx context.Context, minBalance uint64) (string, error) {
+	res, err := p.readRPC.GetBalance(ctx, p.signer.Pubkey(), rpc.CommitmentConfirmed)
+	if err != nil {
+		return "", err
+	}
+	if res.Value < minBalance {
+		return "", fmt.Errorf("balance of %d lamports is below minimum of %d lamports", res.Value, minBalance)
+	}
+	return fmt.Sprintf("balance of %d lamports", res.Value), nil
+}
+
+func (p *Publisher) checkBlockhash(ctx context.Context) (string, error) {
+	if err := p.blockhashes.Init(ctx); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("recent block hash %s", p.blockhashes.GetRecentBlockHash().Blockhash), nil
+}
+
+// checkSlotStream opens the slot stream and waits for one update.
+func (p *Publisher) checkSlotStream(ctx context.Context, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	slots := make(chan uint64, 1)
+	unsubscribe := p.slots.Subscribe(func(slot uint64) {
+		select {
+		case slots <- slot:
+		default:
+		}
+	})
+	defer unsubscribe()
+	go func() { _ = p.slots.Run(ctx) }()
+
+	select {
+	case slot := <-slots:
+		return fmt.Sprintf("received slot %d", slot), nil
+	case <-ctx.Done():
+		return "", fmt.Errorf("no slot update within %s", timeout)
+	}
+}
+
+func (p *Publisher) checkSimulate(ctx context.Context, price solana.PublicKey) (string, error) {
+	tx, err := p.sched.SignTransaction(p.noopUpdate(price), p.blockhashes.GetRecentBlockHash().Blockhash)
+	if err != nil {
+		return "", err
+	}
+	txData, err := tx.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	var res rpc.SimulateTransactionResponse
+	err = p.sendRPC.RPCCallForInto(ctx, &res, "simulateTransaction", []interface{}{
+		base64.StdEncoding.EncodeToString(txData),
+		rpc.M{
+			"encoding":   "base64",
+			"sigVerify":  true,
+			"commitment": rpc.CommitmentConfirmed,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if res.Value == nil {
+		return "", errors.New("empty simulation result")
+	}
+	if res.Value.Err != nil {
+		return "", fmt.Errorf("simulation failed: %v (logs: %s)", res.Value.Err, strings.Join(res.Value.Logs, "; "))
+	}
+	return fmt.Sprintf("simulated update of %s", price), nil
+}
+
+// noopUpdate builds a price update with unknown status.
+func (p *Publisher) noopUpdate(price solana.PublicKey) *solana.TransactionBuilder {
+	ins := pyth.NewInstructionBuilder(p.program).
+		UpdPriceNoFailOnError(p.signer.Pubkey(), price, pyth.CommandUpdPrice{
+			Status:  pyth.PriceStatusUnknown,
+			PubSlot: p.slots.Slot(),
+		})
+	return solana.NewTransactionBuilder().AddInstruction(ins)
+}
@@ -0,0 +1,110 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMockCluster serves canned JSON-RPC results by method.
+func newMockCluster(t *testing.T, results map[string]interface{}) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		_ = json.NewDecoder(req.Body).Decode(&msg)
+		rw.Header().Set("content-type", "application/json")
+		_ = json.NewEncoder(rw).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      msg.ID,
+			"result":  results[msg.Method],
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestPublisher_Check(t *testing.T) {
+	rpcContext := map[string]interface{}{"slot": 100}
+	url := newMockCluster(t, map[string]interface{}{
+		"getAccountInfo": map[string]interface{}{
+			"context": rpcContext,
+			"value": map[string]interface{}{
+				"data":       []string{"", "base64"},
+				"executable": true,
+				"lamports":   1,
+				"owner":      "BPFLoaderUpgradeab1e11111111111111111111111",
+			},
+		},
+		"getBalance": map[string]interface{}{"context": rpcContext, "value": 1000},
+		"getRecentBlockhash": map[string]interface{}{
+			"context": rpcContext,
+			"value": map[string]interface{}{
+				"blockhash":     "4uQeVj5tqViQh7yWWGStvkEG1Zmhx6uasJtWCJziofM",
+				"feeCalculator": map[string]interface{}{"lamportsPerSignature": 5000},
+			},
+		},
+		"simulateTransaction": map[string]interface{}{
+			"context": rpcContext,
+			"value":   map[string]interface{}{"err": map[string]interface{}{"InstructionError": []interface{}{0, "InvalidArgument"}}},
+		},
+	})
+	p := newTestPublisher(t, Options{RPCURL: url})
+
+	results := p.Check(context.Background(), CheckOptions{
+		MinBalance:    5000,
+		SlotTimeout:   100 * time.Millisecond,
+		SimulatePrice: testProgram,
+	})
+	status := make(map[string]string)
+	for _, result := range results {
+		switch {
+		case result.Skipped:
+			status[result.Name] = "skip"
+		case result.Err != nil:
+			status[result.Name] = "fail"
+		default:
+			status[result.Name] = "pass"
+		}
+	}
+	require.Len(t, results, 8)
+	assert.Equal(t, map[string]string{
+		"genesis":           "skip",
+		"program":           "pass",
+		"publisher_account": "pass",
+		"signer":            "pass",
+		"balance":           "fail", // 1000 < 5000 lamports
+		"blockhash":         "pass",
+		"slot_stream":       "fail", // no WebSocket server
+		"simulate":          "fail", // instruction error
+	}, status)
+}
+
+func TestPublisher_CheckGenesis(t *testing.T) {
+	mainnet := solana.MustHashFromBase58("5eykt4UsFv8P8NJdTREpY1vzqKqZKvdpKuc147dw2N9d")
+	devnet := solana.MustHashFromBase58("EtWTRABZaYq6iMfeYKouRu166VU2xqa1wcaWoxPkrZBG")
+	mainnetURL := newMockCluster(t, map[string]interface{}{"getGenesisHash": mainnet.String()})
+	devnetURL := newMockCluster(t, map[string]interface{}{"getGenesisHash": devnet.String()})
+
+	p := newTestPublisher(t, Options{RPCURL: mainnetURL, GenesisHash: mainnet})
+	_, err := p.CheckGenesis(context.Background())
+	assert.NoError(t, err)
+
+	// Every endpoint is checked.
+	p = newTestPublisher(t, Options{RPCURL: mainnetURL, SendRPCURL: devnetURL, GenesisHash: mainnet})
+	_, err = p.CheckGenesis(context.Background())
+	assert.EqualError(t, err, "send RPC serves cluster with genesis hash "+devnet.String()+", expected "+mainnet.String())
+
+	// Skipped without a network.
+	p = newTestPublisher(t, Options{RPCURL: devnetURL})
+	_, err = p.CheckGenesis(context.Background())
+	assert.NoError(t, err)
+}
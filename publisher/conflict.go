@@ -0,0 +1,151 @@
+package publisher
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/gagliardetto/solana-go"
+	"go.uber.org/zap"
+)
+
+// conflictHistory is how many slots of pushed pub slots are remembered per price account.
+const conflictHistory = 1024
+
+// KeyConflict is a price account whose component advanced with pub slots
+// this instance never pushed, so another publisher is using our key.
+type KeyConflict struct {
+	Account   solana.PublicKey
+	PubSlot   uint64 // latest foreign pub slot
+	SinceSlot uint64 // slot the first foreign pub slot was observed
+
+	lastSlot uint64 // slot the latest foreign pub slot was observed
+}
+
+// conflictDetector compares the pub slots of our components on chain
+// to the pub slots of the updates we pushed.
+//
+// Pub slots advancing without a matching push mean that someone else
+// publishes with our key, e.g. a second instance or a legacy publisher.
+// An anomaly is only reported once it persisted for several slots,
+// so that mismatches caused by propagation delay are tolerated.
+type conflictDetector struct {
+	log     *zap.Logger
+	persist uint64 // slots an anomaly must persist before alerting
+
+	lock     sync.Mutex
+	pushed   map[solana.PublicKey]map[uint64]struct{} // audit log of pushed pub slots
+	latest   map[solana.PublicKey]uint64              // latest observed pub slot
+	foreign  map[solana.PublicKey]bool                // latest observed pub slot was not pushed by us
+	suspects map[solana.PublicKey]*KeyConflict
+	alerted  map[solana.PublicKey]bool
+}
+
+func newConflictDetector(log *zap.Logger, persist uint64) *conflictDetector {
+	return &conflictDetector{
+		log:      log,
+		persist:  persist,
+		pushed:   make(map[solana.PublicKey]map[uint64]struct{}),
+		latest:   make(map[solana.PublicKey]uint64),
+		foreign:  make(map[solana.PublicKey]bool),
+		suspects: make(map[solana.PublicKey]*KeyConflict),
+		alerted:  make(map[solana.PublicKey]bool),
+	}
+}
+
+// push records the pub slot of an update queued for a price account.
+func (d *conflictDetector) push(account solana.PublicKey, pubSlot uint64) {
+	if d == nil {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	slots := d.pushed[account]
+	if slots == nil {
+		slots = make(map[uint64]struct{})
+		d.pushed[account] = slots
+	}
+	slots[pubSlot] = struct{}{}
+	for old := range slots {
+		if old+conflictHistory < pubSlot {
+			delete(slots, old)
+		}
+	}
+}
+
+// observe checks the pub slot of our component of a price account,
+// as seen on chain at the given slot.
+//
+// The first observation of an account is the baseline, since pub slots
+// published before startup are not in the audit log.
+// A conflict is reported once foreign pub slots were seen for persist slots,
+// and resolved once only our own pub slots were seen for persist slots.
+func (d *conflictDetector) observe(account solana.PublicKey, pubSlot uint64, slot uint64) {
+	if d == nil {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	latest, known := d.latest[account]
+	if !known {
+		d.latest[account] = pubSlot
+		return
+	}
+	suspect := d.suspects[account]
+	if pubSlot > latest {
+		d.latest[account] = pubSlot
+		_, ours := d.pushed[account][pubSlot]
+		d.foreign[account] = !ours
+		if !ours {
+			if suspect == nil {
+				suspect = &KeyConflict{Account: account, SinceSlot: slot}
+				d.suspects[account] = suspect
+			}
+			suspect.PubSlot = pubSlot
+			suspect.lastSlot = slot
+		}
+	}
+	if suspect == nil {
+		return
+	}
+	if !d.foreign[account] && slot >= suspect.lastSlot+d.persist {
+		d.resolve(account)
+		return
+	}
+	if d.alerted[account] || slot < suspect.SinceSlot+d.persist {
+		return
+	}
+	d.alerted[account] = true
+	metricKeyConflicts.Inc()
+	metricKeyConflictPrices.Inc()
+	d.log.Error("Another publisher is using our key for this price account",
+		zap.Stringer("price", account),
+		zap.Uint64("pub_slot", suspect.PubSlot),
+		zap.Uint64("since_slot", suspect.SinceSlot))
+}
+
+// resolve forgets a suspected conflict. Must hold lock.
+func (d *conflictDetector) resolve(account solana.PublicKey) {
+	delete(d.suspects, account)
+	if d.alerted[account] {
+		delete(d.alerted, account)
+		metricKeyConflictPrices.Dec()
+		d.log.Info("Key conflict resolved", zap.Stringer("price", account))
+	}
+}
+
+// conflicts lists the reported conflicts, ordered by price account.
+func (d *conflictDetector) conflicts() []KeyConflict {
+	if d == nil {
+		return nil
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var list []KeyConflict
+	for account := range d.alerted {
+		list = append(list, *d.suspects[account])
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Account.String() < list[j].Account.String()
+	})
+	return list
+}
@@ -0,0 +1,60 @@
+package publisher
+
+import (
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pyth"
+)
+
+func TestPublisher_KeyConflicts(t *testing.T) {
+	p := newTestPublisher(t, Options{ConflictSlots: 4})
+	require.True(t, p.DetectsConflicts())
+	price := solana.NewWallet().PublicKey()
+	push := func(pubSlot uint64) {
+		require.NoError(t, p.PushPriceWithOpts(price, 100, 1, pyth.PriceStatusTrading, PushOptions{PubSlot: pubSlot}))
+	}
+
+	// Pub slots before startup are the baseline.
+	p.conflicts.observe(price, 90, 100)
+	push(100)
+	p.conflicts.observe(price, 100, 101)
+	assert.Empty(t, p.KeyConflicts())
+
+	// A foreign pub slot replaced by our own update shortly after is tolerated.
+	p.conflicts.observe(price, 101, 102)
+	push(103)
+	p.conflicts.observe(price, 103, 104)
+	p.conflicts.observe(price, 103, 106)
+	assert.Empty(t, p.KeyConflicts())
+
+	// Foreign pub slots persisting for several slots are reported.
+	p.conflicts.observe(price, 107, 107)
+	p.conflicts.observe(price, 108, 109)
+	push(109)
+	p.conflicts.observe(price, 109, 110)
+	assert.Empty(t, p.KeyConflicts(), "reported before persisting")
+	p.conflicts.observe(price, 110, 111)
+	assert.Equal(t, []KeyConflict{{
+		Account:   price,
+		PubSlot:   110,
+		SinceSlot: 107,
+		lastSlot:  111,
+	}}, p.KeyConflicts())
+
+	// Resolved once only our own updates land.
+	push(112)
+	p.conflicts.observe(price, 112, 113)
+	assert.NotEmpty(t, p.KeyConflicts())
+	p.conflicts.observe(price, 112, 115)
+	assert.Empty(t, p.KeyConflicts())
+}
+
+func TestPublisher_KeyConflictsDisabled(t *testing.T) {
+	p := newTestPublisher(t, Options{})
+	assert.False(t, p.DetectsConflicts())
+	p.ObserveComponent(solana.NewWallet().PublicKey(), 100)
+	assert.Empty(t, p.KeyConflicts())
+}
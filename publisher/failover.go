@@ -0,0 +1,99 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"go.uber.org/zap"
+)
+
+// Cluster is a set of endpoints of a Solana cluster to fail over to.
+// The headers configured for the original endpoints are sent to them too.
+type Cluster struct {
+	RPCURL       string
+	WebSocketURL string
+	SendRPCURL   string // defaults to RPCURL
+	// PublisherSendRPCURLs replace Options.PublisherSendRPCURLs.
+	// Publishers not listed send through SendRPCURL.
+	PublisherSendRPCURLs map[solana.PublicKey]string
+}
+
+// clusterEndpoints are the RPC endpoints of the publish pipeline, switched on failover.
+type clusterEndpoints struct {
+	lock       sync.Mutex // serializes failovers
+	read       *rpcSwitch
+	send       *rpcSwitch
+	publishers map[solana.PublicKey]*rpcSwitch
+}
+
+// Failover switches the publish pipeline to another cluster, and queues the
+// updates of sent transactions that have not landed yet again, so that they are
+// sent to the new cluster. Requires Options.RetainUnconfirmed to replay updates.
+//
+// The current slot is read from the new cluster before switching, so that
+// an unreachable cluster is not switched to, and replayed updates stale at
+// the slot of the new cluster are dropped. Returns the number of updates queued.
+//
+// Accounts read by other components, e.g. through the Pyth client, are not switched.
+func (p *Publisher) Failover(ctx context.Context, cluster Cluster) (int, error) {
+	if cluster.RPCURL == "" {
+		return 0, errors.New("missing RPC URL")
+	}
+	if cluster.WebSocketURL == "" {
+		return 0, errors.New("missing WebSocket URL")
+	}
+	if cluster.SendRPCURL == "" {
+		cluster.SendRPCURL = cluster.RPCURL
+	}
+	e := &p.endpoints
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	probe := rpc.NewWithCustomRPCClient(newJSONRPCClient(cluster.RPCURL, e.read.headers, RPCRoleRead, e.read.faults))
+	if !p.genesisHash.IsZero() {
+		hash, err := probe.GetGenesisHash(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get genesis hash of new cluster: %w", err)
+		}
+		if hash != p.genesisHash {
+			return 0, fmt.Errorf("new cluster has genesis hash %s, expected %s", hash, p.genesisHash)
+		}
+	}
+	slot, err := probe.GetSlot(ctx, rpc.CommitmentProcessed)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get slot of new cluster: %w", err)
+	}
+
+	e.read.switchTo(cluster.RPCURL)
+	e.send.switchTo(cluster.SendRPCURL)
+	for publisher, endpoint := range e.publishers {
+		url, ok := cluster.PublisherSendRPCURLs[publisher]
+		if !ok {
+			url = cluster.SendRPCURL
+		}
+		endpoint.switchTo(url)
+	}
+	p.slots.SwitchCluster([]string{cluster.WebSocketURL}, slot)
+	p.confirmer.SetWebSocketURL(cluster.WebSocketURL)
+	if err := p.supervisor.restart(ComponentSlots); err != nil {
+		return 0, err
+	}
+	// Block hashes of the previous cluster are not known to the new one.
+	if err := p.blockhashes.Refresh(ctx); err != nil {
+		p.Log.Warn("Failed to get recent block hash of new cluster", zap.Error(err))
+	}
+
+	var minSlot uint64
+	if slot > p.sched.MaxSlotAge {
+		minSlot = slot - p.sched.MaxSlotAge
+	}
+	n := p.sched.ReplayUnconfirmed(minSlot)
+	p.Log.Info("Failed over to new cluster",
+		zap.Uint64("slot", slot),
+		zap.Int("replayed", n))
+	return n, nil
+}
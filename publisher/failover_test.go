@@ -0,0 +1,52 @@
+package publisher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/schedule"
+)
+
+func TestPublisher_Failover(t *testing.T) {
+	dead := newMockSendCluster(t, 1000)
+	dead.down = true
+	backup := newMockSendCluster(t, 1020)
+	p := newTestPublisher(t, Options{RPCURL: dead.URL, RetainUnconfirmed: time.Minute})
+	slots := runSender(t, p)
+
+	// Both updates are fresh at the slot of the dead cluster, and get lost with it.
+	fresh, stale := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	require.NoError(t, p.PushPriceWithOpts(fresh, 1, 1, pyth.PriceStatusTrading, PushOptions{PubSlot: 1000}))
+	require.NoError(t, p.PushPriceWithOpts(stale, 2, 1, pyth.PriceStatusTrading, PushOptions{PubSlot: 980}))
+	slots <- &ws.SlotsUpdatesResult{Slot: 1000}
+	require.Eventually(t, func() bool {
+		return len(dead.sentTxs()) == 1
+	}, 5*time.Second, time.Millisecond)
+	assert.Empty(t, p.buffer.Queued())
+
+	// The backup cluster is ahead, so that one update is stale there.
+	replayed, err := p.Failover(context.Background(), Cluster{RPCURL: backup.URL, WebSocketURL: "ws://127.0.0.1:0"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayed)
+	assert.Equal(t, uint64(1020), p.Slot())
+	assert.Equal(t, []schedule.QueuedUpdate{
+		{Price: fresh, PubSlot: 1000, Value: 1, Conf: 1, Status: pyth.PriceStatusTrading},
+	}, p.buffer.Queued())
+
+	// The replayed update is sent to the backup cluster, with a block hash it knows.
+	slots <- &ws.SlotsUpdatesResult{Slot: 1021}
+	require.Eventually(t, func() bool {
+		return len(backup.sentTxs()) == 1
+	}, 5*time.Second, time.Millisecond)
+	tx := backup.sentTxs()[0]
+	assert.Equal(t, backup.blockhash, tx.Message.RecentBlockhash)
+	assert.Contains(t, tx.Message.AccountKeys, fresh)
+	assert.NotContains(t, tx.Message.AccountKeys, stale)
+	assert.Len(t, dead.sentTxs(), 1)
+}
@@ -0,0 +1,253 @@
+package publisher
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"go.uber.org/zap"
+)
+
+// LeaderOptions enables hot-standby between instances sharing a publisher key.
+type LeaderOptions struct {
+	// TakeoverSlots is the number of slots without price updates of the
+	// publisher key after which a standby instance starts publishing.
+	TakeoverSlots uint64
+	// PollInterval is how often the recent price updates of the publisher key are checked.
+	PollInterval time.Duration
+}
+
+// LeaderState is whether an instance publishes or stands by.
+type LeaderState string
+
+const (
+	LeaderActive  LeaderState = "active"
+	LeaderStandby LeaderState = "standby"
+)
+
+// maxOwnSignatures is the number of recently sent transactions remembered
+// to tell them apart from transactions of other instances.
+const maxOwnSignatures = 256
+
+// leaderSignatureLimit is the number of recent transactions involving the
+// publisher key searched for the latest price update.
+const leaderSignatureLimit = 10
+
+// leader decides whether this instance publishes, based on the latest
+// price update transaction of the publisher key.
+//
+// Only transactions paid for by the publisher key and calling the Pyth program count,
+// so that e.g. transfers to the publisher key are ignored. Instances start in standby. A standby instance takes over once no transaction
+// landed for TakeoverSlots. An active instance seeing a transaction it did not
+// send steps down and waits a random number of extra slots before taking over
+// again, so that one of two racing instances wins.
+type leader struct {
+	log       *zap.Logger
+	rpc       *rpc.Client
+	publisher solana.PublicKey
+	program   solana.PublicKey
+	slot      func() uint64
+	opts      LeaderOptions
+	rand      *rand.Rand
+
+	lock        sync.Mutex
+	active      bool
+	activeSince uint64   // slot at which this instance took over
+	lastSeen    uint64   // slot of the latest price update of the publisher key
+	jitter      uint64   // extra slots to wait before taking over after a conflict
+	ownSigs     sigCache // transactions sent by this instance
+	updates     sigCache // other transactions, true if price updates
+}
+
+// sigCache remembers a bounded number of recent transaction signatures.
+type sigCache struct {
+	values map[solana.Signature]bool
+	order  []solana.Signature
+}
+
+func (c *sigCache) add(sig solana.Signature, value bool) {
+	if c.values == nil {
+		c.values = make(map[solana.Signature]bool)
+	}
+	if _, ok := c.values[sig]; !ok {
+		if len(c.order) >= maxOwnSignatures {
+			delete(c.values, c.order[0])
+			c.order = c.order[1:]
+		}
+		c.order = append(c.order, sig)
+	}
+	c.values[sig] = value
+}
+
+func (c *sigCache) get(sig solana.Signature) (value, ok bool) {
+	value, ok = c.values[sig]
+	return
+}
+
+func newLeader(log *zap.Logger, rpcClient *rpc.Client, publisher, program solana.PublicKey, slot func() uint64, opts LeaderOptions) *leader {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 2 * time.Second
+	}
+	metricLeaderActive.Set(0)
+	return &leader{
+		log:       log,
+		rpc:       rpcClient,
+		publisher: publisher,
+		program:   program,
+		slot:      slot,
+		opts:      opts,
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// run checks the leader state until the context is cancelled.
+func (l *leader) run(ctx context.Context) {
+	ticker := time.NewTicker(l.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tickCtx, cancel := context.WithTimeout(ctx, l.opts.PollInterval)
+			l.check(tickCtx)
+			cancel()
+		}
+	}
+}
+
+// check fetches the latest price update of the publisher key and updates the state.
+func (l *leader) check(ctx context.Context) {
+	latest, own, err := l.latestUpdate(ctx)
+	if err != nil {
+		l.log.Warn("Failed to get recent transactions of publisher, keeping leader state", zap.Error(err))
+		return
+	}
+	slot := l.slot()
+	if slot == 0 {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	var foreign *rpc.TransactionSignature
+	if latest != nil {
+		if latest.Slot > l.lastSeen {
+			l.lastSeen = latest.Slot
+		}
+		if !own {
+			foreign = latest
+		}
+	}
+
+	switch {
+	case l.active && foreign != nil && foreign.Slot >= l.activeSince:
+		l.active = false
+		l.jitter = uint64(l.rand.Int63n(int64(l.opts.TakeoverSlots) + 1))
+		metricLeaderActive.Set(0)
+		metricLeaderConflicts.Inc()
+		l.log.Warn("Another instance is publishing with the same key, standing by",
+			zap.Stringer("signature", foreign.Signature),
+			zap.Uint64("tx_slot", foreign.Slot),
+			zap.Uint64("takeover_jitter", l.jitter))
+	case !l.active && slot >= l.lastSeen+l.opts.TakeoverSlots+l.jitter:
+		l.active = true
+		l.activeSince = slot
+		l.jitter = 0
+		metricLeaderActive.Set(1)
+		l.log.Info("Taking over publishing",
+			zap.Uint64("slot", slot),
+			zap.Uint64("last_tx_slot", l.lastSeen))
+	}
+}
+
+// latestUpdate returns the latest recent price update of the publisher key,
+// and whether this instance sent it. Nil if there is none.
+func (l *leader) latestUpdate(ctx context.Context) (*rpc.TransactionSignature, bool, error) {
+	limit := leaderSignatureLimit
+	sigs, err := l.rpc.GetSignaturesForAddressWithOpts(ctx, l.publisher, &rpc.GetSignaturesForAddressOpts{
+		Limit:      &limit,
+		Commitment: rpc.CommitmentConfirmed,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	for _, sig := range sigs {
+		if sig == nil {
+			continue
+		}
+		l.lock.Lock()
+		_, own := l.ownSigs.get(sig.Signature)
+		isUpdate, known := l.updates.get(sig.Signature)
+		l.lock.Unlock()
+		if own {
+			return sig, true, nil
+		}
+		if !known {
+			isUpdate, err = l.isPriceUpdate(ctx, sig.Signature)
+			if err != nil {
+				return nil, false, err
+			}
+			l.lock.Lock()
+			l.updates.add(sig.Signature, isUpdate)
+			l.lock.Unlock()
+		}
+		if isUpdate {
+			return sig, false, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// isPriceUpdate returns whether a transaction was paid for by the publisher key and calls the Pyth program.
+func (l *leader) isPriceUpdate(ctx context.Context, sig solana.Signature) (bool, error) {
+	res, err := l.rpc.GetTransaction(ctx, sig, &rpc.GetTransactionOpts{
+		Encoding:   solana.EncodingBase64,
+		Commitment: rpc.CommitmentConfirmed,
+	})
+	if err != nil {
+		return false, err
+	}
+	if res.Transaction == nil {
+		return false, nil
+	}
+	tx, err := solana.TransactionFromDecoder(bin.NewBinDecoder(res.Transaction.GetBinary()))
+	if err != nil {
+		return false, err
+	}
+	keys := tx.Message.AccountKeys
+	if len(keys) == 0 || !keys[0].Equals(l.publisher) {
+		return false, nil
+	}
+	for _, insn := range tx.Message.Instructions {
+		if int(insn.ProgramIDIndex) < len(keys) && keys[insn.ProgramIDIndex].Equals(l.program) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sent remembers a transaction sent by this instance.
+func (l *leader) sent(sig solana.Signature) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.ownSigs.add(sig, true)
+}
+
+// standby returns whether this instance must not publish.
+func (l *leader) standby() bool {
+	return l.state() == LeaderStandby
+}
+
+func (l *leader) state() LeaderState {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.active {
+		return LeaderActive
+	}
+	return LeaderStandby
+}
@@ -0,0 +1,97 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// SlotLeader is the validator scheduled to produce a slot.
+type SlotLeader struct {
+	Slot   uint64
+	Leader solana.PublicKey
+}
+
+// errSlotUnknown is returned while the current slot is not known yet.
+var errSlotUnknown = errors.New("current slot unknown")
+
+// leaderSchedule caches the Solana leader schedule of the current epoch.
+//
+// The schedule is fixed for an epoch, so it is only fetched again
+// once the requested slot leaves the cached epoch.
+type leaderSchedule struct {
+	rpc *rpc.Client
+
+	lock      sync.Mutex
+	firstSlot uint64             // first slot of the cached epoch
+	leaders   []solana.PublicKey // by slot index within the cached epoch
+}
+
+func newLeaderSchedule(rpcClient *rpc.Client) *leaderSchedule {
+	return &leaderSchedule{rpc: rpcClient}
+}
+
+// upcoming returns the leaders of up to n slots starting at the given slot.
+// Slots past the end of the epoch of the given slot are omitted.
+func (s *leaderSchedule) upcoming(ctx context.Context, slot uint64, n int) ([]SlotLeader, error) {
+	if slot == 0 {
+		return nil, errSlotUnknown
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if slot < s.firstSlot || slot >= s.firstSlot+uint64(len(s.leaders)) {
+		if err := s.fetch(ctx); err != nil {
+			return nil, err
+		}
+		if slot < s.firstSlot || slot >= s.firstSlot+uint64(len(s.leaders)) {
+			return nil, fmt.Errorf("slot %d outside of current epoch starting at slot %d", slot, s.firstSlot)
+		}
+	}
+	index := slot - s.firstSlot
+	end := index + uint64(n)
+	if end > uint64(len(s.leaders)) {
+		end = uint64(len(s.leaders))
+	}
+	leaders := make([]SlotLeader, 0, end-index)
+	for i := index; i < end; i++ {
+		leaders = append(leaders, SlotLeader{Slot: s.firstSlot + i, Leader: s.leaders[i]})
+	}
+	return leaders, nil
+}
+
+// fetch replaces the cached schedule with the one of the current epoch. Must hold lock.
+func (s *leaderSchedule) fetch(ctx context.Context) error {
+	epoch, err := s.rpc.GetEpochInfo(ctx, rpc.CommitmentConfirmed)
+	if err != nil {
+		return fmt.Errorf("failed to get epoch info: %w", err)
+	}
+	firstSlot := epoch.AbsoluteSlot - epoch.SlotIndex
+	schedule, err := s.rpc.GetLeaderScheduleWithOpts(ctx, &rpc.GetLeaderScheduleOpts{
+		Commitment: rpc.CommitmentConfirmed,
+		Epoch:      &firstSlot,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get leader schedule: %w", err)
+	}
+	leaders := make([]solana.PublicKey, epoch.SlotsInEpoch)
+	for leader, indexes := range schedule {
+		for _, index := range indexes {
+			if index < uint64(len(leaders)) {
+				leaders[index] = leader
+			}
+		}
+	}
+	s.firstSlot = firstSlot
+	s.leaders = leaders
+	return nil
+}
+
+// UpcomingLeaders returns the leaders of up to n slots starting at the current slot.
+// The list ends early at the end of the current epoch.
+func (p *Publisher) UpcomingLeaders(ctx context.Context, n int) ([]SlotLeader, error) {
+	return p.leaderSchedule.upcoming(ctx, p.slots.Slot(), n)
+}
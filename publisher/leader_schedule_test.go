@@ -0,0 +1,87 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaderSchedule(t *testing.T) {
+	leaderA, leaderB := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	var epochStart, fetches uint64 = 1000, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var msg struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&msg))
+		start := atomic.LoadUint64(&epochStart)
+		var result interface{}
+		switch msg.Method {
+		case "getEpochInfo":
+			result = map[string]interface{}{
+				"absoluteSlot": start + 4,
+				"slotIndex":    4,
+				"slotsInEpoch": 8,
+				"epoch":        start / 8,
+			}
+		case "getLeaderSchedule":
+			atomic.AddUint64(&fetches, 1)
+			var slot uint64
+			require.NoError(t, json.Unmarshal(msg.Params[0], &slot))
+			assert.Equal(t, start, slot)
+			// Leaders take turns every 4 slots.
+			result = map[string][]uint64{
+				leaderA.String(): {0, 1, 2, 3},
+				leaderB.String(): {4, 5, 6, 7},
+			}
+		default:
+			t.Errorf("unexpected method %s", msg.Method)
+		}
+		rw.Header().Set("content-type", "application/json")
+		_ = json.NewEncoder(rw).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      msg.ID,
+			"result":  result,
+		})
+	}))
+	t.Cleanup(srv.Close)
+	schedule := newLeaderSchedule(rpc.New(srv.URL))
+	ctx := context.Background()
+
+	leaders, err := schedule.upcoming(ctx, 1003, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []SlotLeader{
+		{Slot: 1003, Leader: leaderA},
+		{Slot: 1004, Leader: leaderB},
+		{Slot: 1005, Leader: leaderB},
+	}, leaders)
+
+	// Cached within the epoch, truncated at its end.
+	leaders, err = schedule.upcoming(ctx, 1006, 16)
+	require.NoError(t, err)
+	assert.Equal(t, []SlotLeader{
+		{Slot: 1006, Leader: leaderB},
+		{Slot: 1007, Leader: leaderB},
+	}, leaders)
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&fetches))
+
+	// Fetched again in the next epoch.
+	atomic.StoreUint64(&epochStart, 1008)
+	leaders, err = schedule.upcoming(ctx, 1008, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []SlotLeader{{Slot: 1008, Leader: leaderA}}, leaders)
+	assert.Equal(t, uint64(2), atomic.LoadUint64(&fetches))
+
+	_, err = schedule.upcoming(ctx, 0, 1)
+	assert.ErrorIs(t, err, errSlotUnknown)
+}
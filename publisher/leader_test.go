@@ -0,0 +1,216 @@
+package publisher
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pythian/signer/signertest"
+)
+
+// mockLedger is a fake Solana RPC endpoint serving getSignaturesForAddress
+// and getTransaction from transactions recorded by the test.
+type mockLedger struct {
+	*httptest.Server
+	lock sync.Mutex
+	txs  []ledgerTx // newest first
+}
+
+type ledgerTx struct {
+	sig  solana.Signature
+	slot uint64
+	raw  []byte
+}
+
+func newMockLedger(t *testing.T) *mockLedger {
+	m := new(mockLedger)
+	m.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var msg struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&msg))
+		require.NotEmpty(t, msg.Params)
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		var result interface{}
+		switch msg.Method {
+		case "getSignaturesForAddress":
+			var opts struct {
+				Limit int `json:"limit"`
+			}
+			require.Len(t, msg.Params, 2)
+			require.NoError(t, json.Unmarshal(msg.Params[1], &opts))
+			sigs := []map[string]interface{}{}
+			for _, tx := range m.txs {
+				if len(sigs) >= opts.Limit {
+					break
+				}
+				sigs = append(sigs, map[string]interface{}{
+					"signature": tx.sig.String(),
+					"slot":      tx.slot,
+					"err":       nil,
+				})
+			}
+			result = sigs
+		case "getTransaction":
+			var sig solana.Signature
+			require.NoError(t, json.Unmarshal(msg.Params[0], &sig))
+			for _, tx := range m.txs {
+				if tx.sig == sig {
+					result = map[string]interface{}{
+						"slot":        tx.slot,
+						"transaction": []string{base64.StdEncoding.EncodeToString(tx.raw), "base64"},
+						"meta":        map[string]interface{}{"err": nil},
+					}
+				}
+			}
+		default:
+			t.Errorf("unexpected method %s", msg.Method)
+		}
+		rw.Header().Set("content-type", "application/json")
+		_ = json.NewEncoder(rw).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      msg.ID,
+			"result":  result,
+		})
+	}))
+	t.Cleanup(m.Close)
+	return m
+}
+
+// land records a transaction with the given instructions and fee payer.
+func (m *mockLedger) land(t *testing.T, slot uint64, payer solana.PublicKey, insns ...solana.Instruction) solana.Signature {
+	tx, err := solana.NewTransaction(insns, solana.Hash{}, solana.TransactionPayer(payer))
+	require.NoError(t, err)
+	msg, err := tx.Message.MarshalBinary()
+	require.NoError(t, err)
+	raw := append([]byte{0}, msg...) // no signatures
+	var sig solana.Signature
+	copy(sig[:], solana.NewWallet().PublicKey().Bytes())
+	m.lock.Lock()
+	m.txs = append([]ledgerTx{{sig: sig, slot: slot, raw: raw}}, m.txs...)
+	m.lock.Unlock()
+	return sig
+}
+
+// send lands a price update sent by the given instance.
+func (m *mockLedger) send(t *testing.T, p *Publisher, slot uint64) {
+	publisher := p.signer.Pubkey()
+	insn := solana.NewInstruction(testProgram, solana.AccountMetaSlice{
+		solana.Meta(publisher).SIGNER().WRITE(),
+	}, []byte{0x02})
+	p.sched.OnSend(m.land(t, slot, publisher, insn))
+}
+
+// transfer lands a SOL transfer from another account to the publisher key.
+func (m *mockLedger) transfer(t *testing.T, publisher solana.PublicKey, slot uint64) {
+	from := solana.NewWallet().PublicKey()
+	m.land(t, slot, from, system.NewTransferInstruction(1, from, publisher).Build())
+}
+
+func TestPublisher_LeaderFailover(t *testing.T) {
+	ledger := newMockLedger(t)
+	txSigner := signertest.New(t, testProgram)
+	var slot uint64
+	newInstance := func() *Publisher {
+		p := newTestPublisher(t, Options{
+			RPCURL: ledger.URL,
+			Signer: txSigner,
+			Leader: &LeaderOptions{TakeoverSlots: 10},
+		})
+		p.leader.slot = func() uint64 { return slot }
+		return p
+	}
+	a, b := newInstance(), newInstance()
+	ctx := context.Background()
+	assert.Equal(t, LeaderStandby, a.LeaderState())
+	assert.True(t, a.sched.Standby())
+
+	// No recent transactions, the first instance checking takes over.
+	slot = 100
+	a.leader.check(ctx)
+	assert.Equal(t, LeaderActive, a.LeaderState())
+	assert.False(t, a.sched.Standby())
+	ledger.send(t, a, 100)
+
+	// The second instance stands by while the first one publishes.
+	for slot = 101; slot < 130; slot++ {
+		if slot%5 == 0 {
+			ledger.send(t, a, slot)
+		}
+		a.leader.check(ctx)
+		b.leader.check(ctx)
+		require.Equal(t, LeaderActive, a.LeaderState(), "slot %d", slot)
+		require.Equal(t, LeaderStandby, b.LeaderState(), "slot %d", slot)
+	}
+
+	// The first instance stops publishing, the second one takes over after 10 slots.
+	lastSent := slot - 5
+	for ; slot < lastSent+10; slot++ {
+		b.leader.check(ctx)
+		require.Equal(t, LeaderStandby, b.LeaderState(), "slot %d", slot)
+	}
+	b.leader.check(ctx)
+	assert.Equal(t, LeaderActive, b.LeaderState())
+	ledger.send(t, b, slot)
+
+	// The first instance sees the transaction of the second one and steps down.
+	conflicts := testutil.ToFloat64(metricLeaderConflicts)
+	a.leader.check(ctx)
+	assert.Equal(t, LeaderStandby, a.LeaderState())
+	assert.Equal(t, LeaderActive, b.LeaderState())
+	assert.Equal(t, conflicts+1, testutil.ToFloat64(metricLeaderConflicts))
+}
+
+func TestPublisher_LeaderIgnoresTransfers(t *testing.T) {
+	ledger := newMockLedger(t)
+	txSigner := signertest.New(t, testProgram)
+	var slot uint64
+	newInstance := func() *Publisher {
+		p := newTestPublisher(t, Options{
+			RPCURL: ledger.URL,
+			Signer: txSigner,
+			Leader: &LeaderOptions{TakeoverSlots: 10},
+		})
+		p.leader.slot = func() uint64 { return slot }
+		return p
+	}
+	a, b := newInstance(), newInstance()
+	ctx := context.Background()
+
+	slot = 100
+	a.leader.check(ctx)
+	require.Equal(t, LeaderActive, a.LeaderState())
+	ledger.send(t, a, 100)
+	b.leader.check(ctx)
+	require.Equal(t, LeaderStandby, b.LeaderState())
+
+	// A top-up of the publisher key is neither a conflict nor a sign of life.
+	conflicts := testutil.ToFloat64(metricLeaderConflicts)
+	slot = 105
+	ledger.transfer(t, txSigner.Pubkey(), 105)
+	a.leader.check(ctx)
+	b.leader.check(ctx)
+	assert.Equal(t, LeaderActive, a.LeaderState())
+	assert.Equal(t, LeaderStandby, b.LeaderState())
+	assert.Equal(t, conflicts, testutil.ToFloat64(metricLeaderConflicts))
+
+	// The standby instance still takes over 10 slots after the last price update.
+	slot = 109
+	b.leader.check(ctx)
+	assert.Equal(t, LeaderStandby, b.LeaderState())
+	slot = 110
+	b.leader.check(ctx)
+	assert.Equal(t, LeaderActive, b.LeaderState())
+}
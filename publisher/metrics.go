@@ -0,0 +1,82 @@
+package publisher
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Reasons for restarting components.
+const (
+	restartRequested = "requested"
+	restartFailed    = "failed"
+)
+
+// Reasons for rejecting price updates.
+const (
+	rejectNotAllowed = "not_allowed"
+	rejectBreaker    = "breaker"
+	rejectFutureSlot = "future_slot"
+)
+
+var (
+	metricUpdatesRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "publisher",
+		Name:      "price_updates_rejected_total",
+		Help:      "Number of Pyth price updates rejected before buffering",
+	}, []string{"reject_reason"})
+	metricBreakerTrips = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "publisher",
+		Name:      "breaker_trips_total",
+		Help:      "Number of times the price rate-of-change breaker tripped",
+	})
+	metricRPCRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "solana",
+		Name:      "rpc_requests_total",
+		Help:      "Number of HTTP requests to Solana RPC endpoints",
+	}, []string{"role"})
+	metricRPCErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "solana",
+		Name:      "rpc_errors_total",
+		Help:      "Number of failed HTTP requests to Solana RPC endpoints",
+	}, []string{"role"})
+	metricLeaderActive = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "pythian",
+		Subsystem: "publisher",
+		Name:      "leader_active",
+		Help:      "Whether this instance publishes (1) or stands by for another instance with the same key (0)",
+	})
+	metricLeaderConflicts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "publisher",
+		Name:      "leader_conflicts_total",
+		Help:      "Number of times this instance stepped down after seeing another instance publish with the same key",
+	})
+	metricKeyConflicts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "publisher",
+		Name:      "key_conflicts_total",
+		Help:      "Number of times another publisher was detected updating a price account with our key",
+	})
+	metricKeyConflictPrices = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "pythian",
+		Subsystem: "publisher",
+		Name:      "key_conflict_prices",
+		Help:      "Number of price accounts currently updated by another publisher with our key",
+	})
+	metricStaleHalted = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "pythian",
+		Subsystem: "publisher",
+		Name:      "stale_halted_prices",
+		Help:      "Number of price accounts halted by the stale price watchdog",
+	})
+	metricComponentRestarts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "publisher",
+		Name:      "component_restarts_total",
+		Help:      "Number of pipeline component restarts",
+	}, []string{"component", "reason"})
+)
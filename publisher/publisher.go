@@ -0,0 +1,632 @@
+// Package publisher embeds the Pyth price publish pipeline.
+//
+// A Publisher buffers price updates, tracks the current Solana slot,
+// and periodically flushes, signs, and sends update transactions.
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/faults"
+	"go.blockdaemon.com/pythian/schedule"
+	"go.blockdaemon.com/pythian/signer"
+	"go.blockdaemon.com/pythian/stats"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Options configures a Publisher.
+type Options struct {
+	Log          *zap.Logger
+	RPCURL       string           // Solana JSON-RPC HTTP endpoint
+	RPCHeaders   http.Header      // sent with every request to RPCURL
+	WebSocketURL string           // Solana JSON-RPC WebSocket endpoint
+	Program      solana.PublicKey // Pyth on-chain program ID
+	Signer       *signer.Signer   // publisher key and transaction signer
+
+	// GenesisHash is the genesis hash of the intended cluster,
+	// verified against all RPC endpoints by CheckGenesis. Zero skips the check.
+	GenesisHash solana.Hash
+
+	// SendRPCURL is a separate endpoint used to submit transactions and fetch
+	// the block hashes they reference. Empty uses RPCURL and RPCHeaders.
+	SendRPCURL     string
+	SendRPCHeaders http.Header
+
+	// PublisherSendRPCURLs routes transactions of specific publisher keys to
+	// their own endpoints, e.g. staked connections for stake-weighted QoS.
+	// SendRPCHeaders are sent to these endpoints. Other publishers use SendRPCURL.
+	PublisherSendRPCURLs map[solana.PublicKey]string
+
+	// WebSocketHeaders are sent with every WebSocket handshake, e.g. API keys.
+	WebSocketHeaders http.Header
+
+	// SlotWebSocketURLs are additional WebSocket endpoints streaming slot updates,
+	// without WebSocketHeaders. The highest slot seen by any endpoint is tracked.
+	SlotWebSocketURLs []string
+
+	// MaxSlotAge is the number of slots after which a queued update is
+	// considered stale and dropped instead of being sent.
+	MaxSlotAge uint64
+
+	// AllowedAccounts restricts the price accounts that may be updated.
+	// Empty allows all accounts.
+	AllowedAccounts []solana.PublicKey
+
+	// Memo tags every transaction with a Memo program instruction,
+	// e.g. to identify the publishing instance. Empty disables the memo.
+	Memo string
+
+	// NonceAccount sends one transaction per flush through this durable nonce account,
+	// so it cannot expire while block hashes are unavailable. Zero disables.
+	// NonceAuthority must be the signer key, which it defaults to.
+	NonceAccount   solana.PublicKey
+	NonceAuthority solana.PublicKey
+
+	// MaxUpdatesPerTx caps the number of price updates per transaction,
+	// trading throughput for isolation of failing updates. 0 only limits by size.
+	MaxUpdatesPerTx int
+	// MaxTransactions caps the number of transactions sent per slot. Excess updates
+	// are dropped lowest Weights first. 0 disables the cap.
+	MaxTransactions int
+	// Weights ranks price accounts by importance, 1 by default.
+	Weights map[solana.PublicKey]float64
+
+	// PriorityFee is the compute unit price in micro-lamports paid on top of the base fee,
+	// for up to ComputeUnitLimit units per transaction. 0 pays the base fee only.
+	PriorityFee      uint64
+	ComputeUnitLimit uint32 // defaults to schedule.DefaultComputeUnits
+
+	// DrainTimeout sends the queued updates once more when Run returns,
+	// giving up after this duration. 0 disables draining.
+	DrainTimeout time.Duration
+
+	// SlotAligned sends transactions SendOffset after the start of each slot
+	// and skips slots while a previous send is still in flight.
+	SlotAligned bool
+	SendOffset  time.Duration
+
+	// SubmitCommitment is the commitment level at which sent transactions
+	// count as landed. Defaults to confirmed.
+	SubmitCommitment rpc.CommitmentType
+
+	// SendOptions configure the sendTransaction calls.
+	// Nil uses schedule.DefaultSendOptions, which skip preflight.
+	SendOptions *schedule.SendOptions
+
+	// NotifyProcessed reports transactions to SubscribePublished as soon as
+	// they reach processed commitment, ahead of SubmitCommitment.
+	NotifyProcessed bool
+
+	// CoalesceInFlight holds back updates of price accounts while a transaction
+	// updating the same account is in flight, so transactions don't race on chain.
+	CoalesceInFlight bool
+
+	// StatsWindows are the rolling windows of publishing statistics.
+	// Defaults to stats.DefaultWindows.
+	StatsWindows []time.Duration
+
+	// BreakerRules reject updates that move the price too fast from the latest landed price.
+	// The first rule matching an account applies. Empty disables the breaker.
+	BreakerRules []BreakerRule
+
+	// FutureSlots rejects or clamps updates stamped too far ahead of the current slot.
+	FutureSlots schedule.FutureSlotGuard
+
+	// RetainUnconfirmed keeps a copy of sent updates until their transaction
+	// lands or this duration passes, to replay them on Failover. 0 disables.
+	RetainUnconfirmed time.Duration
+
+	// StaleTimeout publishes an unknown status for price accounts without
+	// updates for this duration, until updates resume. 0 disables.
+	StaleTimeout time.Duration
+
+	// Leader enables hot-standby between instances sharing the publisher key.
+	// Nil always publishes.
+	Leader *LeaderOptions
+
+	// ConflictSlots reports price accounts updated with our key by another publisher
+	// if their on-chain pub slots do not match our updates for this many slots.
+	// Requires feeding price accounts to ObserveComponent. 0 disables.
+	ConflictSlots uint64
+
+	// TracerProvider creates spans of flushes and sent transactions.
+	// Nil uses the global provider, which is a no-op unless configured.
+	TracerProvider trace.TracerProvider
+
+	// Faults injects failures for testing. Nil disables fault injection.
+	Faults *faults.Injector
+}
+
+// PushOptions modify how a price update is processed.
+type PushOptions struct {
+	Override bool   // bypass the rate-of-change breaker
+	PubSlot  uint64 // stamp the update with this slot instead of the current slot
+
+	// CorrelationID traces the update through to the logs of its transaction.
+	CorrelationID string
+	// Span is linked from the span of the transaction sending the update.
+	Span trace.SpanContext
+}
+
+// DefaultMaxSlotAge is the default value for Options.MaxSlotAge.
+const DefaultMaxSlotAge = 32
+
+// ErrAccountNotAllowed is returned when pushing a price to an account not on the allowlist.
+var ErrAccountNotAllowed = errors.New("price account not allowed")
+
+// ErrFutureSlot is returned when pushing a price stamped too far ahead of the current slot.
+var ErrFutureSlot = schedule.ErrFutureSlot
+
+// Publisher is the price publish pipeline.
+type Publisher struct {
+	Log *zap.Logger
+
+	program        solana.PublicKey
+	signer         *signer.Signer
+	buffer         *schedule.Buffer
+	slots          *schedule.SlotMonitor
+	blockhashes    *schedule.BlockHashMonitor
+	sched          *schedule.Scheduler
+	confirmer      *schedule.Confirmer
+	readRPC        *rpc.Client
+	sendRPC        *rpc.Client
+	endpoints      clusterEndpoints
+	allowed        allowlist
+	breaker        *breaker
+	stats          *stats.Recorder
+	leader         *leader // nil if hot-standby is disabled
+	leaderSchedule *leaderSchedule
+	genesisHash    solana.Hash
+	watchdog       *staleWatchdog    // nil if disabled
+	conflicts      *conflictDetector // nil if disabled
+	supervisor     *supervisor
+	wsURL          string
+	wsHeaders      http.Header
+	drainTimeout   time.Duration
+	landedSlot     uint64 // slot when a sent transaction last landed
+}
+
+// New creates a new unstarted publisher.
+func New(opts Options) (*Publisher, error) {
+	if opts.Signer == nil {
+		return nil, errors.New("missing signer")
+	}
+	if opts.RPCURL == "" {
+		return nil, errors.New("missing RPC URL")
+	}
+	if opts.WebSocketURL == "" {
+		return nil, errors.New("missing WebSocket URL")
+	}
+	var nonce *schedule.DurableNonce
+	if !opts.NonceAccount.IsZero() {
+		nonce = &schedule.DurableNonce{Account: opts.NonceAccount, Authority: opts.NonceAuthority}
+		if nonce.Authority.IsZero() {
+			nonce.Authority = opts.Signer.Pubkey()
+		}
+		if !nonce.Authority.Equals(opts.Signer.Pubkey()) {
+			return nil, fmt.Errorf("nonce authority %s is not the signer key", nonce.Authority)
+		}
+	}
+	log := opts.Log
+	if log == nil {
+		log = zap.NewNop()
+	}
+	if opts.MaxSlotAge == 0 {
+		opts.MaxSlotAge = DefaultMaxSlotAge
+	}
+
+	recorder := stats.NewRecorder(opts.StatsWindows...)
+
+	if opts.SendRPCURL == "" {
+		opts.SendRPCURL = opts.RPCURL
+		opts.SendRPCHeaders = opts.RPCHeaders
+	}
+	// Endpoints are switched on failover, see Failover.
+	readEndpoint := newRPCSwitch(opts.RPCURL, opts.RPCHeaders, RPCRoleRead, opts.Faults)
+	sendEndpoint := newRPCSwitch(opts.SendRPCURL, opts.SendRPCHeaders, RPCRoleSend, opts.Faults)
+	readRPC := readEndpoint.client()
+	sendRPC := sendEndpoint.client()
+
+	// Block hashes come from the send endpoint so it never sees one it does not know yet.
+	blockhashes := schedule.NewBlockHashMonitor(sendRPC)
+	blockhashes.Log = log.Named("blockhash")
+	blockhashes.Stats = recorder
+
+	slots := schedule.NewSlotMonitor(append([]string{opts.WebSocketURL}, opts.SlotWebSocketURLs...)...)
+	slots.Log = log.Named("slots")
+	slots.WebSocketHeaders = []http.Header{opts.WebSocketHeaders}
+	slots.Faults = opts.Faults
+	slots.HeightRPC = readRPC
+	blockhashes.BlockHeight = slots.BlockHeight
+	blockhashes.CurrentSlot = slots.Slot
+
+	buffer := schedule.NewBuffer()
+	buffer.Log = log.Named("buffer")
+	buffer.Memo = opts.Memo
+	buffer.Stats = recorder
+	buffer.FutureSlots = opts.FutureSlots
+	buffer.CurrentSlot = slots.Slot
+	buffer.CoalesceInFlight = opts.CoalesceInFlight
+	buffer.MaxUpdatesPerTx = opts.MaxUpdatesPerTx
+	buffer.MaxTransactions = opts.MaxTransactions
+	buffer.Weights = opts.Weights
+	if opts.PriorityFee > 0 {
+		buffer.PriorityFee = &schedule.PriorityFee{
+			MicroLamports: opts.PriorityFee,
+			ComputeUnits:  opts.ComputeUnitLimit,
+		}
+		if buffer.PriorityFee.ComputeUnits == 0 {
+			buffer.PriorityFee.ComputeUnits = schedule.DefaultComputeUnits
+		}
+	}
+	if nonce != nil {
+		buffer.ReservedSize = nonce.ReservedSize()
+	}
+
+	confirmer := schedule.NewConfirmer(readRPC, opts.WebSocketURL)
+	confirmer.Log = log.Named("confirmer")
+	confirmer.WebSocketHeaders = opts.WebSocketHeaders
+	confirmer.Stats = recorder
+
+	sched := schedule.NewScheduler(buffer, blockhashes, opts.Signer, sendRPC)
+	sched.Log = log.Named("scheduler")
+	sched.MaxSlotAge = opts.MaxSlotAge
+	sched.Confirmer = confirmer
+	sched.SlotAligned = opts.SlotAligned
+	sched.SendOffset = opts.SendOffset
+	if opts.SubmitCommitment != "" {
+		sched.SubmitCommitment = opts.SubmitCommitment
+	}
+	sched.NotifyProcessed = opts.NotifyProcessed
+	if opts.SendOptions != nil {
+		sched.SendOptions = *opts.SendOptions
+	}
+	sched.Nonce = nonce
+	sched.RetainUnconfirmed = opts.RetainUnconfirmed
+	sched.Stats = recorder
+	sched.Faults = opts.Faults
+	sched.TracerProvider = opts.TracerProvider
+	publisherEndpoints := make(map[solana.PublicKey]*rpcSwitch, len(opts.PublisherSendRPCURLs))
+	if len(opts.PublisherSendRPCURLs) > 0 {
+		sched.PublisherRPC = make(map[solana.PublicKey]*rpc.Client, len(opts.PublisherSendRPCURLs))
+		for publisher, endpoint := range opts.PublisherSendRPCURLs {
+			publisherEndpoints[publisher] = newRPCSwitch(endpoint, opts.SendRPCHeaders, RPCRoleSend, opts.Faults)
+			sched.PublisherRPC[publisher] = publisherEndpoints[publisher].client()
+		}
+	}
+
+	var lead *leader
+	if opts.Leader != nil {
+		lead = newLeader(log.Named("leader"), readRPC, opts.Signer.Pubkey(), opts.Program, slots.Slot, *opts.Leader)
+		sched.Standby = lead.standby
+		sched.OnSend = lead.sent
+	}
+
+	p := &Publisher{
+		Log:         log,
+		program:     opts.Program,
+		signer:      opts.Signer,
+		buffer:      buffer,
+		slots:       slots,
+		blockhashes: blockhashes,
+		sched:       sched,
+		confirmer:   confirmer,
+		readRPC:     readRPC,
+		sendRPC:     sendRPC,
+		endpoints: clusterEndpoints{
+			read:       readEndpoint,
+			send:       sendEndpoint,
+			publishers: publisherEndpoints,
+		},
+		allowed:        newAllowlist(opts.AllowedAccounts),
+		breaker:        newBreaker(log.Named("breaker"), opts.BreakerRules),
+		stats:          recorder,
+		leader:         lead,
+		leaderSchedule: newLeaderSchedule(readRPC),
+		genesisHash:    opts.GenesisHash,
+		wsURL:          opts.WebSocketURL,
+		wsHeaders:      opts.WebSocketHeaders,
+		supervisor:     newSupervisor(log.Named("supervisor")),
+		drainTimeout:   opts.DrainTimeout,
+	}
+	sched.SubscribePublished(p.recordLanded)
+	sched.SubscribePublished(p.breaker.published)
+	p.supervisor.add(ComponentBlockhash, func(ctx context.Context) error {
+		blockhashes.Run(ctx)
+		return nil
+	})
+	p.supervisor.add(ComponentSlots, slots.RunStream)
+	p.supervisor.add(ComponentSender, func(ctx context.Context) error {
+		sched.Run(ctx, slots.Updates())
+		return nil
+	})
+	if opts.StaleTimeout > 0 {
+		p.watchdog = newStaleWatchdog(log.Named("watchdog"), opts.StaleTimeout, p.pushUnknown)
+		p.supervisor.add(ComponentStaleWatchdog, func(ctx context.Context) error {
+			p.watchdog.run(ctx)
+			return nil
+		})
+	}
+	if opts.ConflictSlots > 0 {
+		p.conflicts = newConflictDetector(log.Named("conflicts"), opts.ConflictSlots)
+	}
+	if lead != nil {
+		p.supervisor.add(ComponentLeader, func(ctx context.Context) error {
+			lead.run(ctx)
+			return nil
+		})
+	}
+	return p, nil
+}
+
+// Run executes the publish pipeline until the context is cancelled.
+//
+// Pipeline components run under a supervisor restarting them
+// if they fail or on request (see RestartComponent).
+func (p *Publisher) Run(ctx context.Context) error {
+	if err := p.blockhashes.Init(ctx); err != nil {
+		return err
+	}
+	defer p.confirmer.Close()
+	defer p.slots.Close()
+	err := p.supervisor.run(ctx)
+	if p.drainTimeout > 0 {
+		p.sched.Drain(p.slots.Slot(), p.drainTimeout)
+	}
+	return err
+}
+
+// Supervise adds a component to be run and restarted with the pipeline,
+// e.g. a cache depending on the cluster. Must be called before Run.
+func (p *Publisher) Supervise(name string, run func(ctx context.Context) error) {
+	p.supervisor.add(name, run)
+}
+
+// RestartComponent cancels and relaunches a single pipeline component.
+// Queued updates are kept. Returns ErrUnknownComponent if no such component runs.
+func (p *Publisher) RestartComponent(name string) error {
+	return p.supervisor.restart(name)
+}
+
+// Components returns the state of the supervised pipeline components.
+func (p *Publisher) Components() []ComponentStatus {
+	return p.supervisor.status()
+}
+
+// PushPrice queues a price update for the given price account.
+//
+// The update is stamped with the current slot and replaces any
+// previously queued update for the same account.
+func (p *Publisher) PushPrice(account solana.PublicKey, price int64, conf uint64, status uint32) error {
+	return p.PushPriceWithOpts(account, price, conf, status, PushOptions{})
+}
+
+// PushPriceWithOpts is like PushPrice with additional options.
+func (p *Publisher) PushPriceWithOpts(account solana.PublicKey, price int64, conf uint64, status uint32, opts PushOptions) error {
+	if !p.allowed.allows(account) {
+		metricUpdatesRejected.WithLabelValues(rejectNotAllowed).Inc()
+		p.stats.Inc(stats.UpdatesRejected)
+		return ErrAccountNotAllowed
+	}
+	pubSlot := opts.PubSlot
+	if pubSlot == 0 {
+		pubSlot = p.slots.Slot()
+	}
+	// Check the slot before the breaker, which resets on accepted prices.
+	// The buffer trusts the checked slot, so the guard applies once.
+	pubSlot, err := p.buffer.CheckPubSlot(account, pubSlot)
+	if err != nil {
+		metricUpdatesRejected.WithLabelValues(rejectFutureSlot).Inc()
+		p.stats.Inc(stats.UpdatesRejected)
+		return err
+	}
+	if err := p.breaker.check(account, price, opts.Override); err != nil {
+		metricUpdatesRejected.WithLabelValues(rejectBreaker).Inc()
+		p.stats.Inc(stats.UpdatesRejected)
+		return err
+	}
+	update := pyth.CommandUpdPrice{
+		Status:  status,
+		Price:   price,
+		Conf:    conf,
+		PubSlot: pubSlot,
+	}
+	ins := pyth.NewInstructionBuilder(p.program).
+		UpdPriceNoFailOnError(p.signer.Pubkey(), account, update)
+	// Queue through the watchdog, so that it cannot replace the update with a halt.
+	p.watchdog.push(account, func() {
+		p.buffer.PushCheckedUpdate(ins, schedule.UpdateTrace{
+			CorrelationID: opts.CorrelationID,
+			Span:          opts.Span,
+		})
+	})
+	p.conflicts.push(account, ins.Payload.(*pyth.CommandUpdPrice).PubSlot)
+	p.stats.Inc(stats.UpdatesAccepted)
+	return nil
+}
+
+// pushUnknown queues a status-only update, marking the price account as not publishing.
+// It bypasses the breaker, which tracks prices only.
+func (p *Publisher) pushUnknown(account solana.PublicKey) error {
+	ins := pyth.NewInstructionBuilder(p.program).
+		UpdPriceNoFailOnError(p.signer.Pubkey(), account, pyth.CommandUpdPrice{
+			Status:  pyth.PriceStatusUnknown,
+			PubSlot: p.slots.Slot(),
+		})
+	if err := p.buffer.PushUpdate(ins); err != nil {
+		return err
+	}
+	p.conflicts.push(account, ins.Payload.(*pyth.CommandUpdPrice).PubSlot)
+	return nil
+}
+
+// WebSocketURL returns the configured WebSocket URL.
+func (p *Publisher) WebSocketURL() string {
+	return p.wsURL
+}
+
+// WebSocketHeaders returns the headers to send with WebSocket handshakes.
+func (p *Publisher) WebSocketHeaders() http.Header {
+	return p.wsHeaders
+}
+
+// Pubkey returns the publisher key.
+func (p *Publisher) Pubkey() solana.PublicKey {
+	return p.signer.Pubkey()
+}
+
+// Slot returns the slot number that the cluster is currently processing. 0 if unknown.
+func (p *Publisher) Slot() uint64 {
+	return p.slots.Slot()
+}
+
+// SubscribeSlots registers a callback invoked on every new slot.
+// The returned function removes the callback again.
+func (p *Publisher) SubscribeSlots(callback func(uint64)) context.CancelFunc {
+	return p.slots.Subscribe(callback)
+}
+
+// WarmUpRemaining estimates how long until the slot feed delivers its first slot.
+// 0 once the current slot is known.
+func (p *Publisher) WarmUpRemaining() time.Duration {
+	return p.slots.WarmUpRemaining()
+}
+
+// LandedSlot returns the slot observed when a sent transaction last landed.
+// 0 if none landed yet.
+func (p *Publisher) LandedSlot() uint64 {
+	return atomic.LoadUint64(&p.landedSlot)
+}
+
+func (p *Publisher) recordLanded(event schedule.PricePublished) {
+	if event.Status == schedule.ConfirmLanded && !event.Preliminary {
+		atomic.StoreUint64(&p.landedSlot, p.slots.Slot())
+	}
+}
+
+// EstimateFee estimates the fee of the transactions carrying the queued updates,
+// without flushing them.
+func (p *Publisher) EstimateFee(ctx context.Context) (schedule.FeeEstimate, error) {
+	return p.sched.EstimateFee(ctx)
+}
+
+// SubscribePublished registers a callback invoked when sent transactions
+// reach processed (if enabled, as preliminary events) and final commitment.
+// The returned function removes the callback again.
+func (p *Publisher) SubscribePublished(callback func(schedule.PricePublished)) context.CancelFunc {
+	return p.sched.SubscribePublished(callback)
+}
+
+// DropLog returns the most recently dropped updates, oldest first.
+func (p *Publisher) DropLog() []schedule.DroppedUpdate {
+	return p.buffer.DropLog()
+}
+
+// DebugState is a snapshot of the publish pipeline for debugging.
+type DebugState struct {
+	Queued             []schedule.QueuedUpdate
+	Slot               uint64
+	SlotTime           time.Time // zero if unknown
+	SlotStreamUp       bool
+	ConfirmerConnected bool
+	PendingConfirms    int       // sent transactions awaiting confirmation
+	LastFlush          time.Time // zero if never flushed
+	Drops              []schedule.DroppedUpdate
+}
+
+// DebugState returns a snapshot of the internal pipeline state.
+func (p *Publisher) DebugState() DebugState {
+	return DebugState{
+		Queued:             p.buffer.Queued(),
+		Slot:               p.slots.Slot(),
+		SlotTime:           p.slots.SlotTime(),
+		SlotStreamUp:       p.slots.Connected(),
+		ConfirmerConnected: p.confirmer.Connected(),
+		PendingConfirms:    p.confirmer.Pending(),
+		LastFlush:          p.sched.LastFlush(),
+		Drops:              p.buffer.DropLog(),
+	}
+}
+
+// Stats returns the rolling-window publishing statistics, shortest window first.
+func (p *Publisher) Stats() []stats.WindowStats {
+	return p.stats.Snapshot()
+}
+
+// ConfirmLatency estimates the q-quantile of the time until sent transactions land.
+// Returns false if no transaction has been confirmed yet.
+func (p *Publisher) ConfirmLatency(q float64) (time.Duration, bool) {
+	return schedule.ConfirmLatencyQuantile(q)
+}
+
+// SetSymbols provides the product symbols of price accounts,
+// used to match breaker rules and to label metrics.
+func (p *Publisher) SetSymbols(symbols map[solana.PublicKey]string) {
+	p.breaker.setSymbols(symbols)
+	p.buffer.SetSymbols(symbols)
+}
+
+// SetPermissions provides the publishers listed as components of price accounts.
+// Updates of listed price accounts not listing their publisher are dropped instead of sent.
+func (p *Publisher) SetPermissions(components map[solana.PublicKey][]solana.PublicKey) {
+	p.buffer.SetPermissions(components)
+}
+
+// LeaderState returns whether this instance publishes or stands by.
+// Empty if hot-standby is disabled.
+func (p *Publisher) LeaderState() LeaderState {
+	if p.leader == nil {
+		return ""
+	}
+	return p.leader.state()
+}
+
+// DetectsConflicts returns whether key conflicts are detected (see Options.ConflictSlots).
+func (p *Publisher) DetectsConflicts() bool {
+	return p.conflicts != nil
+}
+
+// ObserveComponent checks the pub slot of our component of a price account
+// as published on chain against the updates pushed by this instance.
+func (p *Publisher) ObserveComponent(account solana.PublicKey, pubSlot uint64) {
+	p.conflicts.observe(account, pubSlot, p.slots.Slot())
+}
+
+// KeyConflicts returns the price accounts currently updated by another publisher with our key.
+func (p *Publisher) KeyConflicts() []KeyConflict {
+	return p.conflicts.conflicts()
+}
+
+// TrippedBreakers returns the price accounts currently rejected by the breaker.
+func (p *Publisher) TrippedBreakers() []TrippedBreaker {
+	return p.breaker.tripped()
+}
+
+// allowlist restricts the price accounts that may be updated.
+// An empty allowlist allows all accounts.
+type allowlist map[solana.PublicKey]struct{}
+
+func newAllowlist(accounts []solana.PublicKey) allowlist {
+	a := make(allowlist, len(accounts))
+	for _, account := range accounts {
+		a[account] = struct{}{}
+	}
+	return a
+}
+
+func (a allowlist) allows(account solana.PublicKey) bool {
+	if len(a) == 0 {
+		return true
+	}
+	_, ok := a[account]
+	return ok
+}
@@ -0,0 +1,264 @@
+package publisher
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/signer/signertest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var testProgram = solana.MustPublicKeyFromBase58("gSbePebfvPy7tRqimPoVecS2UsBvYv46ynrzWocc92s")
+
+// newTestPublisher creates an unstarted publisher.
+func newTestPublisher(t *testing.T, opts Options) *Publisher {
+	if opts.RPCURL == "" {
+		opts.RPCURL = "http://127.0.0.1:0"
+	}
+	if opts.WebSocketURL == "" {
+		opts.WebSocketURL = "ws://127.0.0.1:0"
+	}
+	opts.Program = testProgram
+	if opts.Signer == nil {
+		opts.Signer = signertest.New(t, testProgram)
+	}
+	p, err := New(opts)
+	require.NoError(t, err)
+	return p
+}
+
+func TestPublisher_AllowedAccounts(t *testing.T) {
+	allowed := solana.NewWallet().PublicKey()
+	disallowed := solana.NewWallet().PublicKey()
+
+	p := newTestPublisher(t, Options{AllowedAccounts: []solana.PublicKey{allowed}})
+
+	assert.ErrorIs(t, p.PushPrice(disallowed, 1, 1, pyth.PriceStatusTrading), ErrAccountNotAllowed)
+	assert.Nil(t, p.buffer.Flush(0), "disallowed update got buffered")
+
+	assert.NoError(t, p.PushPrice(allowed, 1, 1, pyth.PriceStatusTrading))
+	assert.NotNil(t, p.buffer.Flush(0), "allowed update not buffered")
+}
+
+func TestPublisher_AllowAll(t *testing.T) {
+	p := newTestPublisher(t, Options{})
+	assert.NoError(t, p.PushPrice(solana.NewWallet().PublicKey(), 1, 1, pyth.PriceStatusTrading))
+	assert.NotNil(t, p.buffer.Flush(0))
+}
+
+// newMockRPC serves getRecentBlockhash and records the headers of each request.
+func newMockRPC(t *testing.T) (url string, headers <-chan http.Header) {
+	ch := make(chan http.Header, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var msg struct {
+			ID json.RawMessage `json:"id"`
+		}
+		_ = json.NewDecoder(req.Body).Decode(&msg)
+		ch <- req.Header
+		rw.Header().Set("content-type", "application/json")
+		_ = json.NewEncoder(rw).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      msg.ID,
+			"result": map[string]interface{}{
+				"context": map[string]interface{}{"slot": 100},
+				"value": map[string]interface{}{
+					"blockhash":     "4uQeVj5tqViQh7yWWGStvkEG1Zmhx6uasJtWCJziofM",
+					"feeCalculator": map[string]interface{}{"lamportsPerSignature": 5000},
+				},
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, ch
+}
+
+// mockSendCluster is a fake Solana RPC endpoint recording the transactions sent to it.
+type mockSendCluster struct {
+	*httptest.Server
+	slot      uint64
+	blockhash solana.Hash
+	down      bool // fail sending transactions, set before use
+
+	lock   sync.Mutex
+	lands  bool // whether transactions sent from now on land
+	sent   []*solana.Transaction
+	landed map[solana.Signature]bool
+}
+
+func newMockSendCluster(t *testing.T, slot uint64) *mockSendCluster {
+	m := &mockSendCluster{
+		slot:      slot,
+		blockhash: solana.Hash(solana.NewWallet().PublicKey()),
+		landed:    make(map[solana.Signature]bool),
+	}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var msg struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&msg))
+		res := map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID}
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		switch msg.Method {
+		case "getSlot":
+			res["result"] = m.slot
+		case "getRecentBlockhash":
+			res["result"] = map[string]interface{}{
+				"context": map[string]interface{}{"slot": m.slot},
+				"value": map[string]interface{}{
+					"blockhash":     m.blockhash.String(),
+					"feeCalculator": map[string]interface{}{"lamportsPerSignature": 5000},
+				},
+			}
+		case "sendTransaction":
+			var encoded string
+			require.NoError(t, json.Unmarshal(msg.Params[0], &encoded))
+			raw, err := base64.StdEncoding.DecodeString(encoded)
+			require.NoError(t, err)
+			tx, err := solana.TransactionFromDecoder(bin.NewBinDecoder(raw))
+			require.NoError(t, err)
+			m.sent = append(m.sent, tx)
+			if m.down {
+				res["error"] = map[string]interface{}{"code": -32005, "message": "Node is unhealthy"}
+				break
+			}
+			m.landed[tx.Signatures[0]] = m.lands
+			res["result"] = tx.Signatures[0].String()
+		case "getSignatureStatuses":
+			var sigs []solana.Signature
+			require.NoError(t, json.Unmarshal(msg.Params[0], &sigs))
+			statuses := make([]interface{}, len(sigs))
+			for i, sig := range sigs {
+				if m.landed[sig] {
+					statuses[i] = map[string]interface{}{
+						"slot":               m.slot,
+						"err":                nil,
+						"confirmationStatus": "confirmed",
+					}
+				}
+			}
+			res["result"] = map[string]interface{}{
+				"context": map[string]interface{}{"slot": m.slot},
+				"value":   statuses,
+			}
+		default:
+			res["result"] = nil
+		}
+		rw.Header().Set("content-type", "application/json")
+		_ = json.NewEncoder(rw).Encode(res)
+	}))
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *mockSendCluster) setLands(lands bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.lands = lands
+}
+
+func (m *mockSendCluster) sentTxs() []*solana.Transaction {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]*solana.Transaction(nil), m.sent...)
+}
+
+// runSender runs the transaction sender of a publisher, sending on the returned slot updates.
+func runSender(t *testing.T, p *Publisher) chan<- *ws.SlotsUpdatesResult {
+	require.NoError(t, p.blockhashes.Init(context.Background()))
+	ctx, cancel := context.WithCancel(context.Background())
+	slots := make(chan *ws.SlotsUpdatesResult)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.sched.Run(ctx, slots)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return slots
+}
+
+func TestPublisher_SendRPC(t *testing.T) {
+	readURL, readHeaders := newMockRPC(t)
+	sendURL, sendHeaders := newMockRPC(t)
+
+	t.Run("Separate", func(t *testing.T) {
+		sendsBefore := testutil.ToFloat64(metricRPCRequests.WithLabelValues(RPCRoleSend))
+		p := newTestPublisher(t, Options{
+			RPCURL:         readURL,
+			RPCHeaders:     http.Header{"X-Api-Key": {"read"}},
+			SendRPCURL:     sendURL,
+			SendRPCHeaders: http.Header{"Authorization": {"Bearer send"}},
+		})
+		require.NoError(t, p.blockhashes.Init(context.Background()))
+		headers := <-sendHeaders
+		assert.Equal(t, "Bearer send", headers.Get("Authorization"))
+		assert.Empty(t, headers.Get("X-Api-Key"))
+		assert.Empty(t, readHeaders)
+		assert.Equal(t, sendsBefore+1, testutil.ToFloat64(metricRPCRequests.WithLabelValues(RPCRoleSend)))
+	})
+
+	t.Run("Shared", func(t *testing.T) {
+		p := newTestPublisher(t, Options{
+			RPCURL:     readURL,
+			RPCHeaders: http.Header{"X-Api-Key": {"read"}},
+		})
+		require.NoError(t, p.blockhashes.Init(context.Background()))
+		assert.Equal(t, "read", (<-readHeaders).Get("X-Api-Key"))
+		assert.Empty(t, sendHeaders)
+	})
+}
+
+func TestPublisher_WebSocketHeaders(t *testing.T) {
+	// Upstream rejects every handshake, after recording its headers.
+	dials := make(chan http.Header, 16)
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		dials <- req.Header
+		http.Error(rw, "invalid API key", http.StatusUnauthorized)
+	}))
+	defer upstream.Close()
+
+	core, logs := observer.New(zap.DebugLevel)
+	p := newTestPublisher(t, Options{
+		Log:              zap.New(core),
+		WebSocketURL:     "ws" + strings.TrimPrefix(upstream.URL, "http"),
+		WebSocketHeaders: http.Header{"X-Api-Key": {"hunter2"}},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = p.slots.Run(ctx) }()
+
+	headers := <-dials
+	assert.Equal(t, "hunter2", headers.Get("X-Api-Key"))
+	require.Eventually(t, func() bool {
+		return logs.FilterMessage("Stream failed, restarting").Len() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The secret never shows up in logs.
+	for _, entry := range logs.All() {
+		assert.NotContains(t, entry.Message, "hunter2")
+		for key, value := range entry.ContextMap() {
+			assert.NotContains(t, fmt.Sprint(value), "hunter2", key)
+		}
+	}
+}
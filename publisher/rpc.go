@@ -0,0 +1,118 @@
+package publisher
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"go.blockdaemon.com/pythian/faults"
+)
+
+// RPC client roles, used as metric labels.
+const (
+	RPCRoleRead = "read" // account reads, block hashes, and confirmations
+	RPCRoleSend = "send" // transaction submission
+)
+
+// NewRPCClient creates a Solana JSON-RPC client that sends the given headers
+// with every request and counts requests by role.
+//
+// The optional fault injector fails read requests with 429 Too Many Requests.
+func NewRPCClient(endpoint string, headers http.Header, role string, faults *faults.Injector) *rpc.Client {
+	return rpc.NewWithCustomRPCClient(newJSONRPCClient(endpoint, headers, role, faults))
+}
+
+func newJSONRPCClient(endpoint string, headers http.Header, role string, faults *faults.Injector) jsonrpc.RPCClient {
+	customHeaders := make(map[string]string, len(headers))
+	for key := range headers {
+		customHeaders[key] = headers.Get(key)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 9
+	transport.IdleConnTimeout = 90 * time.Second
+	return jsonrpc.NewClientWithOpts(endpoint, &jsonrpc.RPCClientOpts{
+		HTTPClient: &http.Client{
+			Transport: &roleTransport{role: role, next: transport, faults: faults},
+		},
+		CustomHeaders: customHeaders,
+	})
+}
+
+// rpcSwitch is a JSON-RPC client whose endpoint can be replaced while in use,
+// so that all components sharing it follow a failover to another cluster.
+type rpcSwitch struct {
+	headers http.Header
+	role    string
+	faults  *faults.Injector
+	current atomic.Value // jsonrpc.RPCClient
+}
+
+func newRPCSwitch(endpoint string, headers http.Header, role string, faults *faults.Injector) *rpcSwitch {
+	s := &rpcSwitch{headers: headers, role: role, faults: faults}
+	s.switchTo(endpoint)
+	return s
+}
+
+// client returns a Solana RPC client using the current endpoint of the switch.
+func (s *rpcSwitch) client() *rpc.Client {
+	return rpc.NewWithCustomRPCClient(s)
+}
+
+// switchTo sends subsequent requests to another endpoint, with the same headers.
+func (s *rpcSwitch) switchTo(endpoint string) {
+	s.current.Store(newJSONRPCClient(endpoint, s.headers, s.role, s.faults))
+}
+
+func (s *rpcSwitch) CallForInto(ctx context.Context, out interface{}, method string, params []interface{}) error {
+	return s.current.Load().(jsonrpc.RPCClient).CallForInto(ctx, out, method, params)
+}
+
+func (s *rpcSwitch) CallWithCallback(ctx context.Context, method string, params []interface{}, callback func(*http.Request, *http.Response) error) error {
+	return s.current.Load().(jsonrpc.RPCClient).CallWithCallback(ctx, method, params, callback)
+}
+
+// roleTransport counts HTTP requests and failures of an RPC client role.
+type roleTransport struct {
+	role   string
+	next   http.RoundTripper
+	faults *faults.Injector
+}
+
+func (t *roleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	metricRPCRequests.WithLabelValues(t.role).Inc()
+	var res *http.Response
+	var err error
+	if t.role == RPCRoleRead && t.faults.ShouldLimitRead() {
+		res = tooManyRequests(req)
+	} else {
+		res, err = t.next.RoundTrip(req)
+	}
+	if err != nil || res.StatusCode >= 400 {
+		metricRPCErrors.WithLabelValues(t.role).Inc()
+	}
+	return res, err
+}
+
+// tooManyRequests fakes a rate limit response.
+func tooManyRequests(req *http.Request) *http.Response {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+	const body = "Too many requests (injected fault)"
+	return &http.Response{
+		Status:        "429 Too Many Requests",
+		StatusCode:    http.StatusTooManyRequests,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"text/plain"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,189 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.blockdaemon.com/pythian/schedule"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// Names of the supervised pipeline components.
+const (
+	ComponentBlockhash = "blockhash"
+	ComponentSlots     = "slots"
+	ComponentSender    = "sender"
+	ComponentLeader    = "leader"
+)
+
+// ComponentState is the lifecycle state of a supervised component.
+type ComponentState string
+
+const (
+	ComponentRunning    ComponentState = "running"
+	ComponentRestarting ComponentState = "restarting"
+	ComponentFailed     ComponentState = "failed"  // stopped on its own, restarting after backoff
+	ComponentStopped    ComponentState = "stopped" // publisher shut down
+)
+
+// ComponentStatus describes a supervised component.
+type ComponentStatus struct {
+	Name     string
+	State    ComponentState
+	Restarts int
+	Err      error // last failure, nil if none
+}
+
+// ErrUnknownComponent is returned when restarting a component that does not exist.
+var ErrUnknownComponent = errors.New("unknown component")
+
+// supervisor runs pipeline components with their own contexts,
+// so that they can be restarted independently.
+//
+// Components stopping on their own are restarted too. Starts of a component
+// are spaced at least backoff apart, like the automatic stream recovery.
+type supervisor struct {
+	log        *zap.Logger
+	backoff    time.Duration
+	components []*component
+}
+
+type component struct {
+	name    string
+	run     func(ctx context.Context) error
+	restart chan struct{}
+
+	lock     sync.Mutex
+	state    ComponentState
+	restarts int
+	err      error
+}
+
+func newSupervisor(log *zap.Logger) *supervisor {
+	return &supervisor{
+		log:     log,
+		backoff: schedule.RetryInterval,
+	}
+}
+
+// add registers a component. Must be called before run.
+func (s *supervisor) add(name string, run func(ctx context.Context) error) {
+	s.components = append(s.components, &component{
+		name:    name,
+		run:     run,
+		restart: make(chan struct{}, 1),
+		state:   ComponentStopped,
+	})
+}
+
+// run runs all components until the context is cancelled.
+func (s *supervisor) run(ctx context.Context) error {
+	var group errgroup.Group
+	for _, c := range s.components {
+		c := c
+		group.Go(func() error {
+			s.supervise(ctx, c)
+			return nil
+		})
+	}
+	return group.Wait()
+}
+
+func (s *supervisor) supervise(ctx context.Context, c *component) {
+	log := s.log.With(zap.String("component", c.name))
+	var lastStart time.Time
+	for {
+		if wait := s.backoff - time.Since(lastStart); !lastStart.IsZero() && wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				c.set(ComponentStopped, nil, false)
+				return
+			case <-timer.C:
+			}
+		}
+		lastStart = time.Now()
+
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() { done <- c.run(runCtx) }()
+		c.set(ComponentRunning, nil, false)
+
+		var err error
+		requested := false
+		select {
+		case err = <-done:
+		case <-c.restart:
+			requested = true
+			log.Info("Restarting component")
+			c.set(ComponentRestarting, nil, false)
+			cancel()
+			<-done
+		}
+		cancel()
+
+		switch {
+		case ctx.Err() != nil:
+			c.set(ComponentStopped, nil, false)
+			log.Info("Stopped component")
+			return
+		case requested:
+			c.set(ComponentRestarting, nil, true)
+			metricComponentRestarts.WithLabelValues(c.name, restartRequested).Inc()
+		default:
+			if err == nil {
+				err = errors.New("stopped unexpectedly")
+			}
+			log.Error("Component failed, restarting", zap.Error(err))
+			c.set(ComponentFailed, err, true)
+			metricComponentRestarts.WithLabelValues(c.name, restartFailed).Inc()
+		}
+	}
+}
+
+// restart requests a restart of the named component.
+func (s *supervisor) restart(name string) error {
+	for _, c := range s.components {
+		if c.name == name {
+			select {
+			case c.restart <- struct{}{}:
+			default: // restart already pending
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownComponent, name)
+}
+
+// status returns the state of all components in registration order.
+func (s *supervisor) status() []ComponentStatus {
+	statuses := make([]ComponentStatus, len(s.components))
+	for i, c := range s.components {
+		c.lock.Lock()
+		statuses[i] = ComponentStatus{
+			Name:     c.name,
+			State:    c.state,
+			Restarts: c.restarts,
+			Err:      c.err,
+		}
+		c.lock.Unlock()
+	}
+	return statuses
+}
+
+func (c *component) set(state ComponentState, err error, restarted bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.state = state
+	if err != nil {
+		c.err = err
+	}
+	if restarted {
+		c.restarts++
+	}
+}
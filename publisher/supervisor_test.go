@@ -0,0 +1,115 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pyth"
+	"go.uber.org/zap"
+)
+
+func TestSupervisor(t *testing.T) {
+	s := newSupervisor(zap.NewNop())
+	s.backoff = 50 * time.Millisecond
+
+	var steadyStarts, flakyStarts int32
+	s.add("steady", func(ctx context.Context) error {
+		atomic.AddInt32(&steadyStarts, 1)
+		<-ctx.Done()
+		return nil
+	})
+	s.add("flaky", func(ctx context.Context) error {
+		if atomic.AddInt32(&flakyStarts, 1) == 1 {
+			return errors.New("broken pipe")
+		}
+		<-ctx.Done()
+		return nil
+	})
+	assert.ErrorIs(t, s.restart("unknown"), ErrUnknownComponent)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = s.run(ctx)
+	}()
+
+	// Failed components are restarted after the backoff.
+	start := time.Now()
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&flakyStarts) == 2
+	}, 5*time.Second, time.Millisecond)
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(s.backoff))
+
+	// Requested restarts only affect the named component.
+	require.NoError(t, s.restart("steady"))
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&steadyStarts) == 2 && s.status()[0].State == ComponentRunning
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&flakyStarts))
+
+	statuses := s.status()
+	require.Len(t, statuses, 2)
+	assert.Equal(t, "steady", statuses[0].Name)
+	assert.Equal(t, 1, statuses[0].Restarts)
+	assert.NoError(t, statuses[0].Err)
+	assert.Equal(t, "flaky", statuses[1].Name)
+	assert.Equal(t, ComponentRunning, statuses[1].State)
+	assert.Equal(t, 1, statuses[1].Restarts)
+	assert.EqualError(t, statuses[1].Err, "broken pipe")
+
+	cancel()
+	<-done
+	for _, status := range s.status() {
+		assert.Equal(t, ComponentStopped, status.State, status.Name)
+	}
+}
+
+func TestPublisher_RestartComponent(t *testing.T) {
+	rpcURL, _ := newMockRPC(t)
+	p := newTestPublisher(t, Options{RPCURL: rpcURL})
+	p.supervisor.backoff = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = p.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	price := solana.NewWallet().PublicKey()
+	require.NoError(t, p.PushPrice(price, 1, 1, pyth.PriceStatusTrading))
+	require.Eventually(t, func() bool {
+		return senderStatus(p).State == ComponentRunning
+	}, 5*time.Second, time.Millisecond)
+
+	require.NoError(t, p.RestartComponent(ComponentSender))
+	require.Eventually(t, func() bool {
+		status := senderStatus(p)
+		return status.Restarts == 1 && status.State == ComponentRunning
+	}, 5*time.Second, time.Millisecond)
+
+	// Queued updates survive the restart.
+	queued := p.buffer.Queued()
+	require.Len(t, queued, 1)
+	assert.Equal(t, price, queued[0].Price)
+}
+
+func senderStatus(p *Publisher) ComponentStatus {
+	for _, status := range p.Components() {
+		if status.Name == ComponentSender {
+			return status
+		}
+	}
+	return ComponentStatus{}
+}
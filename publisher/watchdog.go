@@ -0,0 +1,97 @@
+package publisher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"go.uber.org/zap"
+)
+
+// ComponentStaleWatchdog names the stale price watchdog in the supervisor.
+const ComponentStaleWatchdog = "stale_watchdog"
+
+// staleWatchdog halts price accounts whose feed stopped sending updates.
+//
+// Pyth penalizes publishers of stale prices, so instead of leaving the last
+// price on chain, the watchdog publishes an unknown status. The next update
+// pushed for the account resumes publishing.
+type staleWatchdog struct {
+	log     *zap.Logger
+	timeout time.Duration
+	halt    func(account solana.PublicKey) error
+	now     func() time.Time
+
+	lock   sync.Mutex
+	last   map[solana.PublicKey]time.Time
+	halted map[solana.PublicKey]bool
+}
+
+func newStaleWatchdog(log *zap.Logger, timeout time.Duration, halt func(solana.PublicKey) error) *staleWatchdog {
+	return &staleWatchdog{
+		log:     log,
+		timeout: timeout,
+		halt:    halt,
+		now:     time.Now,
+		last:    make(map[solana.PublicKey]time.Time),
+		halted:  make(map[solana.PublicKey]bool),
+	}
+}
+
+// push queues a fresh update for a price account and records it as seen.
+//
+// The lock is held across both steps, so that check cannot halt the account in between.
+func (w *staleWatchdog) push(account solana.PublicKey, queue func()) {
+	if w == nil {
+		queue()
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	queue()
+	w.last[account] = w.now()
+	if w.halted[account] {
+		delete(w.halted, account)
+		metricStaleHalted.Dec()
+		w.log.Info("Price feed resumed", zap.Stringer("price", account))
+	}
+}
+
+// check halts accounts without updates for longer than the timeout.
+//
+// The lock is held while halting, so that an update pushed concurrently
+// is queued and recorded by push either before the check or after the halt update.
+func (w *staleWatchdog) check() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	now := w.now()
+	for account, last := range w.last {
+		if w.halted[account] || now.Sub(last) <= w.timeout {
+			continue
+		}
+		if err := w.halt(account); err != nil {
+			w.log.Error("Failed to halt stale price", zap.Stringer("price", account), zap.Error(err))
+			continue
+		}
+		w.halted[account] = true
+		metricStaleHalted.Inc()
+		w.log.Warn("Price feed stale, publishing unknown status",
+			zap.Stringer("price", account),
+			zap.Duration("timeout", w.timeout))
+	}
+}
+
+// run checks for stale accounts until the context is cancelled.
+func (w *staleWatchdog) run(ctx context.Context) {
+	ticker := time.NewTicker(w.timeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
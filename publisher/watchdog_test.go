@@ -0,0 +1,89 @@
+package publisher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/schedule"
+	"go.uber.org/zap"
+)
+
+func TestPublisher_StaleWatchdog(t *testing.T) {
+	p := newTestPublisher(t, Options{StaleTimeout: 10 * time.Second})
+	now := time.Unix(1000, 0)
+	p.watchdog.now = func() time.Time { return now }
+
+	live, stale := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	queued := func(account solana.PublicKey) schedule.QueuedUpdate {
+		for _, update := range p.DebugState().Queued {
+			if update.Price == account {
+				return update
+			}
+		}
+		t.Fatalf("no update queued for %s", account)
+		return schedule.QueuedUpdate{}
+	}
+
+	require.NoError(t, p.PushPrice(live, 100, 1, pyth.PriceStatusTrading))
+	require.NoError(t, p.PushPrice(stale, 200, 2, pyth.PriceStatusTrading))
+
+	// The stale feed stops while the other one keeps updating.
+	now = now.Add(6 * time.Second)
+	require.NoError(t, p.PushPrice(live, 101, 1, pyth.PriceStatusTrading))
+	p.watchdog.check()
+	assert.Equal(t, uint32(pyth.PriceStatusTrading), queued(stale).Status, "halted before timeout")
+
+	now = now.Add(6 * time.Second)
+	p.watchdog.check()
+	assert.Equal(t, uint32(pyth.PriceStatusUnknown), queued(stale).Status)
+	assert.Zero(t, queued(stale).Value)
+	assert.Equal(t, uint32(pyth.PriceStatusTrading), queued(live).Status)
+	assert.Equal(t, int64(101), queued(live).Value)
+
+	// Halted once, not on every check.
+	require.NotEmpty(t, p.buffer.Flush(0))
+	p.watchdog.check()
+	assert.Empty(t, p.DebugState().Queued)
+
+	// Fresh prices resume trading.
+	require.NoError(t, p.PushPrice(stale, 210, 2, pyth.PriceStatusTrading))
+	assert.Equal(t, uint32(pyth.PriceStatusTrading), queued(stale).Status)
+	assert.False(t, p.watchdog.halted[stale])
+	now = now.Add(time.Second)
+	p.watchdog.check()
+	assert.Equal(t, int64(210), queued(stale).Value)
+}
+
+func TestStaleWatchdog_Push(t *testing.T) {
+	now := time.Unix(1000, 0)
+	w := newStaleWatchdog(zap.NewNop(), 10*time.Second, func(solana.PublicKey) error { return nil })
+	w.now = func() time.Time { return now }
+	account := solana.NewWallet().PublicKey()
+
+	var queued int
+	queue := func() { queued++ }
+	w.push(account, queue)
+	assert.Equal(t, 1, queued)
+	assert.Equal(t, now, w.last[account])
+
+	now = now.Add(11 * time.Second)
+	w.check()
+	require.True(t, w.halted[account])
+
+	// Queuing a fresh update resumes the account.
+	w.push(account, queue)
+	assert.Equal(t, 2, queued)
+	assert.False(t, w.halted[account])
+	assert.Equal(t, now, w.last[account])
+	w.check()
+	assert.False(t, w.halted[account], "halted right after a fresh update")
+
+	// Without a watchdog, updates are still queued.
+	var disabled *staleWatchdog
+	disabled.push(account, queue)
+	assert.Equal(t, 3, queued)
+}
@@ -0,0 +1,78 @@
+// Package rpcauth attaches authentication headers to Solana RPC connections.
+//
+// Header values may reference secrets in environment variables or files,
+// so that they do not appear in process arguments.
+package rpcauth
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ParseHeaders parses headers in the format "Key: Value".
+// Values are resolved with ResolveValue.
+func ParseHeaders(lines []string) (http.Header, error) {
+	headers := make(http.Header, len(lines))
+	for _, line := range lines {
+		colon := strings.IndexByte(line, ':')
+		if colon <= 0 {
+			return nil, fmt.Errorf("invalid header %q: expected 'Key: Value'", redact(line))
+		}
+		key := strings.TrimSpace(line[:colon])
+		value, err := ResolveValue(strings.TrimSpace(line[colon+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid header %q: %w", key, err)
+		}
+		headers.Add(key, value)
+	}
+	return headers, nil
+}
+
+// ResolveValue resolves secret references.
+//
+// "env:NAME" is replaced with the content of the environment variable NAME,
+// "file:PATH" with the content of the file at PATH, trimmed of surrounding whitespace.
+// Other values are returned as is.
+func ResolveValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, "file:"):
+		buf, err := os.ReadFile(strings.TrimPrefix(value, "file:"))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(buf)), nil
+	default:
+		return value, nil
+	}
+}
+
+// BearerToken adds an "Authorization: Bearer" header to the given headers.
+// The token is resolved with ResolveValue. An empty token is ignored.
+func BearerToken(headers http.Header, token string) error {
+	if token == "" {
+		return nil
+	}
+	secret, err := ResolveValue(token)
+	if err != nil {
+		return fmt.Errorf("invalid bearer token: %w", err)
+	}
+	headers.Set("Authorization", "Bearer "+secret)
+	return nil
+}
+
+// redact hides the value of a header line.
+func redact(line string) string {
+	if len(line) > 8 {
+		return line[:4] + "..."
+	}
+	return "..."
+}
@@ -0,0 +1,43 @@
+package rpcauth
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHeaders(t *testing.T) {
+	t.Setenv("PYTHIAN_TEST_SECRET", "from-env")
+	secretPath := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(secretPath, []byte("from-file\n"), 0600))
+
+	headers, err := ParseHeaders([]string{
+		"X-Plain: value",
+		"X-Env: env:PYTHIAN_TEST_SECRET",
+		"X-File:file:" + secretPath,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.Header{
+		"X-Plain": {"value"},
+		"X-Env":   {"from-env"},
+		"X-File":  {"from-file"},
+	}, headers)
+
+	_, err = ParseHeaders([]string{"X-Env: env:PYTHIAN_TEST_UNSET"})
+	assert.EqualError(t, err, `invalid header "X-Env": environment variable PYTHIAN_TEST_UNSET not set`)
+	_, err = ParseHeaders([]string{"no colon"})
+	assert.Error(t, err)
+}
+
+func TestBearerToken(t *testing.T) {
+	t.Setenv("PYTHIAN_TEST_TOKEN", "abc")
+	headers := make(http.Header)
+	require.NoError(t, BearerToken(headers, ""))
+	assert.Empty(t, headers)
+	require.NoError(t, BearerToken(headers, "env:PYTHIAN_TEST_TOKEN"))
+	assert.Equal(t, "Bearer abc", headers.Get("Authorization"))
+}
@@ -8,35 +8,59 @@ import (
 	"time"
 
 	"github.com/gagliardetto/solana-go/rpc"
+	"go.blockdaemon.com/pythian/stats"
 	"go.uber.org/zap"
 )
 
+// MaxBlockhashAge is the number of blocks after which a block hash expires.
+const MaxBlockhashAge = 150
+
 type BlockHashMonitor struct {
-	client *rpc.Client
-	hash   atomic.Value
+	client  *rpc.Client
+	hash    atomic.Value
+	fetched atomic.Value // blockhashFetch of the current hash
 
 	Log      *zap.Logger
 	Interval time.Duration
+	Stats    *stats.Recorder // optional rolling-window counters
+
+	// BlockHeight and CurrentSlot optionally provide the chain position
+	// to estimate when the current block hash expires. Both return 0 if unknown.
+	BlockHeight func() uint64
+	CurrentSlot func() uint64
+	// FallbackLogSampler throttles warnings about slot-based expiry estimates.
+	FallbackLogSampler *LogSampler
+}
+
+// blockhashFetch is the chain position at which a block hash was fetched.
+type blockhashFetch struct {
+	height uint64
+	slot   uint64
 }
 
 // NewBlockHashMonitor creates a new unstarted monitor for recent block hashes.
-//
-// It also fetches one hash to start out during the lifetime of the given context.
-func NewBlockHashMonitor(ctx context.Context, client *rpc.Client) (*BlockHashMonitor, error) {
-	monitor := &BlockHashMonitor{
+func NewBlockHashMonitor(client *rpc.Client) *BlockHashMonitor {
+	return &BlockHashMonitor{
 		client:   client,
 		Log:      zap.NewNop(),
 		Interval: 2 * time.Second,
+
+		FallbackLogSampler: NewLogSampler(1, time.Minute),
 	}
-	if err := monitor.tick(ctx); err != nil {
-		return nil, fmt.Errorf("failed to get initial recent block hash: %w", err)
+}
+
+// Init fetches the first recent block hash.
+func (b *BlockHashMonitor) Init(ctx context.Context) error {
+	if err := b.tick(ctx); err != nil {
+		return fmt.Errorf("failed to get initial recent block hash: %w", err)
 	}
-	return monitor, nil
+	return nil
 }
 
 // Run the block hash monitor in the background.
 func (b *BlockHashMonitor) Run(ctx context.Context) {
 	ticker := time.NewTicker(b.Interval)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
@@ -54,6 +78,7 @@ func (b *BlockHashMonitor) Run(ctx context.Context) {
 func (b *BlockHashMonitor) tick(ctx context.Context) error {
 	res, err := b.client.GetRecentBlockhash(ctx, rpc.CommitmentConfirmed)
 	if err != nil {
+		b.Stats.Inc(stats.RPCErrors)
 		return err
 	}
 	if res == nil || res.Value == nil {
@@ -61,11 +86,54 @@ func (b *BlockHashMonitor) tick(ctx context.Context) error {
 	}
 	b.Log.Debug("Updated recent block hash", zap.Stringer("blockhash", &res.Value.Blockhash))
 	b.hash.Store(res.Value)
+	b.fetched.Store(blockhashFetch{
+		height: callOptional(b.BlockHeight),
+		slot:   callOptional(b.CurrentSlot),
+	})
 	metricBlockhashUpdates.Inc()
 	return nil
 }
 
+// Refresh fetches a new recent block hash immediately.
+func (b *BlockHashMonitor) Refresh(ctx context.Context) error {
+	return b.tick(ctx)
+}
+
 // GetRecentBlockHash returns the latest cached "recent blockhash" value.
+// Returns nil if no block hash has been fetched yet.
 func (b *BlockHashMonitor) GetRecentBlockHash() *rpc.BlockhashResult {
-	return b.hash.Load().(*rpc.BlockhashResult)
+	hash, _ := b.hash.Load().(*rpc.BlockhashResult)
+	return hash
+}
+
+// BlocksRemaining estimates the number of blocks until the current block hash expires.
+//
+// The estimate is based on block heights, as skipped slots do not count towards expiry.
+// If the block height is unavailable, it falls back to slots, which underestimates
+// the remaining blocks when slots are skipped. Returns false if neither is known.
+func (b *BlockHashMonitor) BlocksRemaining() (int64, bool) {
+	fetched, ok := b.fetched.Load().(blockhashFetch)
+	if !ok {
+		return 0, false
+	}
+	if height := callOptional(b.BlockHeight); height != 0 && fetched.height != 0 {
+		return int64(fetched.height) + MaxBlockhashAge - int64(height), true
+	}
+	slot := callOptional(b.CurrentSlot)
+	if slot == 0 || fetched.slot == 0 {
+		return 0, false
+	}
+	metricBlockHeightFallbacks.Inc()
+	if ok, suppressed := b.FallbackLogSampler.Allow(); ok {
+		b.Log.Warn("Block height unavailable, estimating block hash expiry from slots",
+			zap.Int("suppressed", suppressed))
+	}
+	return int64(fetched.slot) + MaxBlockhashAge - int64(slot), true
+}
+
+func callOptional(fn func() uint64) uint64 {
+	if fn == nil {
+		return 0
+	}
+	return fn()
 }
@@ -0,0 +1,40 @@
+package schedule
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockHashMonitor_BlocksRemaining(t *testing.T) {
+	node := newMockSendNode(t)
+	b := NewBlockHashMonitor(rpc.New(node.URL))
+	var height, slot uint64
+	b.BlockHeight = func() uint64 { return height }
+	b.CurrentSlot = func() uint64 { return slot }
+
+	_, ok := b.BlocksRemaining()
+	assert.False(t, ok, "no block hash yet")
+
+	height, slot = 1000, 1200
+	require.NoError(t, b.Init(context.Background()))
+
+	// Skipped slots do not count towards expiry.
+	height, slot = 1100, 1400
+	remaining, ok := b.BlocksRemaining()
+	require.True(t, ok)
+	assert.Equal(t, int64(50), remaining)
+
+	// Without block height, slots are the conservative estimate.
+	height = 0
+	remaining, ok = b.BlocksRemaining()
+	require.True(t, ok)
+	assert.Equal(t, int64(-50), remaining)
+
+	slot = 0
+	_, ok = b.BlocksRemaining()
+	assert.False(t, ok)
+}
@@ -1,10 +1,15 @@
 package schedule
 
 import (
+	"bytes"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/gagliardetto/solana-go"
 	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/stats"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -12,20 +17,109 @@ import (
 type Buffer struct {
 	Log *zap.Logger
 
+	// ReservedSize is the number of bytes per transaction reserved
+	// for instructions added after flushing.
+	ReservedSize int
+
+	// Memo is prepended to each transaction as a Memo program instruction.
+	// Empty omits the instruction.
+	Memo string
+
+	// Clock returns the current time, used to stamp dropped updates.
+	Clock func() time.Time
+
+	// MaxUpdatesPerTx caps the number of updates per transaction, so that
+	// a failing transaction takes fewer updates with it. 0 only limits by size.
+	MaxUpdatesPerTx int
+
+	// MaxTransactions caps the number of transactions per flush. Updates exceeding it
+	// are dropped, those of price accounts with the lowest Weights first. 0 disables the cap.
+	MaxTransactions int
+	// Weights ranks price accounts by importance. Higher weights are packed
+	// and sent first, lower weights are dropped first. Unlisted price accounts have DefaultWeight. Must not be modified after the buffer is in use.
+	Weights map[solana.PublicKey]float64
+
+	// PriorityFee prepends compute budget instructions to each transaction.
+	// Nil pays the base fee only.
+	PriorityFee *PriorityFee
+
+	Stats *stats.Recorder // optional rolling-window counters
+
+	// FutureSlots guards against updates stamped too far ahead of CurrentSlot,
+	// applied by PushUpdate, PushTracedUpdate and Requeue. CurrentSlot nil disables the guard.
+	FutureSlots FutureSlotGuard
+	CurrentSlot func() uint64
+
+	// CoalesceInFlight holds back updates of price accounts with a sent
+	// transaction that has not landed or failed yet. The latest held update
+	// is flushed once that transaction settles, instead of racing it on chain.
+	CoalesceInFlight bool
+
 	lock    sync.Mutex
 	updates map[solana.PublicKey]*pyth.Instruction
+	traces  map[solana.PublicKey]UpdateTrace // price => request that queued the update
+	flying  map[solana.PublicKey]bool        // prices with unsettled transactions, if CoalesceInFlight
+	drops   *dropLog
+	symbols map[solana.PublicKey]string // price => symbol, for metric labels
+	// components lists the publishers permitted to update each price account.
+	// Nil if unknown, prices missing from the map are not checked either.
+	components map[solana.PublicKey]map[solana.PublicKey]struct{}
 }
 
+// DefaultWeight is the weight of price accounts not listed in Buffer.Weights.
+const DefaultWeight = 1
+
+// DefaultDropLogSize is the number of dropped updates remembered by a buffer.
+const DefaultDropLogSize = 256
+
 func NewBuffer() *Buffer {
 	return &Buffer{
 		Log:     zap.NewNop(),
+		Clock:   time.Now,
 		updates: make(map[solana.PublicKey]*pyth.Instruction),
+		traces:  make(map[solana.PublicKey]UpdateTrace),
+		flying:  make(map[solana.PublicKey]bool),
+		drops:   newDropLog(DefaultDropLogSize),
 	}
 }
 
-func (b *Buffer) PushUpdate(ins *pyth.Instruction) {
-	_, ok := ins.Payload.(*pyth.CommandUpdPrice)
+// PushUpdate queues a price update instruction, replacing any previously
+// queued update for the same price account.
+//
+// Returns ErrFutureSlot if the update was rejected by the future slot guard.
+func (b *Buffer) PushUpdate(ins *pyth.Instruction) error {
+	return b.PushTracedUpdate(ins, UpdateTrace{})
+}
+
+// UpdateTrace identifies the request that submitted an update.
+type UpdateTrace struct {
+	CorrelationID string            // logged when the update is sent
+	Span          trace.SpanContext // linked from the span of the sending transaction
+}
+
+// PushTracedUpdate is like PushUpdate, attaching the trace of the request that submitted the update.
+func (b *Buffer) PushTracedUpdate(ins *pyth.Instruction, tr UpdateTrace) error {
+	update, ok := ins.Payload.(*pyth.CommandUpdPrice)
 	if !ok {
+		return nil
+	}
+	accs := ins.Accounts()
+	if len(accs) != 3 {
+		return nil
+	}
+	pubSlot, err := b.CheckPubSlot(accs[1].PublicKey, update.PubSlot)
+	if err != nil {
+		return err
+	}
+	update.PubSlot = pubSlot
+	b.PushCheckedUpdate(ins, tr)
+	return nil
+}
+
+// PushCheckedUpdate is like PushTracedUpdate without the future slot guard,
+// for callers that already applied CheckPubSlot to the update.
+func (b *Buffer) PushCheckedUpdate(ins *pyth.Instruction, tr UpdateTrace) {
+	if _, ok := ins.Payload.(*pyth.CommandUpdPrice); !ok {
 		return
 	}
 	accs := ins.Accounts()
@@ -36,60 +130,516 @@ func (b *Buffer) PushUpdate(ins *pyth.Instruction) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
 
-	publishAcc := accs[0].PublicKey
 	priceAcc := accs[1].PublicKey
-	if _, ok := b.updates[priceAcc]; ok {
-		metricUpdatesDropped.
-			WithLabelValues(publishAcc.String(), priceAcc.String(), "replaced").
-			Inc()
+	if prev, ok := b.updates[priceAcc]; ok {
+		b.drop(prev, DropOverwritten)
 	}
 	b.updates[priceAcc] = ins
+	if tr.CorrelationID != "" || tr.Span.IsValid() {
+		b.traces[priceAcc] = tr
+	} else {
+		delete(b.traces, priceAcc)
+	}
+}
+
+// CheckPubSlot applies the future slot guard to the pub slot of an update for the given price account.
+// Returns the pub slot to use, or ErrFutureSlot if the update should be rejected.
+func (b *Buffer) CheckPubSlot(price solana.PublicKey, pubSlot uint64) (uint64, error) {
+	if b.CurrentSlot == nil {
+		return pubSlot, nil
+	}
+	currentSlot := b.CurrentSlot()
+	checked, err := b.FutureSlots.check(pubSlot, currentSlot)
+	if err != nil {
+		b.Log.Warn("Rejecting price update with future pub slot",
+			zap.Stringer("price", price),
+			zap.Uint64("pub_slot", pubSlot),
+			zap.Uint64("current_slot", currentSlot))
+		metricFutureSlotUpdates.WithLabelValues(string(FutureSlotReject)).Inc()
+	} else if checked != pubSlot {
+		b.Log.Warn("Clamping future pub slot of price update",
+			zap.Stringer("price", price),
+			zap.Uint64("pub_slot", pubSlot),
+			zap.Uint64("current_slot", currentSlot))
+		metricFutureSlotUpdates.WithLabelValues(string(FutureSlotClamp)).Inc()
+	}
+	return checked, err
 }
 
-// Flush removes all queued instructions and places them into an unsigned transaction.
+// QueuedUpdate summarizes a price update waiting to be flushed.
+type QueuedUpdate struct {
+	Price   solana.PublicKey
+	PubSlot uint64
+	Value   int64  // price to publish
+	Conf    uint64 // confidence to publish
+	Status  uint32 // price status to publish
+}
+
+func summarizeUpdate(insn *pyth.Instruction) QueuedUpdate {
+	cmd := insn.Payload.(*pyth.CommandUpdPrice)
+	return QueuedUpdate{
+		Price:   insn.Accounts()[1].PublicKey,
+		PubSlot: cmd.PubSlot,
+		Value:   cmd.Price,
+		Conf:    cmd.Conf,
+		Status:  cmd.Status,
+	}
+}
+
+func summarizeUpdates(updates []*pyth.Instruction) []QueuedUpdate {
+	summaries := make([]QueuedUpdate, len(updates))
+	for i, insn := range updates {
+		summaries[i] = summarizeUpdate(insn)
+	}
+	return summaries
+}
+
+// Queued lists the updates waiting to be flushed, ordered by price account.
+func (b *Buffer) Queued() []QueuedUpdate {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	queued := make([]QueuedUpdate, 0, len(b.updates))
+	for _, insn := range b.updates {
+		queued = append(queued, summarizeUpdate(insn))
+	}
+	sort.Slice(queued, func(i, j int) bool {
+		return bytes.Compare(queued[i].Price[:], queued[j].Price[:]) < 0
+	})
+	return queued
+}
+
+// SetSymbols provides the product symbols of price accounts,
+// used to label metrics with LabelSymbol.
+func (b *Buffer) SetSymbols(symbols map[solana.PublicKey]string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.symbols = symbols
+}
+
+// symbol returns the symbol of a price account. Must hold lock.
+func (b *Buffer) symbol(price solana.PublicKey) string {
+	if symbol, ok := b.symbols[price]; ok {
+		return symbol
+	}
+	return unknownSymbol
+}
+
+// SetPermissions provides the publishers listed as components of price accounts.
+//
+// Updates of listed price accounts by other publishers are dropped at flush time,
+// since they would fail on chain. Price accounts not listed are not checked.
+func (b *Buffer) SetPermissions(components map[solana.PublicKey][]solana.PublicKey) {
+	permissions := make(map[solana.PublicKey]map[solana.PublicKey]struct{}, len(components))
+	for price, publishers := range components {
+		set := make(map[solana.PublicKey]struct{}, len(publishers))
+		for _, publisher := range publishers {
+			set[publisher] = struct{}{}
+		}
+		permissions[price] = set
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.components = permissions
+}
+
+// permitted returns whether the publisher of an update is a component of its price account.
+// Must hold lock.
+func (b *Buffer) permitted(insn *pyth.Instruction) bool {
+	publishers, ok := b.components[insn.Accounts()[1].PublicKey]
+	if !ok {
+		return true
+	}
+	_, ok = publishers[insn.Accounts()[0].PublicKey]
+	return ok
+}
+
+// DropLog returns the most recently dropped updates, oldest first.
+func (b *Buffer) DropLog() []DroppedUpdate {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.drops.list()
+}
+
+// drop records that an update will never be sent.
+func (b *Buffer) drop(insn *pyth.Instruction, reason DropReason) {
+	update := insn.Payload.(*pyth.CommandUpdPrice)
+	accs := insn.Accounts()
+	publishAcc := accs[0].PublicKey
+	priceAcc := accs[1].PublicKey
+	metrics := getUpdateMetrics()
+	metrics.dropped.
+		WithLabelValues(append(metrics.priceLabels(publishAcc, priceAcc, b.symbol), string(reason))...).
+		Inc()
+	b.Stats.Inc(stats.UpdatesDropped)
+	b.Stats.Inc(stats.DroppedBy(string(reason)))
+	b.drops.add(DroppedUpdate{
+		Time:    b.Clock(),
+		Price:   priceAcc,
+		PubSlot: update.PubSlot,
+		Reason:  reason,
+	})
+}
+
+// Flush removes all queued instructions and places them into unsigned transactions.
 // Returns nil if the buffer is empty.
 //
+// Each transaction only contains updates of a single publisher key, its signer.
+// Updates are packed in order of descending weight, then signer and price account,
+// so that the same set of updates always results in the same transaction messages
+// and transactions carrying the highest weights come first. Instructions within
+// a transaction are ordered by price account. Instructions are split across
+// as many transactions as needed to stay within MaxTransactionSize.
+//
 // Updates created earlier than the given minSlot will be removed.
-func (b *Buffer) Flush(minSlot uint64) *solana.TransactionBuilder {
+// Updates not fitting into MaxTransactions are dropped, the lowest weights first.
+// With CoalesceInFlight, updates of price accounts in flushed transactions
+// are held back until the transactions settle.
+func (b *Buffer) Flush(minSlot uint64) []*solana.TransactionBuilder {
+	flushed := b.flush(minSlot)
+	if flushed == nil {
+		return nil
+	}
+	builders := make([]*solana.TransactionBuilder, len(flushed))
+	for i, tx := range flushed {
+		builders[i] = tx.builder
+	}
+	return builders
+}
+
+// flushedTx is a transaction assembled by Buffer.flush.
+type flushedTx struct {
+	builder *solana.TransactionBuilder
+	insns   []solana.Instruction // instructions added to builder, before merging account metas
+	signer  solana.PublicKey     // publisher signing all updates, and fee payer
+	updates []*pyth.Instruction
+	traces  []string            // correlation IDs of traced updates
+	spans   []trace.SpanContext // spans of the requests that submitted updates
+}
+
+// flush is Flush, also returning the updates of each transaction.
+func (b *Buffer) flush(minSlot uint64) []flushedTx {
 	b.lock.Lock()
 	defer b.lock.Unlock()
 
-	// TODO(richard): Will fail if payload exceeds MTU, split into multiple txs
-	builder := solana.NewTransactionBuilder()
-	var updates uint
-	for price, insn := range b.updates {
+	var queued []queuedUpdate
+	for _, price := range b.sortedPrices() {
+		if b.flying[price] {
+			metricUpdatesHeld.Inc()
+			continue
+		}
+		insn := b.updates[price]
+		tr := b.traces[price]
 		delete(b.updates, price)
-		if b.appendUpdateToBuilder(builder, insn, minSlot) {
-			updates++
+		delete(b.traces, price)
+		if !b.checkUpdate(insn, minSlot) {
+			continue
+		}
+		if !b.permitted(insn) {
+			b.Log.Debug("Dropping price update of price account not listing the publisher",
+				zap.Stringer("price", price),
+				zap.Stringer("publisher", insn.Accounts()[0].PublicKey))
+			b.drop(insn, DropNotPermitted)
+			continue
+		}
+		update, ok := b.newQueuedUpdate(price, insn)
+		if !ok {
+			continue
 		}
+		update.trace = tr
+		queued = append(queued, update)
 	}
-	if updates == 0 {
-		return nil
+	b.sortByWeight(queued)
+	txs, overflow := b.pack(queued)
+	if len(overflow) > 0 {
+		for _, update := range overflow {
+			b.drop(update.insn, DropOverflow)
+		}
+		b.Log.Warn("Transaction limit exceeded, dropping lowest weight updates",
+			zap.Int("max_transactions", b.MaxTransactions),
+			zap.Int("dropped", len(overflow)))
+	}
+
+	metrics := getUpdateMetrics()
+	for _, tx := range txs {
+		for _, insn := range tx.updates {
+			price := insn.Accounts()[1].PublicKey
+			if b.CoalesceInFlight {
+				b.flying[price] = true
+			}
+			metrics.sent.
+				WithLabelValues(metrics.priceLabels(tx.signer, price, b.symbol)...).
+				Inc()
+			b.Stats.Inc(stats.UpdatesPublished)
+		}
+	}
+	return txs
+}
+
+// preview assembles the transactions the next flush would send, without modifying the buffer.
+// Unlike flush, it does not check for stale updates.
+func (b *Buffer) preview() []flushedTx {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var queued []queuedUpdate
+	for _, price := range b.sortedPrices() {
+		insn := b.updates[price]
+		if b.flying[price] || !b.permitted(insn) {
+			continue
+		}
+		if update, ok := b.previewUpdate(price, insn); ok {
+			queued = append(queued, update)
+		}
+	}
+	b.sortByWeight(queued)
+	txs, _ := b.pack(queued)
+	return txs
+}
+
+// queuedUpdate is an update about to be packed into a transaction.
+type queuedUpdate struct {
+	price   solana.PublicKey
+	insn    *pyth.Instruction
+	signer  solana.PublicKey
+	dataLen int
+	trace   UpdateTrace
+}
+
+// newQueuedUpdate prepares an update for packing,
+// dropping it if it does not even fit into an empty transaction.
+func (b *Buffer) newQueuedUpdate(price solana.PublicKey, insn *pyth.Instruction) (queuedUpdate, bool) {
+	data, err := insn.Data()
+	if err != nil {
+		b.Log.Error("Failed to serialize price update", zap.Error(err))
+		return queuedUpdate{}, false
+	}
+	update := queuedUpdate{
+		price:   price,
+		insn:    insn,
+		signer:  insn.Accounts()[0].PublicKey,
+		dataLen: len(data),
+	}
+	// An update that does not even fit into an empty transaction can never be sent.
+	if b.newSizer(update.signer).sizeWith(insn, len(data))+b.ReservedSize > MaxTransactionSize {
+		b.Log.Warn("Dropping oversized price update",
+			zap.Stringer("price", price),
+			zap.Int("reserved_size", b.ReservedSize))
+		b.drop(insn, DropOversized)
+		return queuedUpdate{}, false
+	}
+	return update, true
+}
+
+// previewUpdate is newQueuedUpdate without dropping.
+func (b *Buffer) previewUpdate(price solana.PublicKey, insn *pyth.Instruction) (queuedUpdate, bool) {
+	data, err := insn.Data()
+	if err != nil {
+		return queuedUpdate{}, false
+	}
+	signer := insn.Accounts()[0].PublicKey
+	if b.newSizer(signer).sizeWith(insn, len(data))+b.ReservedSize > MaxTransactionSize {
+		return queuedUpdate{}, false
+	}
+	return queuedUpdate{price: price, insn: insn, signer: signer, dataLen: len(data)}, true
+}
+
+// pack places updates into transactions in the order given, adding each update
+// to the last transaction of its signer while it has room.
+// Once MaxTransactions transactions are open, updates that do not fit into them
+// are returned as overflow. Updates within a transaction are ordered by price account.
+// Must hold lock.
+func (b *Buffer) pack(updates []queuedUpdate) (txs []flushedTx, overflow []queuedUpdate) {
+	type openTx struct {
+		index int
+		sizer *txSizer
+	}
+	open := make(map[solana.PublicKey]openTx)
+	var packed [][]queuedUpdate
+	for _, update := range updates {
+		last, ok := open[update.signer]
+		if !ok || (b.MaxUpdatesPerTx > 0 && len(packed[last.index]) >= b.MaxUpdatesPerTx) ||
+			last.sizer.sizeWith(update.insn, update.dataLen)+b.ReservedSize > MaxTransactionSize {
+			if b.MaxTransactions > 0 && len(txs) >= b.MaxTransactions {
+				overflow = append(overflow, update)
+				continue
+			}
+			last = openTx{index: len(txs), sizer: b.newSizer(update.signer)}
+			open[update.signer] = last
+			txs = append(txs, flushedTx{signer: update.signer})
+			packed = append(packed, nil)
+		}
+		last.sizer.add(update.insn, update.dataLen)
+		packed[last.index] = append(packed[last.index], update)
+	}
+	for i := range txs {
+		tx := &txs[i]
+		sort.Slice(packed[i], func(j, k int) bool {
+			return bytes.Compare(packed[i][j].price[:], packed[i][k].price[:]) < 0
+		})
+		for _, update := range packed[i] {
+			tx.updates = append(tx.updates, update.insn)
+			if update.trace.CorrelationID != "" {
+				tx.traces = append(tx.traces, update.trace.CorrelationID)
+			}
+			if update.trace.Span.IsValid() {
+				tx.spans = append(tx.spans, update.trace.Span)
+			}
+		}
+		tx.insns = b.instructions(tx.updates)
+		tx.builder = newMergedBuilder(tx.signer, tx.insns)
+	}
+	return txs, overflow
+}
+
+// sortByWeight orders updates by descending weight of their price accounts,
+// keeping the order of updates with equal weights.
+func (b *Buffer) sortByWeight(updates []queuedUpdate) {
+	sort.SliceStable(updates, func(i, j int) bool {
+		return b.weight(updates[i].price) > b.weight(updates[j].price)
+	})
+}
+
+// weight returns the configured weight of a price account.
+func (b *Buffer) weight(price solana.PublicKey) float64 {
+	if weight, ok := b.Weights[price]; ok {
+		return weight
+	}
+	return DefaultWeight
+}
+
+// sortedPrices returns the price accounts with queued updates grouped by signer,
+// the publisher key in the first account. Must hold lock.
+func (b *Buffer) sortedPrices() []solana.PublicKey {
+	prices := make([]solana.PublicKey, 0, len(b.updates))
+	for price := range b.updates {
+		prices = append(prices, price)
+	}
+	sort.Slice(prices, func(i, j int) bool {
+		signerI := b.updates[prices[i]].Accounts()[0].PublicKey
+		signerJ := b.updates[prices[j]].Accounts()[0].PublicKey
+		if c := bytes.Compare(signerI[:], signerJ[:]); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(prices[i][:], prices[j][:]) < 0
+	})
+	return prices
+}
+
+// dropFlushed records that flushed updates will never be sent.
+func (b *Buffer) dropFlushed(updates []*pyth.Instruction, reason DropReason) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, insn := range updates {
+		b.drop(insn, reason)
+	}
+}
+
+// settle releases held updates of the price accounts in a transaction
+// once it landed, failed, or was never sent.
+func (b *Buffer) settle(updates []*pyth.Instruction) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, insn := range updates {
+		delete(b.flying, insn.Accounts()[1].PublicKey)
+	}
+}
+
+// Requeue queues previously flushed updates again, e.g. to replay them to another cluster.
+//
+// Updates for price accounts with a newer queued update are discarded.
+// Updates created earlier than minSlot are dropped as stale,
+// and the future slot guard applies as in PushUpdate.
+// Returns the number of updates queued.
+func (b *Buffer) Requeue(updates []*pyth.Instruction, minSlot uint64) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var n int
+	for _, insn := range updates {
+		if !b.checkUpdate(insn, minSlot) {
+			continue
+		}
+		price := insn.Accounts()[1].PublicKey
+		update := insn.Payload.(*pyth.CommandUpdPrice)
+		pubSlot, err := b.CheckPubSlot(price, update.PubSlot)
+		if err != nil {
+			b.drop(insn, DropFutureSlot)
+			continue
+		}
+		update.PubSlot = pubSlot
+		if queued, ok := b.updates[price]; ok {
+			if queued.Payload.(*pyth.CommandUpdPrice).PubSlot >= insn.Payload.(*pyth.CommandUpdPrice).PubSlot {
+				b.drop(insn, DropOverwritten)
+				continue
+			}
+			b.drop(queued, DropOverwritten)
+		}
+		b.updates[price] = insn
+		delete(b.traces, price)
+		n++
+	}
+	return n
+}
+
+// newSizer starts sizing a transaction, accounting for the priority fee and memo if configured.
+func (b *Buffer) newSizer(feePayer solana.PublicKey) *txSizer {
+	sizer := newTxSizer(feePayer)
+	if b.PriorityFee != nil {
+		for _, insn := range b.PriorityFee.instructions() {
+			data, _ := insn.Data()
+			sizer.add(insn, len(data))
+		}
+	}
+	if b.Memo != "" {
+		sizer.add(b.memoInstruction(), len(b.Memo))
+	}
+	return sizer
+}
+
+// instructions returns the instructions of a transaction carrying the updates,
+// with compute budget instructions and a memo if configured.
+func (b *Buffer) instructions(updates []*pyth.Instruction) []solana.Instruction {
+	insns := make([]solana.Instruction, 0, len(updates)+3)
+	if b.PriorityFee != nil {
+		insns = append(insns, b.PriorityFee.instructions()...)
+	}
+	if b.Memo != "" {
+		insns = append(insns, b.memoInstruction())
+	}
+	for _, insn := range updates {
+		insns = append(insns, insn)
+	}
+	return insns
+}
+
+// newMergedBuilder starts a transaction with the given instructions.
+//
+// Account keys shared by several instructions, such as the publisher and the clock sysvar,
+// are merged so that the transaction lists each key once with the combined flags.
+func newMergedBuilder(feePayer solana.PublicKey, insns []solana.Instruction) *solana.TransactionBuilder {
+	builder := solana.NewTransactionBuilder()
+	for _, insn := range mergeAccountMetas(feePayer, insns) {
+		builder.AddInstruction(insn)
 	}
 	return builder
 }
 
-func (b *Buffer) appendUpdateToBuilder(builder *solana.TransactionBuilder, insn *pyth.Instruction, minSlot uint64) bool {
+func (b *Buffer) memoInstruction() solana.Instruction {
+	return solana.NewInstruction(solana.MemoProgramID, nil, []byte(b.Memo))
+}
+
+// checkUpdate returns whether a queued instruction should be sent.
+func (b *Buffer) checkUpdate(insn *pyth.Instruction, minSlot uint64) bool {
 	update, ok := insn.Payload.(*pyth.CommandUpdPrice)
 	if !ok {
 		return false
 	}
-	accs := insn.Accounts()
-	publishAccStr := accs[0].PublicKey.String()
-	priceAccStr := accs[1].PublicKey.String()
 	if update.PubSlot < minSlot {
 		b.Log.Warn("Dropping price update",
-			zap.String("price", priceAccStr),
+			zap.Stringer("price", insn.Accounts()[1].PublicKey),
 			zap.Uint64("pub_slot", update.PubSlot),
 			zap.Uint64("min_slot", minSlot))
-		metricUpdatesDropped.
-			WithLabelValues(publishAccStr, priceAccStr, "replaced").
-			Inc()
+		b.drop(insn, DropStaleSlot)
 		return false
 	}
-	metricUpdatesSent.
-		WithLabelValues(publishAccStr, priceAccStr).
-		Inc()
-	builder.AddInstruction(insn)
 	return true
 }
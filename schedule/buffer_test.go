@@ -0,0 +1,433 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/signer/signertest"
+)
+
+var (
+	testProgram   = solana.MustPublicKeyFromBase58("gSbePebfvPy7tRqimPoVecS2UsBvYv46ynrzWocc92s")
+	testPublisher = solana.MustPublicKeyFromBase58("5U3bH5b6XtG99aVWLqwVzYPVpQiFHytBD68Rz2eFPZd7")
+	testBlockhash = solana.MustHashFromBase58("4uQeVj5tqViQh7yWWGStvkEG1Zmhx6uasJtWCJziofM")
+)
+
+func newTestUpdate(price solana.PublicKey, value int64, pubSlot uint64) *pyth.Instruction {
+	return pyth.NewInstructionBuilder(testProgram).UpdPriceNoFailOnError(testPublisher, price, pyth.CommandUpdPrice{
+		Status:  pyth.PriceStatusTrading,
+		Price:   value,
+		Conf:    1,
+		PubSlot: pubSlot,
+	})
+}
+
+func TestBuffer_FlushDeterministic(t *testing.T) {
+	prices := make([]solana.PublicKey, 16)
+	for i := range prices {
+		prices[i] = solana.NewWallet().PublicKey()
+	}
+
+	buildMessage := func(order []int) [][]byte {
+		buf := NewBuffer()
+		for _, i := range order {
+			buf.PushUpdate(newTestUpdate(prices[i], int64(i+1), 100))
+		}
+		builders := buf.Flush(0)
+		require.NotEmpty(t, builders)
+		var msgs [][]byte
+		for _, builder := range builders {
+			tx, err := buildTransaction(builder, testPublisher, testBlockhash)
+			require.NoError(t, err)
+			assert.Equal(t, testPublisher, tx.Message.AccountKeys[0], "fee payer not first")
+			msg, err := tx.Message.MarshalBinary()
+			require.NoError(t, err)
+			msgs = append(msgs, msg)
+		}
+		return msgs
+	}
+
+	forward := make([]int, len(prices))
+	backward := make([]int, len(prices))
+	for i := range prices {
+		forward[i] = i
+		backward[i] = len(prices) - 1 - i
+	}
+	expected := buildMessage(forward)
+	assert.Equal(t, expected, buildMessage(backward))
+	for i := 0; i < 8; i++ {
+		assert.Equal(t, expected, buildMessage(forward))
+	}
+}
+
+func TestBuffer_FlushSplit(t *testing.T) {
+	buf := NewBuffer()
+	const numUpdates = 64
+	for i := 0; i < numUpdates; i++ {
+		buf.PushUpdate(newTestUpdate(solana.NewWallet().PublicKey(), 1, 100))
+	}
+	builders := buf.Flush(0)
+	require.Greater(t, len(builders), 1)
+
+	var updates int
+	for _, builder := range builders {
+		tx, err := buildTransaction(builder, testPublisher, testBlockhash)
+		require.NoError(t, err)
+		tx.Signatures = make([]solana.Signature, tx.Message.Header.NumRequiredSignatures)
+		raw, err := tx.MarshalBinary()
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(raw), MaxTransactionSize)
+		updates += len(tx.Message.Instructions)
+	}
+	assert.Equal(t, numUpdates, updates)
+	assert.Empty(t, buf.DropLog())
+}
+
+func TestBuffer_MaxUpdatesPerTx(t *testing.T) {
+	buf := NewBuffer()
+	buf.MaxUpdatesPerTx = 1
+	const numUpdates = 5
+	for i := 0; i < numUpdates; i++ {
+		buf.PushUpdate(newTestUpdate(solana.NewWallet().PublicKey(), 1, 100))
+	}
+	builders := buf.Flush(0)
+	require.Len(t, builders, numUpdates)
+	for _, builder := range builders {
+		tx, err := buildTransaction(builder, testPublisher, testBlockhash)
+		require.NoError(t, err)
+		assert.Len(t, tx.Message.Instructions, 1)
+	}
+}
+
+func TestBuffer_MaxTransactionsWeights(t *testing.T) {
+	low := solana.NewWallet().PublicKey()
+	high := solana.NewWallet().PublicKey()
+	normal := solana.NewWallet().PublicKey()
+
+	buf := NewBuffer()
+	buf.MaxUpdatesPerTx = 1
+	buf.MaxTransactions = 2
+	buf.Weights = map[solana.PublicKey]float64{low: 0.5, high: 10}
+	for _, price := range []solana.PublicKey{low, high, normal} {
+		buf.PushUpdate(newTestUpdate(price, 1, 100))
+	}
+	var sent []solana.PublicKey
+	for _, tx := range buf.flush(0) {
+		for _, update := range tx.updates {
+			sent = append(sent, update.Accounts()[1].PublicKey)
+		}
+	}
+	assert.Equal(t, []solana.PublicKey{high, normal}, sent, "highest weight not sent first")
+
+	drops := buf.DropLog()
+	require.Len(t, drops, 1)
+	assert.Equal(t, low, drops[0].Price)
+	assert.Equal(t, DropOverflow, drops[0].Reason)
+
+	// Only the highest weight fits a single transaction.
+	buf.MaxTransactions = 1
+	for _, price := range []solana.PublicKey{low, high, normal} {
+		buf.PushUpdate(newTestUpdate(price, 1, 100))
+	}
+	flushed := buf.flush(0)
+	require.Len(t, flushed, 1)
+	require.Len(t, flushed[0].updates, 1)
+	assert.Equal(t, high, flushed[0].updates[0].Accounts()[1].PublicKey)
+}
+
+func TestBuffer_FlushOversized(t *testing.T) {
+	price := solana.NewWallet().PublicKey()
+	buf := NewBuffer()
+	buf.ReservedSize = MaxTransactionSize - 100 // no room for even one update
+	buf.PushUpdate(newTestUpdate(price, 1, 100))
+
+	assert.Nil(t, buf.Flush(0))
+	drops := buf.DropLog()
+	require.Len(t, drops, 1)
+	assert.Equal(t, price, drops[0].Price)
+	assert.Equal(t, DropOversized, drops[0].Reason)
+
+	// Buffer keeps working afterwards.
+	buf.ReservedSize = 0
+	buf.PushUpdate(newTestUpdate(price, 2, 101))
+	assert.Len(t, buf.Flush(0), 1)
+}
+
+func TestBuffer_FlushMemo(t *testing.T) {
+	const memo = "pythian/test instance-1"
+	txSigner := signertest.New(t, testProgram)
+	buf := NewBuffer()
+	buf.Memo = memo
+	const numUpdates = 64
+	for i := 0; i < numUpdates; i++ {
+		buf.PushUpdate(pyth.NewInstructionBuilder(testProgram).UpdPriceNoFailOnError(
+			txSigner.Pubkey(), solana.NewWallet().PublicKey(), pyth.CommandUpdPrice{PubSlot: 100}))
+	}
+	builders := buf.Flush(0)
+	require.Greater(t, len(builders), 1)
+
+	var updates int
+	for _, builder := range builders {
+		tx, err := buildTransaction(builder, txSigner.Pubkey(), testBlockhash)
+		require.NoError(t, err)
+		require.NoError(t, txSigner.SignPriceUpdate(tx))
+		raw, err := tx.MarshalBinary()
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(raw), MaxTransactionSize)
+
+		first := tx.Message.Instructions[0]
+		assert.Equal(t, solana.MemoProgramID, tx.Message.AccountKeys[first.ProgramIDIndex])
+		assert.Equal(t, memo, string(first.Data))
+		assert.Empty(t, first.Accounts)
+		updates += len(tx.Message.Instructions) - 1
+	}
+	assert.Equal(t, numUpdates, updates)
+}
+
+func TestBuffer_FlushDedupAccounts(t *testing.T) {
+	buf := NewBuffer()
+	buf.Memo = "pythian"
+	updates := make([]*pyth.Instruction, 3)
+	for i := range updates {
+		updates[i] = newTestUpdate(solana.NewWallet().PublicKey(), 1, 100)
+		require.NoError(t, buf.PushUpdate(updates[i]))
+	}
+	builders := buf.Flush(0)
+	require.Len(t, builders, 1)
+	tx, err := buildTransaction(builders[0], testPublisher, testBlockhash)
+	require.NoError(t, err)
+
+	// Publisher, prices, clock, Pyth program, memo program.
+	keys := make(map[solana.PublicKey]bool)
+	for _, key := range tx.Message.AccountKeys {
+		assert.False(t, keys[key], "duplicate key %s", key)
+		keys[key] = true
+	}
+	assert.Len(t, tx.Message.AccountKeys, 1+len(updates)+3)
+	assert.Equal(t, testPublisher, tx.Message.AccountKeys[0])
+	assert.Equal(t, solana.MessageHeader{
+		NumRequiredSignatures:       1,
+		NumReadonlySignedAccounts:   0,
+		NumReadonlyUnsignedAccounts: 3,
+	}, tx.Message.Header)
+
+	// Queued instructions are left untouched.
+	for _, insn := range updates {
+		assert.Equal(t, []*solana.AccountMeta{
+			solana.Meta(testPublisher).SIGNER().WRITE(),
+			solana.Meta(insn.Accounts()[1].PublicKey).WRITE(),
+			solana.Meta(solana.SysVarClockPubkey),
+		}, insn.Accounts())
+	}
+}
+
+func TestMergeAccountMetas(t *testing.T) {
+	shared, other := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	insns := []solana.Instruction{
+		solana.NewInstruction(testProgram, solana.AccountMetaSlice{solana.Meta(shared), solana.Meta(testPublisher)}, nil),
+		solana.NewInstruction(testProgram, solana.AccountMetaSlice{solana.Meta(shared).WRITE(), solana.Meta(other).SIGNER()}, nil),
+	}
+	merged := mergeAccountMetas(testPublisher, insns)
+	require.Len(t, merged, 2)
+	assert.Equal(t, solana.Meta(shared).WRITE(), merged[0].Accounts()[0])
+	assert.Same(t, merged[0].Accounts()[0], merged[1].Accounts()[0])
+	assert.Equal(t, solana.Meta(testPublisher).SIGNER().WRITE(), merged[0].Accounts()[1])
+	assert.Equal(t, solana.Meta(other).SIGNER(), merged[1].Accounts()[1])
+	assert.False(t, insns[0].Accounts()[0].IsWritable, "input modified")
+}
+
+func TestBuffer_FlushPermissions(t *testing.T) {
+	permitted, revoked, unknown := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	buf := NewBuffer()
+	buf.SetPermissions(map[solana.PublicKey][]solana.PublicKey{
+		permitted: {solana.NewWallet().PublicKey(), testPublisher},
+		revoked:   {solana.NewWallet().PublicKey()},
+	})
+	for _, price := range []solana.PublicKey{permitted, revoked, unknown} {
+		require.NoError(t, buf.PushUpdate(newTestUpdate(price, 1, 100)))
+	}
+	builders := buf.Flush(0)
+	require.Len(t, builders, 1)
+	tx, err := buildTransaction(builders[0], testPublisher, testBlockhash)
+	require.NoError(t, err)
+	assert.Len(t, tx.Message.Instructions, 2)
+	assert.Contains(t, tx.Message.AccountKeys, permitted)
+	assert.Contains(t, tx.Message.AccountKeys, unknown)
+	assert.NotContains(t, tx.Message.AccountKeys, revoked)
+
+	drops := buf.DropLog()
+	require.Len(t, drops, 1)
+	assert.Equal(t, revoked, drops[0].Price)
+	assert.Equal(t, DropNotPermitted, drops[0].Reason)
+}
+
+func TestTxSizer(t *testing.T) {
+	builder := solana.NewTransactionBuilder()
+	sizer := newTxSizer(testPublisher)
+	for i := 0; i < 4; i++ {
+		insn := newTestUpdate(solana.NewWallet().PublicKey(), 1, 100)
+		data, err := insn.Data()
+		require.NoError(t, err)
+		expected := sizer.sizeWith(insn, len(data))
+		sizer.add(insn, len(data))
+		builder.AddInstruction(insn)
+
+		tx, err := buildTransaction(builder, testPublisher, testBlockhash)
+		require.NoError(t, err)
+		tx.Signatures = make([]solana.Signature, tx.Message.Header.NumRequiredSignatures)
+		raw, err := tx.MarshalBinary()
+		require.NoError(t, err)
+		assert.Equal(t, len(raw), expected)
+		assert.Equal(t, len(raw), sizer.size())
+	}
+}
+
+func TestBuffer_DropLog(t *testing.T) {
+	priceA := solana.NewWallet().PublicKey()
+	priceB := solana.NewWallet().PublicKey()
+
+	buf := NewBuffer()
+	buf.PushUpdate(newTestUpdate(priceA, 1, 100))
+	buf.PushUpdate(newTestUpdate(priceA, 2, 101)) // overwrites first update
+	buf.PushUpdate(newTestUpdate(priceB, 3, 50))
+	assert.Len(t, buf.Flush(80), 1) // priceB is stale
+
+	drops := buf.DropLog()
+	require.Len(t, drops, 2)
+	assert.Equal(t, priceA, drops[0].Price)
+	assert.Equal(t, uint64(100), drops[0].PubSlot)
+	assert.Equal(t, DropOverwritten, drops[0].Reason)
+	assert.Equal(t, priceB, drops[1].Price)
+	assert.Equal(t, uint64(50), drops[1].PubSlot)
+	assert.Equal(t, DropStaleSlot, drops[1].Reason)
+}
+
+func TestBuffer_DropLogClock(t *testing.T) {
+	now := time.Date(2022, 3, 14, 15, 9, 26, 0, time.UTC)
+	buf := NewBuffer()
+	buf.Clock = func() time.Time { return now }
+	buf.PushUpdate(newTestUpdate(solana.NewWallet().PublicKey(), 1, 50))
+	assert.Empty(t, buf.Flush(80))
+
+	drops := buf.DropLog()
+	require.Len(t, drops, 1)
+	assert.Equal(t, now, drops[0].Time)
+}
+
+func TestDropLog_Wrap(t *testing.T) {
+	log := newDropLog(3)
+	for slot := uint64(1); slot <= 5; slot++ {
+		log.add(DroppedUpdate{PubSlot: slot})
+	}
+	entries := log.list()
+	require.Len(t, entries, 3)
+	assert.Equal(t, uint64(3), entries[0].PubSlot)
+	assert.Equal(t, uint64(4), entries[1].PubSlot)
+	assert.Equal(t, uint64(5), entries[2].PubSlot)
+}
+
+func TestBuffer_FutureSlotGuard(t *testing.T) {
+	var currentSlot uint64
+	newBuffer := func(policy FutureSlotPolicy) *Buffer {
+		buf := NewBuffer()
+		buf.FutureSlots = FutureSlotGuard{MaxAhead: 10, Policy: policy}
+		buf.CurrentSlot = func() uint64 { return currentSlot }
+		return buf
+	}
+	pubSlot := func(insn *pyth.Instruction) uint64 {
+		return insn.Payload.(*pyth.CommandUpdPrice).PubSlot
+	}
+	price := solana.NewWallet().PublicKey()
+
+	t.Run("Reject", func(t *testing.T) {
+		currentSlot = 1000
+		buf := newBuffer(FutureSlotReject)
+		assert.NoError(t, buf.PushUpdate(newTestUpdate(price, 1, 1010)))
+		assert.ErrorIs(t, buf.PushUpdate(newTestUpdate(price, 2, 1011)), ErrFutureSlot)
+		assert.Empty(t, buf.DropLog(), "rejected update replaced queued update")
+		assert.Len(t, buf.Flush(0), 1)
+	})
+
+	t.Run("Clamp", func(t *testing.T) {
+		currentSlot = 1000
+		buf := newBuffer(FutureSlotClamp)
+		insn := newTestUpdate(price, 1, 5000)
+		assert.NoError(t, buf.PushUpdate(insn))
+		assert.Equal(t, uint64(1000), pubSlot(insn))
+		assert.Len(t, buf.Flush(1000), 1)
+	})
+
+	t.Run("StalledMonitor", func(t *testing.T) {
+		// Current slot unknown, guard cannot judge.
+		currentSlot = 0
+		buf := newBuffer(FutureSlotReject)
+		insn := newTestUpdate(price, 1, 5000)
+		assert.NoError(t, buf.PushUpdate(insn))
+		assert.Equal(t, uint64(5000), pubSlot(insn))
+	})
+
+	t.Run("Checked", func(t *testing.T) {
+		// The caller already applied the guard.
+		currentSlot = 1000
+		buf := newBuffer(FutureSlotReject)
+		buf.PushCheckedUpdate(newTestUpdate(price, 1, 5000), UpdateTrace{})
+		require.Len(t, buf.Queued(), 1)
+		assert.Equal(t, uint64(5000), buf.Queued()[0].PubSlot)
+	})
+
+	t.Run("Requeue", func(t *testing.T) {
+		currentSlot = 1000
+		buf := newBuffer(FutureSlotReject)
+		other := solana.NewWallet().PublicKey()
+		assert.Equal(t, 1, buf.Requeue([]*pyth.Instruction{
+			newTestUpdate(price, 1, 1000),
+			newTestUpdate(other, 1, 5000),
+		}, 0))
+		drops := buf.DropLog()
+		require.Len(t, drops, 1)
+		assert.Equal(t, other, drops[0].Price)
+		assert.Equal(t, DropFutureSlot, drops[0].Reason)
+	})
+}
+
+func TestBuffer_FlushSigners(t *testing.T) {
+	publishers := []solana.PublicKey{testPublisher, solana.NewWallet().PublicKey()}
+	buf := NewBuffer()
+	buf.Memo = "test"
+	const numUpdates = 64
+	for i := 0; i < numUpdates; i++ {
+		publisher := publishers[i%len(publishers)]
+		require.NoError(t, buf.PushUpdate(pyth.NewInstructionBuilder(testProgram).UpdPriceNoFailOnError(publisher, solana.NewWallet().PublicKey(), pyth.CommandUpdPrice{
+			Status:  pyth.PriceStatusTrading,
+			Price:   1,
+			PubSlot: 100,
+		})))
+	}
+
+	flushed := buf.flush(0)
+	require.Greater(t, len(flushed), len(publishers))
+	updates := make(map[solana.PublicKey]int)
+	for _, f := range flushed {
+		tx, err := buildTransaction(f.builder, f.signer, testBlockhash)
+		require.NoError(t, err)
+		assert.Equal(t, f.signer, tx.Message.AccountKeys[0], "signer not fee payer")
+		assert.Equal(t, uint8(1), tx.Message.Header.NumRequiredSignatures, "transaction needs another signer")
+		for _, insn := range f.updates {
+			assert.Equal(t, f.signer, insn.Accounts()[0].PublicKey, "update of another publisher")
+		}
+		updates[f.signer] += len(f.updates)
+
+		tx.Signatures = make([]solana.Signature, tx.Message.Header.NumRequiredSignatures)
+		raw, err := tx.MarshalBinary()
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(raw), MaxTransactionSize)
+	}
+	assert.Equal(t, map[solana.PublicKey]int{
+		publishers[0]: numUpdates / 2,
+		publishers[1]: numUpdates / 2,
+	}, updates)
+}
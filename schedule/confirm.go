@@ -0,0 +1,298 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"go.blockdaemon.com/pythian/stats"
+	"go.uber.org/zap"
+)
+
+// ConfirmStatus is the outcome of tracking a sent transaction.
+type ConfirmStatus string
+
+const (
+	ConfirmLanded  ConfirmStatus = "landed"  // transaction reached the target commitment
+	ConfirmFailed  ConfirmStatus = "failed"  // transaction landed with an error
+	ConfirmExpired ConfirmStatus = "expired" // no confirmation before the timeout
+)
+
+// Confirmation methods, used as metric labels.
+const (
+	confirmViaWebSocket = "websocket"
+	confirmViaPolling   = "polling"
+)
+
+// Confirmer tracks whether sent transactions land on chain.
+//
+// Confirmations are received via signatureSubscribe on a shared WebSocket connection.
+// If the subscription cannot be established or breaks, the confirmer falls back
+// to polling getSignatureStatuses until the timeout.
+type Confirmer struct {
+	Log          *zap.Logger
+	WebSocketURL string
+	// WebSocketHeaders are sent with the WebSocket handshake, e.g. API keys.
+	WebSocketHeaders http.Header
+	Timeout          time.Duration   // give up tracking after this duration, extended for finalized commitment
+	PollInterval     time.Duration   // getSignatureStatuses interval when falling back
+	Stats            *stats.Recorder // optional rolling-window counters
+
+	rpc     *rpc.Client
+	wsLock  sync.Mutex
+	ws      *ws.Client
+	pending int64 // transactions being tracked
+}
+
+// NewConfirmer creates a confirmer that lazily connects to the given WebSocket URL.
+func NewConfirmer(rpcClient *rpc.Client, wsURL string) *Confirmer {
+	return &Confirmer{
+		Log:          zap.NewNop(),
+		WebSocketURL: wsURL,
+		Timeout:      30 * time.Second,
+		PollInterval: 2 * time.Second,
+
+		rpc: rpcClient,
+	}
+}
+
+// finalizationDelay is roughly the time between a block getting confirmed and finalized.
+const finalizationDelay = 15 * time.Second
+
+// Track blocks until the transaction with the given signature reaches the commitment level,
+// the timeout passes, or the context is cancelled.
+//
+// If processed is not nil, it is called at most once when the transaction reaches
+// processed commitment, before Track returns. It is not called if the transaction
+// reaches the target commitment first or the target commitment is processed.
+func (c *Confirmer) Track(ctx context.Context, sig solana.Signature, commitment rpc.CommitmentType, processed func()) ConfirmStatus {
+	start := time.Now()
+	atomic.AddInt64(&c.pending, 1)
+	defer atomic.AddInt64(&c.pending, -1)
+	timeout := c.Timeout
+	if commitment == rpc.CommitmentFinalized {
+		timeout += finalizationDelay
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// The once guard orders the preliminary notification before the final result.
+	var once sync.Once
+	var onProcessed func()
+	if processed != nil && commitment != rpc.CommitmentProcessed {
+		onProcessed = func() {
+			once.Do(func() {
+				metricTxsProcessed.Inc()
+				processed()
+			})
+		}
+		defer once.Do(func() {})
+	}
+
+	method := confirmViaWebSocket
+	status, err := c.subscribe(ctx, sig, commitment, onProcessed)
+	if err != nil && ctx.Err() == nil {
+		c.Log.Warn("Signature subscription failed, falling back to polling",
+			zap.Stringer("signature", sig),
+			zap.Error(err))
+		method = confirmViaPolling
+		status = c.poll(ctx, sig, commitment, onProcessed)
+	} else if err != nil {
+		status = ConfirmExpired
+	}
+
+	metricTxsConfirmed.WithLabelValues(method, string(status)).Inc()
+	switch status {
+	case ConfirmLanded:
+		metricConfirmLatency.Observe(time.Since(start).Seconds())
+		c.Log.Debug("Transaction landed", zap.Stringer("signature", sig))
+	case ConfirmFailed:
+		c.Log.Warn("Transaction failed", zap.Stringer("signature", sig))
+	case ConfirmExpired:
+		c.Log.Warn("Transaction not confirmed in time",
+			zap.Stringer("signature", sig),
+			zap.Duration("timeout", timeout))
+	}
+	return status
+}
+
+// subscribe waits for a signature notification.
+//
+// If processed is not nil, a second subscription at processed commitment calls it.
+func (c *Confirmer) subscribe(ctx context.Context, sig solana.Signature, commitment rpc.CommitmentType, processed func()) (ConfirmStatus, error) {
+	client, err := c.wsClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	if processed != nil {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go c.subscribeProcessed(ctx, client, sig, processed)
+	}
+	sub, err := client.SignatureSubscribe(sig, commitment)
+	if err != nil {
+		c.resetWS(client)
+		return "", err
+	}
+	defer sub.Unsubscribe()
+
+	// Unsubscribing unblocks Recv.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			sub.Unsubscribe()
+		case <-done:
+		}
+	}()
+
+	res, err := sub.Recv()
+	if err != nil {
+		c.resetWS(client)
+		return "", err
+	} else if res == nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+		return "", errors.New("signature subscription closed")
+	}
+	if res.Value.Err != nil {
+		return ConfirmFailed, nil
+	}
+	return ConfirmLanded, nil
+}
+
+// subscribeProcessed calls processed once the transaction reaches processed commitment.
+// Errors are ignored, the subscription at the target commitment reports them.
+func (c *Confirmer) subscribeProcessed(ctx context.Context, client *ws.Client, sig solana.Signature, processed func()) {
+	sub, err := client.SignatureSubscribe(sig, rpc.CommitmentProcessed)
+	if err != nil {
+		return
+	}
+	defer sub.Unsubscribe()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			sub.Unsubscribe()
+		case <-done:
+		}
+	}()
+
+	res, err := sub.Recv()
+	if err == nil && res != nil && res.Value.Err == nil {
+		processed()
+	}
+}
+
+// poll queries the signature status until it reaches the target commitment.
+// If processed is not nil, it is called once the status is at least processed.
+func (c *Confirmer) poll(ctx context.Context, sig solana.Signature, commitment rpc.CommitmentType, processed func()) ConfirmStatus {
+	ticker := time.NewTicker(c.PollInterval)
+	defer ticker.Stop()
+	for {
+		res, err := c.rpc.GetSignatureStatuses(ctx, false, sig)
+		if err == nil && len(res.Value) == 1 && res.Value[0] != nil {
+			status := res.Value[0]
+			if status.Err != nil {
+				return ConfirmFailed
+			}
+			if commitmentReached(status.ConfirmationStatus, commitment) {
+				return ConfirmLanded
+			}
+			if processed != nil && commitmentReached(status.ConfirmationStatus, rpc.CommitmentProcessed) {
+				processed()
+			}
+		} else if err != nil && ctx.Err() == nil {
+			c.Stats.Inc(stats.RPCErrors)
+			c.Log.Debug("Failed to get signature status", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ConfirmExpired
+		case <-ticker.C:
+		}
+	}
+}
+
+func commitmentReached(status rpc.ConfirmationStatusType, target rpc.CommitmentType) bool {
+	switch status {
+	case rpc.ConfirmationStatusFinalized:
+		return true
+	case rpc.ConfirmationStatusConfirmed:
+		return target != rpc.CommitmentFinalized
+	case rpc.ConfirmationStatusProcessed:
+		return target == rpc.CommitmentProcessed
+	default:
+		return false
+	}
+}
+
+// wsClient returns the shared WebSocket client, connecting if necessary.
+func (c *Confirmer) wsClient(ctx context.Context) (*ws.Client, error) {
+	c.wsLock.Lock()
+	defer c.wsLock.Unlock()
+	if c.ws != nil {
+		return c.ws, nil
+	}
+	client, err := ws.ConnectWithOptions(ctx, c.WebSocketURL, &ws.Options{HttpHeader: c.WebSocketHeaders})
+	if err != nil {
+		return nil, err
+	}
+	c.ws = client
+	return client, nil
+}
+
+// SetWebSocketURL switches to another WebSocket URL, e.g. after failing over to another cluster.
+// The shared connection is closed, so that pending subscriptions fall back to polling.
+func (c *Confirmer) SetWebSocketURL(wsURL string) {
+	c.wsLock.Lock()
+	defer c.wsLock.Unlock()
+	c.WebSocketURL = wsURL
+	if c.ws != nil {
+		c.ws.Close()
+		c.ws = nil
+	}
+}
+
+// resetWS discards a broken WebSocket client so the next call reconnects.
+func (c *Confirmer) resetWS(client *ws.Client) {
+	c.wsLock.Lock()
+	defer c.wsLock.Unlock()
+	if c.ws == client {
+		c.ws.Close()
+		c.ws = nil
+	}
+}
+
+// Connected returns whether the shared WebSocket connection is established.
+func (c *Confirmer) Connected() bool {
+	c.wsLock.Lock()
+	defer c.wsLock.Unlock()
+	return c.ws != nil
+}
+
+// Pending returns the number of transactions currently being tracked.
+func (c *Confirmer) Pending() int {
+	return int(atomic.LoadInt64(&c.pending))
+}
+
+// Close shuts down the WebSocket connection.
+func (c *Confirmer) Close() {
+	c.wsLock.Lock()
+	defer c.wsLock.Unlock()
+	if c.ws != nil {
+		c.ws.Close()
+		c.ws = nil
+	}
+}
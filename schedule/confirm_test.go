@@ -0,0 +1,181 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockSignatureNode is a fake Solana WebSocket endpoint confirming every signatureSubscribe.
+type mockSignatureNode struct {
+	*httptest.Server
+	unsubscribed chan struct{}
+	commitments  chan string // commitment of each subscription
+
+	// holdFinal delays notifications at other commitments until a processed
+	// subscription was notified and unsubscribed on the same connection.
+	holdFinal bool
+}
+
+func newMockSignatureNode(t *testing.T) *mockSignatureNode {
+	node := &mockSignatureNode{
+		unsubscribed: make(chan struct{}, 16),
+		commitments:  make(chan string, 16),
+	}
+	node.Server = httptest.NewServer(http.HandlerFunc(node.serve))
+	t.Cleanup(node.Close)
+	return node
+}
+
+func (m *mockSignatureNode) URL() string {
+	return "ws" + strings.TrimPrefix(m.Server.URL, "http")
+}
+
+func (m *mockSignatureNode) serve(rw http.ResponseWriter, req *http.Request) {
+	var upgrader websocket.Upgrader
+	conn, err := upgrader.Upgrade(rw, req, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	notify := func(subID uint64) {
+		_ = conn.WriteJSON(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  "signatureNotification",
+			"params": map[string]interface{}{
+				"subscription": subID,
+				"result": map[string]interface{}{
+					"context": map[string]interface{}{"slot": 100},
+					"value":   map[string]interface{}{"err": nil},
+				},
+			},
+		})
+	}
+	var (
+		nextSubID uint64 = 7
+		processed bool
+		heldUntil uint64 // processed subscription releasing held notifications
+		held      []uint64
+	)
+	for {
+		var msg struct {
+			ID     uint64            `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		switch msg.Method {
+		case "signatureSubscribe":
+			var opts struct {
+				Commitment string `json:"commitment"`
+			}
+			if len(msg.Params) == 2 {
+				_ = json.Unmarshal(msg.Params[1], &opts)
+			}
+			m.commitments <- opts.Commitment
+			subID := nextSubID
+			nextSubID++
+			_ = conn.WriteJSON(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"id":      msg.ID,
+				"result":  subID,
+			})
+			switch {
+			case opts.Commitment == "processed":
+				notify(subID)
+				heldUntil = subID
+			case m.holdFinal && !processed:
+				held = append(held, subID)
+			default:
+				notify(subID)
+			}
+		case "signatureUnsubscribe":
+			var subID uint64
+			if len(msg.Params) == 1 {
+				_ = json.Unmarshal(msg.Params[0], &subID)
+			}
+			if heldUntil != 0 && subID == heldUntil {
+				processed = true
+				for _, heldID := range held {
+					notify(heldID)
+				}
+				held = nil
+			}
+			_ = conn.WriteJSON(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"id":      msg.ID,
+				"result":  true,
+			})
+			m.unsubscribed <- struct{}{}
+		}
+	}
+}
+
+func TestConfirmer_WebSocket(t *testing.T) {
+	node := newMockSignatureNode(t)
+	c := NewConfirmer(rpc.New("http://127.0.0.1:0"), node.URL())
+	c.Timeout = 5 * time.Second
+	defer c.Close()
+
+	var sig solana.Signature
+	sig[0] = 1
+	assert.Equal(t, ConfirmLanded, c.Track(context.Background(), sig, rpc.CommitmentConfirmed, nil))
+
+	select {
+	case <-node.unsubscribed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription not cleaned up")
+	}
+}
+
+func TestConfirmer_PollingFallback(t *testing.T) {
+	// Closed server, WebSocket connections fail.
+	deadNode := httptest.NewServer(http.NotFoundHandler())
+	deadNode.Close()
+
+	rpcNode := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&msg))
+		assert.Equal(t, "getSignatureStatuses", msg.Method)
+		rw.Header().Set("content-type", "application/json")
+		_ = json.NewEncoder(rw).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      msg.ID,
+			"result": map[string]interface{}{
+				"context": map[string]interface{}{"slot": 100},
+				"value": []interface{}{map[string]interface{}{
+					"slot":               100,
+					"confirmations":      1,
+					"err":                nil,
+					"confirmationStatus": "confirmed",
+				}},
+			},
+		})
+	}))
+	defer rpcNode.Close()
+
+	c := NewConfirmer(rpc.New(rpcNode.URL), "ws"+strings.TrimPrefix(deadNode.URL, "http"))
+	c.Timeout = 5 * time.Second
+	c.PollInterval = 10 * time.Millisecond
+	defer c.Close()
+
+	var sig solana.Signature
+	sig[0] = 2
+	assert.Equal(t, ConfirmLanded, c.Track(context.Background(), sig, rpc.CommitmentConfirmed, nil))
+}
@@ -0,0 +1,70 @@
+package schedule
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"go.uber.org/zap"
+)
+
+// Drain sends the queued updates one last time on shutdown, after Run returned.
+//
+// It gives up after the timeout, so that shutdown does not hang if the RPC is down.
+// Updates not sent by then are lost and logged with their count, which is returned.
+// The slot is the current slot, used to drop stale updates.
+// Nothing is sent while on standby.
+func (s *Scheduler) Drain(slot uint64, timeout time.Duration) int {
+	if s.Standby != nil && s.Standby() {
+		return 0
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var undrained int64
+	var wg sync.WaitGroup
+	if recentBlockhash := s.blockhash.GetRecentBlockHash(); recentBlockhash != nil {
+		var minSlot uint64
+		if slot > s.MaxSlotAge {
+			minSlot = slot - s.MaxSlotAge
+		}
+		for _, f := range s.buffer.flush(minSlot) {
+			tx, err := buildTransaction(f.builder, f.signer, recentBlockhash.Blockhash)
+			if err == nil {
+				err = s.signer.SignPriceUpdate(tx)
+			}
+			if err != nil {
+				s.Log.Error("Failed to build transaction", zap.Error(err))
+				s.buffer.settle(f.updates)
+				atomic.AddInt64(&undrained, int64(len(f.updates)))
+				continue
+			}
+			wg.Add(1)
+			go func(tx *solana.Transaction, f flushedTx) {
+				defer wg.Done()
+				defer s.buffer.settle(f.updates)
+				sig, err := s.send(ctx, tx)
+				if err != nil {
+					s.Log.Warn("Failed to send transaction while draining", zap.Error(err))
+					atomic.AddInt64(&undrained, int64(len(f.updates)))
+					return
+				}
+				s.Log.Info("Sent transaction while draining",
+					zap.Stringer("signature", sig),
+					zap.Int("updates", len(f.updates)))
+			}(tx, f)
+		}
+	}
+	wg.Wait()
+
+	// Updates held back by CoalesceInFlight, or all if there is no block hash.
+	total := atomic.AddInt64(&undrained, int64(len(s.buffer.Queued())))
+	if total > 0 {
+		s.Log.Error("Shutdown drain incomplete, dropping queued updates",
+			zap.Int64("undrained", total),
+			zap.Duration("timeout", timeout))
+	}
+	return int(total)
+}
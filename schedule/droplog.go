@@ -0,0 +1,62 @@
+package schedule
+
+import (
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// DropReason describes why a price update was never sent.
+type DropReason string
+
+const (
+	DropOverwritten   DropReason = "overwritten"    // replaced by a newer update before flush
+	DropStaleSlot     DropReason = "stale_slot"     // pub slot too old at flush time
+	DropExpired       DropReason = "expired"        // transaction expired before landing
+	DropOverflow      DropReason = "overflow"       // buffer or transaction capacity exceeded
+	DropOversized     DropReason = "oversized"      // instruction alone exceeds the transaction size limit
+	DropUnknownSigner DropReason = "unknown_signer" // no key to sign for the publisher of the update
+	DropNotPermitted  DropReason = "not_permitted"  // publisher is not a component of the price account
+	DropFutureSlot    DropReason = "future_slot"    // pub slot too far ahead of the current slot when requeued
+)
+
+// DroppedUpdate is an entry in the drop log.
+type DroppedUpdate struct {
+	Time    time.Time
+	Price   solana.PublicKey
+	PubSlot uint64
+	Reason  DropReason
+}
+
+// dropLog is a fixed-size ring buffer of recently dropped updates.
+type dropLog struct {
+	entries []DroppedUpdate
+	next    int
+	full    bool
+}
+
+func newDropLog(size int) *dropLog {
+	return &dropLog{entries: make([]DroppedUpdate, size)}
+}
+
+func (d *dropLog) add(entry DroppedUpdate) {
+	if len(d.entries) == 0 {
+		return
+	}
+	d.entries[d.next] = entry
+	d.next++
+	if d.next == len(d.entries) {
+		d.next = 0
+		d.full = true
+	}
+}
+
+// list returns the logged entries from oldest to newest.
+func (d *dropLog) list() []DroppedUpdate {
+	if !d.full {
+		return append([]DroppedUpdate(nil), d.entries[:d.next]...)
+	}
+	out := make([]DroppedUpdate, 0, len(d.entries))
+	out = append(out, d.entries[d.next:]...)
+	return append(out, d.entries[:d.next]...)
+}
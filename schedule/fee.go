@@ -0,0 +1,96 @@
+package schedule
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"go.blockdaemon.com/pythian/signer"
+)
+
+// PriorityFee bids for inclusion by setting a compute unit price on each transaction.
+type PriorityFee struct {
+	MicroLamports uint64 // price per compute unit
+	ComputeUnits  uint32 // compute unit limit requested per transaction
+}
+
+// DefaultComputeUnits is the default compute unit limit of transactions paying a priority fee.
+const DefaultComputeUnits = 200_000
+
+// Lamports returns the priority fee paid per transaction on top of the base fee.
+// Zero if p is nil.
+func (p *PriorityFee) Lamports() uint64 {
+	if p == nil {
+		return 0
+	}
+	return (uint64(p.ComputeUnits)*p.MicroLamports + 999_999) / 1_000_000
+}
+
+// instructions returns the compute budget instructions setting the unit limit and price.
+func (p *PriorityFee) instructions() []solana.Instruction {
+	limit := make([]byte, 5)
+	limit[0] = signer.ComputeBudgetSetUnitLimit
+	binary.LittleEndian.PutUint32(limit[1:], p.ComputeUnits)
+	price := make([]byte, 9)
+	price[0] = signer.ComputeBudgetSetUnitPrice
+	binary.LittleEndian.PutUint64(price[1:], p.MicroLamports)
+	return []solana.Instruction{
+		solana.NewInstruction(signer.ComputeBudgetProgramID, nil, limit),
+		solana.NewInstruction(signer.ComputeBudgetProgramID, nil, price),
+	}
+}
+
+// FeeEstimate is the expected fee of the transactions sent by the next flush.
+type FeeEstimate struct {
+	Transactions int
+	BaseFee      uint64 // lamports, as reported by the cluster
+	PriorityFee  uint64 // lamports, compute unit price times limit
+}
+
+// Total returns the estimated fee in lamports.
+func (e FeeEstimate) Total() uint64 {
+	return e.BaseFee + e.PriorityFee
+}
+
+// EstimateFee estimates the fee of the transactions the next flush would send.
+// The buffer is not modified.
+func (s *Scheduler) EstimateFee(ctx context.Context) (FeeEstimate, error) {
+	recentBlockhash := s.blockhash.GetRecentBlockHash()
+	if recentBlockhash == nil {
+		return FeeEstimate{}, errors.New("no recent block hash yet")
+	}
+	var estimate FeeEstimate
+	for _, f := range s.buffer.preview() {
+		// Query the base fee without compute budget instructions,
+		// newer nodes would include the priority fee otherwise.
+		insns := make([]solana.Instruction, 0, len(f.insns))
+		for _, insn := range f.insns {
+			if !insn.ProgramID().Equals(signer.ComputeBudgetProgramID) {
+				insns = append(insns, insn)
+			}
+		}
+		tx, err := buildTransaction(newMergedBuilder(f.signer, insns), f.signer, recentBlockhash.Blockhash)
+		if err != nil {
+			return FeeEstimate{}, fmt.Errorf("failed to build transaction: %w", err)
+		}
+		msg, err := tx.Message.MarshalBinary()
+		if err != nil {
+			return FeeEstimate{}, fmt.Errorf("failed to serialize message: %w", err)
+		}
+		out, err := s.rpcFor(f.signer).GetFeeForMessage(ctx, base64.StdEncoding.EncodeToString(msg), rpc.CommitmentProcessed)
+		if err != nil {
+			return FeeEstimate{}, err
+		}
+		if out.Value == nil {
+			return FeeEstimate{}, errors.New("block hash not known to node")
+		}
+		estimate.Transactions++
+		estimate.BaseFee += *out.Value
+		estimate.PriorityFee += s.buffer.PriorityFee.Lamports()
+	}
+	return estimate, nil
+}
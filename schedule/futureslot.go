@@ -0,0 +1,51 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrFutureSlot is returned when an update is stamped with a slot too far ahead of the cluster.
+//
+// The on-chain program may accept such updates, which then block newer legitimate updates.
+var ErrFutureSlot = errors.New("pub slot too far in the future")
+
+// FutureSlotPolicy selects how updates with a pub slot too far ahead are handled.
+type FutureSlotPolicy string
+
+const (
+	FutureSlotReject FutureSlotPolicy = "reject" // refuse the update
+	FutureSlotClamp  FutureSlotPolicy = "clamp"  // lower the pub slot to the current slot
+)
+
+// ParseFutureSlotPolicy parses a policy name.
+func ParseFutureSlotPolicy(name string) (FutureSlotPolicy, error) {
+	policy := FutureSlotPolicy(name)
+	switch policy {
+	case FutureSlotReject, FutureSlotClamp:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown future slot policy %q", name)
+	}
+}
+
+// FutureSlotGuard limits how far ahead of the current slot updates may be stamped.
+type FutureSlotGuard struct {
+	MaxAhead uint64 // max slots ahead of the current slot, 0 disables the guard
+	Policy   FutureSlotPolicy
+}
+
+// check returns the pub slot to use for an update.
+//
+// The guard is skipped while the current slot is unknown (0),
+// e.g. before the slot monitor received its first update.
+func (g FutureSlotGuard) check(pubSlot, currentSlot uint64) (uint64, error) {
+	if g.MaxAhead == 0 || currentSlot == 0 || pubSlot <= currentSlot+g.MaxAhead {
+		return pubSlot, nil
+	}
+	if g.Policy == FutureSlotClamp {
+		return currentSlot, nil
+	}
+	return 0, fmt.Errorf("%w: pub slot %d is %d slots ahead of current slot %d (max %d)",
+		ErrFutureSlot, pubSlot, pubSlot-currentSlot, currentSlot, g.MaxAhead)
+}
@@ -0,0 +1,193 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LabelStrategy selects the labels of per-update metrics.
+//
+// Labeling by price account creates a series per feed,
+// which overwhelms Prometheus with thousands of feeds.
+type LabelStrategy string
+
+const (
+	LabelNone      LabelStrategy = "none"      // global counters only
+	LabelPublisher LabelStrategy = "publisher" // publisher key, aggregating all price accounts
+	LabelSymbol    LabelStrategy = "symbol"    // product symbol of the price account
+	LabelPubkey    LabelStrategy = "pubkey"    // publisher and price account keys
+)
+
+// ParseLabelStrategy parses a label strategy name.
+func ParseLabelStrategy(name string) (LabelStrategy, error) {
+	strategy := LabelStrategy(name)
+	switch strategy {
+	case LabelNone, LabelPublisher, LabelSymbol, LabelPubkey:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown metric label strategy %q", name)
+	}
+}
+
+// unknownSymbol labels price accounts whose symbol is not known yet.
+const unknownSymbol = "unknown"
+
+// otherPrices labels price accounts beyond the price label limit.
+const otherPrices = "other"
+
+// updateMetrics are the per-update metrics, labeled according to a strategy.
+type updateMetrics struct {
+	strategy LabelStrategy
+	txsSent  *prometheus.CounterVec
+	dropped  *prometheus.CounterVec
+	sent     *prometheus.CounterVec
+
+	// maxPrices limits the distinct price label values. 0 is unlimited.
+	maxPrices  int
+	pricesLock sync.Mutex
+	prices     map[string]struct{}
+}
+
+var (
+	updateMetricsLock sync.Mutex
+	updateMetricsSet  *updateMetrics
+)
+
+// SetupMetrics registers the per-update metrics with the given label strategy.
+//
+// maxPrices limits the number of distinct price labels of the symbol and pubkey
+// strategies: the first maxPrices price accounts updated keep their own label,
+// any others are aggregated as "other". 0 is unlimited.
+//
+// It must be called once at startup, before any update is processed.
+// Otherwise, metrics are labeled by pubkey. Calling it again with
+// the same settings is a no-op; changing them returns an error.
+func SetupMetrics(strategy LabelStrategy, maxPrices int) error {
+	updateMetricsLock.Lock()
+	defer updateMetricsLock.Unlock()
+	if updateMetricsSet != nil {
+		if updateMetricsSet.strategy != strategy || updateMetricsSet.maxPrices != maxPrices {
+			return fmt.Errorf("metrics already labeled by %s (max %d prices)", updateMetricsSet.strategy, updateMetricsSet.maxPrices)
+		}
+		return nil
+	}
+	m, err := newUpdateMetrics(strategy, prometheus.DefaultRegisterer)
+	if err != nil {
+		return err
+	}
+	m.maxPrices = maxPrices
+	updateMetricsSet = m
+	return nil
+}
+
+// getUpdateMetrics returns the per-update metrics, labeled by pubkey if not set up.
+func getUpdateMetrics() *updateMetrics {
+	updateMetricsLock.Lock()
+	defer updateMetricsLock.Unlock()
+	if updateMetricsSet == nil {
+		m, err := newUpdateMetrics(LabelPubkey, prometheus.DefaultRegisterer)
+		if err != nil {
+			panic(err)
+		}
+		updateMetricsSet = m
+	}
+	return updateMetricsSet
+}
+
+func newUpdateMetrics(strategy LabelStrategy, reg prometheus.Registerer) (*updateMetrics, error) {
+	var publisherLabels, priceLabels []string
+	switch strategy {
+	case LabelNone:
+	case LabelPublisher:
+		publisherLabels = []string{"pyth_publisher"}
+		priceLabels = publisherLabels
+	case LabelSymbol:
+		publisherLabels = []string{"pyth_publisher"}
+		priceLabels = []string{"pyth_publisher", "pyth_symbol"}
+	case LabelPubkey:
+		publisherLabels = []string{"pyth_publisher"}
+		priceLabels = []string{"pyth_publisher", "pyth_price"}
+	default:
+		return nil, fmt.Errorf("unknown metric label strategy %q", strategy)
+	}
+	m := &updateMetrics{
+		strategy: strategy,
+		prices:   make(map[string]struct{}),
+		txsSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "pythian",
+			Subsystem: "solana",
+			Name:      "transactions_sent_total",
+			Help:      "Number of Pyth transactions sent to Solana",
+		}, publisherLabels),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "pythian",
+			Subsystem: "solana",
+			Name:      "price_updates_dropped_total",
+			Help:      "Number of Pyth price updates dropped",
+		}, append(priceLabels, "drop_reason")),
+		sent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "pythian",
+			Subsystem: "solana",
+			Name:      "price_updates_sent_total",
+			Help:      "Number of Pyth price updates sent",
+		}, priceLabels),
+	}
+	for _, vec := range []**prometheus.CounterVec{&m.txsSent, &m.dropped, &m.sent} {
+		if err := reg.Register(*vec); err != nil {
+			// Reuse collectors with the same labels, e.g. from a previous setup in tests.
+			var are prometheus.AlreadyRegisteredError
+			if !errors.As(err, &are) {
+				return nil, err
+			}
+			existing, ok := are.ExistingCollector.(*prometheus.CounterVec)
+			if !ok {
+				return nil, err
+			}
+			*vec = existing
+		}
+	}
+	return m, nil
+}
+
+// priceLabels returns the label values identifying a price update.
+func (m *updateMetrics) priceLabels(publisher, price solana.PublicKey, symbol func(solana.PublicKey) string) []string {
+	switch m.strategy {
+	case LabelPublisher:
+		return []string{publisher.String()}
+	case LabelSymbol:
+		return []string{publisher.String(), m.limitPrice(symbol(price))}
+	case LabelPubkey:
+		return []string{publisher.String(), m.limitPrice(price.String())}
+	default:
+		return nil
+	}
+}
+
+// limitPrice buckets price label values beyond maxPrices as "other".
+func (m *updateMetrics) limitPrice(value string) string {
+	if m.maxPrices <= 0 {
+		return value
+	}
+	m.pricesLock.Lock()
+	defer m.pricesLock.Unlock()
+	if _, ok := m.prices[value]; ok {
+		return value
+	}
+	if len(m.prices) >= m.maxPrices {
+		return otherPrices
+	}
+	m.prices[value] = struct{}{}
+	return value
+}
+
+// publisherLabels returns the label values identifying a transaction.
+func (m *updateMetrics) publisherLabels(publisher solana.PublicKey) []string {
+	if m.strategy == LabelNone {
+		return nil
+	}
+	return []string{publisher.String()}
+}
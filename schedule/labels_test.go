@@ -0,0 +1,103 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateMetrics_Labels(t *testing.T) {
+	publisher, price := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	symbols := func(key solana.PublicKey) string {
+		if key == price {
+			return "Crypto.BTC/USD"
+		}
+		return unknownSymbol
+	}
+
+	for _, tc := range []struct {
+		strategy LabelStrategy
+		want     string
+	}{
+		{LabelNone, `pythian_solana_price_updates_sent_total 1`},
+		{LabelPublisher, `pythian_solana_price_updates_sent_total{pyth_publisher="` + publisher.String() + `"} 1`},
+		{LabelSymbol, `pythian_solana_price_updates_sent_total{pyth_publisher="` + publisher.String() + `",pyth_symbol="Crypto.BTC/USD"} 1`},
+		{LabelPubkey, `pythian_solana_price_updates_sent_total{pyth_price="` + price.String() + `",pyth_publisher="` + publisher.String() + `"} 1`},
+	} {
+		t.Run(string(tc.strategy), func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			m, err := newUpdateMetrics(tc.strategy, reg)
+			require.NoError(t, err)
+			m.sent.WithLabelValues(m.priceLabels(publisher, price, symbols)...).Inc()
+			m.dropped.WithLabelValues(append(m.priceLabels(publisher, price, symbols), string(DropOverwritten))...).Inc()
+			m.txsSent.WithLabelValues(m.publisherLabels(publisher)...).Inc()
+			families, err := reg.Gather()
+			require.NoError(t, err)
+			assert.Len(t, families, 3)
+
+			expected := "# HELP pythian_solana_price_updates_sent_total Number of Pyth price updates sent\n" +
+				"# TYPE pythian_solana_price_updates_sent_total counter\n" + tc.want + "\n"
+			assert.NoError(t, testutil.CollectAndCompare(m.sent, strings.NewReader(expected)))
+
+			// Registering again reuses the collectors.
+			again, err := newUpdateMetrics(tc.strategy, reg)
+			require.NoError(t, err)
+			assert.Same(t, m.sent, again.sent)
+		})
+	}
+
+	t.Run("Conflict", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		_, err := newUpdateMetrics(LabelPubkey, reg)
+		require.NoError(t, err)
+		assert.NotPanics(t, func() {
+			_, err = newUpdateMetrics(LabelNone, reg)
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestUpdateMetrics_Aggregated(t *testing.T) {
+	publisher := solana.NewWallet().PublicKey()
+	prices := []solana.PublicKey{solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()}
+
+	t.Run("Publisher", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		m, err := newUpdateMetrics(LabelPublisher, reg)
+		require.NoError(t, err)
+		for _, price := range prices {
+			m.sent.WithLabelValues(m.priceLabels(publisher, price, nil)...).Inc()
+		}
+		expected := "# HELP pythian_solana_price_updates_sent_total Number of Pyth price updates sent\n" +
+			"# TYPE pythian_solana_price_updates_sent_total counter\n" +
+			`pythian_solana_price_updates_sent_total{pyth_publisher="` + publisher.String() + `"} 3` + "\n"
+		assert.NoError(t, testutil.CollectAndCompare(m.sent, strings.NewReader(expected)))
+	})
+
+	t.Run("MaxPrices", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		m, err := newUpdateMetrics(LabelPubkey, reg)
+		require.NoError(t, err)
+		m.maxPrices = 1
+		for _, price := range append(prices, prices[0]) {
+			m.sent.WithLabelValues(m.priceLabels(publisher, price, nil)...).Inc()
+		}
+		expected := "# HELP pythian_solana_price_updates_sent_total Number of Pyth price updates sent\n" +
+			"# TYPE pythian_solana_price_updates_sent_total counter\n" +
+			`pythian_solana_price_updates_sent_total{pyth_price="` + prices[0].String() + `",pyth_publisher="` + publisher.String() + `"} 2` + "\n" +
+			`pythian_solana_price_updates_sent_total{pyth_price="other",pyth_publisher="` + publisher.String() + `"} 2` + "\n"
+		assert.NoError(t, testutil.CollectAndCompare(m.sent, strings.NewReader(expected)))
+	})
+}
+
+func TestSetupMetrics(t *testing.T) {
+	getUpdateMetrics() // labeled by pubkey unless set up before
+	assert.NoError(t, SetupMetrics(LabelPubkey, 0))
+	assert.Error(t, SetupMetrics(LabelNone, 0))
+	assert.Error(t, SetupMetrics(LabelPubkey, 10))
+}
@@ -0,0 +1,48 @@
+package schedule
+
+import (
+	"sync"
+	"time"
+)
+
+// LogSampler throttles a repeated log message to at most Burst lines per Interval.
+type LogSampler struct {
+	Burst    int
+	Interval time.Duration
+
+	lock        sync.Mutex
+	now         func() time.Time
+	windowStart time.Time
+	logged      int
+	suppressed  int
+}
+
+// NewLogSampler creates a sampler allowing burst lines per interval.
+func NewLogSampler(burst int, interval time.Duration) *LogSampler {
+	return &LogSampler{
+		Burst:    burst,
+		Interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Allow reports whether a line may be logged.
+//
+// If lines were suppressed before this one, their count is returned
+// so the caller can attach it to the logged line.
+func (l *LogSampler) Allow() (ok bool, suppressed int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.now()
+	if now.Sub(l.windowStart) >= l.Interval {
+		l.windowStart = now
+		l.logged = 0
+	}
+	if l.logged >= l.Burst {
+		l.suppressed++
+		return false, 0
+	}
+	l.logged++
+	suppressed, l.suppressed = l.suppressed, 0
+	return true, suppressed
+}
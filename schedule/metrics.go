@@ -12,28 +12,104 @@ var (
 		Name:      "blockhash_updates_total",
 		Help:      "Number of block hash updates received",
 	})
+	metricSkippedSlots = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Name:      "skipped_slots",
+		Help:      "Number of slots skipped between consecutive slot updates",
+	})
+	metricOutOfOrderSlots = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Name:      "out_of_order_slots",
+		Help:      "Number of slot updates ignored for arriving after a higher slot",
+	})
+	metricSlotCallbackPanics = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Name:      "slot_subscriber_panics",
+		Help:      "Number of panics recovered from slot subscriber callbacks",
+	})
+	metricWSReadTimeouts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Name:      "ws_read_timeouts",
+		Help:      "Number of slot streams terminated because no update arrived within the read timeout",
+	})
+	metricBlockHeight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "pythian",
+		Subsystem: "solana",
+		Name:      "block_height",
+		Help:      "Latest confirmed block height",
+	})
+	metricBlockHeightFallbacks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "solana",
+		Name:      "block_height_fallbacks_total",
+		Help:      "Number of block hash expiry estimates based on slots because the block height was unavailable",
+	})
 	metricSlotUpdates = promauto.NewCounter(prometheus.CounterOpts{
 		Namespace: "pythian",
 		Subsystem: "solana",
 		Name:      "slot_updates_total",
 		Help:      "Number of slot updates received",
 	})
-	metricTxsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+	metricTxsConfirmed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "solana",
+		Name:      "transactions_confirmed_total",
+		Help:      "Outcomes of tracked Pyth transactions",
+	}, []string{"method", "status"})
+	metricTxsProcessed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "solana",
+		Name:      "transactions_processed_total",
+		Help:      "Number of tracked Pyth transactions reported at processed commitment ahead of the target commitment",
+	})
+	metricUpdatesReplayed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "solana",
+		Name:      "price_updates_replayed_total",
+		Help:      "Number of unconfirmed Pyth price updates queued again after failover",
+	})
+	metricFutureSlotUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "solana",
+		Name:      "price_updates_future_slot_total",
+		Help:      "Number of Pyth price updates stamped too far ahead of the current slot",
+	}, []string{"action"})
+	metricSendSlotOffset = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "pythian",
+		Subsystem: "solana",
+		Name:      "send_slot_offset_seconds",
+		Help:      "Time since slot start when sending Pyth transactions",
+		Buckets:   []float64{.005, .01, .025, .05, .075, .1, .15, .2, .3, .4, .6, .8},
+	})
+	metricBlockhashRetries = promauto.NewCounter(prometheus.CounterOpts{
 		Namespace: "pythian",
 		Subsystem: "solana",
-		Name:      "transactions_sent_total",
-		Help:      "Number of Pyth transactions sent to Solana",
-	}, []string{"pyth_publisher"})
-	metricUpdatesDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name:      "send_blockhash_retries_total",
+		Help:      "Number of Pyth transactions sent again with a fresh block hash after the send node did not know the block hash",
+	})
+	metricBlockhashRetriesSucceeded = promauto.NewCounter(prometheus.CounterOpts{
 		Namespace: "pythian",
 		Subsystem: "solana",
-		Name:      "price_updates_dropped_total",
-		Help:      "Number of Pyth price updates dropped",
-	}, []string{"pyth_publisher", "pyth_price", "drop_reason"})
-	metricUpdatesSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name:      "send_blockhash_retries_succeeded_total",
+		Help:      "Number of Pyth transactions accepted by the send node after retrying with a fresh block hash",
+	})
+	metricUpdatesHeld = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "pythian",
+		Subsystem: "solana",
+		Name:      "price_updates_held_total",
+		Help:      "Number of times a queued Pyth price update was held back while a transaction updating the same account was in flight",
+	})
+	metricSendCyclesSkipped = promauto.NewCounter(prometheus.CounterOpts{
 		Namespace: "pythian",
 		Subsystem: "solana",
-		Name:      "price_updates_sent_total",
-		Help:      "Number of Pyth price updates sent",
-	}, []string{"pyth_publisher", "pyth_price"})
+		Name:      "send_cycles_skipped_total",
+		Help:      "Number of slots skipped because a previous send was still in flight",
+	})
+	metricConfirmLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "pythian",
+		Subsystem: "solana",
+		Name:      "confirmation_latency_seconds",
+		Help:      "Time from sending a Pyth transaction until it lands",
+		Buckets:   []float64{.4, .8, 1.2, 1.6, 2, 3, 4, 6, 8, 12, 16, 24, 32},
+	})
 )
@@ -0,0 +1,87 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/gagliardetto/solana-go/rpc"
+	"go.blockdaemon.com/pythian/signer"
+)
+
+// DurableNonce configures sending through a durable nonce account.
+//
+// A transaction using the stored nonce in place of a recent block hash
+// does not expire, its first instruction advances the nonce instead.
+// Since only one transaction per nonce value can land, each flush sends
+// at most one transaction through the nonce, and the nonce is not used again
+// until that transaction settled. Other transactions use the recent block hash.
+type DurableNonce struct {
+	Account   solana.PublicKey
+	Authority solana.PublicKey // must be the publisher key signing transactions
+}
+
+// nonceFetchTimeout bounds fetching the nonce value before a flush.
+const nonceFetchTimeout = time.Second
+
+// advanceInstruction returns the instruction consuming the nonce,
+// which must be the first instruction of the transaction.
+func (n *DurableNonce) advanceInstruction() solana.Instruction {
+	return system.NewAdvanceNonceAccountInstruction(n.Account, solana.SysVarRecentBlockHashesPubkey, n.Authority).Build()
+}
+
+// ReservedSize returns the number of bytes the advance-nonce instruction adds
+// to a transaction paid for by the nonce authority, see Buffer.ReservedSize.
+func (n *DurableNonce) ReservedSize() int {
+	insn := n.advanceInstruction()
+	data, _ := insn.Data()
+	sizer := newTxSizer(n.Authority)
+	return sizer.sizeWith(insn, len(data)) - sizer.size()
+}
+
+// fetchNonce returns the nonce value currently stored in the nonce account.
+func (s *Scheduler) fetchNonce(ctx context.Context) (solana.Hash, error) {
+	ctx, cancel := context.WithTimeout(ctx, nonceFetchTimeout)
+	defer cancel()
+	out, err := s.rpc.GetAccountInfoWithOpts(ctx, s.Nonce.Account, &rpc.GetAccountInfoOpts{
+		Commitment: rpc.CommitmentProcessed,
+	})
+	if err != nil {
+		return solana.Hash{}, err
+	}
+	if out.Value == nil || out.Value.Data == nil {
+		return solana.Hash{}, errors.New("nonce account not found")
+	}
+	var nonce system.NonceAccount
+	if err := bin.NewBinDecoder(out.Value.Data.GetBinary()).Decode(&nonce); err != nil {
+		return solana.Hash{}, fmt.Errorf("invalid nonce account: %w", err)
+	}
+	if nonce.State != 1 {
+		return solana.Hash{}, errors.New("nonce account not initialized")
+	}
+	if !nonce.AuthorizedPubkey.Equals(s.Nonce.Authority) {
+		return solana.Hash{}, fmt.Errorf("nonce authority is %s, not %s", nonce.AuthorizedPubkey, s.Nonce.Authority)
+	}
+	return solana.Hash(nonce.Nonce), nil
+}
+
+// buildNonceTransaction assembles an unsigned transaction using the nonce as block hash,
+// with the advance-nonce instruction ahead of the flushed instructions.
+func (s *Scheduler) buildNonceTransaction(f flushedTx, nonce solana.Hash) (*solana.Transaction, error) {
+	insns := append([]solana.Instruction{s.Nonce.advanceInstruction()}, f.insns...)
+	return buildTransaction(newMergedBuilder(f.signer, insns), f.signer, nonce)
+}
+
+// usesNonce returns whether a transaction starts with an advance-nonce instruction.
+func usesNonce(tx *solana.Transaction) bool {
+	if len(tx.Message.Instructions) == 0 {
+		return false
+	}
+	insn := tx.Message.Instructions[0]
+	return tx.Message.AccountKeys[insn.ProgramIDIndex].Equals(solana.SystemProgramID) &&
+		signer.IsAdvanceNonce(insn.Data)
+}
@@ -0,0 +1,54 @@
+package schedule
+
+import (
+	"context"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// PricePublished reports the progress of a sent price update transaction.
+//
+// Each tracked transaction yields one final event. With Scheduler.NotifyProcessed,
+// a preliminary event at processed commitment may precede it.
+type PricePublished struct {
+	Signature solana.Signature
+	Publisher solana.PublicKey
+	Prices    []solana.PublicKey // updated price accounts
+	Updates   []QueuedUpdate     // contents of the price updates
+	Status    ConfirmStatus
+	// Commitment is the commitment level reached, empty unless the transaction landed.
+	Commitment rpc.CommitmentType
+	// Preliminary marks the processed fast path. The transaction may still be dropped.
+	Preliminary bool
+}
+
+const publishedBusKey = "published" // PricePublished events
+
+// SubscribePublished registers a callback invoked for every tracked transaction.
+// Callbacks run on the sending goroutine and must not block.
+// The returned cancel func removes the callback again.
+func (s *Scheduler) SubscribePublished(callback func(PricePublished)) context.CancelFunc {
+	_ = s.bus.Subscribe(publishedBusKey, callback)
+	return func() {
+		_ = s.bus.Unsubscribe(publishedBusKey, callback)
+	}
+}
+
+func (s *Scheduler) publishEvent(event PricePublished) {
+	s.bus.Publish(publishedBusKey, event)
+}
+
+// updatedPrices returns the price accounts updated by a transaction.
+func updatedPrices(tx *solana.Transaction) []solana.PublicKey {
+	var prices []solana.PublicKey
+	for _, insn := range tx.Message.Instructions {
+		program := tx.Message.AccountKeys[insn.ProgramIDIndex]
+		// Price update accounts are the publisher, the price account, and the clock.
+		if program.Equals(solana.MemoProgramID) || program.Equals(solana.SystemProgramID) || len(insn.Accounts) < 2 {
+			continue
+		}
+		prices = append(prices, tx.Message.AccountKeys[insn.Accounts[1]])
+	}
+	return prices
+}
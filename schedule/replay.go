@@ -0,0 +1,77 @@
+package schedule
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"go.blockdaemon.com/pyth"
+	"go.uber.org/zap"
+)
+
+// retainedUpdates are copies of sent updates whose transaction has not landed yet.
+type retainedUpdates struct {
+	lock sync.Mutex
+	txs  map[solana.Signature]retainedTx
+}
+
+type retainedTx struct {
+	updates []*pyth.Instruction
+	expires time.Time
+}
+
+// retain keeps a copy of the updates of a transaction about to be sent.
+func (s *Scheduler) retain(sig solana.Signature, updates []*pyth.Instruction) {
+	if s.RetainUnconfirmed <= 0 || len(updates) == 0 {
+		return
+	}
+	s.retained.lock.Lock()
+	defer s.retained.lock.Unlock()
+	now := s.Clock()
+	if s.retained.txs == nil {
+		s.retained.txs = make(map[solana.Signature]retainedTx)
+	}
+	for retainedSig, tx := range s.retained.txs {
+		if now.After(tx.expires) {
+			delete(s.retained.txs, retainedSig)
+		}
+	}
+	s.retained.txs[sig] = retainedTx{
+		updates: updates,
+		expires: now.Add(s.RetainUnconfirmed),
+	}
+}
+
+// release discards the copy of a transaction that landed.
+func (s *Scheduler) release(sig solana.Signature) {
+	s.retained.lock.Lock()
+	defer s.retained.lock.Unlock()
+	delete(s.retained.txs, sig)
+}
+
+// ReplayUnconfirmed queues the retained updates of sent transactions that
+// have not landed yet, e.g. after failing over to another cluster.
+//
+// Updates created earlier than minSlot are dropped as stale.
+// Returns the number of updates queued.
+func (s *Scheduler) ReplayUnconfirmed(minSlot uint64) int {
+	s.retained.lock.Lock()
+	txs := s.retained.txs
+	s.retained.txs = nil
+	s.retained.lock.Unlock()
+
+	now := s.Clock()
+	var updates []*pyth.Instruction
+	for _, tx := range txs {
+		if now.Before(tx.expires) {
+			updates = append(updates, tx.updates...)
+		}
+	}
+	n := s.buffer.Requeue(updates, minSlot)
+	metricUpdatesReplayed.Add(float64(n))
+	s.Log.Info("Replaying unconfirmed updates",
+		zap.Int("transactions", len(txs)),
+		zap.Int("updates", n),
+		zap.Uint64("min_slot", minSlot))
+	return n
+}
@@ -2,92 +2,500 @@ package schedule
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	eventbus "github.com/asaskevich/EventBus"
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
 	"github.com/gagliardetto/solana-go/rpc/ws"
+	"go.blockdaemon.com/pythian/faults"
 	"go.blockdaemon.com/pythian/signer"
+	"go.blockdaemon.com/pythian/stats"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 // Scheduler buffers price updates and submits transactions.
 type Scheduler struct {
-	Log *zap.Logger
+	Log        *zap.Logger
+	MaxSlotAge uint64     // updates older than this many slots get dropped
+	Confirmer  *Confirmer // optional, tracks sent transactions until they land
 
+	// Clock returns the current time, used for slot timing and flush timestamps.
+	Clock func() time.Time
+
+	// SubmitCommitment is the commitment level used for sending (preflight)
+	// and at which the confirmer considers a transaction landed.
+	SubmitCommitment rpc.CommitmentType
+
+	// SendOptions configure sendTransaction calls. Defaults to DefaultSendOptions.
+	SendOptions SendOptions
+
+	// NotifyProcessed emits preliminary PricePublished events as soon as
+	// transactions reach processed commitment, ahead of SubmitCommitment.
+	NotifyProcessed bool
+
+	// SlotAligned delays each flush until SendOffset after the slot start
+	// (first shred received) and skips the flush if the previous send is still in flight.
+	// Disabled by default, which flushes as soon as a slot update arrives.
+	SlotAligned bool
+	SendOffset  time.Duration
+
+	// PublisherRPC routes transactions paid for by a publisher key to a
+	// specific endpoint, e.g. the staked connection of that identity.
+	// Publishers without a route use the default endpoint.
+	PublisherRPC map[solana.PublicKey]*rpc.Client
+
+	// Standby optionally pauses sending while it returns true,
+	// e.g. while another instance publishes with the same key.
+	Standby func() bool
+	// OnSend is optionally called with the signature of every sent transaction.
+	OnSend func(sig solana.Signature)
+
+	// Nonce optionally sends one transaction per flush through a durable nonce account.
+	// Nil uses the recent block hash for all transactions.
+	Nonce *DurableNonce
+
+	// RetainUnconfirmed keeps a copy of sent updates until their transaction
+	// lands or this duration passes, for ReplayUnconfirmed. 0 disables.
+	RetainUnconfirmed time.Duration
+
+	Stats  *stats.Recorder  // optional rolling-window counters
+	Faults *faults.Injector // optional, delays or drops sends for testing
+
+	// TracerProvider creates spans for flushes and sent transactions.
+	// Nil uses the global provider, which is a no-op unless configured.
+	TracerProvider trace.TracerProvider
+
+	inFlight  int32
+	nonceBusy int32 // 1 while a transaction using the nonce has not settled
+	lastFlush int64 // unix nanos
 	buffer    *Buffer
 	blockhash *BlockHashMonitor
 	signer    *signer.Signer
 	rpc       *rpc.Client
 	wg        sync.WaitGroup
+	bus       eventbus.Bus
+	retained  retainedUpdates
 }
 
 // NewScheduler creates a new unstarted scheduler.
-func NewScheduler(buffer *Buffer, blockhash *BlockHashMonitor, signer *signer.Signer, rpc *rpc.Client) *Scheduler {
+func NewScheduler(buffer *Buffer, blockhash *BlockHashMonitor, signer *signer.Signer, rpcClient *rpc.Client) *Scheduler {
 	return &Scheduler{
-		Log: zap.NewNop(),
+		Log:        zap.NewNop(),
+		Clock:      time.Now,
+		MaxSlotAge: 32,
+
+		SubmitCommitment: rpc.CommitmentConfirmed,
+		SendOptions:      DefaultSendOptions(),
 
 		buffer:    buffer,
 		blockhash: blockhash,
 		signer:    signer,
-		rpc:       rpc,
+		rpc:       rpcClient,
+		bus:       eventbus.New(),
 	}
 }
 
 // Run executes the price update scheduler loop.
 //
 // The provided "slot updates" channel acts as the heart beat that ticks the loop.
-// This method will return when the scheduler shuts down.
+// This method will return when the context is cancelled or the channel is closed,
+// after in-flight transactions are done.
 func (s *Scheduler) Run(ctx context.Context, updates <-chan *ws.SlotsUpdatesResult) {
 	defer s.wg.Wait()
-	for update := range updates {
-		s.tick(ctx, update)
+	for {
+		var update *ws.SlotsUpdatesResult
+		select {
+		case <-ctx.Done():
+			return
+		case next, ok := <-updates:
+			if !ok {
+				return
+			}
+			update = next
+		}
+		slotStart := s.Clock()
+		if s.SlotAligned {
+			if !s.waitSlotOffset(ctx, slotStart) {
+				return
+			}
+			if atomic.LoadInt32(&s.inFlight) > 0 {
+				s.Log.Debug("Previous send still in flight, skipping slot", zap.Uint64("slot", update.Slot))
+				metricSendCyclesSkipped.Inc()
+				continue
+			}
+		}
+		s.tick(ctx, update, slotStart)
+	}
+}
+
+// waitSlotOffset sleeps until SendOffset has passed since the slot start.
+// Returns false if the context was cancelled.
+func (s *Scheduler) waitSlotOffset(ctx context.Context, slotStart time.Time) bool {
+	delay := s.SendOffset - s.Clock().Sub(slotStart)
+	if delay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
 	}
 }
 
-func (s *Scheduler) tick(ctx context.Context, update *ws.SlotsUpdatesResult) {
-	// Assemble transaction.
-	builder := s.buffer.Flush(update.Slot - 32)
-	if builder == nil {
+func (s *Scheduler) tick(ctx context.Context, update *ws.SlotsUpdatesResult, slotStart time.Time) {
+	if s.Standby != nil && s.Standby() {
 		return
 	}
-	builder.SetFeePayer(s.signer.Pubkey())
-	builder.SetRecentBlockHash(s.blockhash.GetRecentBlockHash().Blockhash)
-	tx, err := builder.Build()
-	if err != nil {
-		s.Log.Error("Failed to build transaction", zap.Error(err))
+	recentBlockhash := s.blockhash.GetRecentBlockHash()
+	if recentBlockhash == nil {
+		s.Log.Warn("No recent block hash yet, delaying flush")
+		return
+	}
+	if remaining, ok := s.blockhash.BlocksRemaining(); ok && remaining <= 0 {
+		s.Log.Warn("Recent block hash expired, delaying flush",
+			zap.Stringer("blockhash", &recentBlockhash.Blockhash),
+			zap.Int64("blocks_remaining", remaining))
 		return
 	}
 
-	// Sign transaction.
-	if err := s.signer.SignPriceUpdate(tx); err != nil {
-		s.Log.Error("Failed to sign transaction", zap.Error(err))
+	// Assemble transactions.
+	ctx, span := s.tracer().Start(ctx, "flush", trace.WithAttributes(attrSlot.Int64(int64(update.Slot))))
+	defer span.End()
+	flushed := s.buffer.flush(update.Slot - s.MaxSlotAge)
+	atomic.StoreInt64(&s.lastFlush, s.Clock().UnixNano())
+	span.SetAttributes(attribute.Int("pythian.transactions", len(flushed)))
+	var nonce solana.Hash
+	var useNonce bool
+	if len(flushed) > 0 {
+		nonce, useNonce = s.takeNonce(ctx)
 	}
+	for _, f := range flushed {
+		if !f.signer.Equals(s.signer.Pubkey()) {
+			s.Log.Error("Dropping transaction of unknown publisher key",
+				zap.Stringer("publisher", f.signer),
+				zap.Int("updates", len(f.updates)))
+			s.buffer.dropFlushed(f.updates, DropUnknownSigner)
+			s.buffer.settle(f.updates)
+			continue
+		}
+		var tx *solana.Transaction
+		var err error
+		withNonce := useNonce
+		if withNonce {
+			useNonce = false
+			tx, err = s.buildNonceTransaction(f, nonce)
+		} else {
+			tx, err = buildTransaction(f.builder, f.signer, recentBlockhash.Blockhash)
+		}
+		if err != nil {
+			s.Log.Error("Failed to build transaction", zap.Error(err))
+			s.buffer.settle(f.updates)
+			if withNonce {
+				atomic.StoreInt32(&s.nonceBusy, 0)
+			}
+			continue
+		}
 
-	s.Log.Debug("Submitting price update",
-		zap.Stringer("publisher", &tx.Message.AccountKeys[0]),
-		zap.Int("updates", len(tx.Message.Instructions)))
+		// Sign transaction.
+		if err := s.signer.SignPriceUpdate(tx); err != nil {
+			s.Log.Error("Failed to sign transaction", zap.Error(err))
+			s.buffer.settle(f.updates)
+			if withNonce {
+				atomic.StoreInt32(&s.nonceBusy, 0)
+			}
+			continue
+		}
+
+		s.Log.Debug("Submitting price update",
+			zap.Stringer("publisher", &tx.Message.AccountKeys[0]),
+			zap.Int("updates", len(tx.Message.Instructions)))
 
-	s.wg.Add(1)
-	go s.sendTransaction(ctx, tx)
+		s.wg.Add(1)
+		atomic.AddInt32(&s.inFlight, 1)
+		if withNonce {
+			go func(tx *solana.Transaction, f flushedTx) {
+				defer atomic.StoreInt32(&s.nonceBusy, 0)
+				s.sendTransaction(ctx, tx, f, update.Slot, slotStart)
+			}(tx, f)
+		} else {
+			go s.sendTransaction(ctx, tx, f, update.Slot, slotStart)
+		}
+	}
+	if useNonce {
+		// No transaction was sent with the nonce.
+		atomic.StoreInt32(&s.nonceBusy, 0)
+	}
 }
 
-func (s *Scheduler) sendTransaction(ctx context.Context, tx *solana.Transaction) {
+// takeNonce reserves the durable nonce for one transaction of the flush.
+// Returns false if no nonce is configured, the nonce is still in use
+// by an unsettled transaction, or it could not be fetched.
+func (s *Scheduler) takeNonce(ctx context.Context) (solana.Hash, bool) {
+	if s.Nonce == nil || !atomic.CompareAndSwapInt32(&s.nonceBusy, 0, 1) {
+		return solana.Hash{}, false
+	}
+	nonce, err := s.fetchNonce(ctx)
+	if err != nil {
+		s.Log.Warn("Failed to fetch durable nonce, using recent block hash", zap.Error(err))
+		atomic.StoreInt32(&s.nonceBusy, 0)
+		return solana.Hash{}, false
+	}
+	return nonce, true
+}
+
+// instrumentationName names the OpenTelemetry tracer of this package.
+const instrumentationName = "go.blockdaemon.com/pythian/schedule"
+
+// Span attributes.
+const (
+	attrSlot      = attribute.Key("solana.slot")
+	attrSignature = attribute.Key("solana.signature")
+	attrPublisher = attribute.Key("pyth.publisher")
+	attrPrices    = attribute.Key("pyth.prices")
+)
+
+func (s *Scheduler) tracer() trace.Tracer {
+	provider := s.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(instrumentationName)
+}
+
+// startSendSpan starts the span of a sent transaction, linking the requests that submitted its updates.
+func (s *Scheduler) startSendSpan(ctx context.Context, tx *solana.Transaction, f flushedTx, slot uint64) (context.Context, trace.Span) {
+	prices := updatedPrices(tx)
+	priceStrs := make([]string, len(prices))
+	for i, price := range prices {
+		priceStrs[i] = price.String()
+	}
+	links := make([]trace.Link, len(f.spans))
+	for i, spanCtx := range f.spans {
+		links[i] = trace.Link{SpanContext: spanCtx}
+	}
+	return s.tracer().Start(ctx, "send_transaction",
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			attrSlot.Int64(int64(slot)),
+			attrPublisher.String(f.signer.String()),
+			attrPrices.StringSlice(priceStrs),
+		))
+}
+
+// LastFlush returns the time the buffer was last flushed. Zero if never.
+func (s *Scheduler) LastFlush() time.Time {
+	nanos := atomic.LoadInt64(&s.lastFlush)
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// SignTransaction assembles and signs a transaction the way flushed updates are sent.
+func (s *Scheduler) SignTransaction(builder *solana.TransactionBuilder, blockhash solana.Hash) (*solana.Transaction, error) {
+	tx, err := buildTransaction(builder, s.signer.Pubkey(), blockhash)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.signer.SignPriceUpdate(tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// buildTransaction assembles an unsigned transaction paid for by the publisher.
+//
+// The fee payer is always the first account key and signer.
+func buildTransaction(builder *solana.TransactionBuilder, feePayer solana.PublicKey, blockhash solana.Hash) (*solana.Transaction, error) {
+	builder.SetFeePayer(feePayer)
+	builder.SetRecentBlockHash(blockhash)
+	return builder.Build()
+}
+
+// sendTransaction sends a transaction and tracks it until confirmed.
+// Logs include the correlation IDs of traced updates,
+// and its span links to the spans of the requests that submitted them.
+func (s *Scheduler) sendTransaction(ctx context.Context, tx *solana.Transaction, f flushedTx, slot uint64, slotStart time.Time) {
 	defer s.wg.Done()
-	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	updates, traces := f.updates, f.traces
+	defer s.buffer.settle(updates)
+	log := s.Log
+	if len(traces) > 0 {
+		log = log.With(zap.Strings("correlation_ids", traces))
+	}
+	var txSig solana.Signature
+	if len(tx.Signatures) > 0 {
+		txSig = tx.Signatures[0]
+	}
+	ctx, span := s.startSendSpan(ctx, tx, f, slot)
+	defer span.End()
+	s.retain(txSig, updates)
+	if s.Faults.DelaySend(ctx) != nil || s.Faults.ShouldDropSend() {
+		atomic.AddInt32(&s.inFlight, -1)
+		return
+	}
+	sendCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	sig, err := s.rpc.SendTransactionWithOpts(ctx, tx, true, rpc.CommitmentProcessed)
+	metricSendSlotOffset.Observe(s.Clock().Sub(slotStart).Seconds())
+	s.Stats.Inc(stats.TxsSent)
+	sig, err := s.send(sendCtx, tx)
+	if isBlockhashNotFound(err) && !usesNonce(tx) {
+		log.Warn("Send node does not know block hash, retrying with fresh block hash",
+			zap.Stringer("blockhash", &tx.Message.RecentBlockhash))
+		s.release(txSig)
+		sig, err = s.retryWithFreshBlockhash(sendCtx, tx)
+		if len(tx.Signatures) > 0 {
+			txSig = tx.Signatures[0]
+		}
+		s.retain(txSig, updates)
+	}
+	atomic.AddInt32(&s.inFlight, -1)
 	if err != nil {
-		s.Log.Error("Failed to send transaction", zap.Error(err))
+		s.Stats.Inc(stats.TxsFailed)
+		s.Stats.Inc(stats.RPCErrors)
+		log.Error("Failed to send transaction", zap.Error(err))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "send failed")
+		if isRateLimited(err) {
+			// The transaction was rejected unseen, so its updates compete
+			// by weight for the next flush instead of getting lost.
+			s.release(txSig)
+			n := s.buffer.Requeue(updates, slot-s.MaxSlotAge)
+			log.Warn("Send rate limited, requeued updates", zap.Int("updates", n))
+		}
 		return
 	}
+	span.SetAttributes(attrSignature.String(sig.String()))
 
-	s.Log.Info("Sent transaction",
+	if s.OnSend != nil {
+		s.OnSend(sig)
+	}
+	log.Info("Sent transaction",
 		zap.Stringer("signature", sig),
 		zap.Int("updates", len(tx.Message.Instructions)))
-	metricTxsSent.
-		WithLabelValues(tx.Message.AccountKeys[0].String()).
+	metrics := getUpdateMetrics()
+	metrics.txsSent.
+		WithLabelValues(metrics.publisherLabels(tx.Message.AccountKeys[0])...).
 		Inc()
+
+	if s.Confirmer == nil {
+		return
+	}
+	event := PricePublished{
+		Signature: sig,
+		Publisher: tx.Message.AccountKeys[0],
+		Prices:    updatedPrices(tx),
+		Updates:   summarizeUpdates(updates),
+	}
+	var processed func()
+	if s.NotifyProcessed {
+		processed = func() {
+			preliminary := event
+			preliminary.Status = ConfirmLanded
+			preliminary.Commitment = rpc.CommitmentProcessed
+			preliminary.Preliminary = true
+			s.publishEvent(preliminary)
+		}
+	}
+	event.Status = s.Confirmer.Track(ctx, sig, s.SubmitCommitment, processed)
+	span.SetAttributes(attribute.String("pythian.confirm_status", string(event.Status)))
+	if event.Status != ConfirmLanded {
+		span.SetStatus(codes.Error, "transaction "+string(event.Status))
+	}
+	if len(traces) > 0 {
+		log.Info("Traced transaction confirmation",
+			zap.Stringer("signature", sig),
+			zap.String("status", string(event.Status)))
+	}
+	switch event.Status {
+	case ConfirmLanded:
+		s.release(txSig)
+		event.Commitment = s.SubmitCommitment
+		s.Stats.Inc(stats.TxsConfirmed)
+		s.Stats.Add(stats.UpdatesConfirmed, uint64(countUpdates(tx)))
+	case ConfirmFailed:
+		s.Stats.Inc(stats.TxsFailed)
+	case ConfirmExpired:
+		s.Stats.Inc(stats.TxsExpired)
+	}
+	s.publishEvent(event)
+}
+
+// retryWithFreshBlockhash sends a transaction once more after the send node
+// rejected its block hash, which happens if the node lags behind the node
+// the block hash was fetched from.
+//
+// The transaction is signed again with a fresh block hash.
+// Its instructions, including the pub slots of price updates, are unchanged.
+func (s *Scheduler) retryWithFreshBlockhash(ctx context.Context, tx *solana.Transaction) (solana.Signature, error) {
+	metricBlockhashRetries.Inc()
+	if err := s.blockhash.Refresh(ctx); err != nil {
+		return solana.Signature{}, fmt.Errorf("failed to refresh block hash: %w", err)
+	}
+	tx.Message.RecentBlockhash = s.blockhash.GetRecentBlockHash().Blockhash
+	tx.Signatures = nil
+	if err := s.signer.SignPriceUpdate(tx); err != nil {
+		return solana.Signature{}, fmt.Errorf("failed to sign transaction: %w", err)
+	}
+	sig, err := s.send(ctx, tx)
+	if err != nil {
+		return sig, err
+	}
+	metricBlockhashRetriesSucceeded.Inc()
+	return sig, nil
+}
+
+// isBlockhashNotFound returns whether a send failed because the node did not know the block hash.
+func isBlockhashNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "Blockhash not found")
+}
+
+// isRateLimited returns whether a send was rejected with 429 Too Many Requests.
+func isRateLimited(err error) bool {
+	var httpErr *jsonrpc.HTTPError
+	return errors.As(err, &httpErr) && httpErr.Code == http.StatusTooManyRequests
+}
+
+// rpcFor returns the endpoint that transactions paid for by a publisher are sent to.
+func (s *Scheduler) rpcFor(publisher solana.PublicKey) *rpc.Client {
+	if client, ok := s.PublisherRPC[publisher]; ok {
+		return client
+	}
+	return s.rpc
+}
+
+// countUpdates returns the number of price update instructions in a transaction.
+func countUpdates(tx *solana.Transaction) int {
+	var n int
+	for _, insn := range tx.Message.Instructions {
+		program := tx.Message.AccountKeys[insn.ProgramIDIndex]
+		if !program.Equals(solana.MemoProgramID) && !program.Equals(solana.SystemProgramID) &&
+			!program.Equals(signer.ComputeBudgetProgramID) {
+			n++
+		}
+	}
+	return n
+}
+
+// ConfirmLatencyQuantile estimates the q-quantile of the time until sent transactions land.
+// Returns false if no transaction has been confirmed yet.
+func ConfirmLatencyQuantile(q float64) (time.Duration, bool) {
+	seconds, ok := stats.HistogramQuantile(metricConfirmLatency, q)
+	return time.Duration(seconds * float64(time.Second)), ok
 }
@@ -0,0 +1,831 @@
+package schedule
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/jsonrpc"
+	"go.blockdaemon.com/pythian/signer"
+	"go.blockdaemon.com/pythian/signer/signertest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// mockSendNode is a fake Solana RPC endpoint that holds sendTransaction calls until released.
+type mockSendNode struct {
+	*httptest.Server
+	sends       chan time.Time
+	commitments chan string // preflight commitment of each send
+	release     chan struct{}
+
+	lock              sync.Mutex
+	blockhash         solana.Hash // returned by getRecentBlockhash, testBlockhash if zero
+	blockhashNotFound int         // number of sends to reject for an unknown block hash
+	sent              []*solana.Transaction
+	sentOpts          []map[string]interface{} // options of each send
+	nonceAccount      []byte                   // returned by getAccountInfo
+}
+
+// setBlockhash changes the block hash returned by the node.
+func (m *mockSendNode) setBlockhash(hash solana.Hash) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.blockhash = hash
+}
+
+// rejectBlockhash rejects the next n sends with a "Blockhash not found" error.
+func (m *mockSendNode) rejectBlockhash(n int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.blockhashNotFound = n
+}
+
+// sentTxs returns the transactions received by the node, including rejected ones.
+func (m *mockSendNode) sentTxs() []*solana.Transaction {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]*solana.Transaction(nil), m.sent...)
+}
+
+func newMockSendNode(t *testing.T) *mockSendNode {
+	node := &mockSendNode{
+		sends:       make(chan time.Time, 16),
+		commitments: make(chan string, 16),
+		release:     make(chan struct{}),
+	}
+	node.Server = httptest.NewServer(http.HandlerFunc(node.serve))
+	t.Cleanup(node.Close)
+	return node
+}
+
+func (m *mockSendNode) serve(rw http.ResponseWriter, req *http.Request) {
+	var msg struct {
+		ID     json.RawMessage   `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&msg); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var result interface{}
+	m.lock.Lock()
+	blockhash := m.blockhash
+	nonceAccount := m.nonceAccount
+	m.lock.Unlock()
+	if blockhash.IsZero() {
+		blockhash = testBlockhash
+	}
+	switch msg.Method {
+	case "getRecentBlockhash":
+		result = map[string]interface{}{
+			"context": map[string]interface{}{"slot": 1},
+			"value": map[string]interface{}{
+				"blockhash":     blockhash.String(),
+				"feeCalculator": map[string]interface{}{"lamportsPerSignature": 5000},
+			},
+		}
+	case "getFeeForMessage":
+		result = map[string]interface{}{
+			"context": map[string]interface{}{"slot": 1},
+			"value":   5000,
+		}
+	case "getAccountInfo":
+		result = map[string]interface{}{
+			"context": map[string]interface{}{"slot": 1},
+			"value": map[string]interface{}{
+				"data":       []string{base64.StdEncoding.EncodeToString(nonceAccount), "base64"},
+				"executable": false,
+				"lamports":   1,
+				"owner":      solana.SystemProgramID.String(),
+				"rentEpoch":  0,
+			},
+		}
+	case "sendTransaction":
+		var opts struct {
+			PreflightCommitment string `json:"preflightCommitment"`
+		}
+		if len(msg.Params) == 2 {
+			_ = json.Unmarshal(msg.Params[1], &opts)
+		}
+		var encoded string
+		_ = json.Unmarshal(msg.Params[0], &encoded)
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tx, err := solana.TransactionFromDecoder(bin.NewBinDecoder(data))
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var rawOpts map[string]interface{}
+		if len(msg.Params) == 2 {
+			_ = json.Unmarshal(msg.Params[1], &rawOpts)
+		}
+		m.lock.Lock()
+		m.sent = append(m.sent, tx)
+		m.sentOpts = append(m.sentOpts, rawOpts)
+		reject := m.blockhashNotFound > 0
+		if reject {
+			m.blockhashNotFound--
+		}
+		m.lock.Unlock()
+		if reject {
+			rw.Header().Set("content-type", "application/json")
+			_ = json.NewEncoder(rw).Encode(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"id":      msg.ID,
+				"error": map[string]interface{}{
+					"code":    -32002,
+					"message": "Transaction simulation failed: Blockhash not found",
+				},
+			})
+			return
+		}
+		m.commitments <- opts.PreflightCommitment
+		m.sends <- time.Now()
+		select {
+		case <-m.release:
+		case <-req.Context().Done():
+			return
+		}
+		result = solana.Signature{}.String()
+	}
+	rw.Header().Set("content-type", "application/json")
+	_ = json.NewEncoder(rw).Encode(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      msg.ID,
+		"result":  result,
+	})
+}
+
+func TestScheduler_SlotAligned(t *testing.T) {
+	node := newMockSendNode(t)
+	txSigner := signertest.New(t, testProgram)
+	client := rpc.New(node.URL)
+	blockhashes := NewBlockHashMonitor(client)
+	require.NoError(t, blockhashes.Init(context.Background()))
+
+	buf := NewBuffer()
+	s := NewScheduler(buf, blockhashes, txSigner, client)
+	s.SlotAligned = true
+	s.SendOffset = 20 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan *ws.SlotsUpdatesResult)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx, updates)
+	}()
+	defer func() {
+		cancel()
+		close(updates)
+		<-done
+	}()
+
+	push := func(slot uint64) {
+		buf.PushUpdate(pyth.NewInstructionBuilder(testProgram).UpdPriceNoFailOnError(txSigner.Pubkey(), solana.NewWallet().PublicKey(), pyth.CommandUpdPrice{
+			Status:  pyth.PriceStatusTrading,
+			Price:   1,
+			Conf:    1,
+			PubSlot: slot,
+		}))
+	}
+	recvSend := func() time.Time {
+		select {
+		case sent := <-node.sends:
+			return sent
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for transaction")
+			return time.Time{}
+		}
+	}
+
+	// Send is delayed by the offset.
+	push(1000)
+	slotStart := time.Now()
+	updates <- &ws.SlotsUpdatesResult{Slot: 1000}
+	assert.GreaterOrEqual(t, int64(recvSend().Sub(slotStart)), int64(s.SendOffset))
+
+	// Slot is skipped while the previous send is in flight.
+	push(1001)
+	updates <- &ws.SlotsUpdatesResult{Slot: 1001}
+	select {
+	case <-node.sends:
+		t.Fatal("sent while previous transaction in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Skipped update goes out with the next slot.
+	node.release <- struct{}{}
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&s.inFlight) == 0
+	}, 5*time.Second, time.Millisecond)
+	updates <- &ws.SlotsUpdatesResult{Slot: 1002}
+	recvSend()
+	close(node.release)
+}
+
+func TestScheduler_SubmitCommitment(t *testing.T) {
+	node := newMockSendNode(t)
+	close(node.release)
+	sigNode := newMockSignatureNode(t)
+	txSigner := signertest.New(t, testProgram)
+	client := rpc.New(node.URL)
+	blockhashes := NewBlockHashMonitor(client)
+	require.NoError(t, blockhashes.Init(context.Background()))
+
+	buf := NewBuffer()
+	s := NewScheduler(buf, blockhashes, txSigner, client)
+	s.SubmitCommitment = rpc.CommitmentFinalized
+	s.Confirmer = NewConfirmer(client, sigNode.URL())
+	defer s.Confirmer.Close()
+
+	require.NoError(t, buf.PushUpdate(pyth.NewInstructionBuilder(testProgram).UpdPriceNoFailOnError(txSigner.Pubkey(), solana.NewWallet().PublicKey(), pyth.CommandUpdPrice{
+		Status:  pyth.PriceStatusTrading,
+		Price:   1,
+		Conf:    1,
+		PubSlot: 1000,
+	})))
+	s.tick(context.Background(), &ws.SlotsUpdatesResult{Slot: 1000}, time.Now())
+	s.wg.Wait()
+
+	assert.Equal(t, "finalized", <-node.commitments)
+	assert.Equal(t, "finalized", <-sigNode.commitments)
+}
+
+func TestScheduler_NotifyProcessed(t *testing.T) {
+	node := newMockSendNode(t)
+	close(node.release)
+	sigNode := newMockSignatureNode(t)
+	sigNode.holdFinal = true
+	txSigner := signertest.New(t, testProgram)
+	client := rpc.New(node.URL)
+	blockhashes := NewBlockHashMonitor(client)
+	require.NoError(t, blockhashes.Init(context.Background()))
+
+	buf := NewBuffer()
+	s := NewScheduler(buf, blockhashes, txSigner, client)
+	s.NotifyProcessed = true
+	s.Confirmer = NewConfirmer(client, sigNode.URL())
+	s.Confirmer.Timeout = 5 * time.Second
+	defer s.Confirmer.Close()
+
+	var events []PricePublished
+	unsub := s.SubscribePublished(func(event PricePublished) {
+		events = append(events, event)
+	})
+	defer unsub()
+
+	price := solana.NewWallet().PublicKey()
+	require.NoError(t, buf.PushUpdate(pyth.NewInstructionBuilder(testProgram).UpdPriceNoFailOnError(txSigner.Pubkey(), price, pyth.CommandUpdPrice{
+		Status:  pyth.PriceStatusTrading,
+		Price:   1,
+		Conf:    1,
+		PubSlot: 1000,
+	})))
+	s.tick(context.Background(), &ws.SlotsUpdatesResult{Slot: 1000}, time.Now())
+	s.wg.Wait()
+
+	require.Len(t, events, 2)
+	assert.True(t, events[0].Preliminary)
+	assert.Equal(t, ConfirmLanded, events[0].Status)
+	assert.Equal(t, rpc.CommitmentProcessed, events[0].Commitment)
+	assert.Equal(t, []solana.PublicKey{price}, events[0].Prices)
+	assert.False(t, events[1].Preliminary)
+	assert.Equal(t, ConfirmLanded, events[1].Status)
+	assert.Equal(t, rpc.CommitmentConfirmed, events[1].Commitment)
+	assert.Equal(t, events[0].Signature, events[1].Signature)
+	assert.Equal(t, txSigner.Pubkey(), events[1].Publisher)
+	assert.Equal(t, []QueuedUpdate{
+		{Price: price, PubSlot: 1000, Value: 1, Conf: 1, Status: pyth.PriceStatusTrading},
+	}, events[1].Updates)
+}
+
+func TestScheduler_ReplayUnconfirmed(t *testing.T) {
+	node := newMockSendNode(t)
+	blockhashes := NewBlockHashMonitor(rpc.New(node.URL))
+	require.NoError(t, blockhashes.Init(context.Background()))
+	// The cluster dies while transactions are in flight.
+	deadNode := httptest.NewServer(http.NotFoundHandler())
+	deadNode.Close()
+
+	txSigner := signertest.New(t, testProgram)
+	buf := NewBuffer()
+	s := NewScheduler(buf, blockhashes, txSigner, rpc.New(deadNode.URL))
+	s.RetainUnconfirmed = time.Minute
+
+	push := func(price solana.PublicKey, pubSlot uint64) {
+		require.NoError(t, buf.PushUpdate(pyth.NewInstructionBuilder(testProgram).UpdPriceNoFailOnError(txSigner.Pubkey(), price, pyth.CommandUpdPrice{
+			Status:  pyth.PriceStatusTrading,
+			Price:   1,
+			Conf:    1,
+			PubSlot: pubSlot,
+		})))
+	}
+	priceA, priceB, priceC := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	push(priceA, 1000)
+	push(priceB, 1000)
+	push(priceC, 990)
+	s.tick(context.Background(), &ws.SlotsUpdatesResult{Slot: 1000}, time.Now())
+	s.wg.Wait()
+	assert.Empty(t, buf.Queued())
+
+	// A newer update arrives while failing over.
+	push(priceB, 1010)
+
+	// Unconfirmed updates are queued for the new cluster, unless outdated or stale.
+	assert.Equal(t, 1, s.ReplayUnconfirmed(995))
+	assert.ElementsMatch(t, []QueuedUpdate{
+		{Price: priceA, PubSlot: 1000, Value: 1, Conf: 1, Status: pyth.PriceStatusTrading},
+		{Price: priceB, PubSlot: 1010, Value: 1, Conf: 1, Status: pyth.PriceStatusTrading},
+	}, buf.Queued())
+	assert.Equal(t, 0, s.ReplayUnconfirmed(995), "updates replayed twice")
+}
+
+func TestScheduler_RateLimited(t *testing.T) {
+	node := newMockSendNode(t)
+	blockhashes := NewBlockHashMonitor(rpc.New(node.URL))
+	require.NoError(t, blockhashes.Init(context.Background()))
+	limited := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		http.Error(rw, "Too Many Requests", http.StatusTooManyRequests)
+	}))
+	defer limited.Close()
+
+	txSigner := signertest.New(t, testProgram)
+	buf := NewBuffer()
+	s := NewScheduler(buf, blockhashes, txSigner, rpc.New(limited.URL))
+	price := solana.NewWallet().PublicKey()
+	require.NoError(t, buf.PushUpdate(pyth.NewInstructionBuilder(testProgram).UpdPriceNoFailOnError(
+		txSigner.Pubkey(), price, pyth.CommandUpdPrice{Status: pyth.PriceStatusTrading, Price: 1, Conf: 1, PubSlot: 1000})))
+	s.tick(context.Background(), &ws.SlotsUpdatesResult{Slot: 1000}, time.Now())
+	s.wg.Wait()
+
+	// The rejected update is queued again for the next flush.
+	queued := buf.Queued()
+	require.Len(t, queued, 1)
+	assert.Equal(t, price, queued[0].Price)
+	assert.Empty(t, buf.DropLog())
+}
+
+func TestScheduler_PublisherRPC(t *testing.T) {
+	defaultNode, nodeA, nodeB := newMockSendNode(t), newMockSendNode(t), newMockSendNode(t)
+	close(defaultNode.release)
+	close(nodeA.release)
+	close(nodeB.release)
+	client := rpc.New(defaultNode.URL)
+	blockhashes := NewBlockHashMonitor(client)
+	require.NoError(t, blockhashes.Init(context.Background()))
+
+	publisherA, publisherB := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	s := NewScheduler(NewBuffer(), blockhashes, signertest.New(t, testProgram), client)
+	s.PublisherRPC = map[solana.PublicKey]*rpc.Client{
+		publisherA: rpc.New(nodeA.URL),
+		publisherB: rpc.New(nodeB.URL),
+	}
+
+	send := func(publisher solana.PublicKey) {
+		builder := solana.NewTransactionBuilder().AddInstruction(pyth.NewInstructionBuilder(testProgram).
+			UpdPriceNoFailOnError(publisher, solana.NewWallet().PublicKey(), pyth.CommandUpdPrice{}))
+		tx, err := buildTransaction(builder, publisher, testBlockhash)
+		require.NoError(t, err)
+		tx.Signatures = make([]solana.Signature, 1) // not verified by the mock
+		s.wg.Add(1)
+		atomic.AddInt32(&s.inFlight, 1)
+		s.sendTransaction(context.Background(), tx, flushedTx{}, 0, time.Now())
+	}
+	send(publisherA)
+	send(publisherB)
+	send(publisherB)
+	send(solana.NewWallet().PublicKey())
+
+	assert.Len(t, nodeA.sends, 1)
+	assert.Len(t, nodeB.sends, 2)
+	assert.Len(t, defaultNode.sends, 1)
+}
+
+func TestScheduler_CorrelationID(t *testing.T) {
+	node := newMockSendNode(t)
+	close(node.release)
+	txSigner := signertest.New(t, testProgram)
+	client := rpc.New(node.URL)
+	blockhashes := NewBlockHashMonitor(client)
+	require.NoError(t, blockhashes.Init(context.Background()))
+
+	core, logs := observer.New(zap.InfoLevel)
+	log := zap.New(core)
+	buf := NewBuffer()
+	s := NewScheduler(buf, blockhashes, txSigner, client)
+	s.Log = log
+
+	// Price updates submitted over JSON-RPC carry the request's correlation ID.
+	rpcServer := jsonrpc.NewServer(jsonrpc.HandleFunc(func(ctx context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+		err := buf.PushTracedUpdate(pyth.NewInstructionBuilder(testProgram).UpdPriceNoFailOnError(txSigner.Pubkey(), solana.NewWallet().PublicKey(), pyth.CommandUpdPrice{
+			Status:  pyth.PriceStatusTrading,
+			Price:   1,
+			Conf:    1,
+			PubSlot: 1000,
+		}), UpdateTrace{CorrelationID: jsonrpc.CorrelationID(ctx)})
+		require.NoError(t, err)
+		return jsonrpc.NewResultResponse(req.ID, 0)
+	}))
+	rpcServer.Log = log
+	rpcServer.Tracing = true
+	srv := httptest.NewServer(rpcServer)
+	t.Cleanup(srv.Close)
+	req, err := http.NewRequest(http.MethodPost, srv.URL,
+		strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"update_price"}`))
+	require.NoError(t, err)
+	req.Header.Set(jsonrpc.CorrelationIDHeader, "update-1")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+
+	s.tick(context.Background(), &ws.SlotsUpdatesResult{Slot: 1000}, time.Now())
+	s.wg.Wait()
+
+	requestLogs := logs.FilterMessage("Request started").FilterField(zap.String("correlation_id", "update-1"))
+	assert.Equal(t, 1, requestLogs.Len())
+	sent := logs.FilterMessage("Sent transaction").All()
+	require.Len(t, sent, 1)
+	assert.Equal(t, []interface{}{"update-1"}, sent[0].ContextMap()["correlation_ids"])
+}
+
+func TestScheduler_BlockhashNotFound(t *testing.T) {
+	node := newMockSendNode(t)
+	close(node.release)
+	txSigner := signertest.New(t, testProgram)
+	client := rpc.New(node.URL)
+	blockhashes := NewBlockHashMonitor(client)
+	require.NoError(t, blockhashes.Init(context.Background()))
+	buf := NewBuffer()
+	s := NewScheduler(buf, blockhashes, txSigner, client)
+
+	push := func(pubSlot uint64) {
+		require.NoError(t, buf.PushUpdate(pyth.NewInstructionBuilder(testProgram).UpdPriceNoFailOnError(txSigner.Pubkey(), solana.NewWallet().PublicKey(), pyth.CommandUpdPrice{
+			Status:  pyth.PriceStatusTrading,
+			Price:   1,
+			Conf:    1,
+			PubSlot: pubSlot,
+		})))
+	}
+	freshBlockhash := solana.MustHashFromBase58("9Mv6fvRNBbRTzP2wJjxTKX4iJwNnuzRf2stDbUBtrzjR")
+	node.setBlockhash(freshBlockhash)
+
+	// Retried once with a fresh block hash, keeping the instructions.
+	node.rejectBlockhash(1)
+	push(1000)
+	s.tick(context.Background(), &ws.SlotsUpdatesResult{Slot: 1000}, time.Now())
+	s.wg.Wait()
+	sent := node.sentTxs()
+	require.Len(t, sent, 2)
+	assert.Equal(t, testBlockhash, sent[0].Message.RecentBlockhash)
+	assert.Equal(t, freshBlockhash, sent[1].Message.RecentBlockhash)
+	assert.Equal(t, sent[0].Message.Instructions, sent[1].Message.Instructions)
+	assert.NoError(t, sent[1].VerifySignatures())
+	assert.Len(t, node.sends, 1)
+	assert.Equal(t, freshBlockhash, blockhashes.GetRecentBlockHash().Blockhash)
+
+	// No further retries if the retry is rejected as well.
+	node.rejectBlockhash(3)
+	push(1001)
+	s.tick(context.Background(), &ws.SlotsUpdatesResult{Slot: 1001}, time.Now())
+	s.wg.Wait()
+	assert.Len(t, node.sentTxs(), 4)
+	assert.Len(t, node.sends, 1)
+}
+
+func TestScheduler_CoalesceInFlight(t *testing.T) {
+	node := newMockSendNode(t)
+	txSigner := signertest.New(t, testProgram)
+	client := rpc.New(node.URL)
+	blockhashes := NewBlockHashMonitor(client)
+	require.NoError(t, blockhashes.Init(context.Background()))
+
+	buf := NewBuffer()
+	buf.CoalesceInFlight = true
+	s := NewScheduler(buf, blockhashes, txSigner, client)
+
+	price, other := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	push := func(account solana.PublicKey, value int64, slot uint64) {
+		require.NoError(t, buf.PushUpdate(pyth.NewInstructionBuilder(testProgram).UpdPriceNoFailOnError(txSigner.Pubkey(), account, pyth.CommandUpdPrice{
+			Status:  pyth.PriceStatusTrading,
+			Price:   value,
+			Conf:    1,
+			PubSlot: slot,
+		})))
+	}
+	recvSend := func() {
+		select {
+		case <-node.sends:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for transaction")
+		}
+	}
+
+	// First update is in flight until the node responds.
+	push(price, 1, 1000)
+	s.tick(context.Background(), &ws.SlotsUpdatesResult{Slot: 1000}, time.Now())
+	recvSend()
+
+	// Updates of the same account are held back and coalesced, others go out.
+	push(price, 2, 1001)
+	push(other, 1, 1001)
+	s.tick(context.Background(), &ws.SlotsUpdatesResult{Slot: 1001}, time.Now())
+	recvSend()
+	push(price, 3, 1002)
+	s.tick(context.Background(), &ws.SlotsUpdatesResult{Slot: 1002}, time.Now())
+	select {
+	case <-node.sends:
+		t.Fatal("sent while previous transaction of account in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.Equal(t, []QueuedUpdate{{Price: price, PubSlot: 1002, Value: 3, Conf: 1, Status: pyth.PriceStatusTrading}}, buf.Queued())
+
+	// Held update goes out once the transactions settled.
+	close(node.release)
+	s.wg.Wait()
+	s.tick(context.Background(), &ws.SlotsUpdatesResult{Slot: 1003}, time.Now())
+	recvSend()
+	s.wg.Wait()
+	assert.Empty(t, buf.Queued())
+	sent := node.sentTxs()
+	require.Len(t, sent, 3)
+	assert.Equal(t, 1, countUpdates(sent[2]))
+	assert.Equal(t, price, sent[2].Message.AccountKeys[sent[2].Message.Instructions[0].Accounts[1]])
+}
+
+func TestScheduler_UnknownSigner(t *testing.T) {
+	node := newMockSendNode(t)
+	close(node.release)
+	txSigner := signertest.New(t, testProgram)
+	client := rpc.New(node.URL)
+	blockhashes := NewBlockHashMonitor(client)
+	require.NoError(t, blockhashes.Init(context.Background()))
+	buf := NewBuffer()
+	s := NewScheduler(buf, blockhashes, txSigner, client)
+
+	for _, publisher := range []solana.PublicKey{txSigner.Pubkey(), solana.NewWallet().PublicKey()} {
+		require.NoError(t, buf.PushUpdate(pyth.NewInstructionBuilder(testProgram).UpdPriceNoFailOnError(publisher, solana.NewWallet().PublicKey(), pyth.CommandUpdPrice{
+			Status:  pyth.PriceStatusTrading,
+			Price:   1,
+			PubSlot: 1000,
+		})))
+	}
+	s.tick(context.Background(), &ws.SlotsUpdatesResult{Slot: 1000}, time.Now())
+	s.wg.Wait()
+
+	// Only the update of the scheduler's key is sent.
+	sent := node.sentTxs()
+	require.Len(t, sent, 1)
+	assert.Equal(t, txSigner.Pubkey(), sent[0].Message.AccountKeys[0])
+	drops := buf.DropLog()
+	require.Len(t, drops, 1)
+	assert.Equal(t, DropUnknownSigner, drops[0].Reason)
+}
+
+func TestScheduler_SendOptions(t *testing.T) {
+	node := newMockSendNode(t)
+	close(node.release)
+	txSigner := signertest.New(t, testProgram)
+	client := rpc.New(node.URL)
+	blockhashes := NewBlockHashMonitor(client)
+	require.NoError(t, blockhashes.Init(context.Background()))
+	buf := NewBuffer()
+	s := NewScheduler(buf, blockhashes, txSigner, client)
+
+	send := func() map[string]interface{} {
+		require.NoError(t, buf.PushUpdate(pyth.NewInstructionBuilder(testProgram).UpdPriceNoFailOnError(txSigner.Pubkey(), solana.NewWallet().PublicKey(), pyth.CommandUpdPrice{
+			Status:  pyth.PriceStatusTrading,
+			Price:   1,
+			PubSlot: 1000,
+		})))
+		s.tick(context.Background(), &ws.SlotsUpdatesResult{Slot: 1000}, time.Now())
+		s.wg.Wait()
+		node.lock.Lock()
+		defer node.lock.Unlock()
+		return node.sentOpts[len(node.sentOpts)-1]
+	}
+
+	// Defaults skip preflight, leaving retries to the node.
+	assert.Equal(t, map[string]interface{}{
+		"encoding":            "base64",
+		"skipPreflight":       true,
+		"preflightCommitment": "confirmed",
+	}, send())
+
+	maxRetries := uint(0)
+	s.SendOptions = SendOptions{
+		PreflightCommitment: rpc.CommitmentProcessed,
+		MaxRetries:          &maxRetries,
+	}
+	assert.Equal(t, map[string]interface{}{
+		"encoding":            "base64",
+		"preflightCommitment": "processed",
+		"maxRetries":          float64(0),
+	}, send())
+}
+
+func TestScheduler_Tracing(t *testing.T) {
+	node := newMockSendNode(t)
+	close(node.release)
+	txSigner := signertest.New(t, testProgram)
+	client := rpc.New(node.URL)
+	blockhashes := NewBlockHashMonitor(client)
+	require.NoError(t, blockhashes.Init(context.Background()))
+	buf := NewBuffer()
+	s := NewScheduler(buf, blockhashes, txSigner, client)
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	s.TracerProvider = provider
+
+	// The update was submitted by a traced request.
+	_, request := provider.Tracer("test").Start(context.Background(), "update_price")
+	request.End()
+	price := solana.NewWallet().PublicKey()
+	require.NoError(t, buf.PushTracedUpdate(pyth.NewInstructionBuilder(testProgram).UpdPriceNoFailOnError(txSigner.Pubkey(), price, pyth.CommandUpdPrice{
+		Status:  pyth.PriceStatusTrading,
+		Price:   1,
+		PubSlot: 1000,
+	}), UpdateTrace{Span: request.SpanContext()}))
+	s.tick(context.Background(), &ws.SlotsUpdatesResult{Slot: 1000}, time.Now())
+	s.wg.Wait()
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	flush, send := spans["flush"], spans["send_transaction"]
+	assert.Contains(t, flush.Attributes, attrSlot.Int64(1000))
+	assert.Equal(t, flush.SpanContext.SpanID(), send.Parent.SpanID())
+	require.Len(t, send.Links, 1)
+	assert.Equal(t, request.SpanContext(), send.Links[0].SpanContext)
+	assert.Contains(t, send.Attributes, attrSlot.Int64(1000))
+	assert.Contains(t, send.Attributes, attrPrices.StringSlice([]string{price.String()}))
+	var signed bool
+	for _, attr := range send.Attributes {
+		signed = signed || attr.Key == attrSignature
+	}
+	assert.True(t, signed, "missing signature")
+}
+
+func TestScheduler_DurableNonce(t *testing.T) {
+	node := newMockSendNode(t)
+	txSigner := signertest.New(t, testProgram)
+	nonceHash := solana.MustHashFromBase58("9Mv6fvRNBbRTzP2wJjxTKX4iJwNnuzRf2stDbUBtrzjR")
+	var nonceData bytes.Buffer
+	require.NoError(t, bin.NewBinEncoder(&nonceData).Encode(system.NonceAccount{
+		State:            1,
+		AuthorizedPubkey: txSigner.Pubkey(),
+		Nonce:            solana.PublicKey(nonceHash),
+	}))
+	node.nonceAccount = nonceData.Bytes()
+	client := rpc.New(node.URL)
+	blockhashes := NewBlockHashMonitor(client)
+	require.NoError(t, blockhashes.Init(context.Background()))
+	buf := NewBuffer()
+	s := NewScheduler(buf, blockhashes, txSigner, client)
+	s.Nonce = &DurableNonce{Account: solana.NewWallet().PublicKey(), Authority: txSigner.Pubkey()}
+
+	push := func(pubSlot uint64) {
+		require.NoError(t, buf.PushUpdate(pyth.NewInstructionBuilder(testProgram).UpdPriceNoFailOnError(txSigner.Pubkey(), solana.NewWallet().PublicKey(), pyth.CommandUpdPrice{
+			Status:  pyth.PriceStatusTrading,
+			Price:   1,
+			Conf:    1,
+			PubSlot: pubSlot,
+		})))
+	}
+
+	// Advance-nonce instruction comes first, and the nonce is used as block hash.
+	push(1000)
+	s.tick(context.Background(), &ws.SlotsUpdatesResult{Slot: 1000}, time.Now())
+	<-node.sends
+	sent := node.sentTxs()
+	require.Len(t, sent, 1)
+	tx := sent[0]
+	assert.Equal(t, nonceHash, tx.Message.RecentBlockhash)
+	require.Len(t, tx.Message.Instructions, 2)
+	advance := tx.Message.Instructions[0]
+	assert.Equal(t, solana.SystemProgramID, tx.Message.AccountKeys[advance.ProgramIDIndex])
+	assert.True(t, signer.IsAdvanceNonce(advance.Data))
+	assert.Equal(t, s.Nonce.Account, tx.Message.AccountKeys[advance.Accounts[0]])
+	assert.Equal(t, txSigner.Pubkey(), tx.Message.AccountKeys[0])
+	assert.NoError(t, tx.VerifySignatures())
+	assert.Equal(t, 1, countUpdates(tx))
+
+	// Recent block hash is used while the nonce transaction has not settled.
+	push(1001)
+	s.tick(context.Background(), &ws.SlotsUpdatesResult{Slot: 1001}, time.Now())
+	<-node.sends
+	sent = node.sentTxs()
+	require.Len(t, sent, 2)
+	assert.Equal(t, testBlockhash, sent[1].Message.RecentBlockhash)
+	assert.False(t, usesNonce(sent[1]))
+	close(node.release)
+	s.wg.Wait()
+}
+
+func TestScheduler_EstimateFee(t *testing.T) {
+	node := newMockSendNode(t)
+	txSigner := signertest.New(t, testProgram)
+	client := rpc.New(node.URL)
+	blockhashes := NewBlockHashMonitor(client)
+	require.NoError(t, blockhashes.Init(context.Background()))
+	buf := NewBuffer()
+	buf.PriorityFee = &PriorityFee{MicroLamports: 1500, ComputeUnits: 200_001}
+	s := NewScheduler(buf, blockhashes, txSigner, client)
+
+	estimate, err := s.EstimateFee(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, FeeEstimate{}, estimate)
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, buf.PushUpdate(pyth.NewInstructionBuilder(testProgram).UpdPriceNoFailOnError(txSigner.Pubkey(), solana.NewWallet().PublicKey(), pyth.CommandUpdPrice{
+			Status:  pyth.PriceStatusTrading,
+			Price:   1,
+			Conf:    1,
+			PubSlot: 1000,
+		})))
+	}
+	estimate, err = s.EstimateFee(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, FeeEstimate{
+		Transactions: 1,
+		BaseFee:      5000,
+		PriorityFee:  301, // 200001 units at 1500 micro-lamports, rounded up
+	}, estimate)
+	assert.Equal(t, uint64(5301), estimate.Total())
+	assert.Len(t, buf.Queued(), 2, "buffer must not be drained")
+
+	// Flushed transactions carry the compute budget instructions.
+	close(node.release)
+	s.tick(context.Background(), &ws.SlotsUpdatesResult{Slot: 1000}, time.Now())
+	s.wg.Wait()
+	sent := node.sentTxs()
+	require.Len(t, sent, 1)
+	require.Len(t, sent[0].Message.Instructions, 4)
+	for _, insn := range sent[0].Message.Instructions[:2] {
+		assert.Equal(t, signer.ComputeBudgetProgramID, sent[0].Message.AccountKeys[insn.ProgramIDIndex])
+	}
+	assert.Equal(t, 2, countUpdates(sent[0]))
+}
+
+func TestScheduler_Drain(t *testing.T) {
+	node := newMockSendNode(t)
+	txSigner := signertest.New(t, testProgram)
+	client := rpc.New(node.URL)
+	blockhashes := NewBlockHashMonitor(client)
+	require.NoError(t, blockhashes.Init(context.Background()))
+	buf := NewBuffer()
+	s := NewScheduler(buf, blockhashes, txSigner, client)
+	core, logs := observer.New(zap.InfoLevel)
+	s.Log = zap.New(core)
+
+	push := func() {
+		require.NoError(t, buf.PushUpdate(pyth.NewInstructionBuilder(testProgram).UpdPriceNoFailOnError(txSigner.Pubkey(), solana.NewWallet().PublicKey(), pyth.CommandUpdPrice{
+			Status:  pyth.PriceStatusTrading,
+			Price:   1,
+			Conf:    1,
+			PubSlot: 1000,
+		})))
+	}
+
+	// Send hangs, drain gives up after the timeout.
+	push()
+	push()
+	start := time.Now()
+	assert.Equal(t, 2, s.Drain(1000, 100*time.Millisecond))
+	assert.Less(t, int64(time.Since(start)), int64(2*time.Second))
+	entries := logs.FilterMessage("Shutdown drain incomplete, dropping queued updates").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, int64(2), entries[0].ContextMap()["undrained"])
+	assert.Empty(t, buf.Queued())
+
+	// Everything is sent if the node responds in time.
+	close(node.release)
+	push()
+	assert.Equal(t, 0, s.Drain(1000, 5*time.Second))
+	assert.Equal(t, 1, logs.FilterMessage("Sent transaction while draining").Len())
+}
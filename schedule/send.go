@@ -0,0 +1,53 @@
+package schedule
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// SendOptions configure the sendTransaction calls submitting price updates.
+type SendOptions struct {
+	// SkipPreflight skips the simulation of transactions by the RPC node before forwarding them.
+	SkipPreflight bool
+	// PreflightCommitment is the commitment level of the preflight simulation.
+	// Empty uses the scheduler's SubmitCommitment.
+	PreflightCommitment rpc.CommitmentType
+	// MaxRetries is how often the RPC node retries forwarding a transaction to the leader.
+	// Nil leaves retries to the node's default.
+	MaxRetries *uint
+}
+
+// DefaultSendOptions returns the send options of a new scheduler.
+func DefaultSendOptions() SendOptions {
+	return SendOptions{SkipPreflight: true}
+}
+
+// send submits a signed transaction with the configured send options.
+func (s *Scheduler) send(ctx context.Context, tx *solana.Transaction) (solana.Signature, error) {
+	txData, err := tx.MarshalBinary()
+	if err != nil {
+		return solana.Signature{}, fmt.Errorf("failed to encode transaction: %w", err)
+	}
+	opts := rpc.M{"encoding": "base64"}
+	if s.SendOptions.SkipPreflight {
+		opts["skipPreflight"] = true
+	}
+	if commitment := s.SendOptions.PreflightCommitment; commitment != "" {
+		opts["preflightCommitment"] = commitment
+	} else if s.SubmitCommitment != "" {
+		opts["preflightCommitment"] = s.SubmitCommitment
+	}
+	if s.SendOptions.MaxRetries != nil {
+		opts["maxRetries"] = *s.SendOptions.MaxRetries
+	}
+	var sig solana.Signature
+	err = s.rpcFor(tx.Message.AccountKeys[0]).RPCCallForInto(ctx, &sig, "sendTransaction", []interface{}{
+		base64.StdEncoding.EncodeToString(txData),
+		opts,
+	})
+	return sig, err
+}
@@ -4,40 +4,193 @@ import (
 	"context"
 	"errors"
 	"net"
+	"net/http"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	eventbus "github.com/asaskevich/EventBus"
 	"github.com/cenkalti/backoff/v4"
 	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
 	"github.com/gagliardetto/solana-go/rpc/ws"
+	"go.blockdaemon.com/pythian/faults"
 	"go.uber.org/zap"
 )
 
+// SlotMonitor streams slot updates from one or more WebSocket connections
+// and fans them out to any number of consumers.
+//
+// With multiple sources, the highest slot seen by any of them is tracked,
+// so that a single stalled or lagging source does not hold back the slot.
 type SlotMonitor struct {
-	Log          *zap.Logger
-	WebSocketURL string
+	Log           *zap.Logger
+	WebSocketURLs []string // one connection per URL
+	// WebSocketHeaders[i] is sent with every handshake to WebSocketURLs[i], e.g. API keys.
+	// Missing entries send no headers.
+	WebSocketHeaders []http.Header
 
-	updates  chan *ws.SlotsUpdatesResult
-	lastSlot uint64
-	bus      eventbus.Bus
+	// DropLogSampler throttles warnings about slot updates dropped by slow consumers.
+	DropLogSampler *LogSampler
+	// ReadTimeout restarts the stream if no update arrives within this duration.
+	ReadTimeout time.Duration
+	// Faults optionally discards slot updates to simulate a stalled stream.
+	Faults *faults.Injector
+
+	// HeightRPC optionally polls the block height every HeightInterval,
+	// as slot updates do not carry it. Nil disables block height tracking.
+	HeightRPC      *rpc.Client
+	HeightInterval time.Duration
+
+	// Clock returns the current time, used to stamp slot updates.
+	Clock func() time.Time
+
+	updates        <-chan *ws.SlotsUpdatesResult
+	lastSlot       uint64
+	lastSlotTime   int64 // unix nanos
+	lastHeight     uint64
+	lastHeightTime int64 // unix nanos
+	connected      int32 // number of subscribed sources
+	lastDial       int64 // unix nanos of the latest connection attempt
+	lastSubscribe  int64 // unix nanos of the latest subscription
+	lastFailure    int64 // unix nanos the latest connection failed
+	bus            eventbus.Bus
+
+	slotLock sync.Mutex // serializes advancing lastSlot across sources
+	epoch    uint64     // incremented by SwitchCluster, guarded by slotLock
+
+	consumersLock sync.Mutex
+	consumers     map[chan *ws.SlotsUpdatesResult]struct{}
+	closed        bool
+
+	callbacksLock sync.Mutex
+	callbacks     []slotCallback // in order of subscription
+	nextCallback  uint64
 }
 
-func NewSlotMonitor(wsURL string) *SlotMonitor {
-	return &SlotMonitor{
-		Log:          zap.NewNop(),
-		WebSocketURL: wsURL,
+// slotCallback is a callback registered with Subscribe.
+type slotCallback struct {
+	id uint64
+	fn func(uint64)
+}
+
+// slotSource is the stream state of one WebSocket URL.
+type slotSource struct {
+	index      int
+	url        string
+	headers    http.Header
+	epoch      uint64 // cluster epoch of the URL
+	streamSlot uint64 // last slot seen on the current connection
+}
+
+func NewSlotMonitor(wsURLs ...string) *SlotMonitor {
+	s := &SlotMonitor{
+		Log:           zap.NewNop(),
+		WebSocketURLs: wsURLs,
+
+		DropLogSampler: NewLogSampler(10, 10*time.Second),
+		ReadTimeout:    20 * time.Second,
+		HeightInterval: 2 * time.Second,
+		Clock:          time.Now,
 
-		updates: make(chan *ws.SlotsUpdatesResult, 1),
-		bus:     eventbus.New(),
+		bus:       eventbus.New(),
+		consumers: make(map[chan *ws.SlotsUpdatesResult]struct{}),
 	}
+	_ = s.bus.Subscribe(updateBusKey, s.fanOut)
+	s.updates, _ = s.SubscribeUpdates()
+	return s
 }
 
+// RetryInterval is the delay between attempts to recover a failed stream.
+const RetryInterval = 3 * time.Second
+
+// FirstSlotLatency is the expected delay from dialing or subscribing to the first slot update.
+const FirstSlotLatency = time.Second
+
+// Run streams slot updates until the context is cancelled, reconnecting on errors.
+// Closes all update channels on return.
 func (s *SlotMonitor) Run(ctx context.Context) error {
-	defer close(s.updates)
-	const retryInterval = 3 * time.Second
+	defer s.closeConsumers()
+	return s.RunStream(ctx)
+}
+
+// RunStream is like Run, but leaves the update channels open
+// so that the stream can be restarted. Call Close when done.
+//
+// Each source reconnects independently. Returns once all sources stopped.
+func (s *SlotMonitor) RunStream(ctx context.Context) error {
+	wsURLs, epoch := s.sources()
+	if len(wsURLs) == 0 {
+		return errors.New("no slot WebSocket URLs")
+	}
+	if s.HeightRPC != nil {
+		ctx, cancel := context.WithCancel(ctx)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.pollHeight(ctx)
+		}()
+		defer wg.Wait()
+		defer cancel()
+	}
+	errs := make([]error, len(wsURLs))
+	var wg sync.WaitGroup
+	for i, wsURL := range wsURLs {
+		wg.Add(1)
+		go func(i int, src *slotSource) {
+			defer wg.Done()
+			errs[i] = s.runSource(ctx, src)
+		}(i, &slotSource{index: i, url: wsURL, headers: s.headers(i), epoch: epoch})
+	}
+	wg.Wait()
+	var firstErr error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		s.Log.Error("Slot stream stopped", zap.Int("source", i), zap.Error(err))
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// sources returns the WebSocket URLs to connect to and their cluster epoch.
+func (s *SlotMonitor) sources() ([]string, uint64) {
+	s.slotLock.Lock()
+	defer s.slotLock.Unlock()
+	return s.WebSocketURLs, s.epoch
+}
+
+// SwitchCluster replaces the WebSocket URLs after failing over to another cluster,
+// and restarts slot tracking at the given slot of that cluster, which may be behind.
+//
+// Updates of connections to the previous URLs are ignored from now on.
+// The new URLs are connected to when the stream is restarted.
+func (s *SlotMonitor) SwitchCluster(wsURLs []string, slot uint64) {
+	s.slotLock.Lock()
+	defer s.slotLock.Unlock()
+	s.WebSocketURLs = wsURLs
+	s.epoch++
+	atomic.StoreUint64(&s.lastSlot, slot)
+	atomic.StoreInt64(&s.lastSlotTime, s.Clock().UnixNano())
+	atomic.StoreInt64(&s.lastHeightTime, 0)
+}
+
+// headers returns the handshake headers of a source.
+func (s *SlotMonitor) headers(i int) http.Header {
+	if i < len(s.WebSocketHeaders) {
+		return s.WebSocketHeaders[i]
+	}
+	return nil
+}
+
+// runSource streams slot updates of a single source, reconnecting on errors.
+func (s *SlotMonitor) runSource(ctx context.Context, src *slotSource) error {
 	return backoff.Retry(func() error {
-		err := s.runConn(ctx)
+		err := s.runConn(ctx, src)
 		switch {
 		case errors.Is(err, context.Canceled):
 			return backoff.Permanent(err)
@@ -45,14 +198,16 @@ func (s *SlotMonitor) Run(ctx context.Context) error {
 			if ctxErr := ctx.Err(); ctxErr != nil {
 				return nil
 			}
-			s.Log.Error("Stream failed, restarting", zap.Error(err))
+			s.Log.Error("Stream failed, restarting", zap.Int("source", src.index), zap.Error(err))
+			atomic.StoreInt64(&s.lastFailure, s.Clock().UnixNano())
 			return err
 		}
-	}, backoff.WithContext(backoff.NewConstantBackOff(retryInterval), ctx))
+	}, backoff.WithContext(backoff.NewConstantBackOff(RetryInterval), ctx))
 }
 
-func (s *SlotMonitor) runConn(ctx context.Context) error {
-	client, err := ws.Connect(ctx, s.WebSocketURL)
+func (s *SlotMonitor) runConn(ctx context.Context, src *slotSource) error {
+	atomic.StoreInt64(&s.lastDial, s.Clock().UnixNano())
+	client, err := ws.ConnectWithOptions(ctx, src.url, &ws.Options{HttpHeader: src.headers})
 	if err != nil {
 		return err
 	}
@@ -68,10 +223,14 @@ func (s *SlotMonitor) runConn(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	atomic.StoreInt64(&s.lastSubscribe, s.Clock().UnixNano())
+	atomic.AddInt32(&s.connected, 1)
+	defer atomic.AddInt32(&s.connected, -1)
+	src.streamSlot = 0
 
 	// Stream updates.
 	for {
-		err := s.readNextUpdate(ctx, sub)
+		err := s.readNextUpdate(ctx, src, sub)
 		if errors.Is(err, context.Canceled) {
 			return nil
 		} else if err != nil {
@@ -80,9 +239,9 @@ func (s *SlotMonitor) runConn(ctx context.Context) error {
 	}
 }
 
-func (s *SlotMonitor) readNextUpdate(ctx context.Context, sub *ws.SlotsUpdatesSubscription) error {
-	// If no update comes in within 20 seconds, bail.
-	const readTimeout = 20 * time.Second
+func (s *SlotMonitor) readNextUpdate(ctx context.Context, src *slotSource, sub *ws.SlotsUpdatesSubscription) error {
+	// If no update comes in within the read timeout, bail.
+	readTimeout := s.ReadTimeout
 	ctx, cancel := context.WithTimeout(ctx, readTimeout)
 	defer cancel()
 	go func() {
@@ -90,7 +249,9 @@ func (s *SlotMonitor) readNextUpdate(ctx context.Context, sub *ws.SlotsUpdatesSu
 		// Terminate subscription if above timer has expired.
 		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 			s.Log.Warn("Read deadline exceeded, terminating WebSocket connection",
+				zap.Int("source", src.index),
 				zap.Duration("timeout", readTimeout))
+			metricWSReadTimeouts.Inc()
 			sub.Unsubscribe()
 		}
 	}()
@@ -102,7 +263,7 @@ func (s *SlotMonitor) readNextUpdate(ctx context.Context, sub *ws.SlotsUpdatesSu
 	} else if update == nil {
 		return net.ErrClosed
 	} else if update.Timestamp == nil {
-		ts := solana.UnixTimeSeconds(time.Now().Unix())
+		ts := solana.UnixTimeMilliseconds(s.Clock().UnixMilli())
 		update.Timestamp = &ts
 	}
 
@@ -110,32 +271,186 @@ func (s *SlotMonitor) readNextUpdate(ctx context.Context, sub *ws.SlotsUpdatesSu
 	if update.Type != ws.SlotsUpdatesFirstShredReceived {
 		return nil
 	}
-	atomic.StoreUint64(&s.lastSlot, update.Slot)
+	if s.Faults.ShouldStallSlot(update.Slot) {
+		return nil
+	}
+	// Keep the tracked slot monotonic, updates may arrive out of order.
+	streamSlot := src.streamSlot
+	if update.Slot < streamSlot {
+		metricOutOfOrderSlots.Inc()
+		s.Log.Debug("Ignoring out-of-order slot update",
+			zap.Int("source", src.index),
+			zap.Uint64("slot", update.Slot),
+			zap.Uint64("last_slot", streamSlot))
+		return nil
+	}
+	src.streamSlot = update.Slot
+	if !s.advanceSlot(src.epoch, update.Slot, streamSlot == 0) {
+		return nil // seen first by another source
+	}
 
-	s.bus.Publish(busKey, update.Slot)
+	s.notify(update.Slot)
+	s.bus.Publish(updateBusKey, update)
 	metricSlotUpdates.Inc()
+	s.Log.Debug("Slot update", zap.Uint64("slot", update.Slot))
+
+	return nil
+}
 
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case s.updates <- update:
-		s.Log.Debug("Slot update", zap.Uint64("slot", update.Slot))
-	default:
-		s.Log.Warn("Dropping slot update", zap.Uint64("slot", update.Slot))
+// pollHeight fetches the block height until the context is cancelled.
+func (s *SlotMonitor) pollHeight(ctx context.Context) {
+	ticker := time.NewTicker(s.HeightInterval)
+	defer ticker.Stop()
+	for {
+		tickCtx, cancel := context.WithTimeout(ctx, s.HeightInterval)
+		height, err := s.HeightRPC.GetBlockHeight(tickCtx, rpc.CommitmentConfirmed)
+		cancel()
+		if err == nil {
+			atomic.StoreUint64(&s.lastHeight, height)
+			atomic.StoreInt64(&s.lastHeightTime, s.Clock().UnixNano())
+			metricBlockHeight.Set(float64(height))
+		} else if ctx.Err() == nil {
+			s.Log.Warn("Failed to get block height", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
+}
 
-	return nil
+// advanceSlot moves the tracked slot forward, counting the slots skipped since the previous one.
+// Returns false if the slot is not newer than the tracked slot,
+// or if it comes from a cluster that was switched away from.
+//
+// The first update of a connection is not compared,
+// as the gap to the previous connection does not indicate skipped slots.
+func (s *SlotMonitor) advanceSlot(epoch, slot uint64, firstOfConn bool) bool {
+	s.slotLock.Lock()
+	defer s.slotLock.Unlock()
+	if epoch != s.epoch {
+		return false
+	}
+	prev := atomic.LoadUint64(&s.lastSlot)
+	if slot <= prev {
+		return false
+	}
+	atomic.StoreUint64(&s.lastSlot, slot)
+	atomic.StoreInt64(&s.lastSlotTime, s.Clock().UnixNano())
+	if !firstOfConn && prev != 0 && slot > prev+1 {
+		metricSkippedSlots.Add(float64(slot - prev - 1))
+	}
+	return true
+}
+
+// fanOut delivers a slot update to all update channels without blocking.
+func (s *SlotMonitor) fanOut(update *ws.SlotsUpdatesResult) {
+	s.consumersLock.Lock()
+	defer s.consumersLock.Unlock()
+	for consumer := range s.consumers {
+		select {
+		case consumer <- update:
+		default:
+			if ok, suppressed := s.DropLogSampler.Allow(); ok {
+				s.Log.Warn("Dropping slot update",
+					zap.Uint64("slot", update.Slot),
+					zap.Int("suppressed", suppressed))
+			}
+		}
+	}
+}
+
+// Close closes all update channels. The monitor must not run afterwards.
+func (s *SlotMonitor) Close() {
+	s.closeConsumers()
+}
+
+func (s *SlotMonitor) closeConsumers() {
+	s.consumersLock.Lock()
+	defer s.consumersLock.Unlock()
+	for consumer := range s.consumers {
+		close(consumer)
+		delete(s.consumers, consumer)
+	}
+	s.closed = true
 }
 
-// Subscribe registers a callback function. The returned cancel func
+// SubscribeUpdates creates an additional slot update channel fed by the same
+// WebSocket connections. Like Updates, the channel holds at most one pending
+// update, drops updates while full, and is closed when the monitor stops.
+//
+// The returned cancel func removes and closes the channel.
+func (s *SlotMonitor) SubscribeUpdates() (<-chan *ws.SlotsUpdatesResult, context.CancelFunc) {
+	consumer := make(chan *ws.SlotsUpdatesResult, 1)
+	s.consumersLock.Lock()
+	defer s.consumersLock.Unlock()
+	if s.closed {
+		close(consumer)
+		return consumer, func() {}
+	}
+	s.consumers[consumer] = struct{}{}
+	return consumer, func() {
+		s.consumersLock.Lock()
+		defer s.consumersLock.Unlock()
+		if _, ok := s.consumers[consumer]; ok {
+			close(consumer)
+			delete(s.consumers, consumer)
+		}
+	}
+}
+
+// Subscribe registers a callback invoked with each new slot on the read loop
+// of the source that saw it first. With multiple sources, callbacks may run concurrently.
+// The returned cancel func removes the callback again.
+//
+// A panicking callback is recovered and logged,
+// without affecting slot processing or other callbacks.
 func (s *SlotMonitor) Subscribe(callback func(uint64)) context.CancelFunc {
-	_ = s.bus.Subscribe(busKey, callback)
+	s.callbacksLock.Lock()
+	defer s.callbacksLock.Unlock()
+	s.nextCallback++
+	id := s.nextCallback
+	s.callbacks = append(s.callbacks, slotCallback{id: id, fn: callback})
 	return func() {
-		_ = s.bus.Unsubscribe(busKey, callback)
+		s.callbacksLock.Lock()
+		defer s.callbacksLock.Unlock()
+		for i, cb := range s.callbacks {
+			if cb.id == id {
+				s.callbacks = append(s.callbacks[:i:i], s.callbacks[i+1:]...)
+				return
+			}
+		}
 	}
 }
 
-// Updates the single current update channel.
+// notify invokes the callbacks registered with Subscribe.
+func (s *SlotMonitor) notify(slot uint64) {
+	s.callbacksLock.Lock()
+	callbacks := s.callbacks
+	s.callbacksLock.Unlock()
+	for _, cb := range callbacks {
+		s.invoke(cb.fn, slot)
+	}
+}
+
+// invoke calls a slot callback, recovering from panics.
+func (s *SlotMonitor) invoke(callback func(uint64), slot uint64) {
+	defer func() {
+		if r := recover(); r != nil {
+			metricSlotCallbackPanics.Inc()
+			s.Log.Error("Slot subscriber panicked",
+				zap.Uint64("slot", slot),
+				zap.Any("panic", r),
+				zap.Stack("stack"))
+		}
+	}()
+	callback(slot)
+}
+
+// Updates returns the primary update channel.
+// Use SubscribeUpdates to create channels for additional consumers.
 func (s *SlotMonitor) Updates() <-chan *ws.SlotsUpdatesResult {
 	return s.updates
 }
@@ -145,4 +460,57 @@ func (s *SlotMonitor) Slot() uint64 {
 	return atomic.LoadUint64(&s.lastSlot)
 }
 
-const busKey = "" // dummy key for event bus
+// SlotTime returns the time the current slot was first seen. Zero if unknown.
+func (s *SlotMonitor) SlotTime() time.Time {
+	nanos := atomic.LoadInt64(&s.lastSlotTime)
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// heightMaxAge is the number of poll intervals after which a block height is outdated.
+const heightMaxAge = 3
+
+// BlockHeight returns the latest confirmed block height.
+// 0 if unknown or not updated within a few poll intervals.
+func (s *SlotMonitor) BlockHeight() uint64 {
+	nanos := atomic.LoadInt64(&s.lastHeightTime)
+	if nanos == 0 || s.Clock().Sub(time.Unix(0, nanos)) > heightMaxAge*s.HeightInterval {
+		return 0
+	}
+	return atomic.LoadUint64(&s.lastHeight)
+}
+
+// Connected returns whether any slot stream is currently subscribed.
+func (s *SlotMonitor) Connected() bool {
+	return atomic.LoadInt32(&s.connected) != 0
+}
+
+// WarmUpRemaining estimates how long until the first slot update arrives. 0 once the slot is known.
+//
+// A subscribed or dialing stream is expected to deliver within FirstSlotLatency,
+// a failed stream after the next attempt in RetryInterval. Before the first
+// connection attempt, or once the estimate is overdue, RetryInterval is assumed.
+func (s *SlotMonitor) WarmUpRemaining() time.Duration {
+	if s.Slot() != 0 {
+		return 0
+	}
+	dial := atomic.LoadInt64(&s.lastDial)
+	failure := atomic.LoadInt64(&s.lastFailure)
+	var ready time.Time
+	switch {
+	case s.Connected():
+		ready = time.Unix(0, atomic.LoadInt64(&s.lastSubscribe)).Add(FirstSlotLatency)
+	case failure != 0 && failure >= dial:
+		ready = time.Unix(0, failure).Add(RetryInterval + FirstSlotLatency)
+	case dial != 0:
+		ready = time.Unix(0, dial).Add(FirstSlotLatency)
+	}
+	if remaining := ready.Sub(s.Clock()); !ready.IsZero() && remaining > 0 {
+		return remaining
+	}
+	return RetryInterval
+}
+
+const updateBusKey = "update" // full slot update events
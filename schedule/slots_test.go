@@ -0,0 +1,374 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// mockSlotNode is a fake Solana WebSocket endpoint serving slotsUpdatesSubscribe.
+type mockSlotNode struct {
+	*httptest.Server
+	conns int32
+	slots chan uint64
+}
+
+func newMockSlotNode(t *testing.T) *mockSlotNode {
+	node := &mockSlotNode{slots: make(chan uint64)}
+	node.Server = httptest.NewServer(http.HandlerFunc(node.serve))
+	t.Cleanup(node.Close)
+	return node
+}
+
+func (m *mockSlotNode) URL() string {
+	return "ws" + strings.TrimPrefix(m.Server.URL, "http")
+}
+
+func (m *mockSlotNode) serve(rw http.ResponseWriter, req *http.Request) {
+	var upgrader websocket.Upgrader
+	conn, err := upgrader.Upgrade(rw, req, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	atomic.AddInt32(&m.conns, 1)
+
+	var sub struct {
+		ID     uint64 `json:"id"`
+		Method string `json:"method"`
+	}
+	if err := conn.ReadJSON(&sub); err != nil || sub.Method != "slotsUpdatesSubscribe" {
+		return
+	}
+	if err := conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      sub.ID,
+		"result":  1,
+	}); err != nil {
+		return
+	}
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case slot := <-m.slots:
+			err := conn.WriteJSON(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"method":  "slotsUpdatesNotification",
+				"params": map[string]interface{}{
+					"subscription": 1,
+					"result": map[string]interface{}{
+						"parent":    slot - 1,
+						"slot":      slot,
+						"timestamp": time.Now().UnixMilli(),
+						"type":      ws.SlotsUpdatesFirstShredReceived,
+					},
+				},
+			})
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func runSlotMonitor(t *testing.T, s *SlotMonitor) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = s.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func recvSlot(t *testing.T, updates <-chan *ws.SlotsUpdatesResult) uint64 {
+	select {
+	case update, ok := <-updates:
+		require.True(t, ok, "update channel closed")
+		return update.Slot
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for slot update")
+		return 0
+	}
+}
+
+func TestSlotMonitor_SharedConnection(t *testing.T) {
+	node := newMockSlotNode(t)
+	s := NewSlotMonitor(node.URL())
+	second, cancel := s.SubscribeUpdates()
+	defer cancel()
+	runSlotMonitor(t, s)
+
+	for slot := uint64(100); slot < 103; slot++ {
+		node.slots <- slot
+		assert.Equal(t, slot, recvSlot(t, s.Updates()))
+		assert.Equal(t, slot, recvSlot(t, second))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&node.conns))
+}
+
+func TestSlotMonitor_CloseConsumers(t *testing.T) {
+	s := NewSlotMonitor("ws://127.0.0.1:0")
+	second, _ := s.SubscribeUpdates()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = s.Run(ctx)
+
+	_, ok := <-s.Updates()
+	assert.False(t, ok)
+	_, ok = <-second
+	assert.False(t, ok)
+}
+
+func TestSlotMonitor_DropLogSampling(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	s := NewSlotMonitor("ws://127.0.0.1:0")
+	s.Log = zap.New(core)
+	now := time.Unix(1000, 0)
+	s.DropLogSampler = NewLogSampler(3, time.Second)
+	s.DropLogSampler.now = func() time.Time { return now }
+
+	// Nobody reads the primary channel, so all but the first update get dropped.
+	for slot := uint64(0); slot < 101; slot++ {
+		s.fanOut(&ws.SlotsUpdatesResult{Slot: slot})
+	}
+	assert.Equal(t, 3, logs.FilterMessage("Dropping slot update").Len())
+
+	// Next interval reports the suppressed count.
+	now = now.Add(time.Second)
+	s.fanOut(&ws.SlotsUpdatesResult{Slot: 101})
+	entries := logs.FilterMessage("Dropping slot update").All()
+	require.Len(t, entries, 4)
+	assert.Equal(t, int64(97), entries[3].ContextMap()["suppressed"])
+}
+
+func TestSlotMonitor_ReadTimeout(t *testing.T) {
+	node := newMockSlotNode(t)
+	before := testutil.ToFloat64(metricWSReadTimeouts)
+
+	s := NewSlotMonitor(node.URL())
+	s.ReadTimeout = 50 * time.Millisecond
+	runSlotMonitor(t, s)
+
+	// Node stays quiet, monitor gives up on the stream.
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(metricWSReadTimeouts) > before
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSlotMonitor_WarmUpRemaining(t *testing.T) {
+	var now int64 = time.Unix(1000, 0).UnixNano()
+	clock := func() time.Time { return time.Unix(0, atomic.LoadInt64(&now)) }
+	advance := func(d time.Duration) { atomic.AddInt64(&now, int64(d)) }
+
+	t.Run("Failed", func(t *testing.T) {
+		dead := httptest.NewServer(http.NotFoundHandler())
+		dead.Close()
+		s := NewSlotMonitor("ws" + strings.TrimPrefix(dead.URL, "http"))
+		s.Clock = clock
+		assert.Equal(t, RetryInterval, s.WarmUpRemaining(), "estimate before first attempt")
+
+		runSlotMonitor(t, s)
+		require.Eventually(t, func() bool {
+			return atomic.LoadInt64(&s.lastFailure) != 0
+		}, 5*time.Second, 10*time.Millisecond)
+		// Ready after the next attempt and the first slot.
+		assert.Equal(t, RetryInterval+FirstSlotLatency, s.WarmUpRemaining())
+		advance(time.Second)
+		assert.Equal(t, RetryInterval+FirstSlotLatency-time.Second, s.WarmUpRemaining())
+	})
+
+	t.Run("Subscribed", func(t *testing.T) {
+		node := newMockSlotNode(t)
+		s := NewSlotMonitor(node.URL())
+		s.Clock = clock
+		runSlotMonitor(t, s)
+		require.Eventually(t, s.Connected, 5*time.Second, 10*time.Millisecond)
+
+		assert.Equal(t, FirstSlotLatency, s.WarmUpRemaining())
+		advance(400 * time.Millisecond)
+		assert.Equal(t, FirstSlotLatency-400*time.Millisecond, s.WarmUpRemaining())
+		// Overdue, the stream may be stuck.
+		advance(FirstSlotLatency)
+		assert.Equal(t, RetryInterval, s.WarmUpRemaining())
+
+		node.slots <- 100
+		require.Eventually(t, func() bool { return s.Slot() == 100 }, 5*time.Second, 10*time.Millisecond)
+		assert.Zero(t, s.WarmUpRemaining())
+	})
+}
+
+func TestSlotMonitor_SkippedSlots(t *testing.T) {
+	node := newMockSlotNode(t)
+	before := testutil.ToFloat64(metricSkippedSlots)
+
+	s := NewSlotMonitor(node.URL())
+	runSlotMonitor(t, s)
+
+	// First slot is not a gap from zero, 102-103 and 106-109 are skipped.
+	for _, slot := range []uint64{100, 101, 104, 105, 110} {
+		node.slots <- slot
+		assert.Equal(t, slot, recvSlot(t, s.Updates()))
+	}
+	assert.Equal(t, float64(6), testutil.ToFloat64(metricSkippedSlots)-before)
+}
+
+func TestSlotMonitor_OutOfOrderSlots(t *testing.T) {
+	node := newMockSlotNode(t)
+	before := testutil.ToFloat64(metricOutOfOrderSlots)
+
+	s := NewSlotMonitor(node.URL())
+	runSlotMonitor(t, s)
+
+	var last uint64
+	for _, slot := range []uint64{100, 102, 101, 102, 99, 103} {
+		node.slots <- slot
+		if slot <= last {
+			continue // not forwarded
+		}
+		assert.Equal(t, slot, recvSlot(t, s.Updates()))
+		assert.GreaterOrEqual(t, s.Slot(), last)
+		last = s.Slot()
+	}
+	assert.Equal(t, uint64(103), s.Slot())
+	assert.Equal(t, float64(2), testutil.ToFloat64(metricOutOfOrderSlots)-before)
+}
+
+func TestSlotMonitor_MultipleSources(t *testing.T) {
+	ahead, behind := newMockSlotNode(t), newMockSlotNode(t)
+
+	s := NewSlotMonitor(behind.URL(), ahead.URL())
+	runSlotMonitor(t, s)
+
+	behind.slots <- 100
+	assert.Equal(t, uint64(100), recvSlot(t, s.Updates()))
+	ahead.slots <- 105
+	assert.Equal(t, uint64(105), recvSlot(t, s.Updates()))
+
+	// The lagging source does not move the slot back or repeat slots.
+	behind.slots <- 101
+	behind.slots <- 105
+	ahead.slots <- 106
+	assert.Equal(t, uint64(106), recvSlot(t, s.Updates()))
+	assert.Equal(t, uint64(106), s.Slot())
+	assert.True(t, s.Connected())
+
+	// A gap seen by both sources is counted once.
+	before := testutil.ToFloat64(metricSkippedSlots)
+	ahead.slots <- 110
+	assert.Equal(t, uint64(110), recvSlot(t, s.Updates()))
+	behind.slots <- 110
+	behind.slots <- 111
+	assert.Equal(t, uint64(111), recvSlot(t, s.Updates()))
+	assert.Equal(t, float64(3), testutil.ToFloat64(metricSkippedSlots)-before)
+}
+
+func TestSlotMonitor_SwitchCluster(t *testing.T) {
+	old, backup := newMockSlotNode(t), newMockSlotNode(t)
+	s := NewSlotMonitor(old.URL())
+	defer s.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = s.RunStream(ctx)
+	}()
+	old.slots <- 1000
+	assert.Equal(t, uint64(1000), recvSlot(t, s.Updates()))
+
+	// The backup cluster is behind.
+	s.SwitchCluster([]string{backup.URL()}, 900)
+	assert.Equal(t, uint64(900), s.Slot())
+	old.slots <- 1001
+	assert.Never(t, func() bool { return s.Slot() != 900 }, 100*time.Millisecond, 10*time.Millisecond,
+		"slot of previous cluster tracked")
+
+	cancel()
+	<-done
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = s.RunStream(ctx) }()
+	backup.slots <- 901
+	assert.Equal(t, uint64(901), recvSlot(t, s.Updates()), "slot of previous cluster delivered")
+	assert.Equal(t, uint64(901), s.Slot())
+}
+
+func TestSlotMonitor_BlockHeight(t *testing.T) {
+	var height uint64 = 5000
+	rpcNode := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&msg))
+		assert.Equal(t, "getBlockHeight", msg.Method)
+		rw.Header().Set("content-type", "application/json")
+		_ = json.NewEncoder(rw).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      msg.ID,
+			"result":  atomic.AddUint64(&height, 1),
+		})
+	}))
+	defer rpcNode.Close()
+
+	node := newMockSlotNode(t)
+	s := NewSlotMonitor(node.URL())
+	s.HeightRPC = rpc.New(rpcNode.URL)
+	s.HeightInterval = 10 * time.Millisecond
+	assert.Equal(t, uint64(0), s.BlockHeight())
+	runSlotMonitor(t, s)
+
+	require.Eventually(t, func() bool {
+		return s.BlockHeight() > 5001
+	}, 5*time.Second, time.Millisecond)
+	assert.Greater(t, testutil.ToFloat64(metricBlockHeight), float64(5000))
+
+	// Outdated heights are unknown.
+	rpcNode.Close()
+	require.Eventually(t, func() bool {
+		return s.BlockHeight() == 0
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestSlotMonitor_SubscriberPanic(t *testing.T) {
+	node := newMockSlotNode(t)
+	core, logs := observer.New(zap.ErrorLevel)
+	s := NewSlotMonitor(node.URL())
+	s.Log = zap.New(core)
+	s.Subscribe(func(uint64) {
+		panic("broken subscriber")
+	})
+	slots := make(chan uint64, 2)
+	s.Subscribe(func(slot uint64) {
+		slots <- slot
+	})
+	runSlotMonitor(t, s)
+
+	// Later subscribers and the update channels still see every slot.
+	for slot := uint64(100); slot < 102; slot++ {
+		node.slots <- slot
+		assert.Equal(t, slot, recvSlot(t, s.Updates()))
+		assert.Equal(t, slot, <-slots)
+	}
+	entries := logs.FilterMessage("Slot subscriber panicked").All()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "broken subscriber", entries[0].ContextMap()["panic"])
+}
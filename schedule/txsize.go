@@ -0,0 +1,126 @@
+package schedule
+
+import (
+	"github.com/gagliardetto/solana-go"
+)
+
+// MaxTransactionSize is the maximum size of a serialized transaction.
+// Transactions must fit into a single IPv6 packet minus headers.
+const MaxTransactionSize = 1232
+
+// txSizer tracks the serialized size of a legacy transaction while instructions are added.
+type txSizer struct {
+	keys     map[solana.PublicKey]bool // account => is signer
+	insns    int
+	insnSize int
+}
+
+func newTxSizer(feePayer solana.PublicKey) *txSizer {
+	return &txSizer{keys: map[solana.PublicKey]bool{feePayer: true}}
+}
+
+// size returns the serialized transaction size including signatures.
+func (t *txSizer) size() int {
+	return t.sizeWith(nil, 0)
+}
+
+// sizeWith returns the size the transaction would have after adding the instruction.
+func (t *txSizer) sizeWith(insn solana.Instruction, dataLen int) int {
+	keys := make(map[solana.PublicKey]bool, len(t.keys)+4)
+	for key, isSigner := range t.keys {
+		keys[key] = isSigner
+	}
+	insns, insnSize := t.insns, t.insnSize
+	if insn != nil {
+		mergeKeys(keys, insn)
+		insns++
+		insnSize += instructionSize(len(insn.Accounts()), dataLen)
+	}
+	var signers int
+	for _, isSigner := range keys {
+		if isSigner {
+			signers++
+		}
+	}
+	return compactU16Len(signers) + 64*signers + // signatures
+		3 + // message header
+		compactU16Len(len(keys)) + 32*len(keys) + // account keys
+		32 + // recent block hash
+		compactU16Len(insns) + insnSize
+}
+
+func (t *txSizer) add(insn solana.Instruction, dataLen int) {
+	mergeKeys(t.keys, insn)
+	t.insns++
+	t.insnSize += instructionSize(len(insn.Accounts()), dataLen)
+}
+
+func mergeKeys(keys map[solana.PublicKey]bool, insn solana.Instruction) {
+	for _, acc := range insn.Accounts() {
+		keys[acc.PublicKey] = keys[acc.PublicKey] || acc.IsSigner
+	}
+	if _, ok := keys[insn.ProgramID()]; !ok {
+		keys[insn.ProgramID()] = false
+	}
+}
+
+// instructionSize returns the size of a compiled instruction.
+func instructionSize(accounts int, dataLen int) int {
+	return 1 + // program ID index
+		compactU16Len(accounts) + accounts +
+		compactU16Len(dataLen) + dataLen
+}
+
+// compactU16Len returns the encoded size of a Solana compact-u16.
+func compactU16Len(n int) int {
+	switch {
+	case n < 0x80:
+		return 1
+	case n < 0x4000:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// mergedInstruction is an instruction with account metas replaced by merged ones.
+type mergedInstruction struct {
+	solana.Instruction
+	accounts []*solana.AccountMeta
+}
+
+func (m *mergedInstruction) Accounts() []*solana.AccountMeta {
+	return m.accounts
+}
+
+// mergeAccountMetas returns the instructions with a single account meta per key,
+// shared across all instructions, such that each key is writable or signer
+// if any instruction requires it. The fee payer is always a writable signer.
+//
+// Transaction builders deduplicate keys by updating the first meta of each key in place.
+// The merged metas are copies, so the queued instructions are never modified.
+func mergeAccountMetas(feePayer solana.PublicKey, insns []solana.Instruction) []solana.Instruction {
+	metas := map[solana.PublicKey]*solana.AccountMeta{
+		feePayer: {PublicKey: feePayer, IsSigner: true, IsWritable: true},
+	}
+	for _, insn := range insns {
+		for _, acc := range insn.Accounts() {
+			meta, ok := metas[acc.PublicKey]
+			if !ok {
+				meta = &solana.AccountMeta{PublicKey: acc.PublicKey}
+				metas[acc.PublicKey] = meta
+			}
+			meta.IsSigner = meta.IsSigner || acc.IsSigner
+			meta.IsWritable = meta.IsWritable || acc.IsWritable
+		}
+	}
+	merged := make([]solana.Instruction, len(insns))
+	for i, insn := range insns {
+		accounts := make([]*solana.AccountMeta, len(insn.Accounts()))
+		for j, acc := range insn.Accounts() {
+			accounts[j] = metas[acc.PublicKey]
+		}
+		merged[i] = &mergedInstruction{Instruction: insn, accounts: accounts}
+	}
+	return merged
+}
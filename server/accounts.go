@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"go.blockdaemon.com/pyth"
+)
+
+// maxPriceChainDepth caps the number of price accounts followed per product.
+const maxPriceChainDepth = 16
+
+// accountReader fetches and decodes on-chain Pyth accounts.
+type accountReader interface {
+	GetAllProductAccounts(ctx context.Context) ([]pyth.ProductAccountEntry, error)
+	GetProductAccount(ctx context.Context, product solana.PublicKey) (pyth.ProductAccountEntry, error)
+	// GetPriceAccounts returns the price accounts with the given keys in order.
+	// Accounts that do not exist are returned as nil.
+	GetPriceAccounts(ctx context.Context, prices []solana.PublicKey) ([]*pyth.PriceAccountEntry, error)
+}
+
+// pythAccountReader reads accounts using the Pyth client.
+type pythAccountReader struct {
+	client      *pyth.Client
+	products    *productFetch
+	unparseable unparseableAccounts
+}
+
+func newPythAccountReader(client *pyth.Client) *pythAccountReader {
+	p := &pythAccountReader{client: client}
+	p.products = newProductFetch(map[ProductFetchStrategy]productFetcher{
+		ProductFetchClient: func(ctx context.Context) ([]pyth.ProductAccountEntry, error) {
+			return client.GetAllProductAccounts(ctx, rpc.CommitmentConfirmed)
+		},
+		ProductFetchFiltered: p.getFilteredProductAccounts,
+		ProductFetchMapping:  p.getMappedProductAccounts,
+	})
+	return p
+}
+
+func (p *pythAccountReader) GetAllProductAccounts(ctx context.Context) ([]pyth.ProductAccountEntry, error) {
+	return p.products.fetch(ctx)
+}
+
+// GetProductAccount fetches and decodes a product account.
+// Returns rpc.ErrNotFound if the account does not exist,
+// and an error matching isWrongAccount if it is not a product account.
+func (p *pythAccountReader) GetProductAccount(ctx context.Context, product solana.PublicKey) (pyth.ProductAccountEntry, error) {
+	var entry pyth.ProductAccountEntry
+	err := p.getMultipleAccounts(ctx, []solana.PublicKey{product}, func(key solana.PublicKey, data []byte, slot uint64) error {
+		if data == nil {
+			return rpc.ErrNotFound
+		}
+		decoded, err := decodeProductAccount(data)
+		if err != nil {
+			return err
+		}
+		entry = pyth.ProductAccountEntry{
+			ProductAccount: decoded,
+			Pubkey:         key,
+			Slot:           slot,
+		}
+		return nil
+	})
+	return entry, err
+}
+
+func (p *pythAccountReader) GetPriceAccounts(ctx context.Context, prices []solana.PublicKey) ([]*pyth.PriceAccountEntry, error) {
+	entries := make([]*pyth.PriceAccountEntry, 0, len(prices))
+	err := p.getMultipleAccounts(ctx, prices, func(key solana.PublicKey, data []byte, slot uint64) error {
+		if data == nil {
+			entries = append(entries, nil)
+			return nil
+		}
+		price, err := decodePriceAccount(data)
+		if err != nil {
+			// Treat the account like a missing one, instead of failing the whole product list.
+			p.unparseable.add(key, "price", err)
+			entries = append(entries, nil)
+			return nil
+		}
+		p.unparseable.remove(key)
+		entries = append(entries, &pyth.PriceAccountEntry{
+			PriceAccount: price,
+			Pubkey:       key,
+			Slot:         slot,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// decodeProduct decodes a product account.
+// Returns nil if the account is skipped because it failed to decode.
+func (p *pythAccountReader) decodeProduct(key solana.PublicKey, data []byte) *pyth.ProductAccount {
+	product, err := decodeProductAccount(data)
+	if err != nil {
+		p.unparseable.add(key, "product", err)
+		return nil
+	}
+	p.unparseable.remove(key)
+	return product
+}
+
+// getMultipleAccounts fetches accounts in chunks and calls fn for each key in order.
+// Data is nil if the account does not exist.
+func (p *pythAccountReader) getMultipleAccounts(
+	ctx context.Context,
+	keys []solana.PublicKey,
+	fn func(key solana.PublicKey, data []byte, slot uint64) error,
+) error {
+	const batchSize = 100 // getMultipleAccounts limit
+	for len(keys) > 0 {
+		batch := keys
+		if len(batch) > batchSize {
+			batch = batch[:batchSize]
+		}
+		keys = keys[len(batch):]
+
+		res, err := p.client.RPC.GetMultipleAccountsWithOpts(ctx, batch, &rpc.GetMultipleAccountsOpts{
+			Encoding:   solana.EncodingBase64,
+			Commitment: rpc.CommitmentConfirmed,
+		})
+		if err != nil {
+			return err
+		}
+		if len(res.Value) != len(batch) {
+			return fmt.Errorf("requested %d accounts, got %d", len(batch), len(res.Value))
+		}
+		for i, acc := range res.Value {
+			var data []byte
+			if acc != nil && acc.Data != nil {
+				data = acc.Data.GetBinary()
+			}
+			if err := fn(batch[i], data, res.Context.Slot); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// priceChain tracks the traversal of a product's linked list of price accounts.
+type priceChain struct {
+	next    solana.PublicKey
+	seen    map[solana.PublicKey]bool
+	prices  []pyth.PriceAccountEntry
+	warning string
+}
+
+// walkPriceChains fetches the price accounts of the given products.
+//
+// Price accounts form a linked list starting at the product's first price.
+// Broken lists (cycles, dangling pointers, excessive length) do not fail the walk,
+// instead the prices fetched so far are returned along with a warning.
+func walkPriceChains(ctx context.Context, reader accountReader, products []pyth.ProductAccountEntry) (map[solana.PublicKey]*priceChain, error) {
+	chains := make(map[solana.PublicKey]*priceChain, len(products))
+	var frontier []*priceChain
+	for _, product := range products {
+		chain := &priceChain{
+			next: product.FirstPrice,
+			seen: map[solana.PublicKey]bool{product.FirstPrice: true},
+		}
+		chains[product.Pubkey] = chain
+		if !product.FirstPrice.IsZero() {
+			frontier = append(frontier, chain)
+		}
+	}
+
+	for depth := 0; len(frontier) > 0; depth++ {
+		if depth >= maxPriceChainDepth {
+			for _, chain := range frontier {
+				chain.warning = fmt.Sprintf("price account list exceeds %d entries", maxPriceChainDepth)
+			}
+			break
+		}
+
+		keys := make([]solana.PublicKey, len(frontier))
+		for i, chain := range frontier {
+			keys[i] = chain.next
+		}
+		prices, err := reader.GetPriceAccounts(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+
+		var nextFrontier []*priceChain
+		for i, chain := range frontier {
+			price := prices[i]
+			if price == nil {
+				chain.warning = "dangling price account pointer to " + chain.next.String()
+				continue
+			}
+			chain.prices = append(chain.prices, *price)
+			if price.Next.IsZero() {
+				continue
+			}
+			if chain.seen[price.Next] {
+				chain.warning = "cyclic price account list at " + price.Next.String()
+				continue
+			}
+			chain.seen[price.Next] = true
+			chain.next = price.Next
+			nextFrontier = append(nextFrontier, chain)
+		}
+		frontier = nextFrontier
+	}
+	return chains, nil
+}
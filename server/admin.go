@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.blockdaemon.com/pythian/jsonrpc"
+	"go.blockdaemon.com/pythian/lifecycle"
+	"go.blockdaemon.com/pythian/publisher"
+	"go.blockdaemon.com/pythian/schedule"
+)
+
+// EnableAdmin registers methods for inspecting and operating the publisher.
+//
+// These expose internal state and must not be reachable by untrusted clients.
+func (h *Handler) EnableAdmin() {
+	h.HandleFunc("get_drop_log", h.handleGetDropLog)
+	h.HandleFunc("failover", h.handleFailover)
+	h.HandleFunc("restart_component", h.handleRestartComponent)
+	h.HandleFunc("dump_state", h.handleDumpState)
+	h.HandleFunc("get_metrics", h.handleGetMetrics)
+	h.HandleFunc("estimate_fee", h.handleEstimateFee)
+}
+
+// EnableReload registers the "reload" admin method.
+//
+// It is the reload path on platforms without SIGHUP, such as Windows.
+func (h *Handler) EnableReload(controller *lifecycle.Controller) {
+	h.HandleFunc("reload", func(_ context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+		controller.Reload("admin")
+		return jsonrpc.NewResultResponse(req.ID, 0)
+	})
+}
+
+func (h *Handler) handleGetDropLog(_ context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+	return jsonrpc.NewResultResponse(req.ID, dropsToJSON(h.publisher.DropLog()))
+}
+
+// handleFailover switches the publisher to another cluster and replays unconfirmed updates to it.
+func (h *Handler) handleFailover(ctx context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+	var params struct {
+		RPCURL       string `json:"rpc_url"`
+		WebSocketURL string `json:"ws_url"`
+		SendRPCURL   string `json:"send_rpc_url"`
+	}
+	if err := decodeParams(req.Params, &params); err != nil || params.RPCURL == "" || params.WebSocketURL == "" {
+		return jsonrpc.NewInvalidParamsResponse(req.ID)
+	}
+	replayed, err := h.publisher.Failover(ctx, publisher.Cluster{
+		RPCURL:       params.RPCURL,
+		WebSocketURL: params.WebSocketURL,
+		SendRPCURL:   params.SendRPCURL,
+	})
+	if err != nil {
+		return jsonrpc.NewErrorStringResponse(req.ID, rpcErrNotReady, "failed to fail over: "+err.Error())
+	}
+	var result struct {
+		Updates int `json:"updates"`
+	}
+	result.Updates = replayed
+	return jsonrpc.NewResultResponse(req.ID, &result)
+}
+
+// handleEstimateFee estimates the fee of sending the queued updates, without flushing them.
+func (h *Handler) handleEstimateFee(ctx context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+	estimate, err := h.publisher.EstimateFee(ctx)
+	if err != nil {
+		return jsonrpc.NewErrorStringResponse(req.ID, rpcErrNotReady, "failed to estimate fee: "+err.Error())
+	}
+	return jsonrpc.NewResultResponse(req.ID, &feeEstimate{
+		Transactions: estimate.Transactions,
+		BaseFee:      estimate.BaseFee,
+		PriorityFee:  estimate.PriorityFee,
+		Total:        estimate.Total(),
+	})
+}
+
+// handleRestartComponent cancels and relaunches a single pipeline component.
+func (h *Handler) handleRestartComponent(_ context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+	var params struct {
+		Name string `json:"name"`
+	}
+	if err := decodeParams(req.Params, &params); err != nil || params.Name == "" {
+		return jsonrpc.NewInvalidParamsResponse(req.ID)
+	}
+	if err := h.publisher.RestartComponent(params.Name); errors.Is(err, publisher.ErrUnknownComponent) {
+		return jsonrpc.NewErrorResponse(req.ID, jsonrpc.Error{
+			Code:    jsonrpc.ErrCodeInvalidParams,
+			Message: "Invalid Params: " + err.Error(),
+		})
+	} else if err != nil {
+		return jsonrpc.NewErrorStringResponse(req.ID, rpcErrNotReady, err.Error())
+	}
+	return jsonrpc.NewResultResponse(req.ID, componentsToJSON(h.publisher.Components()))
+}
+
+func componentsToJSON(statuses []publisher.ComponentStatus) []componentStatus {
+	result := make([]componentStatus, len(statuses))
+	for i, status := range statuses {
+		result[i] = componentStatus{
+			Name:     status.Name,
+			State:    string(status.State),
+			Restarts: status.Restarts,
+		}
+		if status.Err != nil {
+			result[i].Error = status.Err.Error()
+		}
+	}
+	return result
+}
+
+func dropsToJSON(drops []schedule.DroppedUpdate) []droppedUpdate {
+	result := make([]droppedUpdate, len(drops))
+	for i, drop := range drops {
+		result[i] = droppedUpdate{
+			Time:    drop.Time.UTC().Format(time.RFC3339Nano),
+			Account: drop.Price.String(),
+			PubSlot: drop.PubSlot,
+			Reason:  string(drop.Reason),
+		}
+	}
+	return result
+}
+
+// DebugStateHandler serves a JSON snapshot of the buffer, slot, and connection state
+// for debugging. The given server is used to report the number of connected clients.
+//
+// Like the admin methods, this must not be reachable by untrusted clients.
+func (h *Handler) DebugStateHandler(rpcServer *jsonrpc.Server) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		state := h.debugState(rpcServer)
+		rw.Header().Set("content-type", "application/json; charset=utf-8")
+		enc := json.NewEncoder(rw)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(&state)
+	})
+}
+
+func (h *Handler) debugState(rpcServer *jsonrpc.Server) debugState {
+	pub := h.publisher.DebugState()
+	state := debugState{
+		Buffer: debugBuffer{
+			Depth:   len(pub.Queued),
+			Updates: make([]queuedPrice, len(pub.Queued)),
+		},
+		Slot: debugSlot{Slot: pub.Slot},
+		WebSockets: debugWebSockets{
+			SlotStream: connState(pub.SlotStreamUp),
+			Confirmer:  connState(pub.ConfirmerConnected),
+			Clients:    rpcServer.Conns(),
+		},
+		RecentDrops: dropsToJSON(pub.Drops),
+	}
+	for i, update := range pub.Queued {
+		state.Buffer.Updates[i] = queuedPrice{
+			Account: update.Price.String(),
+			PubSlot: update.PubSlot,
+		}
+	}
+	if !pub.SlotTime.IsZero() {
+		slotTime := pub.SlotTime.UTC().Format(time.RFC3339Nano)
+		age := h.Clock().Sub(pub.SlotTime).Seconds()
+		state.Slot.Time = &slotTime
+		state.Slot.AgeSeconds = &age
+	}
+	if !pub.LastFlush.IsZero() {
+		lastFlush := pub.LastFlush.UTC().Format(time.RFC3339Nano)
+		state.LastFlush = &lastFlush
+	}
+	return state
+}
+
+func connState(connected bool) string {
+	if connected {
+		return "connected"
+	}
+	return "disconnected"
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+	"errors"
+)
+
+// ComponentConflictDetector names the key conflict detector in the publisher supervisor.
+const ComponentConflictDetector = "conflict_detector"
+
+// RunConflictDetector streams price accounts, feeding the pub slots of our
+// components to the publisher to detect other publishers using our key.
+// Run it under the publisher supervisor to restart it if the stream fails.
+func (h *Handler) RunConflictDetector(ctx context.Context) error {
+	if !h.publisher.DetectsConflicts() {
+		return errors.New("conflict detection not enabled")
+	}
+	stream := h.client.StreamPriceAccounts()
+	defer stream.Close()
+
+	pubkey := h.publisher.Pubkey()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case entry, ok := <-stream.Updates():
+			if !ok {
+				return stream.Err()
+			}
+			for _, comp := range entry.Components {
+				if comp.Publisher == pubkey {
+					h.publisher.ObserveComponent(entry.Pubkey, comp.Latest.PubSlot)
+				}
+			}
+		}
+	}
+}
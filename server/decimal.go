@@ -0,0 +1,56 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+)
+
+// maxDecimalExponent bounds the exponents that are formatted as decimals.
+// Pyth exponents are small in practice, this only guards against garbage accounts.
+const maxDecimalExponent = 64
+
+// formatDecimal formats value * 10^exponent as an exact decimal string.
+//
+// Negative exponents produce exactly -exponent fractional digits.
+// Returns an empty string if the exponent is out of bounds.
+func formatDecimal(value int64, exponent int32) string {
+	if value < 0 {
+		// Two's complement negation also works for math.MinInt64.
+		return formatScaled(uint64(-(value+1))+1, true, exponent)
+	}
+	return formatScaled(uint64(value), false, exponent)
+}
+
+// formatDecimalUnsigned is like formatDecimal for unsigned values.
+func formatDecimalUnsigned(value uint64, exponent int32) string {
+	return formatScaled(value, false, exponent)
+}
+
+func formatScaled(magnitude uint64, negative bool, exponent int32) string {
+	if exponent > maxDecimalExponent || exponent < -maxDecimalExponent {
+		return ""
+	}
+	digits := strconv.FormatUint(magnitude, 10)
+
+	var sb strings.Builder
+	if negative {
+		sb.WriteByte('-')
+	}
+	switch {
+	case exponent >= 0:
+		sb.WriteString(digits)
+		if magnitude != 0 {
+			sb.WriteString(strings.Repeat("0", int(exponent)))
+		}
+	default:
+		scale := int(-exponent)
+		if len(digits) <= scale {
+			digits = strings.Repeat("0", scale-len(digits)+1) + digits
+		}
+		point := len(digits) - scale
+		sb.WriteString(digits[:point])
+		sb.WriteByte('.')
+		sb.WriteString(digits[point:])
+	}
+	return sb.String()
+}
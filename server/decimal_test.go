@@ -0,0 +1,43 @@
+package server
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatDecimal(t *testing.T) {
+	cases := []struct {
+		value    int64
+		exponent int32
+		expected string
+	}{
+		{2314525, -2, "23145.25"},
+		{2314525, 0, "2314525"},
+		{2314525, 3, "2314525000"},
+		{-2314525, -2, "-23145.25"},
+		{-2314525, 2, "-231452500"},
+		{5, -3, "0.005"},
+		{-5, -3, "-0.005"},
+		{100, -2, "1.00"},
+		{0, -8, "0.00000000"},
+		{0, 0, "0"},
+		{0, 5, "0"},
+		{1, -1, "0.1"},
+		{math.MaxInt64, -8, "92233720368.54775807"},
+		{math.MinInt64, -8, "-92233720368.54775808"},
+		{math.MinInt64, 0, "-9223372036854775808"},
+		{1, maxDecimalExponent + 1, ""},
+		{1, -maxDecimalExponent - 1, ""},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, formatDecimal(c.value, c.exponent), "%d * 10^%d", c.value, c.exponent)
+	}
+}
+
+func TestFormatDecimalUnsigned(t *testing.T) {
+	assert.Equal(t, "184467440737.09551615", formatDecimalUnsigned(math.MaxUint64, -8))
+	assert.Equal(t, "0.25", formatDecimalUnsigned(25, -2))
+	assert.Equal(t, "25", formatDecimalUnsigned(25, 0))
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gagliardetto/solana-go"
+	"go.blockdaemon.com/pyth"
+)
+
+// pythHeaderSize is the size of the account header: magic, version, account type, and size.
+const pythHeaderSize = 16
+
+// priceAccountSize is the size of v2 price accounts.
+const priceAccountSize = 3312
+
+// errNotPythAccount is returned for accounts not starting with the Pyth magic.
+var errNotPythAccount = errors.New("not a Pyth account")
+
+// accountTypeError is returned for Pyth accounts of another type than expected,
+// e.g. a price account passed as a product account.
+type accountTypeError struct {
+	actual, expected uint32
+}
+
+func (e *accountTypeError) Error() string {
+	return fmt.Sprintf("account type %d, expected %d", e.actual, e.expected)
+}
+
+// isWrongAccount returns whether decoding failed because the account
+// is not a Pyth account of the expected type.
+func isWrongAccount(err error) bool {
+	var typeErr *accountTypeError
+	return errors.Is(err, errNotPythAccount) || errors.As(err, &typeErr)
+}
+
+// decodeProductAccount decodes a product account, see decodeAccount.
+func decodeProductAccount(data []byte) (*pyth.ProductAccount, error) {
+	product := new(pyth.ProductAccount)
+	if err := decodeAccount(data, pyth.AccountTypeProduct, productAccountSize, product); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// decodePriceAccount decodes a price account, see decodeAccount.
+func decodePriceAccount(data []byte) (*pyth.PriceAccount, error) {
+	price := new(pyth.PriceAccount)
+	if err := decodeAccount(data, pyth.AccountTypePrice, priceAccountSize, price); err != nil {
+		return nil, err
+	}
+	return price, nil
+}
+
+// decodeAccount decodes account data in the v2 layout, tolerating future versions.
+//
+// The Pyth program extends layouts by appending fields, and the pyth package
+// rejects versions it does not know. Trailing bytes beyond the v2 size are
+// dropped, and newer versions are decoded as v2.
+func decodeAccount(data []byte, accountType uint32, size int, v encoding.BinaryUnmarshaler) error {
+	if len(data) < pythHeaderSize {
+		return fmt.Errorf("account data too short (%d bytes)", len(data))
+	}
+	if binary.LittleEndian.Uint32(data[0:4]) != pythMagic {
+		return errNotPythAccount
+	}
+	version := binary.LittleEndian.Uint32(data[4:8])
+	if version < pythVersion {
+		return fmt.Errorf("unsupported account version %d", version)
+	}
+	if actual := binary.LittleEndian.Uint32(data[8:12]); actual != accountType {
+		return &accountTypeError{actual: actual, expected: accountType}
+	}
+	if len(data) > size {
+		data = data[:size]
+	}
+	if version != pythVersion {
+		data = append([]byte(nil), data...)
+		binary.LittleEndian.PutUint32(data[4:8], pythVersion)
+	}
+	if err := v.UnmarshalBinary(data); err != nil {
+		return fmt.Errorf("version %d: %w", version, err)
+	}
+	return nil
+}
+
+// unparseableAccounts remembers accounts skipped because they failed to decode.
+type unparseableAccounts struct {
+	lock     sync.Mutex
+	accounts map[solana.PublicKey]unparseableAccount
+}
+
+// add records an account that failed to decode.
+func (u *unparseableAccounts) add(key solana.PublicKey, accountType string, err error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.accounts == nil {
+		u.accounts = make(map[solana.PublicKey]unparseableAccount)
+	}
+	if _, ok := u.accounts[key]; !ok {
+		metricUnparseableAccounts.WithLabelValues(accountType).Inc()
+	}
+	u.accounts[key] = unparseableAccount{
+		Account: key.String(),
+		Type:    accountType,
+		Error:   err.Error(),
+	}
+}
+
+// remove forgets an account after it decoded successfully.
+func (u *unparseableAccounts) remove(key solana.PublicKey) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if entry, ok := u.accounts[key]; ok {
+		metricUnparseableAccounts.WithLabelValues(entry.Type).Dec()
+		delete(u.accounts, key)
+	}
+}
+
+// list returns the unparseable accounts sorted by key.
+func (u *unparseableAccounts) list() []unparseableAccount {
+	if u == nil {
+		return nil
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if len(u.accounts) == 0 {
+		return nil
+	}
+	list := make([]unparseableAccount, 0, len(u.accounts))
+	for _, entry := range u.accounts {
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Account < list[j].Account
+	})
+	return list
+}
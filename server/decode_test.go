@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/publisher"
+)
+
+// accountFixture returns account data with the given header.
+func accountFixture(magic, version, accountType uint32, size int) []byte {
+	data := make([]byte, size)
+	binary.LittleEndian.PutUint32(data[0:4], magic)
+	binary.LittleEndian.PutUint32(data[4:8], version)
+	binary.LittleEndian.PutUint32(data[8:12], accountType)
+	binary.LittleEndian.PutUint32(data[12:16], uint32(size))
+	for i := pythHeaderSize; i < size; i++ {
+		data[i] = byte(i)
+	}
+	return data
+}
+
+// recordingAccount captures the data passed to UnmarshalBinary.
+type recordingAccount struct {
+	data []byte
+	err  error
+}
+
+func (r *recordingAccount) UnmarshalBinary(data []byte) error {
+	r.data = data
+	return r.err
+}
+
+func TestDecodeAccount(t *testing.T) {
+	v2 := accountFixture(pythMagic, pythVersion, pyth.AccountTypePrice, priceAccountSize)
+
+	t.Run("V2", func(t *testing.T) {
+		var acc recordingAccount
+		require.NoError(t, decodeAccount(v2, pyth.AccountTypePrice, priceAccountSize, &acc))
+		assert.Equal(t, v2, acc.data)
+	})
+	t.Run("TrailingBytes", func(t *testing.T) {
+		var acc recordingAccount
+		future := accountFixture(pythMagic, pythVersion, pyth.AccountTypePrice, 2*priceAccountSize)
+		require.NoError(t, decodeAccount(future, pyth.AccountTypePrice, priceAccountSize, &acc))
+		assert.Len(t, acc.data, priceAccountSize)
+		assert.Equal(t, future[pythHeaderSize:priceAccountSize], acc.data[pythHeaderSize:])
+	})
+	t.Run("FutureVersion", func(t *testing.T) {
+		var acc recordingAccount
+		future := accountFixture(pythMagic, pythVersion+1, pyth.AccountTypePrice, priceAccountSize+256)
+		require.NoError(t, decodeAccount(future, pyth.AccountTypePrice, priceAccountSize, &acc))
+		assert.Equal(t, uint32(pythVersion), binary.LittleEndian.Uint32(acc.data[4:8]))
+		assert.Equal(t, v2[pythHeaderSize:], acc.data[pythHeaderSize:])
+		assert.Equal(t, uint32(pythVersion+1), binary.LittleEndian.Uint32(future[4:8]), "input modified")
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		for name, data := range map[string][]byte{
+			"Short":       v2[:8],
+			"Magic":       accountFixture(0xdeadbeef, pythVersion, pyth.AccountTypePrice, priceAccountSize),
+			"OldVersion":  accountFixture(pythMagic, 1, pyth.AccountTypePrice, priceAccountSize),
+			"AccountType": accountFixture(pythMagic, pythVersion, pyth.AccountTypeProduct, productAccountSize),
+		} {
+			var acc recordingAccount
+			assert.Error(t, decodeAccount(data, pyth.AccountTypePrice, priceAccountSize, &acc), name)
+			assert.Nil(t, acc.data, name)
+		}
+	})
+	t.Run("UnmarshalError", func(t *testing.T) {
+		acc := recordingAccount{err: errors.New("bad layout")}
+		err := decodeAccount(v2, pyth.AccountTypePrice, priceAccountSize, &acc)
+		assert.EqualError(t, err, "version 2: bad layout")
+	})
+}
+
+func TestHandler_UnparseableAccounts(t *testing.T) {
+	h := newTestHandler(t, new(fakeAccounts), publisher.Options{})
+	h.unparseable = new(unparseableAccounts)
+
+	product := solana.NewWallet().PublicKey()
+	_, err := decodeProductAccount(accountFixture(pythMagic, pythVersion, pyth.AccountTypePrice, priceAccountSize))
+	require.Error(t, err)
+	h.unparseable.add(product, "product", err)
+
+	resp := call(t, h, "get_health", nil)
+	require.Nil(t, resp.Error)
+	report := resp.Result.(*healthReport)
+	require.Len(t, report.Unparseable, 1)
+	assert.Equal(t, product.String(), report.Unparseable[0].Account)
+	assert.Equal(t, "product", report.Unparseable[0].Type)
+	assert.Equal(t, "account type 3, expected 2", report.Unparseable[0].Error)
+
+	// Forgotten after decoding successfully.
+	h.unparseable.remove(product)
+	resp = call(t, h, "get_health", nil)
+	assert.Empty(t, resp.Result.(*healthReport).Unparseable)
+}
+
+// newAccountRPC serves getMultipleAccounts with the given account data.
+func newAccountRPC(t *testing.T, accounts map[solana.PublicKey][]byte) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var msg struct {
+			ID     json.RawMessage   `json:"id"`
+			Params []json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&msg))
+		var keys []solana.PublicKey
+		require.NoError(t, json.Unmarshal(msg.Params[0], &keys))
+		values := make([]interface{}, len(keys))
+		for i, key := range keys {
+			if data, ok := accounts[key]; ok {
+				values[i] = map[string]interface{}{
+					"data":     []string{base64.StdEncoding.EncodeToString(data), "base64"},
+					"lamports": 1,
+					"owner":    testProgram.String(),
+				}
+			}
+		}
+		_ = json.NewEncoder(rw).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      msg.ID,
+			"result": map[string]interface{}{
+				"context": map[string]interface{}{"slot": 100},
+				"value":   values,
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHandler_GetProductWrongAccount(t *testing.T) {
+	price, wallet := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	srv := newAccountRPC(t, map[solana.PublicKey][]byte{
+		price:  accountFixture(pythMagic, pythVersion, pyth.AccountTypePrice, priceAccountSize),
+		wallet: make([]byte, 64),
+	})
+	reader := newPythAccountReader(&pyth.Client{RPC: rpc.New(srv.URL)})
+	h := newTestHandler(t, reader, publisher.Options{})
+
+	resp := call(t, h, "get_product", map[string]interface{}{"account": price.String()})
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, rpcErrUnknownSymbol, resp.Error.Code)
+	assert.Equal(t, "not a product account: account type 3, expected 2", resp.Error.Message)
+
+	resp = call(t, h, "get_product", map[string]interface{}{"account": wallet.String()})
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, rpcErrUnknownSymbol, resp.Error.Code)
+	assert.Equal(t, "not a product account: not a Pyth account", resp.Error.Message)
+
+	resp = call(t, h, "get_product", map[string]interface{}{"account": solana.NewWallet().PublicKey().String()})
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, rpcErrUnknownSymbol, resp.Error.Code)
+	assert.Equal(t, "unknown symbol", resp.Error.Message)
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/jsonrpc"
+)
+
+// aggregateCache remembers the on-chain aggregate price of price accounts.
+type aggregateCache struct {
+	lock    sync.Mutex
+	entries map[solana.PublicKey]cachedAggregate
+}
+
+type cachedAggregate struct {
+	info    pyth.PriceInfo
+	fetched time.Time
+}
+
+// get returns the current aggregate, refreshing it if older than ttl at now.
+// Returns nil if the price account does not exist.
+func (c *aggregateCache) get(ctx context.Context, reader accountReader, account solana.PublicKey, ttl time.Duration, now time.Time) (*pyth.PriceInfo, error) {
+	c.lock.Lock()
+	entry, ok := c.entries[account]
+	c.lock.Unlock()
+	if ok && now.Sub(entry.fetched) < ttl {
+		return &entry.info, nil
+	}
+
+	prices, err := reader.GetPriceAccounts(ctx, []solana.PublicKey{account})
+	if err != nil {
+		return nil, err
+	}
+	if len(prices) != 1 || prices[0] == nil {
+		return nil, nil
+	}
+	entry = cachedAggregate{info: prices[0].Agg, fetched: now}
+
+	c.lock.Lock()
+	if c.entries == nil {
+		c.entries = make(map[solana.PublicKey]cachedAggregate)
+	}
+	c.entries[account] = entry
+	c.lock.Unlock()
+	return &entry.info, nil
+}
+
+// checkDeviation rejects prices deviating more than MaxDeviation from the current aggregate.
+// It checks the price to publish, after smoothing, like the breaker does.
+//
+// The guard fails open: If the aggregate is unavailable or not trading, the update is allowed.
+func (h *Handler) checkDeviation(ctx context.Context, account solana.PublicKey, price int64) error {
+	if h.MaxDeviation <= 0 {
+		return nil
+	}
+	agg, err := h.aggregates.get(ctx, h.accounts, account, h.AggregateCacheTTL, h.Clock())
+	if err != nil || agg == nil || agg.Status != pyth.PriceStatusTrading || agg.Price == 0 {
+		return nil
+	}
+	deviation := relativeDeviation(agg.Price, price)
+	if deviation > h.MaxDeviation {
+		return fmt.Errorf("price %d deviates %.2f%% from aggregate %d (limit %.2f%%)",
+			price, deviation*100, agg.Price, h.MaxDeviation*100)
+	}
+	return nil
+}
+
+// relativeDeviation returns |price-ref|/|ref|.
+func relativeDeviation(ref, price int64) float64 {
+	diff := float64(price) - float64(ref)
+	if diff < 0 {
+		diff = -diff
+	}
+	base := float64(ref)
+	if base < 0 {
+		base = -base
+	}
+	return diff / base
+}
+
+// handleGetMyDeviation compares our latest component price to the on-chain aggregate.
+func (h *Handler) handleGetMyDeviation(ctx context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+	// Decode params.
+	var params struct {
+		Account solana.PublicKey `json:"account"`
+	}
+	if err := decodeParams(req.Params, &params); err != nil {
+		return jsonrpc.NewInvalidParamsResponse(req.ID)
+	}
+	if params.Account.IsZero() {
+		return jsonrpc.NewInvalidParamsResponse(req.ID)
+	}
+
+	// Read the account directly, alerts should not see cached prices.
+	prices, err := h.accounts.GetPriceAccounts(ctx, []solana.PublicKey{params.Account})
+	if err != nil {
+		return h.notReady(req.ID, "failed to get price account: "+err.Error())
+	}
+	if len(prices) != 1 || prices[0] == nil {
+		return jsonrpc.NewErrorStringResponse(req.ID, rpcErrUnknownSymbol, "unknown price account")
+	}
+	return jsonrpc.NewResultResponse(req.ID, deviationToJSON(prices[0], h.publisher.Pubkey()))
+}
+
+// deviationToJSON compares the component of the given publisher to the aggregate.
+//
+// Deviations are only reported if both our component and the aggregate are trading.
+func deviationToJSON(price *pyth.PriceAccountEntry, publisher solana.PublicKey) myDeviation {
+	res := myDeviation{
+		Account:        price.Pubkey.String(),
+		Publisher:      publisher.String(),
+		Status:         statusToString(pyth.PriceStatusUnknown),
+		AggregatePrice: price.Agg.Price,
+		AggregateSlot:  price.Agg.PubSlot,
+	}
+	var ours *pyth.PriceComp
+	others := 0
+	oldestOther := uint64(0)
+	for i := range price.Components {
+		comp := &price.Components[i]
+		switch {
+		case comp.Publisher.IsZero():
+			continue
+		case comp.Publisher == publisher:
+			ours = comp
+		default:
+			if others == 0 || comp.Latest.PubSlot < oldestOther {
+				oldestOther = comp.Latest.PubSlot
+			}
+			others++
+		}
+	}
+	if ours == nil {
+		return res
+	}
+	res.Component = true
+	res.Status = statusToString(ours.Latest.Status)
+	res.PubSlot = ours.Latest.PubSlot
+	res.Stalest = others > 0 && ours.Latest.PubSlot <= oldestOther
+	if ours.Latest.Status != pyth.PriceStatusTrading {
+		return res
+	}
+	res.Active = true
+	res.Price = &ours.Latest.Price
+	if price.Agg.Status != pyth.PriceStatusTrading {
+		return res
+	}
+	abs := ours.Latest.Price - price.Agg.Price
+	if abs < 0 {
+		abs = -abs
+	}
+	res.AbsDeviation = &abs
+	if price.Agg.Price != 0 {
+		percent := relativeDeviation(price.Agg.Price, ours.Latest.Price) * 100
+		res.DeviationPercent = &percent
+	}
+	return res
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"go.blockdaemon.com/pythian/errlog"
+	"go.blockdaemon.com/pythian/jsonrpc"
+)
+
+// stateDump configures where state dumps are written.
+type stateDump struct {
+	dir       string
+	rpcServer *jsonrpc.Server
+	errors    *errlog.Ring
+}
+
+// EnableStateDump writes state dumps into the given directory, see DumpState.
+// The given server is used to report the number of connected clients,
+// and the ring supplies recent errors.
+func (h *Handler) EnableStateDump(dir string, rpcServer *jsonrpc.Server, ring *errlog.Ring) {
+	h.dump = &stateDump{dir: dir, rpcServer: rpcServer, errors: ring}
+}
+
+// DumpState writes a snapshot of everything the server knows for post-mortems
+// to a timestamped JSON file and returns its path.
+//
+// Errors are redacted by the ring when recorded, component errors when dumped.
+// The dump holds no keys or credentials.
+func (h *Handler) DumpState() (string, error) {
+	if h.dump == nil {
+		return "", errors.New("state dumps not enabled")
+	}
+	now := h.Clock().UTC()
+	snapshot := h.stateSnapshot(now)
+	data, err := json.MarshalIndent(&snapshot, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(h.dump.dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(h.dump.dir, "pythian-state-"+now.Format("20060102T150405.000Z")+".json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (h *Handler) stateSnapshot(now time.Time) stateSnapshot {
+	debug := h.debugState(h.dump.rpcServer)
+	snapshot := stateSnapshot{
+		Time:                 now.Format(time.RFC3339Nano),
+		Slot:                 debug.Slot,
+		Buffer:               dumpBuffer{Depth: debug.Buffer.Depth},
+		LastFlush:            debug.LastFlush,
+		PendingConfirmations: h.publisher.DebugState().PendingConfirms,
+		Subscriptions:        int(atomic.LoadInt64(&h.subscriptions)),
+		WebSockets:           debug.WebSockets,
+		Components:           componentsToJSON(h.publisher.Components()),
+		RecentErrors:         []recentError{},
+	}
+	for _, update := range debug.Buffer.Updates {
+		pubSlot := update.PubSlot
+		if snapshot.Buffer.OldestPubSlot == nil || pubSlot < *snapshot.Buffer.OldestPubSlot {
+			snapshot.Buffer.OldestPubSlot = &pubSlot
+		}
+		if snapshot.Buffer.NewestPubSlot == nil || pubSlot > *snapshot.Buffer.NewestPubSlot {
+			snapshot.Buffer.NewestPubSlot = &pubSlot
+		}
+	}
+	h.healthLock.Lock()
+	cacheTime := h.cacheTime
+	h.healthLock.Unlock()
+	if !cacheTime.IsZero() {
+		age := now.Sub(cacheTime).Seconds()
+		snapshot.AccountCacheAge = &age
+	}
+	if ring := h.dump.errors; ring != nil {
+		for i := range snapshot.Components {
+			snapshot.Components[i].Error = ring.Redact(snapshot.Components[i].Error)
+		}
+		for _, entry := range ring.List() {
+			snapshot.RecentErrors = append(snapshot.RecentErrors, recentError{
+				Time:      entry.Time.UTC().Format(time.RFC3339Nano),
+				Component: entry.Logger,
+				Message:   entry.Message,
+				Error:     entry.Error,
+			})
+		}
+	} else {
+		for i := range snapshot.Components {
+			snapshot.Components[i].Error = errlog.RedactURLs(snapshot.Components[i].Error)
+		}
+	}
+	return snapshot
+}
+
+// handleDumpState writes a state dump and returns its path.
+func (h *Handler) handleDumpState(_ context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+	path, err := h.DumpState()
+	if err != nil {
+		return jsonrpc.NewErrorStringResponse(req.ID, rpcErrNotReady, "failed to dump state: "+err.Error())
+	}
+	var result struct {
+		Path string `json:"path"`
+	}
+	result.Path = path
+	return jsonrpc.NewResultResponse(req.ID, &result)
+}
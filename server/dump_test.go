@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/errlog"
+	"go.blockdaemon.com/pythian/jsonrpc"
+	"go.blockdaemon.com/pythian/publisher"
+	"go.blockdaemon.com/pythian/signer"
+	"go.uber.org/zap"
+)
+
+func TestHandler_DumpState(t *testing.T) {
+	const token = "Bearer 7f3a9c1e5d"
+	key, err := solana.NewRandomPrivateKey()
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "publisher.key")
+	require.NoError(t, os.WriteFile(keyPath, []byte(key.String()), 0600))
+	txSigner, err := signer.NewSigner(keyPath, testProgram)
+	require.NoError(t, err)
+	t.Cleanup(txSigner.Close)
+
+	ring := errlog.NewRing(10)
+	ring.AddSecret(token)
+	log := ring.Wrap(zap.NewNop())
+	pub, err := publisher.New(publisher.Options{
+		Log:          log.Named("publisher"),
+		RPCURL:       "http://127.0.0.1:0/s3cret-path?api-key=s3cret-query",
+		WebSocketURL: "ws://127.0.0.1:0",
+		Program:      testProgram,
+		Signer:       txSigner,
+	})
+	require.NoError(t, err)
+	h := newHandler(&pyth.Client{Env: pyth.Env{Program: testProgram}}, new(fakeAccounts), pub)
+	h.EnableAdmin()
+	dir := filepath.Join(t.TempDir(), "dumps")
+	h.EnableStateDump(dir, jsonrpc.NewServer(h), ring)
+
+	log.Named("sender").Error("Failed to send transaction",
+		zap.Error(errors.New(`Post "http://127.0.0.1:0/s3cret-path?api-key=s3cret-query": authorization `+token+` rejected`)))
+	require.NoError(t, pub.PushPrice(solana.NewWallet().PublicKey(), 100, 1, pyth.PriceStatusTrading))
+
+	resp := call(t, h, "dump_state", nil)
+	require.Nil(t, resp.Error)
+	path := resp.Result.(*struct {
+		Path string `json:"path"`
+	}).Path
+	assert.Equal(t, dir, filepath.Dir(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var dump stateSnapshot
+	require.NoError(t, json.Unmarshal(data, &dump))
+	assert.Equal(t, 1, dump.Buffer.Depth)
+	assert.NotEmpty(t, dump.Components)
+	require.Len(t, dump.RecentErrors, 1)
+	assert.Equal(t, "sender", dump.RecentErrors[0].Component)
+	assert.Equal(t, `Post "http://127.0.0.1:0/[REDACTED]": authorization [REDACTED] rejected`, dump.RecentErrors[0].Error)
+
+	// Secrets never appear in the dump.
+	for _, secret := range []string{token, "7f3a9c1e5d", "s3cret", key.String()} {
+		assert.False(t, strings.Contains(string(data), secret), "dump contains secret %q", secret)
+	}
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestHandler_DumpStateDisabled(t *testing.T) {
+	h := newTestHandler(t, new(fakeAccounts), publisher.Options{})
+	h.EnableAdmin()
+	resp := call(t, h, "dump_state", nil)
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, rpcErrNotReady, resp.Error.Code)
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+)
+
+// Product lists are the largest responses served, with thousands of
+// price accounts on mainnet. They are encoded by hand instead of via
+// reflection and spliced into the JSON-RPC response as is, see
+// jsonrpc.ResultAppender. The output is byte-identical to encoding/json,
+// see TestProductListJSON_Golden.
+
+// productList is the result of get_product_list.
+type productList []productAccount
+
+// productDetailList is the result of get_all_products.
+type productDetailList []productAccountDetail
+
+func (l productList) MarshalJSON() ([]byte, error) {
+	return l.AppendJSON(nil), nil
+}
+
+func (l productList) AppendJSON(buf []byte) []byte {
+	if l == nil {
+		return append(buf, "null"...)
+	}
+	size := 0
+	for i := range l {
+		size += 256 + 128*len(l[i].Prices)
+	}
+	if cap(buf)-len(buf) < size {
+		buf = append(make([]byte, 0, len(buf)+size), buf...)
+	}
+	buf = append(buf, '[')
+	for i := range l {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = l[i].appendJSON(buf)
+	}
+	return append(buf, ']')
+}
+
+func (l productDetailList) MarshalJSON() ([]byte, error) {
+	return l.AppendJSON(nil), nil
+}
+
+func (l productDetailList) AppendJSON(buf []byte) []byte {
+	if l == nil {
+		return append(buf, "null"...)
+	}
+	size := 0
+	for i := range l {
+		size += 256
+		for j := range l[i].PriceAccounts {
+			size += 384 + 128*len(l[i].PriceAccounts[j].PublisherAccounts)
+		}
+	}
+	if cap(buf)-len(buf) < size {
+		buf = append(make([]byte, 0, len(buf)+size), buf...)
+	}
+	buf = append(buf, '[')
+	for i := range l {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = l[i].appendJSON(buf)
+	}
+	return append(buf, ']')
+}
+
+func (p *productAccount) appendJSON(buf []byte) []byte {
+	buf = append(buf, `{"account":`...)
+	buf = appendJSONString(buf, p.Account)
+	buf = append(buf, `,"attr_dict":`...)
+	buf = appendJSONStringMap(buf, p.AttrDict)
+	buf = append(buf, `,"price":`...)
+	if p.Prices == nil {
+		buf = append(buf, "null"...)
+	} else {
+		buf = append(buf, '[')
+		for i := range p.Prices {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = p.Prices[i].appendJSON(buf)
+		}
+		buf = append(buf, ']')
+	}
+	if p.Warning != "" {
+		buf = append(buf, `,"warning":`...)
+		buf = appendJSONString(buf, p.Warning)
+	}
+	return append(buf, '}')
+}
+
+func (p *priceAccount) appendJSON(buf []byte) []byte {
+	buf = append(buf, `{"account":`...)
+	buf = appendJSONString(buf, p.Account)
+	buf = append(buf, `,"price_exponent":`...)
+	buf = strconv.AppendInt(buf, int64(p.PriceExponent), 10)
+	buf = append(buf, `,"price_type":`...)
+	buf = appendJSONString(buf, p.PriceType)
+	return append(buf, '}')
+}
+
+func (p *productAccountDetail) appendJSON(buf []byte) []byte {
+	buf = append(buf, `{"account":`...)
+	buf = appendJSONString(buf, p.Account)
+	buf = append(buf, `,"attr_dict":`...)
+	buf = appendJSONStringMap(buf, p.AttrDict)
+	buf = append(buf, `,"price_accounts":`...)
+	if p.PriceAccounts == nil {
+		buf = append(buf, "null"...)
+	} else {
+		buf = append(buf, '[')
+		for i := range p.PriceAccounts {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = p.PriceAccounts[i].appendJSON(buf)
+		}
+		buf = append(buf, ']')
+	}
+	if p.Warning != "" {
+		buf = append(buf, `,"warning":`...)
+		buf = appendJSONString(buf, p.Warning)
+	}
+	return append(buf, '}')
+}
+
+func (p *priceAccountDetail) appendJSON(buf []byte) []byte {
+	buf = append(buf, `{"account":`...)
+	buf = appendJSONString(buf, p.Account)
+	buf = append(buf, `,"price_type":`...)
+	buf = appendJSONString(buf, p.PriceType)
+	buf = append(buf, `,"price_exponent":`...)
+	buf = strconv.AppendInt(buf, int64(p.PriceExponent), 10)
+	buf = append(buf, `,"status":`...)
+	buf = appendJSONString(buf, p.Status)
+	buf = append(buf, `,"price":`...)
+	buf = strconv.AppendInt(buf, p.Price, 10)
+	buf = append(buf, `,"conf":`...)
+	buf = strconv.AppendInt(buf, p.Conf, 10)
+	if p.PriceDecimal != "" {
+		buf = append(buf, `,"price_decimal":`...)
+		buf = appendJSONString(buf, p.PriceDecimal)
+	}
+	if p.ConfDecimal != "" {
+		buf = append(buf, `,"conf_decimal":`...)
+		buf = appendJSONString(buf, p.ConfDecimal)
+	}
+	buf = append(buf, `,"ema_price":`...)
+	buf = strconv.AppendInt(buf, p.EmaPrice, 10)
+	buf = append(buf, `,"ema_confidence":`...)
+	buf = strconv.AppendInt(buf, p.EmaConfidence, 10)
+	buf = append(buf, `,"valid_slot":`...)
+	buf = strconv.AppendUint(buf, p.ValidSlot, 10)
+	buf = append(buf, `,"pub_slot":`...)
+	buf = strconv.AppendUint(buf, p.PubSlot, 10)
+	buf = append(buf, `,"prev_slot":`...)
+	buf = strconv.AppendUint(buf, p.PrevSlot, 10)
+	buf = append(buf, `,"prev_price":`...)
+	buf = strconv.AppendInt(buf, p.PrevPrice, 10)
+	buf = append(buf, `,"prev_conf":`...)
+	buf = strconv.AppendInt(buf, p.PrevConf, 10)
+	buf = append(buf, `,"publisher_accounts":`...)
+	if p.PublisherAccounts == nil {
+		buf = append(buf, "null"...)
+	} else {
+		buf = append(buf, '[')
+		for i := range p.PublisherAccounts {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = p.PublisherAccounts[i].appendJSON(buf)
+		}
+		buf = append(buf, ']')
+	}
+	return append(buf, '}')
+}
+
+func (p *publisherAccount) appendJSON(buf []byte) []byte {
+	buf = append(buf, `{"account":`...)
+	buf = appendJSONString(buf, p.Account)
+	buf = append(buf, `,"status":`...)
+	buf = appendJSONString(buf, p.Status)
+	buf = append(buf, `,"price":`...)
+	buf = strconv.AppendInt(buf, p.Price, 10)
+	buf = append(buf, `,"conf":`...)
+	buf = strconv.AppendInt(buf, p.Conf, 10)
+	buf = append(buf, `,"slot":`...)
+	buf = strconv.AppendUint(buf, p.Slot, 10)
+	return append(buf, '}')
+}
+
+// appendJSONStringMap encodes a map with sorted keys, like encoding/json.
+func appendJSONStringMap(buf []byte, m map[string]string) []byte {
+	if m == nil {
+		return append(buf, "null"...)
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf = append(buf, '{')
+	for i, k := range keys {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = appendJSONString(buf, k)
+		buf = append(buf, ':')
+		buf = appendJSONString(buf, m[k])
+	}
+	return append(buf, '}')
+}
+
+// appendJSONString encodes a string.
+//
+// Pubkeys and most attributes are printable ASCII and copied as is.
+// Anything else defers to encoding/json to preserve its escaping rules.
+func appendJSONString(buf []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c >= 0x7f || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			enc, _ := json.Marshal(s)
+			return append(buf, enc...)
+		}
+	}
+	buf = append(buf, '"')
+	buf = append(buf, s...)
+	return append(buf, '"')
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pythian/jsonrpc"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+// mainnetProductCount approximates the number of products on mainnet.
+const mainnetProductCount = 400
+
+func testKey(i int) string {
+	var key solana.PublicKey
+	key[0], key[1], key[31] = byte(i), byte(i>>8), 0xff
+	return key.String()
+}
+
+// testProducts returns products shaped like mainnet,
+// with edge cases for escaping and omitted fields.
+func testProducts(n int) (productList, productDetailList) {
+	list := make(productList, n)
+	details := make(productDetailList, n)
+	for i := 0; i < n; i++ {
+		attrs := map[string]string{
+			"symbol":         fmt.Sprintf("Crypto.SYM%d/USD", i),
+			"asset_type":     "Crypto",
+			"base":           fmt.Sprintf("SYM%d", i),
+			"quote_currency": "USD",
+			"description":    fmt.Sprintf("SYM%d/USD", i),
+			"generic_symbol": fmt.Sprintf("SYM%dUSD", i),
+		}
+		var prices []priceAccount
+		var priceDetails []priceAccountDetail
+		switch i {
+		case 0:
+			attrs["description"] = "S&P <500> \"index\" \\ ünïcödé  \n\t\x01"
+		case 1:
+			attrs = nil
+		case 2:
+			attrs = map[string]string{}
+			priceDetails = []priceAccountDetail{}
+		default:
+			prices = []priceAccount{{Account: testKey(i), PriceExponent: -8, PriceType: "price"}}
+			publishers := make([]publisherAccount, 0, 32)
+			for j := 0; j < 32; j++ {
+				publishers = append(publishers, publisherAccount{
+					Account: testKey(i*32 + j),
+					Status:  "trading",
+					Price:   int64(i*1000 + j),
+					Conf:    int64(j),
+					Slot:    uint64(120000000 + j),
+				})
+			}
+			detail := priceAccountDetail{
+				Account:           testKey(i),
+				PriceType:         "price",
+				PriceExponent:     -8,
+				Status:            "trading",
+				Price:             int64(i) * 100000000,
+				Conf:              int64(i),
+				EmaPrice:          int64(i) * 99999999,
+				EmaConfidence:     int64(i) + 1,
+				ValidSlot:         120000000,
+				PubSlot:           120000001,
+				PrevSlot:          119999999,
+				PrevPrice:         -int64(i),
+				PrevConf:          int64(i) + 2,
+				PublisherAccounts: publishers,
+			}
+			if i%2 == 0 {
+				detail.PriceDecimal = formatDecimal(detail.Price, -8)
+				detail.ConfDecimal = formatDecimalUnsigned(uint64(detail.Conf), -8)
+			}
+			if i == 3 {
+				detail.PublisherAccounts = nil
+			}
+			priceDetails = []priceAccountDetail{detail}
+		}
+		list[i] = productAccount{Account: testKey(i), AttrDict: attrs, Prices: prices}
+		details[i] = productAccountDetail{Account: testKey(i), AttrDict: attrs, PriceAccounts: priceDetails}
+		if i == 4 {
+			list[i].Warning = "cycle in price account list"
+			details[i].Warning = list[i].Warning
+		}
+	}
+	return list, details
+}
+
+func checkGolden(t *testing.T, name string, got []byte) {
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		require.NoError(t, os.MkdirAll("testdata", 0755))
+		require.NoError(t, os.WriteFile(path, got, 0644))
+	}
+	want, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(got))
+}
+
+// checkResponse compares JSON-RPC responses with a result encoded by hand and via reflection.
+func checkResponse(t *testing.T, result, reflected interface{}) {
+	got, err := json.Marshal(jsonrpc.NewResultResponse(1, result))
+	require.NoError(t, err)
+	want, err := json.Marshal(jsonrpc.NewResultResponse(1, reflected))
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(got))
+}
+
+func TestProductListJSON_Golden(t *testing.T) {
+	list, details := testProducts(8)
+
+	t.Run("ProductList", func(t *testing.T) {
+		got, err := json.Marshal(list)
+		require.NoError(t, err)
+		want, err := json.Marshal([]productAccount(list))
+		require.NoError(t, err)
+		assert.Equal(t, string(want), string(got))
+		checkGolden(t, "product_list.golden.json", got)
+		checkResponse(t, list, []productAccount(list))
+	})
+	t.Run("ProductDetailList", func(t *testing.T) {
+		got, err := json.Marshal(details)
+		require.NoError(t, err)
+		want, err := json.Marshal([]productAccountDetail(details))
+		require.NoError(t, err)
+		assert.Equal(t, string(want), string(got))
+		checkGolden(t, "product_detail_list.golden.json", got)
+		checkResponse(t, details, []productAccountDetail(details))
+	})
+	t.Run("Nil", func(t *testing.T) {
+		got, err := json.Marshal(productList(nil))
+		require.NoError(t, err)
+		assert.Equal(t, "null", string(got))
+	})
+}
+
+func BenchmarkProductListJSON(b *testing.B) {
+	list, details := testProducts(mainnetProductCount)
+	for _, bench := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"ProductList/Reflect", []productAccount(list)},
+		{"ProductList/Direct", list},
+		{"ProductDetailList/Reflect", []productAccountDetail(details)},
+		{"ProductDetailList/Direct", details},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := json.Marshal(jsonrpc.NewResultResponse(1, bench.value)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"go.blockdaemon.com/pythian/jsonrpc"
+)
+
+// Metric families summarized by get_metrics.
+const (
+	metricNameUpdatesSent = "pythian_solana_price_updates_sent_total"
+	metricNameDropped     = "pythian_solana_price_updates_dropped_total"
+	metricNameTxsSent     = "pythian_solana_transactions_sent_total"
+	metricNameWSConns     = "pythian_rpc_websocket_conns"
+)
+
+// handleGetMetrics returns the key metrics as JSON,
+// for operators unable to scrape Prometheus.
+//
+// Counters are read from the Prometheus registry, summed over all labels
+// except the drop reason, so the values match the scraped ones.
+func (h *Handler) handleGetMetrics(_ context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+	families, err := h.gatherer.Gather()
+	if err != nil {
+		return jsonrpc.NewErrorStringResponse(req.ID, rpcErrNotReady, "failed to gather metrics: "+err.Error())
+	}
+	pub := h.publisher.DebugState()
+	snapshot := metricsSnapshot{
+		UpdatesDropped: make(map[string]uint64),
+		BufferDepth:    len(pub.Queued),
+		Slot:           pub.Slot,
+		SlotStream:     connState(pub.SlotStreamUp),
+		Confirmer:      connState(pub.ConfirmerConnected),
+	}
+	for _, family := range families {
+		switch family.GetName() {
+		case metricNameUpdatesSent:
+			snapshot.UpdatesSent = uint64(sumMetrics(family))
+		case metricNameTxsSent:
+			snapshot.TransactionsSent = uint64(sumMetrics(family))
+		case metricNameWSConns:
+			snapshot.Clients = int(sumMetrics(family))
+		case metricNameDropped:
+			for _, metric := range family.GetMetric() {
+				reason := labelValue(metric, "drop_reason")
+				snapshot.UpdatesDropped[reason] += uint64(metric.GetCounter().GetValue())
+			}
+		}
+	}
+	if !pub.SlotTime.IsZero() {
+		lag := h.Clock().Sub(pub.SlotTime).Seconds()
+		snapshot.SlotLagSeconds = &lag
+	}
+	if !pub.LastFlush.IsZero() {
+		lastFlush := pub.LastFlush.UTC().Format(time.RFC3339Nano)
+		snapshot.LastFlush = &lastFlush
+	}
+	return jsonrpc.NewResultResponse(req.ID, &snapshot)
+}
+
+// sumMetrics adds up the values of all series of a counter or gauge.
+func sumMetrics(family *dto.MetricFamily) float64 {
+	var sum float64
+	for _, metric := range family.GetMetric() {
+		switch {
+		case metric.Counter != nil:
+			sum += metric.GetCounter().GetValue()
+		case metric.Gauge != nil:
+			sum += metric.GetGauge().GetValue()
+		}
+	}
+	return sum
+}
+
+func labelValue(metric *dto.Metric, name string) string {
+	for _, label := range metric.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"go.blockdaemon.com/pythian/faults"
+	"go.blockdaemon.com/pythian/jsonrpc"
+)
+
+// EnableFaultInjection registers admin methods that inject failures into the publish pipeline.
+//
+// The injector must be the one passed to the publisher.
+func (h *Handler) EnableFaultInjection(injector *faults.Injector) {
+	h.HandleFunc("set_faults", func(_ context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+		var params struct {
+			DropSendPercent float64 `json:"drop_send_percent"`
+			SendDelayMs     uint64  `json:"send_delay_ms"`
+			Read429Percent  float64 `json:"read_429_percent"`
+		}
+		if err := decodeParams(req.Params, &params); err != nil {
+			return jsonrpc.NewInvalidParamsResponse(req.ID)
+		}
+		if !validPercent(params.DropSendPercent) || !validPercent(params.Read429Percent) {
+			return jsonrpc.NewInvalidParamsResponse(req.ID)
+		}
+		injector.Set(faults.Config{
+			DropSendRate:  params.DropSendPercent / 100,
+			SendDelay:     time.Duration(params.SendDelayMs) * time.Millisecond,
+			ReadLimitRate: params.Read429Percent / 100,
+		})
+		return jsonrpc.NewResultResponse(req.ID, faultStateToJSON(injector.State()))
+	})
+	h.HandleFunc("stall_slots", func(_ context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+		var params struct {
+			Seconds float64 `json:"seconds"`
+		}
+		if err := decodeParams(req.Params, &params); err != nil || params.Seconds <= 0 {
+			return jsonrpc.NewInvalidParamsResponse(req.ID)
+		}
+		injector.StallSlots(time.Duration(params.Seconds * float64(time.Second)))
+		return jsonrpc.NewResultResponse(req.ID, faultStateToJSON(injector.State()))
+	})
+	h.HandleFunc("clear_faults", func(_ context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+		injector.Clear()
+		return jsonrpc.NewResultResponse(req.ID, faultStateToJSON(injector.State()))
+	})
+	h.HandleFunc("get_faults", func(_ context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+		return jsonrpc.NewResultResponse(req.ID, faultStateToJSON(injector.State()))
+	})
+}
+
+func validPercent(p float64) bool {
+	return p >= 0 && p <= 100
+}
+
+func faultStateToJSON(state faults.State) faultState {
+	out := faultState{
+		DropSendPercent: state.DropSendRate * 100,
+		SendDelayMs:     uint64(state.SendDelay / time.Millisecond),
+		Read429Percent:  state.ReadLimitRate * 100,
+	}
+	if !state.StallUntil.IsZero() {
+		out.StallSlotsUntil = state.StallUntil.UTC().Format(time.RFC3339Nano)
+	}
+	return out
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"go.blockdaemon.com/pyth"
+	"go.uber.org/zap"
+)
+
+// ComponentPriceFeed names the dashboard price feed in the publisher supervisor.
+const ComponentPriceFeed = "price_feed"
+
+// feedQueueSize is the number of batches buffered per feed client.
+// Clients falling further behind are disconnected.
+const feedQueueSize = 16
+
+// priceFeed tracks aggregate prices and fans out changes to dashboard clients.
+//
+// Changes are coalesced: Each flush sends at most one update per price account,
+// carrying its latest state.
+type priceFeed struct {
+	interval time.Duration
+
+	lock    sync.Mutex
+	symbols map[solana.PublicKey]string
+	latest  map[solana.PublicKey]feedUpdate
+	pending map[solana.PublicKey]bool
+	clients map[*feedClient]struct{}
+}
+
+// feedClient receives batches of updates.
+type feedClient struct {
+	c    chan []feedUpdate
+	lost chan struct{} // closed when the client fell behind
+}
+
+func newPriceFeed(interval time.Duration) *priceFeed {
+	return &priceFeed{
+		interval: interval,
+		symbols:  make(map[solana.PublicKey]string),
+		latest:   make(map[solana.PublicKey]feedUpdate),
+		pending:  make(map[solana.PublicKey]bool),
+		clients:  make(map[*feedClient]struct{}),
+	}
+}
+
+// setSymbols updates the symbols of price accounts.
+func (f *priceFeed) setSymbols(symbols map[solana.PublicKey]string) {
+	if f == nil {
+		return
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.symbols = symbols
+	for account, update := range f.latest {
+		if symbol := symbols[account]; symbol != update.Symbol {
+			update.Symbol = symbol
+			f.latest[account] = update
+			f.pending[account] = true
+		}
+	}
+}
+
+// observe records the aggregate state of a price account.
+func (f *priceFeed) observe(entry pyth.PriceAccountEntry) {
+	if entry.PriceAccount == nil {
+		return
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	update := feedUpdate{
+		Account: entry.Pubkey.String(),
+		Symbol:  f.symbols[entry.Pubkey],
+		Price:   entry.Agg.Price,
+		Conf:    entry.Agg.Conf,
+		Status:  statusToString(entry.Agg.Status),
+		Slot:    entry.Agg.PubSlot,
+	}
+	if prev, ok := f.latest[entry.Pubkey]; ok && prev == update {
+		return
+	}
+	f.latest[entry.Pubkey] = update
+	f.pending[entry.Pubkey] = true
+}
+
+// flush sends pending changes to all clients.
+func (f *priceFeed) flush() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if len(f.pending) == 0 {
+		return
+	}
+	batch := make([]feedUpdate, 0, len(f.pending))
+	for account := range f.pending {
+		batch = append(batch, f.latest[account])
+	}
+	f.pending = make(map[solana.PublicKey]bool)
+	sortFeedUpdates(batch)
+	for client := range f.clients {
+		select {
+		case client.c <- batch:
+		default:
+			delete(f.clients, client)
+			close(client.lost)
+		}
+	}
+}
+
+// subscribe returns a snapshot of all known prices and a client receiving subsequent changes.
+func (f *priceFeed) subscribe() ([]feedUpdate, *feedClient) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	snapshot := make([]feedUpdate, 0, len(f.latest))
+	for _, update := range f.latest {
+		snapshot = append(snapshot, update)
+	}
+	sortFeedUpdates(snapshot)
+	client := &feedClient{
+		c:    make(chan []feedUpdate, feedQueueSize),
+		lost: make(chan struct{}),
+	}
+	f.clients[client] = struct{}{}
+	return snapshot, client
+}
+
+func (f *priceFeed) unsubscribe(client *feedClient) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.clients, client)
+}
+
+func sortFeedUpdates(updates []feedUpdate) {
+	sort.Slice(updates, func(i, j int) bool {
+		return updates[i].Account < updates[j].Account
+	})
+}
+
+// EnableFeed tracks aggregate prices for the dashboard feed,
+// sending at most one update per price account and interval.
+// Run RunPriceFeed to observe prices and serve FeedHandler.
+func (h *Handler) EnableFeed(interval time.Duration) {
+	h.feed = newPriceFeed(interval)
+}
+
+// RunPriceFeed streams price accounts into the dashboard feed
+// and sends coalesced changes to clients.
+// Run it under the publisher supervisor to restart it if the stream fails.
+func (h *Handler) RunPriceFeed(ctx context.Context) error {
+	if h.feed == nil {
+		return errors.New("feed not enabled")
+	}
+	stream := h.client.StreamPriceAccounts()
+	defer stream.Close()
+
+	ticker := time.NewTicker(h.feed.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case entry, ok := <-stream.Updates():
+			if !ok {
+				return stream.Err()
+			}
+			h.feed.observe(entry)
+		case <-ticker.C:
+			h.feed.flush()
+		}
+	}
+}
+
+// FeedHandler serves the dashboard feed as Server-Sent Events.
+//
+// Clients first receive a "snapshot" event listing all known prices,
+// then "update" events listing the prices changed since the last event.
+// Wrap it with jsonrpc.Server.Stream to apply the limits of the RPC listener.
+func (h *Handler) FeedHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if h.feed == nil {
+			http.Error(rw, "Feed not enabled", http.StatusNotFound)
+			return
+		}
+		if req.Method != http.MethodGet {
+			http.Error(rw, "Only GET supported", http.StatusMethodNotAllowed)
+			return
+		}
+		flusher, ok := rw.(http.Flusher)
+		if !ok {
+			http.Error(rw, "Streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		snapshot, client := h.feed.subscribe()
+		defer h.feed.unsubscribe(client)
+
+		rw.Header().Set("content-type", "text/event-stream")
+		rw.Header().Set("cache-control", "no-cache")
+		rw.WriteHeader(http.StatusOK)
+		if err := writeFeedEvent(rw, "snapshot", snapshot); err != nil {
+			return
+		}
+		flusher.Flush()
+		for {
+			select {
+			case <-req.Context().Done():
+				return
+			case <-client.lost:
+				h.Log.Debug("Disconnecting slow feed client", zap.String("remote", req.RemoteAddr))
+				return
+			case batch := <-client.c:
+				if err := writeFeedEvent(rw, "update", batch); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+func writeFeedEvent(rw http.ResponseWriter, event string, updates []feedUpdate) error {
+	data, err := json.Marshal(updates)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("event: ")
+	buf.WriteString(event)
+	buf.WriteString("\ndata: ")
+	buf.Write(data)
+	buf.WriteString("\n\n")
+	_, err = rw.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/jsonrpc"
+	"go.blockdaemon.com/pythian/publisher"
+)
+
+func feedEntry(account solana.PublicKey, price int64, slot uint64) pyth.PriceAccountEntry {
+	acc := new(pyth.PriceAccount)
+	acc.Agg.Price = price
+	acc.Agg.Conf = 2
+	acc.Agg.Status = pyth.PriceStatusTrading
+	acc.Agg.PubSlot = slot
+	return pyth.PriceAccountEntry{PriceAccount: acc, Pubkey: account, Slot: slot}
+}
+
+func TestPriceFeed_Coalesce(t *testing.T) {
+	feed := newPriceFeed(time.Second)
+	a, b := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	feed.setSymbols(map[solana.PublicKey]string{a: "Crypto.BTC/USD"})
+
+	feed.observe(feedEntry(a, 100, 1))
+	snapshot, client := feed.subscribe()
+	require.Len(t, snapshot, 1)
+	assert.Equal(t, feedUpdate{
+		Account: a.String(),
+		Symbol:  "Crypto.BTC/USD",
+		Price:   100,
+		Conf:    2,
+		Status:  "trading",
+		Slot:    1,
+	}, snapshot[0])
+
+	// Only the latest state of each account is sent.
+	feed.observe(feedEntry(a, 101, 2))
+	feed.observe(feedEntry(a, 102, 3))
+	feed.observe(feedEntry(b, 50, 3))
+	feed.flush()
+	batch := <-client.c
+	require.Len(t, batch, 2)
+	byAccount := map[string]feedUpdate{batch[0].Account: batch[0], batch[1].Account: batch[1]}
+	assert.Equal(t, int64(102), byAccount[a.String()].Price)
+	assert.Equal(t, int64(50), byAccount[b.String()].Price)
+
+	// Unchanged accounts are not sent again.
+	feed.observe(feedEntry(a, 102, 3))
+	feed.flush()
+	assert.Empty(t, client.c)
+
+	feed.unsubscribe(client)
+	feed.observe(feedEntry(a, 103, 4))
+	feed.flush()
+	assert.Empty(t, client.c)
+}
+
+func TestPriceFeed_SlowClient(t *testing.T) {
+	feed := newPriceFeed(time.Second)
+	account := solana.NewWallet().PublicKey()
+	_, client := feed.subscribe()
+	for i := 0; i <= feedQueueSize; i++ {
+		feed.observe(feedEntry(account, int64(i), uint64(i)))
+		feed.flush()
+	}
+	select {
+	case <-client.lost:
+	default:
+		t.Fatal("slow client not disconnected")
+	}
+	assert.Empty(t, feed.clients)
+}
+
+func TestHandler_FeedHandler(t *testing.T) {
+	h := newTestHandler(t, new(fakeAccounts), publisher.Options{})
+	h.EnableFeed(time.Second)
+	account := solana.NewWallet().PublicKey()
+	h.feed.observe(feedEntry(account, 100, 1))
+
+	rpcServer := jsonrpc.NewServer(h)
+	rpcServer.MaxConns = 1
+	srv := httptest.NewServer(rpcServer.Stream(h.FeedHandler()))
+	t.Cleanup(srv.Close)
+
+	res, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("content-type"))
+	events := bufio.NewReader(res.Body)
+
+	readEvent := func() (string, []feedUpdate) {
+		t.Helper()
+		var event string
+		var updates []feedUpdate
+		for {
+			line, err := events.ReadString('\n')
+			require.NoError(t, err)
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case line == "":
+				return event, updates
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &updates))
+			}
+		}
+	}
+
+	event, updates := readEvent()
+	assert.Equal(t, "snapshot", event)
+	require.Len(t, updates, 1)
+	assert.Equal(t, int64(100), updates[0].Price)
+
+	// Feed clients count towards the connection limit.
+	limited, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	limited.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, limited.StatusCode)
+
+	h.feed.observe(feedEntry(account, 101, 2))
+	h.feed.flush()
+	event, updates = readEvent()
+	assert.Equal(t, "update", event)
+	require.Len(t, updates, 1)
+	assert.Equal(t, int64(101), updates[0].Price)
+}
+
+func TestHandler_FeedHandler_Origin(t *testing.T) {
+	h := newTestHandler(t, new(fakeAccounts), publisher.Options{})
+	h.EnableFeed(time.Second)
+	srv := httptest.NewServer(jsonrpc.NewServer(h).Stream(h.FeedHandler()))
+	t.Cleanup(srv.Close)
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("origin", "https://evil.example")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"go.blockdaemon.com/pyth"
+)
+
+// ProductFetchStrategy selects how the list of product accounts is fetched.
+//
+// Some RPC providers reject large getProgramAccounts responses,
+// so different strategies may be required depending on the provider.
+type ProductFetchStrategy string
+
+const (
+	ProductFetchAuto     ProductFetchStrategy = "auto"     // probe strategies until one works
+	ProductFetchClient   ProductFetchStrategy = "client"   // Pyth client default
+	ProductFetchFiltered ProductFetchStrategy = "filtered" // getProgramAccounts with dataSize/memcmp filters
+	ProductFetchMapping  ProductFetchStrategy = "mapping"  // mapping account walk, then chunked getMultipleAccounts
+)
+
+// productFetchProbeOrder is the order in which strategies are tried in auto mode.
+var productFetchProbeOrder = []ProductFetchStrategy{
+	ProductFetchFiltered,
+	ProductFetchMapping,
+	ProductFetchClient,
+}
+
+// ParseProductFetchStrategy parses a strategy name.
+func ParseProductFetchStrategy(name string) (ProductFetchStrategy, error) {
+	strategy := ProductFetchStrategy(name)
+	switch strategy {
+	case ProductFetchAuto, ProductFetchClient, ProductFetchFiltered, ProductFetchMapping:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown product fetch strategy %q", name)
+	}
+}
+
+// Pyth v2 product accounts have a fixed size and start with a header
+// consisting of magic, version, and account type.
+const (
+	pythMagic          = 0xa1b2c3d4
+	pythVersion        = 2
+	productAccountSize = 512
+)
+
+type productFetcher func(ctx context.Context) ([]pyth.ProductAccountEntry, error)
+
+// productFetch fetches product accounts with a configurable strategy.
+type productFetch struct {
+	fetchers map[ProductFetchStrategy]productFetcher
+
+	lock     sync.Mutex
+	strategy ProductFetchStrategy
+	detected ProductFetchStrategy // last working strategy in auto mode
+}
+
+func newProductFetch(fetchers map[ProductFetchStrategy]productFetcher) *productFetch {
+	return &productFetch{
+		fetchers: fetchers,
+		strategy: ProductFetchAuto,
+	}
+}
+
+func (f *productFetch) setStrategy(strategy ProductFetchStrategy) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.strategy = strategy
+	f.detected = ""
+}
+
+// fetch returns all product accounts.
+//
+// Errors name the strategies that were attempted.
+func (f *productFetch) fetch(ctx context.Context) ([]pyth.ProductAccountEntry, error) {
+	f.lock.Lock()
+	strategy, detected := f.strategy, f.detected
+	f.lock.Unlock()
+
+	if strategy != ProductFetchAuto {
+		return f.fetchWith(ctx, strategy)
+	}
+	if detected != "" {
+		if products, err := f.fetchWith(ctx, detected); err == nil {
+			return products, nil
+		}
+	}
+
+	var failures []string
+	for _, candidate := range productFetchProbeOrder {
+		products, err := f.fetchWith(ctx, candidate)
+		if err == nil {
+			f.lock.Lock()
+			if f.strategy == ProductFetchAuto {
+				f.detected = candidate
+			}
+			f.lock.Unlock()
+			return products, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		failures = append(failures, err.Error())
+	}
+	return nil, fmt.Errorf("all product fetch strategies failed: %s", strings.Join(failures, "; "))
+}
+
+func (f *productFetch) fetchWith(ctx context.Context, strategy ProductFetchStrategy) ([]pyth.ProductAccountEntry, error) {
+	fetcher, ok := f.fetchers[strategy]
+	if !ok {
+		return nil, fmt.Errorf("product fetch strategy %q not available", strategy)
+	}
+	products, err := fetcher(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("product fetch strategy %q failed: %w", strategy, err)
+	}
+	return products, nil
+}
+
+// getFilteredProductAccounts requests only product accounts from getProgramAccounts.
+//
+// The filters match magic and account type, but neither version nor size,
+// so that accounts of future versions are still listed.
+func (p *pythAccountReader) getFilteredProductAccounts(ctx context.Context) ([]pyth.ProductAccountEntry, error) {
+	magic := make([]byte, 4)
+	binary.LittleEndian.PutUint32(magic, pythMagic)
+	accountType := make([]byte, 4)
+	binary.LittleEndian.PutUint32(accountType, uint32(pyth.AccountTypeProduct))
+
+	res, err := p.client.RPC.GetProgramAccountsWithOpts(ctx, p.client.Env.Program, &rpc.GetProgramAccountsOpts{
+		Commitment: rpc.CommitmentConfirmed,
+		Encoding:   solana.EncodingBase64,
+		Filters: []rpc.RPCFilter{
+			{Memcmp: &rpc.RPCFilterMemcmp{Offset: 0, Bytes: magic}},
+			{Memcmp: &rpc.RPCFilterMemcmp{Offset: 8, Bytes: accountType}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	products := make([]pyth.ProductAccountEntry, 0, len(res))
+	for _, acc := range res {
+		if acc.Account == nil || acc.Account.Data == nil {
+			continue
+		}
+		if product := p.decodeProduct(acc.Pubkey, acc.Account.Data.GetBinary()); product != nil {
+			products = append(products, pyth.ProductAccountEntry{
+				ProductAccount: product,
+				Pubkey:         acc.Pubkey,
+			})
+		}
+	}
+	return products, nil
+}
+
+// getMappedProductAccounts lists product keys from the mapping accounts
+// and fetches them in chunks.
+func (p *pythAccountReader) getMappedProductAccounts(ctx context.Context) ([]pyth.ProductAccountEntry, error) {
+	keys, err := p.client.GetAllProductKeys(ctx, rpc.CommitmentConfirmed)
+	if err != nil {
+		return nil, err
+	}
+	products := make([]pyth.ProductAccountEntry, 0, len(keys))
+	err = p.getMultipleAccounts(ctx, keys, func(key solana.PublicKey, data []byte, slot uint64) error {
+		if data == nil {
+			return nil
+		}
+		if product := p.decodeProduct(key, data); product != nil {
+			products = append(products, pyth.ProductAccountEntry{
+				ProductAccount: product,
+				Pubkey:         key,
+				Slot:           slot,
+			})
+		}
+		return nil
+	})
+	return products, err
+}
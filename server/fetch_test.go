@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pyth"
+)
+
+func TestProductFetch_AutoDetect(t *testing.T) {
+	product := pyth.ProductAccountEntry{Pubkey: solana.NewWallet().PublicKey()}
+	calls := make(map[ProductFetchStrategy]int)
+	fail := func(strategy ProductFetchStrategy) productFetcher {
+		return func(context.Context) ([]pyth.ProductAccountEntry, error) {
+			calls[strategy]++
+			return nil, errors.New("response too large")
+		}
+	}
+	f := newProductFetch(map[ProductFetchStrategy]productFetcher{
+		ProductFetchFiltered: fail(ProductFetchFiltered),
+		ProductFetchMapping: func(context.Context) ([]pyth.ProductAccountEntry, error) {
+			calls[ProductFetchMapping]++
+			return []pyth.ProductAccountEntry{product}, nil
+		},
+		ProductFetchClient: fail(ProductFetchClient),
+	})
+
+	for i := 0; i < 3; i++ {
+		products, err := f.fetch(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []pyth.ProductAccountEntry{product}, products)
+	}
+	// Filtered strategy is probed once, then the working strategy sticks.
+	assert.Equal(t, 1, calls[ProductFetchFiltered])
+	assert.Equal(t, 3, calls[ProductFetchMapping])
+	assert.Equal(t, 0, calls[ProductFetchClient])
+}
+
+func TestProductFetch_ErrorNamesStrategy(t *testing.T) {
+	fail := func(context.Context) ([]pyth.ProductAccountEntry, error) {
+		return nil, errors.New("response too large")
+	}
+	f := newProductFetch(map[ProductFetchStrategy]productFetcher{
+		ProductFetchFiltered: fail,
+		ProductFetchMapping:  fail,
+		ProductFetchClient:   fail,
+	})
+
+	_, err := f.fetch(context.Background())
+	require.Error(t, err)
+	for _, strategy := range []string{"filtered", "mapping", "client"} {
+		assert.Contains(t, err.Error(), `"`+strategy+`"`)
+	}
+
+	f.setStrategy(ProductFetchMapping)
+	_, err = f.fetch(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, `product fetch strategy "mapping" failed: response too large`, err.Error())
+}
@@ -3,100 +3,249 @@ package server
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math"
 	"net"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/rpc"
 	"github.com/mitchellh/mapstructure"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.blockdaemon.com/pyth"
 	"go.blockdaemon.com/pythian/jsonrpc"
+	"go.blockdaemon.com/pythian/publisher"
 	"go.blockdaemon.com/pythian/schedule"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 const (
-	rpcErrUnknownSymbol = -32000
-	rpcErrNotReady      = -32002
+	rpcErrUnknownSymbol   = -32000
+	rpcErrAmbiguousSymbol = -32001
+	rpcErrNotReady        = -32002
+	rpcErrBreakerTripped  = -32004
 )
 
+// Handler is the JSON-RPC front-end of the publisher.
 type Handler struct {
 	*jsonrpc.Mux
-	Log       *zap.Logger
-	client    *pyth.Client
-	buffer    *schedule.Buffer
-	publisher solana.PublicKey
-	slots     *schedule.SlotMonitor
-	subNonce  uint64
+	Log *zap.Logger
+
+	// DecimalPrices adds price_decimal and conf_decimal fields to all price responses.
+	// Clients may also request them individually with the "decimal" param.
+	DecimalPrices bool
+
+	// MinConfirmRate marks the server as degraded in get_health if the share of
+	// confirmed transactions in the shortest stats window drops below it. 0 disables.
+	MinConfirmRate float64
+
+	// MaxDeviation rejects price updates deviating more than this ratio
+	// from the on-chain aggregate price. 0 disables the guard.
+	MaxDeviation float64
+	// DefaultConf is the confidence of price updates omitting conf.
+	// 0 requires conf, unless DefaultConfRatio is set.
+	DefaultConf uint64
+	// DefaultConfRatio derives the confidence of price updates omitting conf
+	// as this ratio of the price. Ignored if DefaultConf is set.
+	DefaultConfRatio float64
+	// AggregateCacheTTL is how long aggregate prices are cached for the deviation guard.
+	AggregateCacheTTL time.Duration
+	// SymbolCacheTTL is how long the product list is cached for symbol lookups.
+	SymbolCacheTTL time.Duration
+
+	// Clock returns the current time, used for cache ages and state dumps.
+	Clock func() time.Time
+	// Version is the server version reported by ping.
+	// Defaults to the module version of the build.
+	Version string
+
+	client   *pyth.Client
+	accounts accountReader
+	products *productFetch   // nil if accounts are not read from the Pyth client
+	static   *staticAccounts // nil unless accounts are pinned by SetStaticAccounts
+	// unparseable lists accounts that failed to decode. Nil if accounts are not read from the Pyth client.
+	unparseable *unparseableAccounts
+	publisher   *publisher.Publisher
+	subNonce    uint64
+
+	aggregates aggregateCache
+	smoother   priceSmoother
+	symbols    symbolCache
+	feed       *priceFeed // nil unless the dashboard feed is enabled
+	dump       *stateDump // nil unless state dumps are enabled
+	gatherer   prometheus.Gatherer
+
+	permissionRefresh time.Duration // 0 unless the permission check is enabled
+	started           time.Time
+
+	subscriptions int64 // active subscriptions
+
+	healthLock   sync.Mutex
+	brokenChains map[solana.PublicKey]string // product => warning
+	cacheTime    time.Time                   // time accounts were last fetched
+}
+
+func NewHandler(client *pyth.Client, publisher *publisher.Publisher) *Handler {
+	reader := newPythAccountReader(client)
+	h := newHandler(client, reader, publisher)
+	h.products = reader.products
+	h.unparseable = &reader.unparseable
+	return h
+}
+
+// SetProductFetchStrategy selects how product accounts are listed.
+// Defaults to ProductFetchAuto.
+func (h *Handler) SetProductFetchStrategy(strategy ProductFetchStrategy) {
+	if h.products != nil {
+		h.products.setStrategy(strategy)
+	}
 }
 
-func NewHandler(
-	client *pyth.Client,
-	updateBuffer *schedule.Buffer,
-	publisher solana.PublicKey,
-	slots *schedule.SlotMonitor,
-) *Handler {
+func newHandler(client *pyth.Client, accounts accountReader, publisher *publisher.Publisher) *Handler {
 	mux := jsonrpc.NewMux()
 	h := &Handler{
 		Mux:       mux,
 		Log:       zap.NewNop(),
+		Clock:     time.Now,
+		Version:   buildVersion(),
 		client:    client,
-		buffer:    updateBuffer,
+		accounts:  accounts,
 		publisher: publisher,
-		slots:     slots,
 		subNonce:  1,
+		gatherer:  prometheus.DefaultGatherer,
+
+		AggregateCacheTTL: 10 * time.Second,
+		SymbolCacheTTL:    time.Minute,
 	}
+	h.started = h.Clock()
 	mux.HandleFunc("get_product_list", h.handleGetProductList)
 	mux.HandleFunc("get_product", h.handleGetProduct)
 	mux.HandleFunc("get_all_products", h.handleGetAllProducts)
 	mux.HandleFunc("update_price", h.handleUpdatePrice)
 	mux.HandleFunc("subscribe_price", h.handleSubscribePrice)
 	mux.HandleFunc("subscribe_price_sched", h.handleSubscribePriceSchedule)
+	mux.HandleFunc("subscribe_account", h.handleSubscribeAccount)
+	mux.HandleFunc("subscribe_lag", h.handleSubscribeLag)
+	mux.HandleFunc("resolve_symbol", h.handleResolveSymbol)
+	mux.HandleFunc("get_health", h.handleGetHealth)
+	mux.HandleFunc("get_stats", h.handleGetStats)
+	mux.HandleFunc("get_status_summary", h.handleGetStatusSummary)
+	mux.HandleFunc("get_my_deviation", h.handleGetMyDeviation)
+	mux.HandleFunc("get_leaders", h.handleGetLeaders)
+	mux.HandleFunc("ping", h.handlePing)
 	return h
 }
 
-func (h *Handler) getAllProductsAndPrices(ctx context.Context) ([]pyth.ProductAccountEntry, map[solana.PublicKey][]pyth.PriceAccountEntry, error) {
-	products, err := h.client.GetAllProductAccounts(ctx, rpc.CommitmentConfirmed)
+func (h *Handler) getAllProductsAndPrices(ctx context.Context) ([]pyth.ProductAccountEntry, map[solana.PublicKey]*priceChain, error) {
+	var products []pyth.ProductAccountEntry
+	var chains map[solana.PublicKey]*priceChain
+	var err error
+	if h.static != nil {
+		products, chains, err = h.static.fetch(ctx, h.accounts)
+	} else {
+		products, err = h.accounts.GetAllProductAccounts(ctx)
+		if err == nil {
+			chains, err = walkPriceChains(ctx, h.accounts, products)
+		}
+	}
 	if err != nil {
 		return nil, nil, err
 	}
-	priceKeys := make([]solana.PublicKey, 0, len(products))
+
+	// Remember broken price account lists for health reports.
+	brokenChains := make(map[solana.PublicKey]string)
+	for product, chain := range chains {
+		if chain.warning != "" {
+			brokenChains[product] = chain.warning
+		}
+	}
+	metricBrokenPriceChains.Set(float64(len(brokenChains)))
+
+	// Let the publisher match breaker rules by symbol.
+	symbols := make(map[solana.PublicKey]string)
 	for _, product := range products {
-		if !product.FirstPrice.IsZero() {
-			priceKeys = append(priceKeys, product.FirstPrice)
+		symbol, ok := product.Attrs.Get("symbol")
+		if !ok {
+			continue
+		}
+		for _, price := range chains[product.Pubkey].prices {
+			symbols[price.Pubkey] = symbol
 		}
 	}
-	prices, err := h.client.GetPriceAccountsRecursive(ctx, rpc.CommitmentConfirmed, priceKeys...)
+	h.publisher.SetSymbols(symbols)
+	h.feed.setSymbols(symbols)
+	h.symbols.set(newSymbolIndex(products), h.Clock())
+	h.healthLock.Lock()
+	h.brokenChains = brokenChains
+	h.cacheTime = h.Clock()
+	h.healthLock.Unlock()
+
+	return products, chains, nil
+}
+
+// WarmUp fetches all product and price accounts, populating caches.
+// Returns the number of products.
+func (h *Handler) WarmUp(ctx context.Context) (int, error) {
+	products, _, err := h.getAllProductsAndPrices(ctx)
 	if err != nil {
-		return nil, nil, err
+		return 0, err
 	}
-	pricesPerProduct := make(map[solana.PublicKey][]pyth.PriceAccountEntry)
-	for _, price := range prices {
-		pricesPerProduct[price.Product] = append(pricesPerProduct[price.Product], price)
+	return len(products), nil
+}
+
+// ComponentAccountCache names the account cache in the publisher supervisor.
+const ComponentAccountCache = "account_cache"
+
+// RunAccountCache discards cached accounts and fetches them again,
+// then holds the cache until the context is cancelled.
+// Run it under the publisher supervisor to make the cache restartable.
+func (h *Handler) RunAccountCache(ctx context.Context) error {
+	h.symbols.clear()
+	n, err := h.WarmUp(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch products: %w", err)
 	}
-	return products, pricesPerProduct, nil
+	h.Log.Info("Fetched products", zap.Int("products", n))
+	<-ctx.Done()
+	return nil
 }
 
 func (h *Handler) handleGetProductList(ctx context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
-	products, pricesPerProduct, err := h.getAllProductsAndPrices(ctx)
+	products, chains, err := h.getAllProductsAndPrices(ctx)
 	if err != nil {
-		return jsonrpc.NewErrorStringResponse(req.ID, rpcErrNotReady, "failed to get products: "+err.Error())
+		return h.notReady(req.ID, "failed to get products: "+err.Error())
 	}
-	products2 := make([]productAccount, len(products))
+	products2 := make(productList, len(products))
 	for i, prod := range products {
-		products2[i] = productToJSON(prod, pricesPerProduct[prod.Pubkey])
+		chain := chains[prod.Pubkey]
+		products2[i] = productToJSON(prod, chain.prices)
+		products2[i].Warning = chain.warning
 	}
 	return jsonrpc.NewResultResponse(req.ID, products2)
 }
 
 func (h *Handler) handleGetAllProducts(ctx context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
-	products, pricesPerProduct, err := h.getAllProductsAndPrices(ctx)
+	// Decode params.
+	var params struct {
+		Decimal bool `json:"decimal"`
+	}
+	if err := decodeParams(req.Params, &params); err != nil {
+		return jsonrpc.NewInvalidParamsResponse(req.ID)
+	}
+
+	products, chains, err := h.getAllProductsAndPrices(ctx)
 	if err != nil {
-		return jsonrpc.NewErrorStringResponse(req.ID, rpcErrNotReady, "failed to get products: "+err.Error())
+		return h.notReady(req.ID, "failed to get products: "+err.Error())
 	}
-	products2 := make([]productAccountDetail, len(products))
+	products2 := make(productDetailList, len(products))
 	for i, prod := range products {
-		products2[i] = productToDetailJSON(prod, pricesPerProduct[prod.Pubkey])
+		chain := chains[prod.Pubkey]
+		products2[i] = productToDetailJSON(prod, chain.prices, h.DecimalPrices || params.Decimal)
+		products2[i].Warning = chain.warning
 	}
 	return jsonrpc.NewResultResponse(req.ID, products2)
 }
@@ -105,82 +254,203 @@ func (h *Handler) handleGetProduct(ctx context.Context, req jsonrpc.Request, _ j
 	// Decode params.
 	var params struct {
 		Account solana.PublicKey `json:"account"`
+		Symbol  string           `json:"symbol"`
+		Decimal bool             `json:"decimal"`
 	}
 	if err := decodeParams(req.Params, &params); err != nil {
 		return jsonrpc.NewInvalidParamsResponse(req.ID)
 	}
+	if params.Account.IsZero() && params.Symbol != "" {
+		match, errResp := h.resolveSymbolUnique(ctx, req.ID, params.Symbol)
+		if errResp != nil {
+			return errResp
+		}
+		params.Account = match.Product
+	}
 
 	// Retrieve data from chain.
-	entry, err := h.client.GetProductAccount(ctx, params.Account, rpc.CommitmentConfirmed)
+	entry, err := h.accounts.GetProductAccount(ctx, params.Account)
 	if errors.Is(err, rpc.ErrNotFound) {
 		return jsonrpc.NewErrorStringResponse(req.ID, rpcErrUnknownSymbol, "unknown symbol")
+	} else if isWrongAccount(err) {
+		return jsonrpc.NewErrorStringResponse(req.ID, rpcErrUnknownSymbol, "not a product account: "+err.Error())
 	} else if err != nil {
-		return jsonrpc.NewErrorStringResponse(req.ID, rpcErrNotReady, "failed to get product: "+err.Error())
+		return h.notReady(req.ID, "failed to get product: "+err.Error())
 	}
-	prices, err := h.client.GetPriceAccountsRecursive(ctx, rpc.CommitmentConfirmed, entry.FirstPrice)
-	if errors.Is(err, rpc.ErrNotFound) {
-		return jsonrpc.NewErrorStringResponse(req.ID, rpcErrUnknownSymbol, "unknown symbol")
-	} else if err != nil {
-		return jsonrpc.NewErrorStringResponse(req.ID, rpcErrNotReady, "failed to get price accs: "+err.Error())
+	chains, err := walkPriceChains(ctx, h.accounts, []pyth.ProductAccountEntry{entry})
+	if err != nil {
+		return h.notReady(req.ID, "failed to get price accs: "+err.Error())
 	}
 
-	return jsonrpc.NewResultResponse(req.ID, productToDetailJSON(entry, prices))
+	chain := chains[entry.Pubkey]
+	product := productToDetailJSON(entry, chain.prices, h.DecimalPrices || params.Decimal)
+	product.Warning = chain.warning
+	return jsonrpc.NewResultResponse(req.ID, product)
 }
 
-func (h *Handler) handleUpdatePrice(_ context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+func (h *Handler) handleResolveSymbol(ctx context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
 	// Decode params.
 	var params struct {
-		Account solana.PublicKey `json:"account"`
-		Price   int64            `json:"price"`
-		Conf    uint64           `json:"conf"`
-		Status  string           `json:"status"`
+		Symbol string `json:"symbol"`
 	}
 	if err := decodeParams(req.Params, &params); err != nil {
 		return jsonrpc.NewInvalidParamsResponse(req.ID)
 	}
-	if params.Account.IsZero() || params.Price == 0 || params.Conf == 0 || params.Status == "" {
+	if params.Symbol == "" {
 		return jsonrpc.NewInvalidParamsResponse(req.ID)
 	}
 
-	// Assemble instruction.
-	update := pyth.CommandUpdPrice{
-		Status:  statusFromString(params.Status),
-		Price:   params.Price,
-		Conf:    params.Conf,
-		PubSlot: h.slots.Slot(),
+	matches, err := h.resolveSymbol(ctx, params.Symbol)
+	if err != nil {
+		return h.notReady(req.ID, "failed to get products: "+err.Error())
 	}
-	ins := pyth.NewInstructionBuilder(h.client.Env.Program).
-		UpdPriceNoFailOnError(h.publisher, params.Account, update)
+	if len(matches) == 0 {
+		return jsonrpc.NewErrorStringResponse(req.ID, rpcErrUnknownSymbol, "unknown symbol")
+	}
+	return jsonrpc.NewResultResponse(req.ID, symbolMatchesToJSON(matches))
+}
 
-	// Push instruction to write buffer. (Will be picked up by scheduler)
-	h.buffer.PushUpdate(ins)
+func (h *Handler) handleUpdatePrice(ctx context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+	// Decode params.
+	var params struct {
+		Account  solana.PublicKey `json:"account"`
+		Price    int64            `json:"price"`
+		Conf     *uint64          `json:"conf"`
+		Status   string           `json:"status"`
+		Override bool             `json:"override"`
+		PubSlot  uint64           `json:"pub_slot"`
+	}
+	if err := decodeParams(req.Params, &params); err != nil {
+		return jsonrpc.NewInvalidParamsResponse(req.ID)
+	}
+	if params.Account.IsZero() || params.Price == 0 || params.Status == "" {
+		return jsonrpc.NewInvalidParamsResponse(req.ID)
+	}
+	var conf uint64
+	if params.Conf != nil {
+		conf = *params.Conf
+	} else {
+		conf = h.defaultConf(params.Price)
+	}
+	if conf == 0 {
+		return jsonrpc.NewInvalidParamsResponse(req.ID)
+	}
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("pyth.price", params.Account.String()),
+		attribute.Int64("solana.slot", int64(h.publisher.Slot())),
+	)
+
+	// Smoothing applies first, so that the deviation check and the breaker
+	// both judge the price that is actually published.
+	status := statusFromString(params.Status)
+	price, avg, smoothed := h.smoother.peek(params.Account, params.Price, status)
+	if smoothed {
+		h.Log.Debug("Smoothed price",
+			zap.Stringer("account", params.Account),
+			zap.Int64("raw_price", params.Price),
+			zap.Int64("price", price))
+	}
+
+	if err := h.checkDeviation(ctx, params.Account, price); err != nil {
+		return jsonrpc.NewErrorResponse(req.ID, jsonrpc.Error{
+			Code:    jsonrpc.ErrCodeInvalidParams,
+			Message: "Invalid Params: " + err.Error(),
+		})
+	}
+
+	// Push update to write buffer. (Will be picked up by scheduler)
+	err := h.publisher.PushPriceWithOpts(params.Account, price, conf, status,
+		publisher.PushOptions{
+			Override:      params.Override,
+			PubSlot:       params.PubSlot,
+			CorrelationID: jsonrpc.CorrelationID(ctx),
+			Span:          span.SpanContext(),
+		})
+	if err != nil {
+		return h.pushError(req.ID, err)
+	}
+	h.smoother.commit(params.Account, status, avg)
 
 	return jsonrpc.NewResultResponse(req.ID, 0)
 }
 
-func (h *Handler) handleSubscribePrice(_ context.Context, req jsonrpc.Request, callback jsonrpc.Requester) *jsonrpc.Response {
+// pushError returns the error response for an update rejected by the publisher.
+func (h *Handler) pushError(id interface{}, err error) *jsonrpc.Response {
+	var breakerErr *publisher.BreakerError
+	if errors.Is(err, publisher.ErrAccountNotAllowed) || errors.Is(err, publisher.ErrFutureSlot) {
+		return jsonrpc.NewErrorResponse(id, jsonrpc.Error{
+			Code:    jsonrpc.ErrCodeInvalidParams,
+			Message: "Invalid Params",
+			Data:    err.Error(),
+		})
+	} else if errors.As(err, &breakerErr) {
+		return jsonrpc.NewErrorResponse(id, jsonrpc.Error{
+			Code:    rpcErrBreakerTripped,
+			Message: err.Error(),
+			Data:    newRetryHint(breakerErr.RetryAfter),
+		})
+	}
+	return h.notReady(id, "failed to push update: "+err.Error())
+}
+
+// defaultConf returns the confidence substituted for updates omitting conf,
+// or 0 if conf is required.
+func (h *Handler) defaultConf(price int64) uint64 {
+	if h.DefaultConf != 0 {
+		return h.DefaultConf
+	}
+	if h.DefaultConfRatio <= 0 {
+		return 0
+	}
+	conf := uint64(math.Round(math.Abs(float64(price)) * h.DefaultConfRatio))
+	if conf == 0 {
+		conf = 1 // zero confidence is invalid
+	}
+	return conf
+}
+
+func (h *Handler) handleSubscribePrice(ctx context.Context, req jsonrpc.Request, callback jsonrpc.Requester) *jsonrpc.Response {
 	if req.ID == nil {
 		return nil
 	}
 
 	// Decode params.
 	var params struct {
-		Account solana.PublicKey `json:"account"`
+		Account   solana.PublicKey `json:"account"`
+		Symbol    string           `json:"symbol"`
+		Decimal   bool             `json:"decimal"`
+		Published bool             `json:"published"`
 	}
 	if err := decodeParams(req.Params, &params); err != nil {
 		return jsonrpc.NewInvalidParamsResponse(req.ID)
 	}
+	if params.Account.IsZero() && params.Symbol != "" {
+		// Subscribe to the first price account of the product.
+		match, errResp := h.resolveSymbolUnique(ctx, req.ID, params.Symbol)
+		if errResp != nil {
+			return errResp
+		}
+		params.Account = match.FirstPrice
+	}
 	if params.Account.IsZero() {
 		return jsonrpc.NewInvalidParamsResponse(req.ID)
 	}
 
 	// Launch new subscription worker.
+	// Subscriptions exempt the connection from the idle timeout.
 	subID := h.newSubID()
-	go h.asyncSubscribePrice(params.Account, callback, subID)
+	release := jsonrpc.KeepActive(callback)
+	h.trackSubscription(callback)
+	go h.asyncSubscribePrice(params.Account, h.DecimalPrices || params.Decimal, callback, subID, release)
+	if params.Published {
+		go h.asyncSubscribePublished(params.Account, callback, subID)
+	}
 	return newSubscriptionResponse(req.ID, subID)
 }
 
-func (h *Handler) asyncSubscribePrice(account solana.PublicKey, callback jsonrpc.Requester, subID uint64) {
+func (h *Handler) asyncSubscribePrice(account solana.PublicKey, decimals bool, callback jsonrpc.Requester, subID uint64, release func()) {
+	defer release()
 	h.Log.Debug("Subscribing to price updates",
 		zap.Stringer("program", h.client.Env.Program),
 		zap.Stringer("price", account))
@@ -200,6 +470,10 @@ func (h *Handler) asyncSubscribePrice(account solana.PublicKey, callback jsonrpc
 			ValidSlot: update.Account.ValidSlot,
 			PubSlot:   update.CurrentInfo.PubSlot,
 		}
+		if decimals {
+			price.PriceDecimal = formatDecimal(price.Price, update.Account.Exponent)
+			price.ConfDecimal = formatDecimalUnsigned(price.Conf, update.Account.Exponent)
+		}
 		err := callback.AsyncRequestJSONRPC(context.Background(), "notify_price", subscriptionUpdate{
 			Result:       &price,
 			Subscription: subID,
@@ -212,6 +486,39 @@ func (h *Handler) asyncSubscribePrice(account solana.PublicKey, callback jsonrpc
 	<-callback.Done()
 }
 
+// asyncSubscribePublished notifies the subscriber of transactions updating the price account,
+// including preliminary notifications at processed commitment if enabled.
+func (h *Handler) asyncSubscribePublished(account solana.PublicKey, callback jsonrpc.Requester, subID uint64) {
+	unsub := h.publisher.SubscribePublished(func(event schedule.PricePublished) {
+		if !containsKey(event.Prices, account) {
+			return
+		}
+		err := callback.AsyncRequestJSONRPC(context.Background(), "notify_price_published", subscriptionUpdate{
+			Result: &pricePublished{
+				Signature:   event.Signature.String(),
+				Status:      string(event.Status),
+				Commitment:  string(event.Commitment),
+				Preliminary: event.Preliminary,
+			},
+			Subscription: subID,
+		})
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			h.Log.Warn("Failed to deliver async publish notification", zap.Error(err))
+		}
+	})
+	defer unsub()
+	<-callback.Done()
+}
+
+func containsKey(keys []solana.PublicKey, key solana.PublicKey) bool {
+	for _, k := range keys {
+		if k.Equals(key) {
+			return true
+		}
+	}
+	return false
+}
+
 func (h *Handler) handleSubscribePriceSchedule(_ context.Context, req jsonrpc.Request, callback jsonrpc.Requester) *jsonrpc.Response {
 	if req.ID == nil {
 		return nil
@@ -230,13 +537,15 @@ func (h *Handler) handleSubscribePriceSchedule(_ context.Context, req jsonrpc.Re
 
 	// Launch new subscription worker.
 	subID := h.newSubID()
+	_ = jsonrpc.KeepActive(callback) // held until the connection closes
+	h.trackSubscription(callback)
 	go h.asyncSubscribePriceSchedule(callback, subID)
 	return newSubscriptionResponse(req.ID, subID)
 }
 
 func (h *Handler) asyncSubscribePriceSchedule(callback jsonrpc.Requester, subID uint64) {
 	var unsub context.CancelFunc
-	unsub = h.slots.Subscribe(func(slot uint64) {
+	unsub = h.publisher.SubscribeSlots(func(slot uint64) {
 		err := callback.AsyncRequestJSONRPC(context.Background(), "notify_price_sched", subscriptionUpdate{
 			Subscription: subID,
 		})
@@ -248,6 +557,29 @@ func (h *Handler) asyncSubscribePriceSchedule(callback jsonrpc.Requester, subID
 	})
 }
 
+// trackSubscription counts a subscription as active until its connection closes.
+func (h *Handler) trackSubscription(callback jsonrpc.Requester) {
+	atomic.AddInt64(&h.subscriptions, 1)
+	go func() {
+		<-callback.Done()
+		atomic.AddInt64(&h.subscriptions, -1)
+	}()
+}
+
+// notReady responds with rpcErrNotReady.
+// While the slot feed warms up, the estimated time until it is ready is added as a retry hint.
+func (h *Handler) notReady(id interface{}, msg string) *jsonrpc.Response {
+	rpcErr := jsonrpc.Error{Code: rpcErrNotReady, Message: msg}
+	if remaining := h.publisher.WarmUpRemaining(); remaining > 0 {
+		rpcErr.Data = newRetryHint(remaining)
+	}
+	return jsonrpc.NewErrorResponse(id, rpcErr)
+}
+
+func newRetryHint(d time.Duration) *retryHint {
+	return &retryHint{RetryAfterMs: (d + time.Millisecond - 1).Milliseconds()}
+}
+
 func newSubscriptionResponse(reqID interface{}, subID uint64) *jsonrpc.Response {
 	var result struct {
 		Subscription uint64 `json:"subscription"`
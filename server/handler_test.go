@@ -0,0 +1,536 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/jsonrpc"
+	"go.blockdaemon.com/pythian/lifecycle"
+	"go.blockdaemon.com/pythian/publisher"
+	"go.blockdaemon.com/pythian/signer/signertest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var testProgram = solana.MustPublicKeyFromBase58("gSbePebfvPy7tRqimPoVecS2UsBvYv46ynrzWocc92s")
+
+// fakeAccounts serves Pyth accounts from memory.
+type fakeAccounts struct {
+	products       []pyth.ProductAccountEntry
+	prices         map[solana.PublicKey]*pyth.PriceAccountEntry
+	priceFetches   int
+	productFetches int
+	productLists   int
+}
+
+func (f *fakeAccounts) GetAllProductAccounts(context.Context) ([]pyth.ProductAccountEntry, error) {
+	f.productLists++
+	return f.products, nil
+}
+
+func (f *fakeAccounts) GetProductAccount(_ context.Context, key solana.PublicKey) (pyth.ProductAccountEntry, error) {
+	f.productFetches++
+	for _, product := range f.products {
+		if product.Pubkey == key {
+			return product, nil
+		}
+	}
+	return pyth.ProductAccountEntry{}, rpc.ErrNotFound
+}
+
+func (f *fakeAccounts) GetPriceAccounts(_ context.Context, keys []solana.PublicKey) ([]*pyth.PriceAccountEntry, error) {
+	f.priceFetches++
+	entries := make([]*pyth.PriceAccountEntry, len(keys))
+	for i, key := range keys {
+		entries[i] = f.prices[key]
+	}
+	return entries, nil
+}
+
+func (f *fakeAccounts) addProduct(firstPrice solana.PublicKey) solana.PublicKey {
+	key := solana.NewWallet().PublicKey()
+	f.products = append(f.products, pyth.ProductAccountEntry{
+		ProductAccount: &pyth.ProductAccount{FirstPrice: firstPrice},
+		Pubkey:         key,
+	})
+	return key
+}
+
+func (f *fakeAccounts) addPrice(key, product, next solana.PublicKey) {
+	if f.prices == nil {
+		f.prices = make(map[solana.PublicKey]*pyth.PriceAccountEntry)
+	}
+	f.prices[key] = &pyth.PriceAccountEntry{
+		PriceAccount: &pyth.PriceAccount{Product: product, Next: next, Exponent: -8},
+		Pubkey:       key,
+	}
+}
+
+func newTestHandler(t *testing.T, accounts accountReader, opts publisher.Options) *Handler {
+	opts.RPCURL = "http://127.0.0.1:0"
+	opts.WebSocketURL = "ws://127.0.0.1:0"
+	opts.Program = testProgram
+	opts.Signer = signertest.New(t, testProgram)
+	pub, err := publisher.New(opts)
+	require.NoError(t, err)
+	client := &pyth.Client{Env: pyth.Env{Program: testProgram}}
+	return newHandler(client, accounts, pub)
+}
+
+func call(t *testing.T, h *Handler, method string, params interface{}) *jsonrpc.Response {
+	resp := h.ServeJSONRPC(context.Background(), jsonrpc.Request{
+		Version: jsonrpc.Version,
+		ID:      1,
+		Method:  method,
+		Params:  params,
+	}, nil)
+	require.NotNil(t, resp)
+	return resp
+}
+
+func TestHandler_BrokenPriceChains(t *testing.T) {
+	accounts := new(fakeAccounts)
+
+	// Healthy product with two prices.
+	priceA1, priceA2 := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	productA := accounts.addProduct(priceA1)
+	accounts.addPrice(priceA1, productA, priceA2)
+	accounts.addPrice(priceA2, productA, solana.PublicKey{})
+
+	// Cyclic price list.
+	priceB1, priceB2 := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	productB := accounts.addProduct(priceB1)
+	accounts.addPrice(priceB1, productB, priceB2)
+	accounts.addPrice(priceB2, productB, priceB1)
+
+	// Dangling next pointer.
+	priceC1, priceC2 := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	productC := accounts.addProduct(priceC1)
+	accounts.addPrice(priceC1, productC, priceC2)
+
+	// Product without prices.
+	productD := accounts.addProduct(solana.PublicKey{})
+
+	h := newTestHandler(t, accounts, publisher.Options{})
+	resp := call(t, h, "get_product_list", nil)
+	require.Nil(t, resp.Error)
+	products := resp.Result.(productList)
+	require.Len(t, products, 4)
+
+	assert.Equal(t, productA.String(), products[0].Account)
+	assert.Len(t, products[0].Prices, 2)
+	assert.Empty(t, products[0].Warning)
+
+	assert.Equal(t, productB.String(), products[1].Account)
+	assert.Len(t, products[1].Prices, 2)
+	assert.Contains(t, products[1].Warning, "cyclic")
+
+	assert.Equal(t, productC.String(), products[2].Account)
+	assert.Len(t, products[2].Prices, 1)
+	assert.Contains(t, products[2].Warning, "dangling")
+
+	assert.Equal(t, productD.String(), products[3].Account)
+	assert.Empty(t, products[3].Prices)
+	assert.Empty(t, products[3].Warning)
+
+	// Broken lists are reported in health.
+	resp = call(t, h, "get_health", nil)
+	require.Nil(t, resp.Error)
+	report := resp.Result.(*healthReport)
+	var broken []string
+	for _, chain := range report.BrokenPriceChains {
+		broken = append(broken, chain.Product)
+	}
+	assert.ElementsMatch(t, []string{productB.String(), productC.String()}, broken)
+}
+
+func TestHandler_GetProductCyclic(t *testing.T) {
+	accounts := new(fakeAccounts)
+	price := solana.NewWallet().PublicKey()
+	product := accounts.addProduct(price)
+	accounts.addPrice(price, product, price) // points to itself
+
+	h := newTestHandler(t, accounts, publisher.Options{})
+	resp := call(t, h, "get_product", map[string]interface{}{"account": product.String()})
+	require.Nil(t, resp.Error)
+	detail := resp.Result.(productAccountDetail)
+	assert.Len(t, detail.PriceAccounts, 1)
+	assert.Contains(t, detail.Warning, "cyclic")
+}
+
+func TestHandler_GetProductDecimal(t *testing.T) {
+	accounts := new(fakeAccounts)
+	price := solana.NewWallet().PublicKey()
+	product := accounts.addProduct(price)
+	accounts.addPrice(price, product, solana.PublicKey{})
+	accounts.prices[price].Agg = pyth.PriceInfo{Price: -2314525000000, Conf: 150000000}
+
+	h := newTestHandler(t, accounts, publisher.Options{})
+	resp := call(t, h, "get_product", map[string]interface{}{"account": product.String()})
+	require.Nil(t, resp.Error)
+	detail := resp.Result.(productAccountDetail)
+	assert.Empty(t, detail.PriceAccounts[0].PriceDecimal)
+	assert.Empty(t, detail.PriceAccounts[0].ConfDecimal)
+
+	resp = call(t, h, "get_product", map[string]interface{}{"account": product.String(), "decimal": true})
+	require.Nil(t, resp.Error)
+	detail = resp.Result.(productAccountDetail)
+	assert.Equal(t, "-23145.25000000", detail.PriceAccounts[0].PriceDecimal)
+	assert.Equal(t, "1.50000000", detail.PriceAccounts[0].ConfDecimal)
+}
+
+func TestHandler_GetStats(t *testing.T) {
+	h := newTestHandler(t, new(fakeAccounts), publisher.Options{
+		StatsWindows: []time.Duration{time.Minute},
+	})
+	require.NoError(t, h.publisher.PushPrice(solana.NewWallet().PublicKey(), 1, 1, pyth.PriceStatusTrading))
+
+	resp := call(t, h, "get_stats", nil)
+	require.Nil(t, resp.Error)
+	report := resp.Result.(*statsReport)
+	require.Len(t, report.Windows, 1)
+	assert.Equal(t, "1m0s", report.Windows[0].Window)
+	assert.Equal(t, uint64(1), report.Windows[0].Counts["updates_accepted"])
+	assert.Nil(t, report.Windows[0].ConfirmRate)
+}
+
+func TestHandler_DeviationGuard(t *testing.T) {
+	accounts := new(fakeAccounts)
+	price := solana.NewWallet().PublicKey()
+	product := accounts.addProduct(price)
+	accounts.addPrice(price, product, solana.PublicKey{})
+	accounts.prices[price].Agg = pyth.PriceInfo{Price: 1000, Conf: 1, Status: pyth.PriceStatusTrading}
+
+	h := newTestHandler(t, accounts, publisher.Options{})
+	update := func(value int64) *jsonrpc.Response {
+		return call(t, h, "update_price", map[string]interface{}{
+			"account": price.String(),
+			"price":   value,
+			"conf":    1,
+			"status":  "trading",
+		})
+	}
+
+	// Disabled by default.
+	assert.Nil(t, update(100000).Error)
+	assert.Zero(t, accounts.priceFetches)
+
+	h.MaxDeviation = 0.1
+	resp := update(100000)
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, jsonrpc.ErrCodeInvalidParams, resp.Error.Code)
+	assert.Contains(t, resp.Error.Message, "9900.00%")
+
+	assert.Nil(t, update(1050).Error)
+	assert.Nil(t, update(950).Error)
+	assert.Equal(t, 1, accounts.priceFetches, "aggregate not cached")
+}
+
+func TestHandler_DefaultConf(t *testing.T) {
+	h := newTestHandler(t, new(fakeAccounts), publisher.Options{})
+	price := solana.NewWallet().PublicKey()
+	update := func(params map[string]interface{}) *jsonrpc.Response {
+		params["account"] = price.String()
+		params["price"] = 20000
+		params["status"] = "trading"
+		params["override"] = true
+		return call(t, h, "update_price", params)
+	}
+	queuedConf := func() uint64 {
+		queued := h.publisher.DebugState().Queued
+		require.Len(t, queued, 1)
+		return queued[0].Conf
+	}
+
+	// Conf is required by default.
+	resp := update(map[string]interface{}{})
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, jsonrpc.ErrCodeInvalidParams, resp.Error.Code)
+
+	h.DefaultConf = 7
+	require.Nil(t, update(map[string]interface{}{}).Error)
+	assert.Equal(t, uint64(7), queuedConf())
+	require.Nil(t, update(map[string]interface{}{"conf": 3}).Error)
+	assert.Equal(t, uint64(3), queuedConf(), "explicit conf replaced")
+	assert.NotNil(t, update(map[string]interface{}{"conf": 0}).Error, "zero conf accepted")
+
+	h.DefaultConf = 0
+	h.DefaultConfRatio = 0.005
+	require.Nil(t, update(map[string]interface{}{}).Error)
+	assert.Equal(t, uint64(100), queuedConf())
+}
+
+func TestHandler_RetryAfter(t *testing.T) {
+	h := newTestHandler(t, new(fakeAccounts), publisher.Options{})
+
+	// Retry once the breaker cools down.
+	resp := h.pushError(1, &publisher.BreakerError{RetryAfter: time.Minute})
+	assert.Equal(t, rpcErrBreakerTripped, resp.Error.Code)
+	require.IsType(t, &retryHint{}, resp.Error.Data)
+	assert.Equal(t, time.Minute.Milliseconds(), resp.Error.Data.(*retryHint).RetryAfterMs)
+
+	// Retry once the slot feed is expected to be warmed up.
+	resp = h.notReady(1, "failed to get products")
+	assert.Equal(t, rpcErrNotReady, resp.Error.Code)
+	require.IsType(t, &retryHint{}, resp.Error.Data)
+	assert.Equal(t, h.publisher.WarmUpRemaining().Milliseconds(), resp.Error.Data.(*retryHint).RetryAfterMs)
+	assert.Positive(t, resp.Error.Data.(*retryHint).RetryAfterMs)
+}
+
+func TestHandler_GetMyDeviation(t *testing.T) {
+	accounts := new(fakeAccounts)
+	price := solana.NewWallet().PublicKey()
+	product := accounts.addProduct(price)
+	accounts.addPrice(price, product, solana.PublicKey{})
+	h := newTestHandler(t, accounts, publisher.Options{})
+
+	entry := accounts.prices[price]
+	entry.Agg = pyth.PriceInfo{Price: 1000, Status: pyth.PriceStatusTrading, PubSlot: 100}
+	entry.Components[0] = pyth.PriceComp{
+		Publisher: solana.NewWallet().PublicKey(),
+		Latest:    pyth.PriceInfo{Price: 1010, Status: pyth.PriceStatusTrading, PubSlot: 99},
+	}
+	getDeviation := func() myDeviation {
+		resp := call(t, h, "get_my_deviation", map[string]interface{}{"account": price.String()})
+		require.Nil(t, resp.Error)
+		return resp.Result.(myDeviation)
+	}
+
+	t.Run("NotComponent", func(t *testing.T) {
+		res := getDeviation()
+		assert.False(t, res.Component)
+		assert.False(t, res.Active)
+		assert.Nil(t, res.AbsDeviation)
+	})
+
+	entry.Components[1] = pyth.PriceComp{
+		Publisher: h.publisher.Pubkey(),
+		Latest:    pyth.PriceInfo{Price: 950, Status: pyth.PriceStatusTrading, PubSlot: 98},
+	}
+	t.Run("Trading", func(t *testing.T) {
+		res := getDeviation()
+		assert.True(t, res.Component)
+		assert.True(t, res.Active)
+		assert.Equal(t, int64(950), *res.Price)
+		assert.Equal(t, int64(50), *res.AbsDeviation)
+		assert.InDelta(t, 5.0, *res.DeviationPercent, 1e-9)
+		assert.True(t, res.Stalest)
+	})
+
+	entry.Components[1].Latest = pyth.PriceInfo{Price: 950, Status: pyth.PriceStatusUnknown, PubSlot: 100}
+	t.Run("Inactive", func(t *testing.T) {
+		res := getDeviation()
+		assert.True(t, res.Component)
+		assert.False(t, res.Active)
+		assert.Equal(t, "unknown", res.Status)
+		assert.Nil(t, res.Price)
+		assert.Nil(t, res.DeviationPercent)
+		assert.False(t, res.Stalest)
+	})
+
+	t.Run("UnknownAccount", func(t *testing.T) {
+		resp := call(t, h, "get_my_deviation", map[string]interface{}{"account": solana.NewWallet().PublicKey().String()})
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, rpcErrUnknownSymbol, resp.Error.Code)
+	})
+}
+
+func TestHandler_DebugState(t *testing.T) {
+	h := newTestHandler(t, new(fakeAccounts), publisher.Options{})
+	price := solana.NewWallet().PublicKey()
+	require.NoError(t, h.publisher.PushPrice(price, 1, 1, pyth.PriceStatusTrading))
+
+	rec := httptest.NewRecorder()
+	h.DebugStateHandler(jsonrpc.NewServer(h)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/state", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var state map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &state))
+	for _, key := range []string{"buffer", "slot", "websockets", "last_flush", "recent_drops"} {
+		assert.Contains(t, state, key)
+	}
+	assert.JSONEq(t, `{"depth":1,"updates":[{"account":"`+price.String()+`","pub_slot":0}]}`, string(state["buffer"]))
+	assert.JSONEq(t, `{"slot":0,"time":null,"age_seconds":null}`, string(state["slot"]))
+	assert.JSONEq(t, `{"slot_stream":"disconnected","confirmer":"disconnected","clients":0}`, string(state["websockets"]))
+	assert.JSONEq(t, `null`, string(state["last_flush"]))
+}
+
+func TestHandler_GetMetrics(t *testing.T) {
+	h := newTestHandler(t, new(fakeAccounts), publisher.Options{})
+	h.EnableAdmin()
+	reg := prometheus.NewRegistry()
+	h.gatherer = reg
+	sent := prometheus.NewCounterVec(prometheus.CounterOpts{Name: metricNameUpdatesSent}, []string{"pyth_price"})
+	dropped := prometheus.NewCounterVec(prometheus.CounterOpts{Name: metricNameDropped}, []string{"pyth_price", "drop_reason"})
+	conns := prometheus.NewGauge(prometheus.GaugeOpts{Name: metricNameWSConns})
+	reg.MustRegister(sent, dropped, conns)
+	sent.WithLabelValues("a").Add(3)
+	sent.WithLabelValues("b").Add(2)
+	dropped.WithLabelValues("a", "stale").Add(1)
+	dropped.WithLabelValues("b", "stale").Add(1)
+	dropped.WithLabelValues("b", "overwritten").Add(4)
+	conns.Set(2)
+	require.NoError(t, h.publisher.PushPrice(solana.NewWallet().PublicKey(), 1, 1, pyth.PriceStatusTrading))
+
+	resp := call(t, h, "get_metrics", nil)
+	require.Nil(t, resp.Error)
+	snapshot := resp.Result.(*metricsSnapshot)
+	assert.Equal(t, uint64(5), snapshot.UpdatesSent)
+	assert.Equal(t, map[string]uint64{"stale": 2, "overwritten": 4}, snapshot.UpdatesDropped)
+	assert.Zero(t, snapshot.TransactionsSent)
+	assert.Equal(t, 2, snapshot.Clients)
+	assert.Equal(t, 1, snapshot.BufferDepth)
+	assert.Nil(t, snapshot.LastFlush)
+	assert.Nil(t, snapshot.SlotLagSeconds)
+	assert.Equal(t, "disconnected", snapshot.SlotStream)
+}
+
+func TestHandler_Reload(t *testing.T) {
+	h := newTestHandler(t, new(fakeAccounts), publisher.Options{})
+	controller := lifecycle.NewController()
+	reloads := 0
+	controller.OnReload(func() { reloads++ })
+	h.EnableReload(controller)
+
+	resp := call(t, h, "reload", nil)
+	require.Nil(t, resp.Error)
+	assert.Equal(t, 1, reloads)
+}
+
+func TestHandler_Smoothing(t *testing.T) {
+	h := newTestHandler(t, new(fakeAccounts), publisher.Options{})
+	smoothed, raw := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	require.Error(t, h.SetSmoothing(smoothed, 0))
+	require.Error(t, h.SetSmoothing(smoothed, 1.5))
+	const alpha = 0.25
+	require.NoError(t, h.SetSmoothing(smoothed, alpha))
+
+	published := func(account solana.PublicKey) int64 {
+		for _, queued := range h.publisher.DebugState().Queued {
+			if queued.Price == account {
+				return queued.Value
+			}
+		}
+		t.Fatalf("no update queued for %s", account)
+		return 0
+	}
+	update := func(account solana.PublicKey, price int64, status string) {
+		resp := call(t, h, "update_price", map[string]interface{}{
+			"account":  account.String(),
+			"price":    price,
+			"conf":     1,
+			"status":   status,
+			"override": true,
+		})
+		require.Nil(t, resp.Error)
+	}
+
+	var ema float64
+	for i, price := range []int64{1000, 2000, 1000, 1600, 1600} {
+		if i == 0 {
+			ema = float64(price)
+		} else {
+			ema = alpha*float64(price) + (1-alpha)*ema
+		}
+		update(smoothed, price, "trading")
+		assert.Equal(t, int64(math.Round(ema)), published(smoothed), "price %d", i)
+
+		update(raw, price, "trading")
+		assert.Equal(t, price, published(raw), "disabled by default")
+	}
+
+	// Halts pass through and restart the average.
+	update(smoothed, 500, "halted")
+	assert.Equal(t, int64(500), published(smoothed))
+	update(smoothed, 3000, "trading")
+	assert.Equal(t, int64(3000), published(smoothed))
+}
+
+func TestHandler_SmoothingRejected(t *testing.T) {
+	price := solana.NewWallet().PublicKey()
+	h := newTestHandler(t, new(fakeAccounts), publisher.Options{
+		AllowedAccounts: []solana.PublicKey{solana.NewWallet().PublicKey()},
+	})
+	require.NoError(t, h.SetSmoothing(price, 0.5))
+	h.smoother.commit(price, pyth.PriceStatusTrading, 1000)
+
+	// The publisher rejects the update after smoothing.
+	resp := call(t, h, "update_price", map[string]interface{}{
+		"account": price.String(),
+		"price":   2000,
+		"conf":    1,
+		"status":  "trading",
+	})
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, jsonrpc.ErrCodeInvalidParams, resp.Error.Code)
+
+	// The rejected spike did not move the average.
+	smoothed, _, ok := h.smoother.peek(price, 1010, pyth.PriceStatusTrading)
+	require.True(t, ok)
+	assert.Equal(t, int64(1005), smoothed)
+}
+
+func TestHandler_GetLeaders(t *testing.T) {
+	h := newTestHandler(t, new(fakeAccounts), publisher.Options{})
+
+	resp := call(t, h, "get_leaders", map[string]interface{}{"limit": -1})
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, jsonrpc.ErrCodeInvalidParams, resp.Error.Code)
+
+	// Not ready before the first slot update.
+	resp = call(t, h, "get_leaders", nil)
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, rpcErrNotReady, resp.Error.Code)
+}
+
+func TestHandler_Tracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	h := newTestHandler(t, new(fakeAccounts), publisher.Options{})
+	h.TracerProvider = provider
+
+	account := solana.NewWallet().PublicKey()
+	resp := call(t, h, "update_price", map[string]interface{}{
+		"account": account.String(),
+		"price":   100,
+		"conf":    1,
+		"status":  "trading",
+	})
+	require.Nil(t, resp.Error)
+	resp = call(t, h, "update_price", map[string]interface{}{"account": account.String()})
+	require.NotNil(t, resp.Error)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	attrs := func(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+		m := make(map[attribute.Key]attribute.Value)
+		for _, kv := range span.Attributes {
+			m[kv.Key] = kv.Value
+		}
+		return m
+	}
+
+	ok := spans[0]
+	assert.Equal(t, "update_price", ok.Name)
+	assert.Equal(t, codes.Unset, ok.Status.Code)
+	assert.Equal(t, "update_price", attrs(ok)["rpc.method"].AsString())
+	assert.Equal(t, account.String(), attrs(ok)["pyth.price"].AsString())
+	assert.Contains(t, attrs(ok), attribute.Key("solana.slot"))
+
+	failed := spans[1]
+	assert.Equal(t, codes.Error, failed.Status.Code)
+	assert.Equal(t, int64(jsonrpc.ErrCodeInvalidParams), attrs(failed)["rpc.jsonrpc.error_code"].AsInt64())
+}
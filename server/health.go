@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go.blockdaemon.com/pythian/jsonrpc"
+	"go.blockdaemon.com/pythian/publisher"
+)
+
+func (h *Handler) handleGetHealth(_ context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+	report := healthReport{
+		Status:     "ok",
+		Slot:       h.publisher.Slot(),
+		Leader:     string(h.publisher.LeaderState()),
+		Components: componentsToJSON(h.publisher.Components()),
+	}
+	if report.Slot == 0 {
+		report.Status = "starting"
+	}
+
+	h.healthLock.Lock()
+	for product, warning := range h.brokenChains {
+		report.BrokenPriceChains = append(report.BrokenPriceChains, brokenPriceChain{
+			Product: product.String(),
+			Warning: warning,
+		})
+	}
+	h.healthLock.Unlock()
+	sort.Slice(report.BrokenPriceChains, func(i, j int) bool {
+		return report.BrokenPriceChains[i].Product < report.BrokenPriceChains[j].Product
+	})
+
+	report.Unparseable = h.unparseable.list()
+
+	for _, tripped := range h.publisher.TrippedBreakers() {
+		report.TrippedBreakers = append(report.TrippedBreakers, trippedBreaker{
+			Account: tripped.Account.String(),
+			Symbol:  tripped.Symbol,
+			Reason:  tripped.Reason,
+			Until:   tripped.Until.UTC().Format(time.RFC3339Nano),
+		})
+	}
+	for _, conflict := range h.publisher.KeyConflicts() {
+		report.KeyConflicts = append(report.KeyConflicts, keyConflict{
+			Account:   conflict.Account.String(),
+			PubSlot:   conflict.PubSlot,
+			SinceSlot: conflict.SinceSlot,
+		})
+	}
+	if warning := h.confirmRateWarning(); warning != "" {
+		report.Warnings = append(report.Warnings, warning)
+	}
+	for _, component := range report.Components {
+		if component.State == string(publisher.ComponentFailed) {
+			report.Warnings = append(report.Warnings, "component "+component.Name+" failed: "+component.Error)
+		}
+	}
+	if (len(report.TrippedBreakers) > 0 || len(report.KeyConflicts) > 0 || len(report.Warnings) > 0) && report.Status == "ok" {
+		report.Status = "degraded"
+	}
+
+	return jsonrpc.NewResultResponse(req.ID, &report)
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"go.blockdaemon.com/pythian/jsonrpc"
+	"go.uber.org/zap"
+)
+
+// defaultLagDebounceSlots is the number of consecutive slots the lag must stay
+// above or below the threshold before subscribe_lag reports a change.
+const defaultLagDebounceSlots = 3
+
+// handleSubscribeLag notifies the client with notify_lag when the publish slot lag,
+// the number of slots since a sent transaction last landed, exceeds a threshold,
+// and once more when it recovered.
+func (h *Handler) handleSubscribeLag(_ context.Context, req jsonrpc.Request, callback jsonrpc.Requester) *jsonrpc.Response {
+	if req.ID == nil {
+		return nil
+	}
+	var params struct {
+		Threshold     uint64  `json:"threshold"`
+		DebounceSlots *uint64 `json:"debounce_slots"`
+	}
+	if err := decodeParams(req.Params, &params); err != nil || params.Threshold == 0 {
+		return jsonrpc.NewInvalidParamsResponse(req.ID)
+	}
+	debounce := uint64(defaultLagDebounceSlots)
+	if params.DebounceSlots != nil {
+		debounce = *params.DebounceSlots
+	}
+
+	subID := h.newSubID()
+	_ = jsonrpc.KeepActive(callback) // held until the connection closes
+	h.trackSubscription(callback)
+	watch := &lagWatch{
+		lagDebouncer: lagDebouncer{threshold: params.Threshold, debounce: debounce},
+		callback:     callback,
+		subID:        subID,
+	}
+	var unsub context.CancelFunc
+	unsub = h.publisher.SubscribeSlots(func(slot uint64) {
+		err := watch.observe(slot, h.publisher.LandedSlot())
+		if errors.Is(err, net.ErrClosed) {
+			go unsub()
+		} else if err != nil {
+			h.Log.Warn("Failed to deliver async lag update", zap.Error(err))
+		}
+	})
+	return newSubscriptionResponse(req.ID, subID)
+}
+
+// lagDebouncer tracks whether the lag exceeds a threshold,
+// changing state only once the lag stayed on the other side for debounce observations.
+type lagDebouncer struct {
+	threshold uint64
+	debounce  uint64
+	lagging   bool
+	streak    uint64 // consecutive observations contradicting the state
+}
+
+// observe records a lag and returns whether the state changed.
+func (d *lagDebouncer) observe(lag uint64) bool {
+	if (lag > d.threshold) == d.lagging {
+		d.streak = 0
+		return false
+	}
+	d.streak++
+	if d.streak < d.debounce {
+		return false
+	}
+	d.lagging = !d.lagging
+	d.streak = 0
+	return true
+}
+
+// lagWatch notifies a subscribed client of lag state changes.
+type lagWatch struct {
+	lock sync.Mutex // slot callbacks may run concurrently
+	lagDebouncer
+	callback jsonrpc.Requester
+	subID    uint64
+}
+
+// observe computes the lag at a slot, notifying the client if the state changed.
+// Nothing is reported before the first transaction landed.
+func (w *lagWatch) observe(slot, landedSlot uint64) error {
+	if landedSlot == 0 {
+		return nil
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	var lag uint64
+	if slot > landedSlot {
+		lag = slot - landedSlot
+	}
+	if !w.lagDebouncer.observe(lag) {
+		return nil
+	}
+	return w.callback.AsyncRequestJSONRPC(context.Background(), "notify_lag", subscriptionUpdate{
+		Result: &lagUpdate{
+			Lagging:   w.lagging,
+			Lag:       lag,
+			Slot:      slot,
+			Threshold: w.threshold,
+		},
+		Subscription: w.subID,
+	})
+}
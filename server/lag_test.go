@@ -0,0 +1,47 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLagWatch(t *testing.T) {
+	callback := &recordingRequester{method: "notify_lag", notifications: make(chan interface{}, 16)}
+	watch := &lagWatch{
+		lagDebouncer: lagDebouncer{threshold: 10, debounce: 3},
+		callback:     callback,
+		subID:        7,
+	}
+	observe := func(slot, landedSlot uint64) {
+		require.NoError(t, watch.observe(slot, landedSlot))
+	}
+
+	// Nothing landed yet.
+	observe(500, 0)
+	// Lag flaps above the threshold without alerting.
+	observe(105, 100)
+	observe(120, 100)
+	observe(121, 100)
+	observe(105, 100)
+	// Lag stays above the threshold.
+	for slot := uint64(120); slot < 126; slot++ {
+		observe(slot, 100)
+	}
+	// Transactions land again.
+	for slot := uint64(201); slot < 206; slot++ {
+		observe(slot, 200)
+	}
+
+	close(callback.notifications)
+	var updates []*lagUpdate
+	for params := range callback.notifications {
+		update := params.(subscriptionUpdate)
+		assert.Equal(t, uint64(7), update.Subscription)
+		updates = append(updates, update.Result.(*lagUpdate))
+	}
+	require.Len(t, updates, 2)
+	assert.Equal(t, &lagUpdate{Lagging: true, Lag: 22, Slot: 122, Threshold: 10}, updates[0])
+	assert.Equal(t, &lagUpdate{Lagging: false, Lag: 3, Slot: 203, Threshold: 10}, updates[1])
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+
+	"go.blockdaemon.com/pythian/jsonrpc"
+)
+
+const (
+	defaultLeadersLimit = 16
+	maxLeadersLimit     = 1024
+)
+
+func (h *Handler) handleGetLeaders(ctx context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+	// Decode params.
+	var params struct {
+		Limit int `json:"limit"`
+	}
+	if err := decodeParams(req.Params, &params); err != nil {
+		return jsonrpc.NewInvalidParamsResponse(req.ID)
+	}
+	if params.Limit == 0 {
+		params.Limit = defaultLeadersLimit
+	}
+	if params.Limit < 0 || params.Limit > maxLeadersLimit {
+		return jsonrpc.NewInvalidParamsResponse(req.ID)
+	}
+
+	leaders, err := h.publisher.UpcomingLeaders(ctx, params.Limit)
+	if err != nil {
+		return h.notReady(req.ID, "failed to get leader schedule: "+err.Error())
+	}
+	result := make([]slotLeader, len(leaders))
+	for i, leader := range leaders {
+		result[i] = slotLeader{
+			Slot:   leader.Slot,
+			Leader: leader.Leader.String(),
+		}
+	}
+	return jsonrpc.NewResultResponse(req.ID, result)
+}
@@ -0,0 +1,21 @@
+package server
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	metricBrokenPriceChains = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "pythian",
+		Subsystem: "pyth",
+		Name:      "broken_price_chains",
+		Help:      "Number of products with a broken price account list",
+	})
+	metricUnparseableAccounts = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "pythian",
+		Subsystem: "pyth",
+		Name:      "unparseable_accounts",
+		Help:      "Number of Pyth accounts skipped because they failed to decode",
+	}, []string{"account_type"})
+)
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"go.uber.org/zap"
+)
+
+// ComponentPermissions names the permission refresh in the publisher supervisor.
+const ComponentPermissions = "permission_refresh"
+
+// EnablePermissionCheck makes RunPermissionRefresh fetch the components
+// of all price accounts every interval, so that updates of price accounts
+// no longer listing our publisher are dropped instead of failing on chain.
+func (h *Handler) EnablePermissionCheck(interval time.Duration) {
+	h.permissionRefresh = interval
+}
+
+// RunPermissionRefresh periodically provides the publisher with the components of price accounts.
+// Failed refreshes keep the previous permissions.
+// Run it under the publisher supervisor.
+func (h *Handler) RunPermissionRefresh(ctx context.Context) error {
+	if h.permissionRefresh <= 0 {
+		return errors.New("permission check not enabled")
+	}
+	ticker := time.NewTicker(h.permissionRefresh)
+	defer ticker.Stop()
+	for {
+		if err := h.refreshPermissions(ctx); err != nil && ctx.Err() == nil {
+			h.Log.Warn("Failed to refresh publisher permissions", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshPermissions fetches all price accounts and passes their components to the publisher.
+func (h *Handler) refreshPermissions(ctx context.Context) error {
+	_, chains, err := h.getAllProductsAndPrices(ctx)
+	if err != nil {
+		return err
+	}
+	components := make(map[solana.PublicKey][]solana.PublicKey)
+	for _, chain := range chains {
+		for _, price := range chain.prices {
+			var publishers []solana.PublicKey
+			for _, comp := range price.Components {
+				if !comp.Publisher.IsZero() {
+					publishers = append(publishers, comp.Publisher)
+				}
+			}
+			components[price.Pubkey] = publishers
+		}
+	}
+	h.publisher.SetPermissions(components)
+	return nil
+}
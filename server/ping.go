@@ -0,0 +1,31 @@
+package server
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	"go.blockdaemon.com/pythian/jsonrpc"
+)
+
+// handlePing answers liveness checks of long-lived clients.
+// It only reads local state and never touches the network.
+func (h *Handler) handlePing(_ context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+	now := h.Clock()
+	return jsonrpc.NewResultResponse(req.ID, &pingResponse{
+		Message:       "pong",
+		Time:          now.UTC().Format(time.RFC3339Nano),
+		UptimeSeconds: now.Sub(h.started).Seconds(),
+		Version:       h.Version,
+	})
+}
+
+// buildVersion returns the module version of the running binary,
+// "(devel)" if unknown, like for builds from a local checkout.
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" {
+		return "(devel)"
+	}
+	return info.Main.Version
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.blockdaemon.com/pythian/publisher"
+)
+
+func TestHandler_Ping(t *testing.T) {
+	accounts := new(fakeAccounts)
+	h := newTestHandler(t, accounts, publisher.Options{})
+	now := h.started.Add(90 * time.Second)
+	h.Clock = func() time.Time { return now }
+	h.Version = "v1.2.3"
+
+	resp := call(t, h, "ping", nil)
+	assert.Nil(t, resp.Error)
+	assert.Equal(t, &pingResponse{
+		Message:       "pong",
+		Time:          now.UTC().Format(time.RFC3339Nano),
+		UptimeSeconds: 90,
+		Version:       "v1.2.3",
+	}, resp.Result)
+	assert.Zero(t, accounts.productLists)
+	assert.Zero(t, accounts.productFetches)
+	assert.Zero(t, accounts.priceFetches)
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.blockdaemon.com/pythian/publisher"
+)
+
+// Preflight validates the configuration before serving.
+//
+// It checks that the endpoints are reachable, the program and publisher
+// accounts exist, and the publisher is permissioned on at least one price account.
+// The returned error lists every failed check.
+func (h *Handler) Preflight(ctx context.Context) error {
+	results := h.publisher.Preflight(ctx)
+	detail, err := h.CheckPermissions(ctx)
+	results = append(results, publisher.CheckResult{Name: "permissions", Detail: detail, Err: err})
+
+	var failures []string
+	for _, result := range results {
+		if result.Err != nil {
+			failures = append(failures, result.Name+": "+result.Err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New("preflight failed: " + strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// CheckPermissions verifies that the publisher key is a component of at least one price account.
+func (h *Handler) CheckPermissions(ctx context.Context) (string, error) {
+	_, chains, err := h.getAllProductsAndPrices(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get products: %w", err)
+	}
+	key := h.publisher.Pubkey()
+	var permitted int
+	for _, chain := range chains {
+		for _, price := range chain.prices {
+			for _, comp := range price.Components {
+				if comp.Publisher == key {
+					permitted++
+					break
+				}
+			}
+		}
+	}
+	if permitted == 0 {
+		return "", fmt.Errorf("publisher %s is not permissioned on any price account", key)
+	}
+	return fmt.Sprintf("publisher %s is permissioned on %d price accounts", key, permitted), nil
+}
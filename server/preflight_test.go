@@ -0,0 +1,36 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pythian/publisher"
+)
+
+func TestHandler_Preflight(t *testing.T) {
+	accounts := new(fakeAccounts)
+	price := solana.NewWallet().PublicKey()
+	product := accounts.addProduct(price)
+	accounts.addPrice(price, product, solana.PublicKey{})
+	accounts.prices[price].Components[0].Publisher = solana.NewWallet().PublicKey()
+
+	h := newTestHandler(t, accounts, publisher.Options{})
+
+	// Misconfigured publisher key, not a component of any price.
+	_, err := h.CheckPermissions(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not permissioned on any price account")
+
+	err = h.Preflight(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "permissions: publisher "+h.publisher.Pubkey().String()+" is not permissioned")
+	assert.Contains(t, err.Error(), "program: ") // no RPC endpoint
+
+	accounts.prices[price].Components[1].Publisher = h.publisher.Pubkey()
+	detail, err := h.CheckPermissions(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, detail, "permissioned on 1 price accounts")
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/gagliardetto/solana-go"
+	"go.blockdaemon.com/pyth"
+)
+
+// priceSmoother applies an exponential moving average to incoming prices.
+//
+// Each smoothed price account has its own alpha, the weight of the newest price.
+// Accounts without an alpha pass through unchanged.
+type priceSmoother struct {
+	lock   sync.Mutex
+	alphas map[solana.PublicKey]float64
+	values map[solana.PublicKey]float64 // current average
+}
+
+// set configures the alpha of a price account and resets its average.
+func (s *priceSmoother) set(account solana.PublicKey, alpha float64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.alphas == nil {
+		s.alphas = make(map[solana.PublicKey]float64)
+		s.values = make(map[solana.PublicKey]float64)
+	}
+	s.alphas[account] = alpha
+	delete(s.values, account)
+}
+
+// peek returns the price to publish and the average to commit once the update was accepted.
+// Returns false if the price passes through unchanged.
+//
+// The first price after startup or a non-trading status seeds the average.
+// Non-trading prices pass through unchanged and reset the average on commit.
+func (s *priceSmoother) peek(account solana.PublicKey, price int64, status uint32) (int64, float64, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	alpha, ok := s.alphas[account]
+	if !ok || status != pyth.PriceStatusTrading {
+		return price, 0, false
+	}
+	avg, ok := s.values[account]
+	if !ok {
+		avg = float64(price)
+	} else {
+		avg = alpha*float64(price) + (1-alpha)*avg
+	}
+	return int64(math.Round(avg)), avg, true
+}
+
+// commit stores the average returned by peek, or resets it for non-trading prices.
+// Updates rejected before queuing are not committed, so they do not move the average.
+func (s *priceSmoother) commit(account solana.PublicKey, status uint32, avg float64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.alphas[account]; !ok {
+		return
+	}
+	if status != pyth.PriceStatusTrading {
+		delete(s.values, account)
+		return
+	}
+	s.values[account] = avg
+}
+
+// SetSmoothing publishes an exponential moving average of the prices of an account
+// instead of the raw prices. Alpha is the weight of the newest price, from 0 (exclusive) to 1.
+func (h *Handler) SetSmoothing(account solana.PublicKey, alpha float64) error {
+	if !(alpha > 0 && alpha <= 1) {
+		return fmt.Errorf("EMA alpha of %s must be in (0, 1], got %v", account, alpha)
+	}
+	h.smoother.set(account, alpha)
+	return nil
+}
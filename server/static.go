@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/gagliardetto/solana-go"
+	"go.blockdaemon.com/pyth"
+)
+
+// StaticProduct is a product account and the price accounts served with it.
+type StaticProduct struct {
+	Product solana.PublicKey   `json:"product"`
+	Prices  []solana.PublicKey `json:"prices"`
+}
+
+// LoadStaticAccounts reads a JSON file listing products and their prices, like:
+//
+//	[{"product": "<pubkey>", "prices": ["<pubkey>", ...]}, ...]
+func LoadStaticAccounts(path string) ([]StaticProduct, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var products []StaticProduct
+	if err := json.Unmarshal(buf, &products); err != nil {
+		return nil, fmt.Errorf("invalid static accounts file: %w", err)
+	}
+	if len(products) == 0 {
+		return nil, errors.New("no products in static accounts file")
+	}
+	for _, product := range products {
+		if product.Product.IsZero() {
+			return nil, errors.New("static accounts file lists product without key")
+		}
+	}
+	return products, nil
+}
+
+// SetStaticAccounts pins the product and price accounts served by the read handlers,
+// instead of listing all product accounts and following their price account lists.
+//
+// Price accounts are fetched for every request. Product accounts are fetched
+// once and cached, unless refresh is set.
+func (h *Handler) SetStaticAccounts(products []StaticProduct, refresh bool) {
+	h.static = &staticAccounts{products: products, refresh: refresh}
+}
+
+// staticAccounts serves a configured set of products and prices.
+type staticAccounts struct {
+	products []StaticProduct
+	refresh  bool
+
+	lock   sync.Mutex
+	cached []pyth.ProductAccountEntry // nil until fetched
+}
+
+// fetch returns the configured products and the price accounts of each.
+// Missing price accounts are reported as chain warnings.
+func (s *staticAccounts) fetch(ctx context.Context, reader accountReader) ([]pyth.ProductAccountEntry, map[solana.PublicKey]*priceChain, error) {
+	products, err := s.getProducts(ctx, reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	var keys []solana.PublicKey
+	for _, product := range s.products {
+		keys = append(keys, product.Prices...)
+	}
+	prices, err := reader.GetPriceAccounts(ctx, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	chains := make(map[solana.PublicKey]*priceChain, len(s.products))
+	for _, product := range s.products {
+		chain := new(priceChain)
+		for _, key := range product.Prices {
+			price := prices[0]
+			prices = prices[1:]
+			if price == nil {
+				chain.warning = "missing price account " + key.String()
+				continue
+			}
+			chain.prices = append(chain.prices, *price)
+		}
+		chains[product.Product] = chain
+	}
+	return products, chains, nil
+}
+
+func (s *staticAccounts) getProducts(ctx context.Context, reader accountReader) ([]pyth.ProductAccountEntry, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.cached != nil && !s.refresh {
+		return s.cached, nil
+	}
+	products := make([]pyth.ProductAccountEntry, len(s.products))
+	for i, product := range s.products {
+		entry, err := reader.GetProductAccount(ctx, product.Product)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get product %s: %w", product.Product, err)
+		}
+		products[i] = entry
+	}
+	s.cached = products
+	return products, nil
+}
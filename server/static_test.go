@@ -0,0 +1,53 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pythian/publisher"
+)
+
+func TestHandler_StaticAccounts(t *testing.T) {
+	accounts := new(fakeAccounts)
+	price1, price2, missing := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	product := accounts.addProduct(price1)
+	accounts.addPrice(price1, product, price2)
+	accounts.addPrice(price2, product, solana.PublicKey{})
+	// Not configured, must not be served.
+	accounts.addProduct(solana.PublicKey{})
+
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{
+		"product": "`+product.String()+`",
+		"prices": ["`+price2.String()+`", "`+missing.String()+`"]
+	}]`), 0600))
+	static, err := LoadStaticAccounts(path)
+	require.NoError(t, err)
+
+	h := newTestHandler(t, accounts, publisher.Options{})
+	h.SetStaticAccounts(static, false)
+	for i := 0; i < 2; i++ {
+		resp := call(t, h, "get_product_list", nil)
+		require.Nil(t, resp.Error)
+		products := resp.Result.(productList)
+		require.Len(t, products, 1)
+		assert.Equal(t, product.String(), products[0].Account)
+		require.Len(t, products[0].Prices, 1)
+		assert.Equal(t, price2.String(), products[0].Prices[0].Account)
+		assert.Contains(t, products[0].Warning, missing.String())
+	}
+	assert.Zero(t, accounts.productLists)
+	assert.Equal(t, 1, accounts.productFetches, "product accounts are cached")
+	assert.Equal(t, 2, accounts.priceFetches)
+
+	// Product accounts are fetched again with refresh.
+	h.SetStaticAccounts(static, true)
+	call(t, h, "get_product_list", nil)
+	call(t, h, "get_product_list", nil)
+	assert.Equal(t, 3, accounts.productFetches)
+	assert.Zero(t, accounts.productLists)
+}
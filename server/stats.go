@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"go.blockdaemon.com/pythian/jsonrpc"
+)
+
+func (h *Handler) handleGetStats(_ context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+	var report statsReport
+	for _, window := range h.publisher.Stats() {
+		report.Windows = append(report.Windows, statsWindow{
+			Window:        window.Window.String(),
+			Seconds:       window.Window.Seconds(),
+			Counts:        window.Counts,
+			PublishRate:   optionalRate(window.PublishRate()),
+			ConfirmRate:   optionalRate(window.ConfirmRate()),
+			TxFailureRate: optionalRate(window.TxFailureRate()),
+		})
+	}
+	p50, ok50 := h.publisher.ConfirmLatency(0.5)
+	p95, ok95 := h.publisher.ConfirmLatency(0.95)
+	if ok50 && ok95 {
+		report.ConfirmLatency = &latencyStats{
+			P50: p50.Seconds(),
+			P95: p95.Seconds(),
+		}
+	}
+	return jsonrpc.NewResultResponse(req.ID, &report)
+}
+
+// confirmRateWarning returns a warning if the confirmation rate over the
+// shortest stats window is below MinConfirmRate.
+func (h *Handler) confirmRateWarning() string {
+	if h.MinConfirmRate <= 0 {
+		return ""
+	}
+	windows := h.publisher.Stats()
+	if len(windows) == 0 {
+		return ""
+	}
+	rate, ok := windows[0].ConfirmRate()
+	if !ok || rate >= h.MinConfirmRate {
+		return ""
+	}
+	return fmt.Sprintf("confirmation rate %.3f below %.3f over %s", rate, h.MinConfirmRate, windows[0].Window)
+}
+
+func optionalRate(rate float64, ok bool) *float64 {
+	if !ok {
+		return nil
+	}
+	return &rate
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/jsonrpc"
+	"go.blockdaemon.com/pythian/schedule"
+	"go.uber.org/zap"
+)
+
+// handleSubscribeAccount streams changes of a product or price account
+// as notify_account notifications until the client disconnects.
+func (h *Handler) handleSubscribeAccount(_ context.Context, req jsonrpc.Request, callback jsonrpc.Requester) *jsonrpc.Response {
+	if req.ID == nil {
+		return nil
+	}
+	var params struct {
+		Account solana.PublicKey `json:"account"`
+	}
+	if err := decodeParams(req.Params, &params); err != nil {
+		return jsonrpc.NewInvalidParamsResponse(req.ID)
+	}
+	if params.Account.IsZero() {
+		return jsonrpc.NewInvalidParamsResponse(req.ID)
+	}
+
+	subID := h.newSubID()
+	release := jsonrpc.KeepActive(callback)
+	h.trackSubscription(callback)
+	go h.asyncSubscribeAccount(params.Account, callback, subID, release)
+	return newSubscriptionResponse(req.ID, subID)
+}
+
+func (h *Handler) asyncSubscribeAccount(account solana.PublicKey, callback jsonrpc.Requester, subID uint64, release func()) {
+	defer release()
+	h.Log.Debug("Subscribing to account updates", zap.Stringer("account", account))
+	defer h.Log.Debug("Unsubscribing from account updates", zap.Stringer("account", account))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		defer cancel()
+		select {
+		case <-callback.Done():
+		case <-ctx.Done():
+		}
+	}()
+
+	// Reconnect until the client goes away.
+	_ = backoff.Retry(func() error {
+		err := h.streamAccount(ctx, account, func(update *accountUpdate) {
+			err := callback.AsyncRequestJSONRPC(ctx, "notify_account", subscriptionUpdate{
+				Result:       update,
+				Subscription: subID,
+			})
+			if err != nil {
+				h.Log.Warn("Failed to deliver async account update", zap.Error(err))
+			}
+		})
+		if ctx.Err() != nil {
+			return backoff.Permanent(ctx.Err())
+		}
+		h.Log.Warn("Account stream failed, restarting", zap.Stringer("account", account), zap.Error(err))
+		return err
+	}, backoff.WithContext(backoff.NewConstantBackOff(schedule.RetryInterval), ctx))
+}
+
+// streamAccount subscribes to an account over WebSocket and
+// passes decoded updates to the callback until the stream fails.
+func (h *Handler) streamAccount(ctx context.Context, account solana.PublicKey, callback func(*accountUpdate)) error {
+	client, err := ws.ConnectWithOptions(ctx, h.client.WebSocketURL, &ws.Options{HttpHeader: h.publisher.WebSocketHeaders()})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// Make sure client cannot outlive context.
+	go func() {
+		defer client.Close()
+		<-ctx.Done()
+	}()
+
+	sub, err := client.AccountSubscribeWithOpts(account, rpc.CommitmentConfirmed, solana.EncodingBase64)
+	if err != nil {
+		return err
+	}
+	for {
+		result, err := sub.Recv()
+		if err != nil {
+			return err
+		} else if result == nil {
+			return net.ErrClosed
+		}
+		if result.Value.Data == nil {
+			continue
+		}
+		update, err := decodeAccountUpdate(account, result.Context.Slot, result.Value.Data.GetBinary())
+		if err != nil {
+			h.Log.Debug("Ignoring account update", zap.Stringer("account", account), zap.Error(err))
+			continue
+		}
+		callback(update)
+	}
+}
+
+// decodeAccountUpdate decodes the data of a changed product or price account.
+func decodeAccountUpdate(account solana.PublicKey, slot uint64, data []byte) (*accountUpdate, error) {
+	update := &accountUpdate{Account: account.String(), Slot: slot}
+	product, err := decodeProductAccount(data)
+	if err == nil {
+		update.Type = "product"
+		update.Product = &productUpdate{
+			AttrDict:   product.Attrs.KVs(),
+			FirstPrice: product.FirstPrice.String(),
+		}
+		return update, nil
+	}
+	var typeErr *accountTypeError
+	if !errors.As(err, &typeErr) {
+		return nil, err
+	}
+	price, err := decodePriceAccount(data)
+	if errors.As(err, &typeErr) {
+		return nil, fmt.Errorf("not a product or price account: %w", err)
+	} else if err != nil {
+		return nil, err
+	}
+	detail := priceToDetailJSON(pyth.PriceAccountEntry{PriceAccount: price, Pubkey: account, Slot: slot})
+	update.Type = "price"
+	update.Price = &detail
+	return update, nil
+}
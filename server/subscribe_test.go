@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/jsonrpc"
+	"go.blockdaemon.com/pythian/publisher"
+)
+
+// mockAccountNode serves accountSubscribe, sending the data passed to updates.
+func mockAccountNode(t *testing.T, account solana.PublicKey, updates <-chan []byte) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var upgrader websocket.Upgrader
+		conn, err := upgrader.Upgrade(rw, req, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var sub struct {
+			ID     uint64        `json:"id"`
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		if err := conn.ReadJSON(&sub); err != nil || sub.Method != "accountSubscribe" {
+			return
+		}
+		assert.Equal(t, account.String(), sub.Params[0])
+		if err := conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": sub.ID, "result": 1}); err != nil {
+			return
+		}
+		for {
+			select {
+			case <-req.Context().Done():
+				return
+			case data := <-updates:
+				err := conn.WriteJSON(map[string]interface{}{
+					"jsonrpc": "2.0",
+					"method":  "accountNotification",
+					"params": map[string]interface{}{
+						"subscription": 1,
+						"result": map[string]interface{}{
+							"context": map[string]interface{}{"slot": 100},
+							"value": map[string]interface{}{
+								"data":     []string{base64.StdEncoding.EncodeToString(data), "base64"},
+								"lamports": 1,
+								"owner":    testProgram.String(),
+							},
+						},
+					},
+				})
+				if err != nil {
+					return
+				}
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// recordingRequester records notifications of a method sent to a client.
+type recordingRequester struct {
+	method        string
+	done          chan struct{}
+	notifications chan interface{}
+}
+
+func (r *recordingRequester) Done() <-chan struct{} {
+	return r.done
+}
+
+func (r *recordingRequester) AsyncRequestJSONRPC(_ context.Context, method string, params interface{}) error {
+	if method == r.method {
+		r.notifications <- params
+	}
+	return nil
+}
+
+func TestHandler_SubscribeAccount(t *testing.T) {
+	price := solana.NewWallet().PublicKey()
+	updates := make(chan []byte)
+	h := newTestHandler(t, new(fakeAccounts), publisher.Options{})
+	h.client.WebSocketURL = mockAccountNode(t, price, updates)
+
+	callback := &recordingRequester{method: "notify_account", done: make(chan struct{}), notifications: make(chan interface{})}
+	defer close(callback.done)
+	resp := h.ServeJSONRPC(context.Background(), jsonrpc.Request{
+		Version: jsonrpc.Version,
+		ID:      1,
+		Method:  "subscribe_account",
+		Params:  map[string]interface{}{"account": price.String()},
+	}, callback)
+	require.Nil(t, resp.Error)
+	subID := resp.Result.(*struct {
+		Subscription uint64 `json:"subscription"`
+	}).Subscription
+
+	// Non-Pyth accounts are not forwarded.
+	updates <- []byte("garbage")
+	updates <- accountFixture(pythMagic, pythVersion, pyth.AccountTypePrice, priceAccountSize)
+	select {
+	case params := <-callback.notifications:
+		update := params.(subscriptionUpdate)
+		assert.Equal(t, subID, update.Subscription)
+		result := update.Result.(*accountUpdate)
+		assert.Equal(t, price.String(), result.Account)
+		assert.Equal(t, uint64(100), result.Slot)
+		assert.Equal(t, "price", result.Type)
+		require.NotNil(t, result.Price)
+		assert.Equal(t, price.String(), result.Price.Account)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for account notification")
+	}
+}
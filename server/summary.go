@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+
+	"github.com/gagliardetto/solana-go"
+	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/jsonrpc"
+	"go.blockdaemon.com/pythian/publisher"
+)
+
+// handleGetStatusSummary counts all price accounts by aggregate trading status,
+// and those whose aggregate was not updated within stale_slots of the current slot.
+func (h *Handler) handleGetStatusSummary(ctx context.Context, req jsonrpc.Request, _ jsonrpc.Requester) *jsonrpc.Response {
+	var params struct {
+		StaleSlots uint64 `json:"stale_slots"`
+	}
+	if err := decodeParams(req.Params, &params); err != nil {
+		return jsonrpc.NewInvalidParamsResponse(req.ID)
+	}
+	if params.StaleSlots == 0 {
+		params.StaleSlots = publisher.DefaultMaxSlotAge
+	}
+
+	_, chains, err := h.getAllProductsAndPrices(ctx)
+	if err != nil {
+		return h.notReady(req.ID, "failed to get products: "+err.Error())
+	}
+	summary := summarizeStatus(chains, h.publisher.Slot(), params.StaleSlots)
+	return jsonrpc.NewResultResponse(req.ID, &summary)
+}
+
+// summarizeStatus counts the price accounts of the chains.
+// Staleness is only counted if the slot is known.
+func summarizeStatus(chains map[solana.PublicKey]*priceChain, slot uint64, staleSlots uint64) statusSummary {
+	summary := statusSummary{Slot: slot}
+	if slot != 0 {
+		summary.Stale = new(int)
+	}
+	for _, chain := range chains {
+		for _, price := range chain.prices {
+			summary.Total++
+			switch price.Agg.Status {
+			case pyth.PriceStatusTrading:
+				summary.Trading++
+			case pyth.PriceStatusHalted:
+				summary.Halted++
+			case pyth.PriceStatusAuction:
+				summary.Auction++
+			default:
+				summary.Unknown++
+			}
+			if slot != 0 && price.Agg.PubSlot+staleSlots < slot {
+				*summary.Stale++
+			}
+		}
+	}
+	return summary
+}
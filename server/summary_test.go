@@ -0,0 +1,60 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/publisher"
+)
+
+func TestSummarizeStatus(t *testing.T) {
+	price := func(status uint32, pubSlot uint64) pyth.PriceAccountEntry {
+		return pyth.PriceAccountEntry{PriceAccount: &pyth.PriceAccount{
+			Agg: pyth.PriceInfo{Status: status, PubSlot: pubSlot},
+		}}
+	}
+	chains := map[solana.PublicKey]*priceChain{
+		solana.NewWallet().PublicKey(): {prices: []pyth.PriceAccountEntry{
+			price(pyth.PriceStatusTrading, 1000),
+			price(pyth.PriceStatusTrading, 960), // stale
+			price(pyth.PriceStatusHalted, 900),  // stale
+		}},
+		solana.NewWallet().PublicKey(): {prices: []pyth.PriceAccountEntry{
+			price(pyth.PriceStatusAuction, 999),
+			price(pyth.PriceStatusUnknown, 968),
+		}},
+		solana.NewWallet().PublicKey(): {},
+	}
+
+	summary := summarizeStatus(chains, 1000, 32)
+	require.NotNil(t, summary.Stale)
+	assert.Equal(t, 2, *summary.Stale)
+	summary.Stale = nil
+	assert.Equal(t, statusSummary{
+		Total:   5,
+		Trading: 2,
+		Halted:  1,
+		Auction: 1,
+		Unknown: 1,
+		Slot:    1000,
+	}, summary)
+
+	// Staleness is unknown without a slot.
+	assert.Nil(t, summarizeStatus(chains, 0, 32).Stale)
+}
+
+func TestHandler_GetStatusSummary(t *testing.T) {
+	accounts := new(fakeAccounts)
+	priceKey := solana.NewWallet().PublicKey()
+	product := accounts.addProduct(priceKey)
+	accounts.addPrice(priceKey, product, solana.PublicKey{})
+	accounts.prices[priceKey].Agg.Status = pyth.PriceStatusTrading
+
+	h := newTestHandler(t, accounts, publisher.Options{})
+	resp := call(t, h, "get_status_summary", nil)
+	require.Nil(t, resp.Error)
+	assert.Equal(t, &statusSummary{Total: 1, Trading: 1}, resp.Result)
+}
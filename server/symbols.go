@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"go.blockdaemon.com/pyth"
+	"go.blockdaemon.com/pythian/jsonrpc"
+)
+
+// symbolMatch is a product matching a symbol.
+type symbolMatch struct {
+	Symbol     string
+	Product    solana.PublicKey
+	FirstPrice solana.PublicKey
+}
+
+// symbolIndex maps human-readable symbols to products.
+//
+// Lookups are case-insensitive and ignore slashes and spaces,
+// so "Crypto.BTC/USD", "crypto.btcusd" and "Crypto.BTC USD" are equivalent.
+// Symbols without an asset class prefix ("BTC/USD") match all asset classes.
+type symbolIndex struct {
+	full map[string][]symbolMatch // normalized symbol => products
+	base map[string][]symbolMatch // normalized symbol without asset class => products
+}
+
+func newSymbolIndex(products []pyth.ProductAccountEntry) symbolIndex {
+	idx := symbolIndex{
+		full: make(map[string][]symbolMatch),
+		base: make(map[string][]symbolMatch),
+	}
+	for _, product := range products {
+		symbol, ok := product.Attrs.Get("symbol")
+		if !ok {
+			continue
+		}
+		idx.add(symbolMatch{
+			Symbol:     symbol,
+			Product:    product.Pubkey,
+			FirstPrice: product.FirstPrice,
+		})
+	}
+	return idx
+}
+
+func (idx symbolIndex) add(match symbolMatch) {
+	key := normalizeSymbol(match.Symbol)
+	idx.full[key] = append(idx.full[key], match)
+	if dot := strings.IndexByte(key, '.'); dot >= 0 {
+		base := key[dot+1:]
+		idx.base[base] = append(idx.base[base], match)
+	}
+}
+
+// lookup returns all products matching a symbol, ordered by symbol.
+// Exact matches of the full symbol take precedence.
+func (idx symbolIndex) lookup(symbol string) []symbolMatch {
+	key := normalizeSymbol(symbol)
+	matches := idx.full[key]
+	if len(matches) == 0 {
+		matches = idx.base[key]
+	}
+	out := make([]symbolMatch, len(matches))
+	copy(out, matches)
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Symbol < out[j].Symbol
+	})
+	return out
+}
+
+func normalizeSymbol(symbol string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(symbol)))
+}
+
+// symbolCache holds the symbol index of the last product list fetch.
+type symbolCache struct {
+	lock    sync.Mutex
+	index   symbolIndex
+	updated time.Time
+}
+
+func (c *symbolCache) set(index symbolIndex, now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.index = index
+	c.updated = now
+}
+
+func (c *symbolCache) clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.index = symbolIndex{}
+	c.updated = time.Time{}
+}
+
+func (c *symbolCache) get(maxAge time.Duration, now time.Time) (symbolIndex, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.updated.IsZero() || now.Sub(c.updated) > maxAge {
+		return symbolIndex{}, false
+	}
+	return c.index, true
+}
+
+// resolveSymbolUnique resolves a symbol to a single product.
+// Returns an error response if the symbol is unknown or ambiguous.
+func (h *Handler) resolveSymbolUnique(ctx context.Context, id interface{}, symbol string) (symbolMatch, *jsonrpc.Response) {
+	matches, err := h.resolveSymbol(ctx, symbol)
+	if err != nil {
+		return symbolMatch{}, h.notReady(id, "failed to get products: "+err.Error())
+	}
+	switch len(matches) {
+	case 0:
+		return symbolMatch{}, jsonrpc.NewErrorStringResponse(id, rpcErrUnknownSymbol, "unknown symbol")
+	case 1:
+		return matches[0], nil
+	default:
+		return symbolMatch{}, jsonrpc.NewErrorResponse(id, jsonrpc.Error{
+			Code:    rpcErrAmbiguousSymbol,
+			Message: "ambiguous symbol",
+			Data:    symbolMatchesToJSON(matches),
+		})
+	}
+}
+
+func symbolMatchesToJSON(matches []symbolMatch) []resolvedSymbol {
+	out := make([]resolvedSymbol, len(matches))
+	for i, match := range matches {
+		out[i] = resolvedSymbol{
+			Symbol:  match.Symbol,
+			Product: match.Product.String(),
+		}
+		if !match.FirstPrice.IsZero() {
+			out[i].Price = match.FirstPrice.String()
+		}
+	}
+	return out
+}
+
+// resolveSymbol returns all products matching a symbol.
+//
+// The product list is refetched if the cached index is older than SymbolCacheTTL.
+func (h *Handler) resolveSymbol(ctx context.Context, symbol string) ([]symbolMatch, error) {
+	index, ok := h.symbols.get(h.SymbolCacheTTL, h.Clock())
+	if !ok {
+		products, _, err := h.getAllProductsAndPrices(ctx)
+		if err != nil {
+			return nil, err
+		}
+		index = newSymbolIndex(products)
+	}
+	return index.lookup(symbol), nil
+}
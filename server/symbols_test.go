@@ -0,0 +1,75 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pythian/jsonrpc"
+	"go.blockdaemon.com/pythian/publisher"
+)
+
+func TestHandler_ResolveSymbol(t *testing.T) {
+	h := newTestHandler(t, new(fakeAccounts), publisher.Options{})
+
+	cryptoBTC := symbolMatch{
+		Symbol:     "Crypto.BTC/USD",
+		Product:    solana.NewWallet().PublicKey(),
+		FirstPrice: solana.NewWallet().PublicKey(),
+	}
+	equityBTC := symbolMatch{
+		Symbol:     "Equity.US.BTC/USD",
+		Product:    solana.NewWallet().PublicKey(),
+		FirstPrice: solana.NewWallet().PublicKey(),
+	}
+	fxBTC := symbolMatch{
+		Symbol:  "FX.BTC/USD",
+		Product: solana.NewWallet().PublicKey(),
+	}
+	index := newSymbolIndex(nil)
+	index.add(cryptoBTC)
+	index.add(equityBTC)
+	index.add(fxBTC)
+	h.symbols.set(index, h.Clock())
+
+	resolve := func(symbol string) []resolvedSymbol {
+		resp := call(t, h, "resolve_symbol", map[string]interface{}{"symbol": symbol})
+		require.Nil(t, resp.Error)
+		return resp.Result.([]resolvedSymbol)
+	}
+
+	t.Run("Normalization", func(t *testing.T) {
+		want := []resolvedSymbol{{
+			Symbol:  "Crypto.BTC/USD",
+			Product: cryptoBTC.Product.String(),
+			Price:   cryptoBTC.FirstPrice.String(),
+		}}
+		for _, symbol := range []string{"Crypto.BTC/USD", "crypto.btc/usd", "CRYPTO.BTCUSD", " Crypto.BTC USD "} {
+			assert.Equal(t, want, resolve(symbol), symbol)
+		}
+	})
+
+	t.Run("Ambiguous", func(t *testing.T) {
+		matches := resolve("btc/usd")
+		require.Len(t, matches, 2)
+		assert.Equal(t, cryptoBTC.Product.String(), matches[0].Product)
+		assert.Equal(t, fxBTC.Product.String(), matches[1].Product)
+		assert.Empty(t, matches[1].Price)
+
+		resp := call(t, h, "get_product", map[string]interface{}{"symbol": "BTC/USD"})
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, rpcErrAmbiguousSymbol, resp.Error.Code)
+		assert.Len(t, resp.Error.Data, 2)
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		resp := call(t, h, "resolve_symbol", map[string]interface{}{"symbol": "Crypto.ETH/USD"})
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, rpcErrUnknownSymbol, resp.Error.Code)
+
+		resp = call(t, h, "resolve_symbol", map[string]interface{}{})
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, jsonrpc.ErrCodeInvalidParams, resp.Error.Code)
+	})
+}
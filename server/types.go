@@ -6,6 +6,7 @@ type productAccount struct {
 	Account  string            `json:"account"`
 	AttrDict map[string]string `json:"attr_dict"`
 	Prices   []priceAccount    `json:"price"`
+	Warning  string            `json:"warning,omitempty"`
 }
 
 type priceAccount struct {
@@ -14,10 +15,17 @@ type priceAccount struct {
 	PriceType     string `json:"price_type"`
 }
 
+type resolvedSymbol struct {
+	Symbol  string `json:"symbol"`
+	Product string `json:"product"`
+	Price   string `json:"price,omitempty"`
+}
+
 type productAccountDetail struct {
 	Account       string               `json:"account"`
 	AttrDict      map[string]string    `json:"attr_dict"`
 	PriceAccounts []priceAccountDetail `json:"price_accounts"`
+	Warning       string               `json:"warning,omitempty"`
 }
 
 type priceAccountDetail struct {
@@ -27,6 +35,8 @@ type priceAccountDetail struct {
 	Status            string             `json:"status"`
 	Price             int64              `json:"price"`
 	Conf              int64              `json:"conf"`
+	PriceDecimal      string             `json:"price_decimal,omitempty"`
+	ConfDecimal       string             `json:"conf_decimal,omitempty"`
 	EmaPrice          int64              `json:"ema_price"`
 	EmaConfidence     int64              `json:"ema_confidence"`
 	ValidSlot         uint64             `json:"valid_slot"`
@@ -51,11 +61,258 @@ type subscriptionUpdate struct {
 }
 
 type priceUpdate struct {
-	Price     int64  `json:"price"`
-	Conf      uint64 `json:"conf"`
-	Status    string `json:"status"`
-	ValidSlot uint64 `json:"valid_slot"`
-	PubSlot   uint64 `json:"pub_slot"`
+	Price        int64  `json:"price"`
+	Conf         uint64 `json:"conf"`
+	PriceDecimal string `json:"price_decimal,omitempty"`
+	ConfDecimal  string `json:"conf_decimal,omitempty"`
+	Status       string `json:"status"`
+	ValidSlot    uint64 `json:"valid_slot"`
+	PubSlot      uint64 `json:"pub_slot"`
+}
+
+// accountUpdate notifies a subscriber of a changed product or price account.
+type accountUpdate struct {
+	Account string              `json:"account"`
+	Slot    uint64              `json:"slot"`
+	Type    string              `json:"type"` // "product" or "price"
+	Product *productUpdate      `json:"product,omitempty"`
+	Price   *priceAccountDetail `json:"price,omitempty"`
+}
+
+type productUpdate struct {
+	AttrDict   map[string]string `json:"attr_dict"`
+	FirstPrice string            `json:"first_price"`
+}
+
+// metricsSnapshot summarizes the key metrics for get_metrics.
+type metricsSnapshot struct {
+	UpdatesSent      uint64            `json:"updates_sent"`
+	UpdatesDropped   map[string]uint64 `json:"updates_dropped"` // by drop reason
+	TransactionsSent uint64            `json:"transactions_sent"`
+	BufferDepth      int               `json:"buffer_depth"`
+	LastFlush        *string           `json:"last_flush"`
+	Slot             uint64            `json:"slot"`
+	SlotLagSeconds   *float64          `json:"slot_lag_seconds"` // time since the latest slot update
+	SlotStream       string            `json:"slot_stream"`
+	Confirmer        string            `json:"confirmer"`
+	Clients          int               `json:"clients"`
+}
+
+// statusSummary counts price accounts by aggregate status for get_status_summary.
+type statusSummary struct {
+	Total   int    `json:"total"`
+	Trading int    `json:"trading"`
+	Halted  int    `json:"halted"`
+	Auction int    `json:"auction"`
+	Unknown int    `json:"unknown"`
+	Stale   *int   `json:"stale"` // aggregate older than stale_slots, null if the slot is unknown
+	Slot    uint64 `json:"slot"`
+}
+
+// pingResponse is the result of ping.
+type pingResponse struct {
+	Message       string  `json:"message"` // always "pong"
+	Time          string  `json:"time"`
+	UptimeSeconds float64 `json:"uptime_seconds"`
+	Version       string  `json:"version"`
+}
+
+// lagUpdate is a notify_lag notification, sent when the publish slot lag
+// exceeds the subscribed threshold and when it recovered.
+type lagUpdate struct {
+	Lagging   bool   `json:"lagging"`
+	Lag       uint64 `json:"lag"` // slots since a sent transaction last landed
+	Slot      uint64 `json:"slot"`
+	Threshold uint64 `json:"threshold"`
+}
+
+// feeEstimate is the expected fee of sending the queued updates, in lamports.
+type feeEstimate struct {
+	Transactions int    `json:"transactions"`
+	BaseFee      uint64 `json:"base_fee"`
+	PriorityFee  uint64 `json:"priority_fee"`
+	Total        uint64 `json:"total"`
+}
+
+// retryHint is the error data of responses suggesting when to retry.
+type retryHint struct {
+	RetryAfterMs int64 `json:"retry_after_ms"`
+}
+
+// slotLeader is the validator scheduled to produce a slot.
+type slotLeader struct {
+	Slot   uint64 `json:"slot"`
+	Leader string `json:"leader"`
+}
+
+// feedUpdate is the aggregate state of a price account in the dashboard feed.
+type feedUpdate struct {
+	Account string `json:"account"`
+	Symbol  string `json:"symbol,omitempty"`
+	Price   int64  `json:"price"`
+	Conf    uint64 `json:"conf"`
+	Status  string `json:"status"`
+	Slot    uint64 `json:"slot"`
+}
+
+// pricePublished notifies a subscriber of a sent transaction updating the price.
+type pricePublished struct {
+	Signature   string `json:"signature"`
+	Status      string `json:"status"`
+	Commitment  string `json:"commitment,omitempty"`
+	Preliminary bool   `json:"preliminary"`
+}
+
+// myDeviation compares our component price to the aggregate of a price account.
+type myDeviation struct {
+	Account          string   `json:"account"`
+	Publisher        string   `json:"publisher"`
+	Component        bool     `json:"component"` // publisher is a component of the price account
+	Active           bool     `json:"active"`    // component is trading
+	Status           string   `json:"status"`
+	Price            *int64   `json:"price"`
+	PubSlot          uint64   `json:"pub_slot"`
+	AggregatePrice   int64    `json:"aggregate_price"`
+	AggregateSlot    uint64   `json:"aggregate_slot"`
+	AbsDeviation     *int64   `json:"abs_deviation"`
+	DeviationPercent *float64 `json:"deviation_percent"`
+	Stalest          bool     `json:"stalest"` // no other component published less recently
+}
+
+type healthReport struct {
+	Status            string               `json:"status"`
+	Slot              uint64               `json:"slot"`
+	Leader            string               `json:"leader,omitempty"`
+	Components        []componentStatus    `json:"components,omitempty"`
+	BrokenPriceChains []brokenPriceChain   `json:"broken_price_chains,omitempty"`
+	Unparseable       []unparseableAccount `json:"unparseable_accounts,omitempty"`
+	TrippedBreakers   []trippedBreaker     `json:"tripped_breakers,omitempty"`
+	KeyConflicts      []keyConflict        `json:"key_conflicts,omitempty"`
+	Warnings          []string             `json:"warnings,omitempty"`
+}
+
+type componentStatus struct {
+	Name     string `json:"name"`
+	State    string `json:"state"`
+	Restarts int    `json:"restarts"`
+	Error    string `json:"error,omitempty"`
+}
+
+type brokenPriceChain struct {
+	Product string `json:"product"`
+	Warning string `json:"warning"`
+}
+
+// unparseableAccount is an account skipped because it failed to decode.
+type unparseableAccount struct {
+	Account string `json:"account"`
+	Type    string `json:"type"`
+	Error   string `json:"error"`
+}
+
+type trippedBreaker struct {
+	Account string `json:"account"`
+	Symbol  string `json:"symbol,omitempty"`
+	Reason  string `json:"reason"`
+	Until   string `json:"until"`
+}
+
+// keyConflict is a price account updated by another publisher with our key.
+type keyConflict struct {
+	Account   string `json:"account"`
+	PubSlot   uint64 `json:"pub_slot"`   // latest pub slot not published by us
+	SinceSlot uint64 `json:"since_slot"` // slot the conflict was first observed
+}
+
+type statsReport struct {
+	Windows        []statsWindow `json:"windows"`
+	ConfirmLatency *latencyStats `json:"confirm_latency,omitempty"`
+}
+
+type statsWindow struct {
+	Window        string            `json:"window"`
+	Seconds       float64           `json:"seconds"`
+	Counts        map[string]uint64 `json:"counts"`
+	PublishRate   *float64          `json:"publish_rate"`
+	ConfirmRate   *float64          `json:"confirm_rate"`
+	TxFailureRate *float64          `json:"tx_failure_rate"`
+}
+
+type latencyStats struct {
+	P50 float64 `json:"p50_seconds"`
+	P95 float64 `json:"p95_seconds"`
+}
+
+type droppedUpdate struct {
+	Time    string `json:"time"`
+	Account string `json:"account"`
+	PubSlot uint64 `json:"pub_slot"`
+	Reason  string `json:"reason"`
+}
+
+type faultState struct {
+	DropSendPercent float64 `json:"drop_send_percent"`
+	SendDelayMs     uint64  `json:"send_delay_ms"`
+	Read429Percent  float64 `json:"read_429_percent"`
+	StallSlotsUntil string  `json:"stall_slots_until,omitempty"`
+}
+
+type debugState struct {
+	Buffer      debugBuffer     `json:"buffer"`
+	Slot        debugSlot       `json:"slot"`
+	WebSockets  debugWebSockets `json:"websockets"`
+	LastFlush   *string         `json:"last_flush"`
+	RecentDrops []droppedUpdate `json:"recent_drops"`
+}
+
+// stateSnapshot is the content of a state dump.
+type stateSnapshot struct {
+	Time                 string            `json:"time"`
+	Slot                 debugSlot         `json:"slot"`
+	Buffer               dumpBuffer        `json:"buffer"`
+	LastFlush            *string           `json:"last_flush"`
+	PendingConfirmations int               `json:"pending_confirmations"`
+	AccountCacheAge      *float64          `json:"account_cache_age_seconds"`
+	Subscriptions        int               `json:"subscriptions"`
+	WebSockets           debugWebSockets   `json:"websockets"`
+	Components           []componentStatus `json:"components"`
+	RecentErrors         []recentError     `json:"recent_errors"`
+}
+
+// dumpBuffer summarizes the queued updates.
+type dumpBuffer struct {
+	Depth         int     `json:"depth"`
+	OldestPubSlot *uint64 `json:"oldest_pub_slot"`
+	NewestPubSlot *uint64 `json:"newest_pub_slot"`
+}
+
+type recentError struct {
+	Time      string `json:"time"`
+	Component string `json:"component"`
+	Message   string `json:"message"`
+	Error     string `json:"error,omitempty"`
+}
+
+type debugBuffer struct {
+	Depth   int           `json:"depth"`
+	Updates []queuedPrice `json:"updates"`
+}
+
+type queuedPrice struct {
+	Account string `json:"account"`
+	PubSlot uint64 `json:"pub_slot"`
+}
+
+type debugSlot struct {
+	Slot       uint64   `json:"slot"`
+	Time       *string  `json:"time"`
+	AgeSeconds *float64 `json:"age_seconds"`
+}
+
+type debugWebSockets struct {
+	SlotStream string `json:"slot_stream"`
+	Confirmer  string `json:"confirmer"`
+	Clients    int    `json:"clients"`
 }
 
 func productToJSON(product pyth.ProductAccountEntry, prices []pyth.PriceAccountEntry) productAccount {
@@ -78,7 +335,9 @@ func priceToJSON(price pyth.PriceAccountEntry) priceAccount {
 	}
 }
 
-func productToDetailJSON(product pyth.ProductAccountEntry, prices []pyth.PriceAccountEntry) productAccountDetail {
+// productToDetailJSON converts a product and its prices.
+// If decimals is set, prices are additionally formatted as decimal strings.
+func productToDetailJSON(product pyth.ProductAccountEntry, prices []pyth.PriceAccountEntry, decimals bool) productAccountDetail {
 	acc := productAccountDetail{
 		Account:       product.Pubkey.String(),
 		AttrDict:      product.Attrs.KVs(),
@@ -86,6 +345,10 @@ func productToDetailJSON(product pyth.ProductAccountEntry, prices []pyth.PriceAc
 	}
 	for i, price := range prices {
 		acc.PriceAccounts[i] = priceToDetailJSON(price)
+		if decimals {
+			acc.PriceAccounts[i].PriceDecimal = formatDecimal(price.Agg.Price, price.Exponent)
+			acc.PriceAccounts[i].ConfDecimal = formatDecimalUnsigned(price.Agg.Conf, price.Exponent)
+		}
 	}
 	return acc
 }
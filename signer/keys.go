@@ -0,0 +1,136 @@
+package signer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// Private key loading errors.
+var (
+	ErrKeyNotFound   = errors.New("private key not found")
+	ErrKeyUnparsable = errors.New("private key unparsable")
+)
+
+// CredentialName is the name of the systemd credential holding the private key,
+// e.g. "LoadCredential=publisher-key:/etc/pythian/publisher.json".
+const CredentialName = "publisher-key"
+
+// LoadPrivateKey loads a private key from a source:
+//
+//   - "fd://N" reads the inherited file descriptor N until EOF.
+//   - "env://NAME" reads the environment variable NAME, which is unset afterwards.
+//   - "" discovers CredentialName in the systemd credentials directory ($CREDENTIALS_DIRECTORY).
+//   - Any other source is a file path.
+//
+// Keys are either a JSON array of bytes (solana-keygen format) or a base58 string.
+// Errors wrap ErrKeyNotFound or ErrKeyUnparsable.
+func LoadPrivateKey(source string) (solana.PrivateKey, error) {
+	raw, err := readPrivateKey(source)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(raw)
+	key, err := parsePrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrKeyUnparsable, describeSource(source), err)
+	}
+	return key, nil
+}
+
+func readPrivateKey(source string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(source, "fd://"):
+		fd, err := strconv.ParseUint(strings.TrimPrefix(source, "fd://"), 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key source %q: %w", source, err)
+		}
+		f := os.NewFile(uintptr(fd), source)
+		if f == nil {
+			return nil, fmt.Errorf("%w: %s is not a valid file descriptor", ErrKeyNotFound, source)
+		}
+		defer f.Close()
+		raw, err := io.ReadAll(f)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read %s: %v", ErrKeyNotFound, source, err)
+		}
+		return raw, nil
+	case strings.HasPrefix(source, "env://"):
+		name := strings.TrimPrefix(source, "env://")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: environment variable %s not set", ErrKeyNotFound, name)
+		}
+		// Do not leak the key to child processes.
+		_ = os.Unsetenv(name)
+		return []byte(value), nil
+	case source == "":
+		dir, ok := os.LookupEnv("CREDENTIALS_DIRECTORY")
+		if !ok {
+			return nil, fmt.Errorf("%w: no private key configured and no systemd credentials directory", ErrKeyNotFound)
+		}
+		return readPrivateKeyFile(filepath.Join(dir, CredentialName))
+	default:
+		return readPrivateKeyFile(strings.TrimPrefix(source, "file://"))
+	}
+}
+
+func readPrivateKeyFile(path string) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s does not exist", ErrKeyNotFound, path)
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyNotFound, err)
+	}
+	return raw, nil
+}
+
+func parsePrivateKey(raw []byte) (solana.PrivateKey, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 {
+		return nil, errors.New("empty key")
+	}
+	if trimmed[0] == '[' {
+		var ints []byte
+		if err := json.Unmarshal(trimmed, &ints); err != nil {
+			return nil, fmt.Errorf("invalid JSON key: %w", err)
+		}
+		defer zero(ints)
+		return checkPrivateKey(append(solana.PrivateKey(nil), ints...))
+	}
+	key, err := solana.PrivateKeyFromBase58(string(trimmed))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base58 key: %w", err)
+	}
+	return checkPrivateKey(key)
+}
+
+func checkPrivateKey(key solana.PrivateKey) (solana.PrivateKey, error) {
+	if len(key) != 64 {
+		zero(key)
+		return nil, fmt.Errorf("expected 64 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// describeSource names a key source for errors, without revealing secrets.
+func describeSource(source string) string {
+	if source == "" {
+		return "systemd credential " + CredentialName
+	}
+	return source
+}
+
+func zero(buf []byte) {
+	for i := range buf {
+		buf[i] = 0
+	}
+}
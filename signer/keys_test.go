@@ -0,0 +1,104 @@
+package signer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKey(t *testing.T) (key solana.PrivateKey, keyJSON []byte) {
+	key, err := solana.NewRandomPrivateKey()
+	require.NoError(t, err)
+	keyInts := make([]int, len(key))
+	for i, b := range key {
+		keyInts[i] = int(b)
+	}
+	keyJSON, err = json.Marshal(keyInts)
+	require.NoError(t, err)
+	return key, keyJSON
+}
+
+func TestLoadPrivateKey(t *testing.T) {
+	key, keyJSON := newTestKey(t)
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "key.json")
+	require.NoError(t, os.WriteFile(jsonPath, keyJSON, 0600))
+	base58Path := filepath.Join(dir, "key.txt")
+	require.NoError(t, os.WriteFile(base58Path, []byte(key.String()+"\n"), 0600))
+
+	t.Run("File", func(t *testing.T) {
+		loaded, err := LoadPrivateKey(jsonPath)
+		require.NoError(t, err)
+		assert.Equal(t, key, loaded)
+
+		loaded, err = LoadPrivateKey("file://" + base58Path)
+		require.NoError(t, err)
+		assert.Equal(t, key, loaded)
+	})
+
+	t.Run("FD", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		_, err = w.Write(keyJSON)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		loaded, err := LoadPrivateKey(fmt.Sprintf("fd://%d", r.Fd()))
+		require.NoError(t, err)
+		assert.Equal(t, key, loaded)
+	})
+
+	t.Run("Env", func(t *testing.T) {
+		t.Setenv("PYTHIAN_TEST_KEY", string(keyJSON))
+		loaded, err := LoadPrivateKey("env://PYTHIAN_TEST_KEY")
+		require.NoError(t, err)
+		assert.Equal(t, key, loaded)
+		_, ok := os.LookupEnv("PYTHIAN_TEST_KEY")
+		assert.False(t, ok, "key not removed from environment")
+
+		t.Setenv("PYTHIAN_TEST_KEY", key.String())
+		loaded, err = LoadPrivateKey("env://PYTHIAN_TEST_KEY")
+		require.NoError(t, err)
+		assert.Equal(t, key, loaded)
+	})
+
+	t.Run("Credentials", func(t *testing.T) {
+		credDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(credDir, CredentialName), keyJSON, 0600))
+		t.Setenv("CREDENTIALS_DIRECTORY", credDir)
+		loaded, err := LoadPrivateKey("")
+		require.NoError(t, err)
+		assert.Equal(t, key, loaded)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		_, err := LoadPrivateKey(filepath.Join(dir, "missing.json"))
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+		_, err = LoadPrivateKey("env://PYTHIAN_TEST_MISSING")
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+
+		t.Setenv("CREDENTIALS_DIRECTORY", t.TempDir())
+		_, err = LoadPrivateKey("")
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+	})
+
+	t.Run("Unparsable", func(t *testing.T) {
+		for name, content := range map[string]string{
+			"garbage":  "not a key",
+			"short":    "[1,2,3]",
+			"overflow": "[256]",
+			"empty":    "\n",
+		} {
+			t.Setenv("PYTHIAN_TEST_KEY", content)
+			_, err := LoadPrivateKey("env://PYTHIAN_TEST_KEY")
+			assert.ErrorIs(t, err, ErrKeyUnparsable, name)
+			assert.NotErrorIs(t, err, ErrKeyNotFound, name)
+		}
+	})
+}
@@ -2,9 +2,12 @@
 package signer
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
 
 	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
 )
 
 // Signer signs Solana transactions carrying Pyth price updates.
@@ -14,9 +17,10 @@ type Signer struct {
 	pythProgram solana.PublicKey
 }
 
-// NewSigner loads the unencrypted private key from the provided file.
-func NewSigner(privateKeyPath string, pythProgram solana.PublicKey) (*Signer, error) {
-	pk, err := solana.PrivateKeyFromSolanaKeygenFile(privateKeyPath)
+// NewSigner loads the unencrypted private key from the provided source.
+// See LoadPrivateKey for supported sources.
+func NewSigner(privateKeySource string, pythProgram solana.PublicKey) (*Signer, error) {
+	pk, err := LoadPrivateKey(privateKeySource)
 	if err != nil {
 		return nil, err
 	}
@@ -39,6 +43,21 @@ func (s *Signer) Close() {
 	}
 }
 
+// ComputeBudgetProgramID is the native program setting compute unit limits and prices.
+var ComputeBudgetProgramID = solana.MustPublicKeyFromBase58("ComputeBudget111111111111111111111111111111")
+
+// Compute budget instructions allowed in price update transactions.
+const (
+	ComputeBudgetSetUnitLimit = 2
+	ComputeBudgetSetUnitPrice = 3
+)
+
+// IsAdvanceNonce returns whether the data of a system program instruction
+// encodes AdvanceNonceAccount.
+func IsAdvanceNonce(data []byte) bool {
+	return len(data) == 4 && binary.LittleEndian.Uint32(data) == system.Instruction_AdvanceNonceAccount
+}
+
 // SignPriceUpdate signs Pyth price update operations.
 func (s *Signer) SignPriceUpdate(tx *solana.Transaction) error {
 	// Verify instructions.
@@ -60,8 +79,22 @@ func (s *Signer) SignPriceUpdate(tx *solana.Transaction) error {
 			}
 		*/
 		// Reject if requested sig for unknown program instruction.
+		// Memos are allowed to tag transactions, compute budget instructions
+		// to pay priority fees, and advancing a durable nonce to send with it.
 		requestedProgram := tx.Message.AccountKeys[op.ProgramIDIndex]
-		if !requestedProgram.Equals(s.pythProgram) {
+		if requestedProgram.Equals(solana.SystemProgramID) {
+			if !IsAdvanceNonce(op.Data) {
+				return errors.New("refusing to sign system program instruction other than advance nonce")
+			}
+			continue
+		}
+		if requestedProgram.Equals(ComputeBudgetProgramID) {
+			if len(op.Data) == 0 || (op.Data[0] != ComputeBudgetSetUnitLimit && op.Data[0] != ComputeBudgetSetUnitPrice) {
+				return errors.New("refusing to sign compute budget instruction other than setting unit limit or price")
+			}
+			continue
+		}
+		if !requestedProgram.Equals(s.pythProgram) && !requestedProgram.Equals(solana.MemoProgramID) {
 			return fmt.Errorf("refusing to sign for program %s", requestedProgram.String())
 		}
 		// TODO(richard): Restrict to price updates.
@@ -0,0 +1,33 @@
+// Package signertest provides publisher signers for tests.
+package signertest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/pythian/signer"
+)
+
+// New returns a signer with a random key, loaded from a key file in a temporary directory.
+// The signer is closed when the test finishes.
+func New(t testing.TB, pythProgram solana.PublicKey) *signer.Signer {
+	key, err := solana.NewRandomPrivateKey()
+	require.NoError(t, err)
+	keyInts := make([]int, len(key))
+	for i, b := range key {
+		keyInts[i] = int(b)
+	}
+	keyJSON, err := json.Marshal(keyInts)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "publisher.json")
+	require.NoError(t, os.WriteFile(keyPath, keyJSON, 0600))
+
+	s, err := signer.NewSigner(keyPath, pythProgram)
+	require.NoError(t, err)
+	t.Cleanup(s.Close)
+	return s
+}
@@ -0,0 +1,39 @@
+package stats
+
+import (
+	"math"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// HistogramQuantile estimates the q-quantile (0 <= q <= 1) of a Prometheus histogram
+// by linear interpolation within buckets, like PromQL's histogram_quantile.
+//
+// Returns false if the histogram is empty.
+func HistogramQuantile(h prometheus.Histogram, q float64) (float64, bool) {
+	var m dto.Metric
+	if err := h.Write(&m); err != nil || m.Histogram == nil {
+		return 0, false
+	}
+	total := m.Histogram.GetSampleCount()
+	if total == 0 {
+		return 0, false
+	}
+	rank := q * float64(total)
+
+	var prevBound float64
+	var prevCount uint64
+	for _, b := range m.Histogram.Bucket {
+		bound, count := b.GetUpperBound(), b.GetCumulativeCount()
+		if float64(count) >= rank {
+			if math.IsInf(bound, +1) || count == prevCount {
+				return prevBound, true
+			}
+			return prevBound + (bound-prevBound)*(rank-float64(prevCount))/float64(count-prevCount), true
+		}
+		prevBound, prevCount = bound, count
+	}
+	// Falls into the implicit +Inf bucket.
+	return prevBound, true
+}
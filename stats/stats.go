@@ -0,0 +1,210 @@
+// Package stats keeps rolling-window counters of publishing activity.
+//
+// Unlike Prometheus counters, which only ever increase, these answer
+// questions like "how many updates were dropped in the last 5 minutes"
+// without an external time series database.
+package stats
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Counter names.
+const (
+	UpdatesAccepted  = "updates_accepted"  // accepted into the write buffer
+	UpdatesRejected  = "updates_rejected"  // rejected before buffering
+	UpdatesPublished = "updates_published" // included in a sent transaction
+	UpdatesConfirmed = "updates_confirmed" // included in a landed transaction
+	UpdatesDropped   = "updates_dropped"   // never sent, see DroppedBy
+	TxsSent          = "txs_sent"          // transactions submitted
+	TxsFailed        = "txs_failed"        // failed to submit or landed with error
+	TxsConfirmed     = "txs_confirmed"     // landed successfully
+	TxsExpired       = "txs_expired"       // not confirmed in time
+	RPCErrors        = "rpc_errors"        // failed Solana RPC requests
+)
+
+// DroppedBy returns the counter name for updates dropped for the given reason.
+func DroppedBy(reason string) string {
+	return UpdatesDropped + "_" + reason
+}
+
+// DefaultWindows are the rolling windows tracked if none are configured.
+var DefaultWindows = []time.Duration{5 * time.Minute, time.Hour}
+
+// bucketsPerWindow is the resolution of each window.
+// Memory usage per window is bounded by this times the number of counter names.
+const bucketsPerWindow = 60
+
+// Recorder counts events over multiple rolling windows.
+//
+// All methods are safe to call on a nil Recorder, which discards events.
+type Recorder struct {
+	windows []*window
+	start   time.Time
+	now     func() time.Time
+}
+
+// NewRecorder creates a recorder tracking the given window lengths.
+func NewRecorder(windows ...time.Duration) *Recorder {
+	if len(windows) == 0 {
+		windows = DefaultWindows
+	}
+	r := &Recorder{
+		start: time.Now(),
+		now:   time.Now,
+	}
+	for _, length := range windows {
+		r.windows = append(r.windows, newWindow(length))
+	}
+	sort.Slice(r.windows, func(i, j int) bool {
+		return r.windows[i].length < r.windows[j].length
+	})
+	return r
+}
+
+// Add increments a counter.
+func (r *Recorder) Add(counter string, n uint64) {
+	if r == nil || n == 0 {
+		return
+	}
+	elapsed := r.elapsed()
+	for _, w := range r.windows {
+		w.add(elapsed, counter, n)
+	}
+}
+
+// Inc increments a counter by one.
+func (r *Recorder) Inc(counter string) {
+	r.Add(counter, 1)
+}
+
+// Snapshot returns the counts of all windows, shortest first.
+func (r *Recorder) Snapshot() []WindowStats {
+	if r == nil {
+		return nil
+	}
+	elapsed := r.elapsed()
+	snapshot := make([]WindowStats, len(r.windows))
+	for i, w := range r.windows {
+		snapshot[i] = WindowStats{
+			Window: w.length,
+			Counts: w.sum(elapsed),
+		}
+	}
+	return snapshot
+}
+
+// elapsed returns the time since the recorder was created.
+//
+// Time is measured using the monotonic clock, so wall clock jumps do not affect windows.
+func (r *Recorder) elapsed() time.Duration {
+	return r.now().Sub(r.start)
+}
+
+// WindowStats are the counts of a single window.
+type WindowStats struct {
+	Window time.Duration
+	Counts map[string]uint64
+}
+
+// ratio returns num/denom, false if denom is zero.
+func ratio(num, denom uint64) (float64, bool) {
+	if denom == 0 {
+		return 0, false
+	}
+	return float64(num) / float64(denom), true
+}
+
+// PublishRate is the share of accepted updates that were sent.
+func (w WindowStats) PublishRate() (float64, bool) {
+	return ratio(w.Counts[UpdatesPublished], w.Counts[UpdatesAccepted])
+}
+
+// ConfirmRate is the share of resolved transactions that landed successfully.
+func (w WindowStats) ConfirmRate() (float64, bool) {
+	confirmed := w.Counts[TxsConfirmed]
+	return ratio(confirmed, confirmed+w.Counts[TxsFailed]+w.Counts[TxsExpired])
+}
+
+// TxFailureRate is the share of sent transactions that failed.
+func (w WindowStats) TxFailureRate() (float64, bool) {
+	return ratio(w.Counts[TxsFailed], w.Counts[TxsSent])
+}
+
+// window is a ring buffer of counter buckets.
+type window struct {
+	length     time.Duration
+	resolution time.Duration
+
+	lock      sync.Mutex
+	buckets   []bucket
+	lastEpoch int64
+}
+
+type bucket struct {
+	epoch  int64
+	counts map[string]uint64
+}
+
+func newWindow(length time.Duration) *window {
+	resolution := length / bucketsPerWindow
+	if resolution < time.Second {
+		resolution = time.Second
+	}
+	n := int((length + resolution - 1) / resolution)
+	if n < 1 {
+		n = 1
+	}
+	buckets := make([]bucket, n)
+	for i := range buckets {
+		buckets[i].epoch = -1
+	}
+	return &window{
+		length:     length,
+		resolution: resolution,
+		buckets:    buckets,
+	}
+}
+
+// epoch returns the bucket index for the given time. Must hold lock.
+//
+// Never goes backwards, so a misbehaving clock cannot resurrect expired buckets.
+func (w *window) epoch(elapsed time.Duration) int64 {
+	epoch := int64(elapsed / w.resolution)
+	if epoch < w.lastEpoch {
+		epoch = w.lastEpoch
+	}
+	w.lastEpoch = epoch
+	return epoch
+}
+
+func (w *window) add(elapsed time.Duration, counter string, n uint64) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	epoch := w.epoch(elapsed)
+	b := &w.buckets[epoch%int64(len(w.buckets))]
+	if b.epoch != epoch {
+		b.epoch = epoch
+		b.counts = make(map[string]uint64)
+	}
+	b.counts[counter] += n
+}
+
+func (w *window) sum(elapsed time.Duration) map[string]uint64 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	epoch := w.epoch(elapsed)
+	oldest := epoch - int64(len(w.buckets)) + 1
+	counts := make(map[string]uint64)
+	for _, b := range w.buckets {
+		if b.epoch < oldest || b.epoch > epoch {
+			continue
+		}
+		for counter, n := range b.counts {
+			counts[counter] += n
+		}
+	}
+	return counts
+}
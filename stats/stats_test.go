@@ -0,0 +1,112 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRecorder(windows ...time.Duration) (*Recorder, *time.Time) {
+	r := NewRecorder(windows...)
+	now := r.start
+	r.now = func() time.Time { return now }
+	return r, &now
+}
+
+func TestRecorder_Rolling(t *testing.T) {
+	r, now := newTestRecorder(time.Hour, time.Minute)
+
+	r.Inc(TxsSent)
+	r.Add(UpdatesPublished, 10)
+	*now = now.Add(30 * time.Second)
+	r.Inc(TxsSent)
+
+	snapshot := r.Snapshot()
+	require.Len(t, snapshot, 2)
+	assert.Equal(t, time.Minute, snapshot[0].Window, "windows not sorted")
+	assert.Equal(t, uint64(2), snapshot[0].Counts[TxsSent])
+	assert.Equal(t, uint64(10), snapshot[0].Counts[UpdatesPublished])
+
+	// First events expire from the short window only.
+	*now = now.Add(45 * time.Second)
+	snapshot = r.Snapshot()
+	assert.Equal(t, uint64(1), snapshot[0].Counts[TxsSent])
+	assert.Zero(t, snapshot[0].Counts[UpdatesPublished])
+	assert.Equal(t, uint64(2), snapshot[1].Counts[TxsSent])
+
+	// Long idle period empties all windows.
+	*now = now.Add(48 * time.Hour)
+	for _, window := range r.Snapshot() {
+		assert.Empty(t, window.Counts)
+	}
+}
+
+func TestRecorder_ClockBackwards(t *testing.T) {
+	r, now := newTestRecorder(time.Minute)
+	*now = now.Add(10 * time.Minute)
+	r.Inc(TxsSent)
+
+	// Going back in time must not revive or misplace buckets.
+	*now = now.Add(-5 * time.Minute)
+	r.Inc(TxsSent)
+	assert.Equal(t, uint64(2), r.Snapshot()[0].Counts[TxsSent])
+
+	*now = now.Add(5*time.Minute + time.Minute)
+	assert.Empty(t, r.Snapshot()[0].Counts)
+}
+
+func TestRecorder_Nil(t *testing.T) {
+	var r *Recorder
+	r.Inc(TxsSent)
+	assert.Nil(t, r.Snapshot())
+}
+
+func TestWindowStats_Rates(t *testing.T) {
+	w := WindowStats{Counts: map[string]uint64{
+		UpdatesAccepted:  10,
+		UpdatesPublished: 8,
+		TxsSent:          4,
+		TxsConfirmed:     3,
+		TxsFailed:        1,
+	}}
+	rate, ok := w.PublishRate()
+	assert.True(t, ok)
+	assert.InDelta(t, 0.8, rate, 1e-9)
+	rate, ok = w.ConfirmRate()
+	assert.True(t, ok)
+	assert.InDelta(t, 0.75, rate, 1e-9)
+	rate, ok = w.TxFailureRate()
+	assert.True(t, ok)
+	assert.InDelta(t, 0.25, rate, 1e-9)
+
+	_, ok = WindowStats{}.ConfirmRate()
+	assert.False(t, ok)
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "test",
+		Buckets: []float64{1, 2, 4},
+	})
+	_, ok := HistogramQuantile(h, 0.5)
+	assert.False(t, ok)
+
+	for i := 0; i < 50; i++ {
+		h.Observe(0.5)
+	}
+	for i := 0; i < 50; i++ {
+		h.Observe(3)
+	}
+	p50, ok := HistogramQuantile(h, 0.5)
+	assert.True(t, ok)
+	assert.InDelta(t, 1, p50, 1e-9)
+	p95, _ := HistogramQuantile(h, 0.95)
+	assert.InDelta(t, 3.8, p95, 1e-9)
+
+	h.Observe(100)
+	p100, _ := HistogramQuantile(h, 1)
+	assert.InDelta(t, 4, p100, 1e-9)
+}